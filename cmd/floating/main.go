@@ -0,0 +1,132 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/font-go/font"
+	"github.com/google/font-go/raster/floating"
+	"golang.org/x/image/math/f32"
+)
+
+var (
+	dumpFlag    = flag.Bool("dump", false, "print the vector data instead of rasterizing to out.png")
+	faceFlag    = flag.Int("face", 0, "font index within a font collection, such as a .ttc file")
+	fontFlag    = flag.String("font", path.Join(os.Getenv("HOME"), "fonts/Roboto-Regular.ttf"), "font filename")
+	glyphIDFlag = flag.Int("glyphid", 76, "glyph ID; for example 76 is 'g' from Roboto-Regular")
+	ppemFlag    = flag.Float64("ppem", 42, "pixels per em")
+	runeFlag    = flag.String("rune", "", "if non-empty, render the glyph for the first rune of this string instead of -glyphid")
+	varFlag     = flag.String("var", "", "variable font axis values, such as \"wght=700,wdth=75\"")
+)
+
+func main() {
+	flag.Parse()
+	b, err := ioutil.ReadFile(*fontFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c, err := font.ParseCollection(b)
+	if err != nil {
+		log.Fatal(err)
+	}
+	f, err := c.Font(*faceFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *varFlag != "" {
+		coords, err := parseVariation(*varFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		f.SetVariation(coords)
+	}
+
+	glyphID := font.GlyphID(*glyphIDFlag)
+	if *runeFlag != "" {
+		r, _ := utf8.DecodeRuneInString(*runeFlag)
+		glyphID = f.GlyphIndex(r)
+	}
+	g, err := f.Glyph(glyphID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// TODO: use the overall font's bbox from the head table, not the glyph's bbox.
+	dx, dy, transform := g.SizeAndTransform(f.Scale(float32(*ppemFlag)))
+	if *dumpFlag {
+		if err := f.Outline(dumper{}, g, transform); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	z := floating.NewRasterizer(dx, dy)
+	if err := f.Outline(z, g, transform); err != nil {
+		log.Fatal(err)
+	}
+	dst := image.NewAlpha(z.Bounds())
+	z.Accumulate(dst)
+
+	out, err := os.Create("out.png")
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = png.Encode(out, dst)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseVariation parses comma-separated axis values, such as "wght=700".
+func parseVariation(s string) (map[font.Tag]float32, error) {
+	coords := map[font.Tag]float32{}
+	for _, kv := range strings.Split(s, ",") {
+		i := strings.IndexByte(kv, '=')
+		if i != 4 {
+			return nil, fmt.Errorf("invalid axis value %q", kv)
+		}
+		v, err := strconv.ParseFloat(kv[i+1:], 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid axis value %q: %v", kv, err)
+		}
+		coords[font.MakeTag(kv[:i])] = float32(v)
+	}
+	return coords, nil
+}
+
+// dumper is a font.Pather that prints each segment, one per line, with a "---"
+// line before each contour.
+type dumper struct{}
+
+func (dumper) MoveTo(p f32.Vec2) {
+	fmt.Println("---")
+	fmt.Printf("moveTo\t%v\n", p)
+}
+
+func (dumper) LineTo(p f32.Vec2)    { fmt.Printf("lineTo\t%v\n", p) }
+func (dumper) QuadTo(p, q f32.Vec2) { fmt.Printf("quadTo\t%v\t%v\n", p, q) }
+func (dumper) CubeTo(p, q, r f32.Vec2) {
+	fmt.Printf("cubeTo\t%v\t%v\t%v\n", p, q, r)
+}
@@ -0,0 +1,649 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// DICT operators. Two byte operators, whose first byte is 12, are 1200 plus
+// their second byte.
+const (
+	cffOpCharset        = 15
+	cffOpCharStrings    = 17
+	cffOpPrivate        = 18
+	cffOpSubrs          = 19
+	cffOpVSIndex        = 22
+	cffOpBlend          = 23
+	cffOpVariationStore = 24
+	cffOpCharstringType = 1206
+	cffOpROS            = 1230
+	cffOpFDArray        = 1236
+	cffOpFDSelect       = 1237
+)
+
+// The maximum numbers of operands of a DICT operator, which are also the
+// maximum depths of the charstring argument stack.
+const (
+	cffMaxOperands  = 48
+	cff2MaxOperands = 513
+)
+
+var (
+	cffTag  = MakeTag("CFF ")
+	cff2Tag = MakeTag("CFF2")
+)
+
+// cff is a parsed CFF or CFF2 table, the PostScript outlines of an OpenType
+// font. In an OpenType font, the table holds exactly one font, whose glyph IDs
+// index its charstrings directly.
+//
+// The Top DICT's FontMatrix is assumed to be the default, so that the font
+// units are those of the head table's unitsPerEm.
+type cff struct {
+	// cff2 is whether this is a CFF2 table, whose charstrings have no advance
+	// widths or endchar operators, and may vary with the font's variation
+	// coordinates.
+	cff2        bool
+	charStrings cffIndex
+	globalSubrs cffIndex
+	// privates are the Private DICTs of each Font DICT. A CFF font that is
+	// not CID-keyed has one, from its Top DICT.
+	privates []cffPrivate
+	// fdSelect maps glyph IDs to their Font DICT. It is nil for fonts with a
+	// single Private DICT.
+	fdSelect []byte
+	// varStore holds the regions of a CFF2 table's blend operators.
+	varStore itemVariationStore
+	// charset maps glyph IDs to SIDs, for finding the glyphs of accented
+	// characters. It is nil for the predefined charsets, of which only the
+	// ISOAdobe one, whose glyph IDs are their SIDs, has the standard
+	// encoding's glyphs. isoAdobe is whether the charset is that one.
+	charset  []byte
+	isoAdobe bool
+}
+
+// cffPrivate is the part of a Private DICT that charstrings use.
+type cffPrivate struct {
+	subrs cffIndex
+	// vsindex selects the ItemVariationData subtable, of the variation
+	// store, whose regions the blend operator uses, unless a charstring
+	// selects another.
+	vsindex int
+}
+
+func (c *cff) tag() Tag {
+	if c.cff2 {
+		return cff2Tag
+	}
+	return cffTag
+}
+
+// cffParser parses the INDEXes and DICTs of a CFF or CFF2 table, b, whose
+// encodings differ slightly.
+type cffParser struct {
+	b    []byte
+	cff2 bool
+	// varStore is the CFF2 table's variation store, which determines the
+	// number of operands of a Private DICT's blend operators.
+	varStore itemVariationStore
+}
+
+func (p *cffParser) invalid(format string, args ...interface{}) error {
+	tag := cffTag
+	if p.cff2 {
+		tag = cff2Tag
+	}
+	return ErrInvalidTable{Tag: tag, Reason: fmt.Sprintf(format, args...)}
+}
+
+// parseCFF parses the CFF table b.
+func parseCFF(b []byte) (*cff, error) {
+	if len(b) < 4 {
+		return nil, ErrTableTooShort{Tag: cffTag, Length: len(b), MinLength: 4}
+	}
+	if major := b[0]; major != 1 {
+		return nil, ErrUnsupportedFormat{Tag: cffTag, Format: uint32(major)}
+	}
+	p := &cffParser{b: b}
+
+	// The header is followed by the Name, Top DICT, String and Global Subr
+	// INDEXes.
+	names, offset, err := p.index(int(b[2]))
+	if err != nil {
+		return nil, err
+	}
+	if names.count != 1 {
+		return nil, p.invalid("%d fonts, want 1", names.count)
+	}
+	topDicts, offset, err := p.index(offset)
+	if err != nil {
+		return nil, err
+	}
+	_, offset, err = p.index(offset)
+	if err != nil {
+		return nil, err
+	}
+	c := &cff{}
+	if c.globalSubrs, _, err = p.index(offset); err != nil {
+		return nil, err
+	}
+
+	topDict, ok := topDicts.get(0)
+	if !ok {
+		return nil, p.invalid("Top DICT is out of bounds")
+	}
+	top, err := p.dict(topDict)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := top.int(cffOpCharstringType, 0); ok && t != 2 {
+		return nil, ErrUnsupportedFormat{Tag: cffTag, Format: uint32(t)}
+	}
+	if err := p.charStrings(c, top); err != nil {
+		return nil, err
+	}
+
+	if _, ok := top[cffOpROS]; !ok {
+		private, err := p.private(top)
+		if err != nil {
+			return nil, err
+		}
+		c.privates = []cffPrivate{private}
+		// Offsets 0, 1 and 2 are the predefined ISOAdobe, Expert and
+		// ExpertSubset charsets.
+		switch charset, _ := top.int(cffOpCharset, 0); {
+		case charset == 0:
+			c.isoAdobe = true
+		case charset > 2:
+			if charset >= len(b) {
+				return nil, p.invalid("charset is out of bounds")
+			}
+			c.charset = b[charset:]
+		}
+		return c, nil
+	}
+	// A CID-keyed font has a Font DICT, with its own Private DICT, for each
+	// group of glyphs that FDSelect maps to it.
+	if err := p.fonts(c, top); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseCFF2 parses the CFF2 table b.
+func parseCFF2(b []byte) (*cff, error) {
+	if len(b) < 5 {
+		return nil, ErrTableTooShort{Tag: cff2Tag, Length: len(b), MinLength: 5}
+	}
+	if major := b[0]; major != 2 {
+		return nil, ErrUnsupportedFormat{Tag: cff2Tag, Format: uint32(major)}
+	}
+	p := &cffParser{b: b, cff2: true}
+
+	// The header, which has the length of the Top DICT, is followed by the
+	// Top DICT and the Global Subr INDEX.
+	start := int(b[2])
+	end := start + int(u16(b, 3))
+	if end > len(b) {
+		return nil, p.invalid("Top DICT is out of bounds")
+	}
+	top, err := p.dict(b[start:end])
+	if err != nil {
+		return nil, err
+	}
+	c := &cff{cff2: true}
+	if c.globalSubrs, _, err = p.index(end); err != nil {
+		return nil, err
+	}
+	if err := p.charStrings(c, top); err != nil {
+		return nil, err
+	}
+
+	// The variation store is preceded by its length.
+	if _, ok := top[cffOpVariationStore]; ok {
+		offset, ok := top.int(cffOpVariationStore, 0)
+		if !ok || offset+2 > len(b) || offset+2+int(u16(b, int32(offset))) > len(b) {
+			return nil, p.invalid("VariationStore is out of bounds")
+		}
+		c.varStore = itemVariationStore(b[offset+2 : offset+2+int(u16(b, int32(offset)))])
+		p.varStore = c.varStore
+	}
+
+	// Like a CID-keyed CFF font, a CFF2 font has Font DICTs.
+	if err := p.fonts(c, top); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// charStrings parses the CharStrings INDEX that the Top DICT refers to.
+func (p *cffParser) charStrings(c *cff, top cffDict) error {
+	offset, ok := top.int(cffOpCharStrings, 0)
+	if !ok {
+		return p.invalid("Top DICT has no CharStrings")
+	}
+	var err error
+	c.charStrings, _, err = p.index(offset)
+	return err
+}
+
+// fonts parses the Font DICTs and the FDSelect that the Top DICT refers to.
+func (p *cffParser) fonts(c *cff, top cffDict) error {
+	fdArrayOffset, ok := top.int(cffOpFDArray, 0)
+	if !ok {
+		return p.invalid("Top DICT has no FDArray")
+	}
+	fdArray, _, err := p.index(fdArrayOffset)
+	if err != nil {
+		return err
+	}
+	c.privates = make([]cffPrivate, fdArray.count)
+	for i := range c.privates {
+		fontDict, ok := fdArray.get(i)
+		if !ok {
+			return p.invalid("Font DICT %d is out of bounds", i)
+		}
+		fd, err := p.dict(fontDict)
+		if err != nil {
+			return err
+		}
+		if c.privates[i], err = p.private(fd); err != nil {
+			return err
+		}
+	}
+
+	fdSelectOffset, ok := top.int(cffOpFDSelect, 0)
+	if !ok && p.cff2 && fdArray.count == 1 {
+		// A CFF2 font with one Font DICT needs no FDSelect.
+		return nil
+	}
+	if !ok || fdSelectOffset >= len(p.b) {
+		return p.invalid("Top DICT has no FDSelect")
+	}
+	c.fdSelect = p.b[fdSelectOffset:]
+	var n int
+	switch format := c.fdSelect[0]; {
+	case format == 0:
+		n = 1 + c.charStrings.count
+	case format == 3:
+		// Format 3 has a header, the ranges and a sentinel glyph ID.
+		n = 3
+		if len(c.fdSelect) >= n {
+			n = 5 + 3*int(u16(c.fdSelect, 1))
+		}
+	case format == 4 && p.cff2:
+		// Format 4 is format 3 with 32-bit glyph IDs and 16-bit Font DICT
+		// indexes.
+		n = 5
+		if len(c.fdSelect) >= n {
+			n = 9 + 6*int(u32(c.fdSelect, 1))
+		}
+	default:
+		return ErrUnsupportedFormat{Tag: c.tag(), Format: uint32(format)}
+	}
+	if len(c.fdSelect) < n {
+		return p.invalid("FDSelect is truncated")
+	}
+	return nil
+}
+
+// private parses the Private DICT that the Top DICT or Font DICT d refers to.
+// A font need not have one.
+func (p *cffParser) private(d cffDict) (cffPrivate, error) {
+	if _, ok := d[cffOpPrivate]; !ok {
+		return cffPrivate{}, nil
+	}
+	length, ok0 := d.int(cffOpPrivate, 0)
+	offset, ok1 := d.int(cffOpPrivate, 1)
+	if !ok0 || !ok1 || offset+length > len(p.b) {
+		return cffPrivate{}, p.invalid("Private DICT is out of bounds")
+	}
+	pd, err := p.dict(p.b[offset : offset+length])
+	if err != nil {
+		return cffPrivate{}, err
+	}
+	var private cffPrivate
+	private.vsindex, _ = pd.int(cffOpVSIndex, 0)
+	if subrs, ok := pd.int(cffOpSubrs, 0); ok {
+		// The Subrs offset is relative to the start of the Private DICT.
+		if private.subrs, _, err = p.index(offset + subrs); err != nil {
+			return cffPrivate{}, err
+		}
+	}
+	return private, nil
+}
+
+// fd returns the index of the Font DICT of the glyph, or -1 if there is none.
+func (c *cff) fd(glyphID GlyphID) int {
+	if c.fdSelect == nil {
+		return 0
+	}
+	b := c.fdSelect
+	switch b[0] {
+	case 0:
+		return int(b[1+int(glyphID)])
+	case 3:
+		n := int(u16(b, 1))
+		// Each range is a first glyph ID and a Font DICT index, and ends at
+		// the next range's first glyph ID, or at the sentinel.
+		for i := 0; i < n; i++ {
+			r := int32(3 + 3*i)
+			if GlyphID(u16(b, r)) <= glyphID && glyphID < GlyphID(u16(b, r+3)) {
+				return int(b[r+2])
+			}
+		}
+	case 4:
+		n := int(u32(b, 1))
+		for i := 0; i < n; i++ {
+			r := int32(5 + 6*i)
+			if u32(b, r) <= uint32(glyphID) && uint32(glyphID) < u32(b, r+6) {
+				return int(u16(b, r+4))
+			}
+		}
+	}
+	return -1
+}
+
+// standardGlyph returns the glyph of the character with the code in the
+// standard encoding, as the base and accent glyphs of accented characters are.
+func (c *cff) standardGlyph(code float32) (GlyphID, bool) {
+	if !(0 <= code && code < 256) || code != float32(int(code)) {
+		return 0, false
+	}
+	sid := int(cffStandardEncoding[int(code)])
+	if sid == 0 {
+		return 0, false
+	}
+	n := c.charStrings.count
+	if c.isoAdobe {
+		return GlyphID(sid), sid < n
+	}
+	// The charset's SIDs start with glyph 1, as glyph 0 is .notdef.
+	b := otData(c.charset)
+	switch b.u8(0) {
+	case 0:
+		for g := 1; g < n && 2*g < len(b); g++ {
+			if int(b.u16(2*g-1)) == sid {
+				return GlyphID(g), true
+			}
+		}
+	case 1, 2:
+		// Each range is a first SID and the number of SIDs after it, as an
+		// 8-bit number in format 1 and a 16-bit number in format 2.
+		rangeLen := 2 + int(b.u8(0))
+		for g, i := 1, 1; g < n && i+rangeLen <= len(b); i += rangeLen {
+			first, nLeft := int(b.u16(i)), int(b.u8(i+2))
+			if rangeLen == 4 {
+				nLeft = int(b.u16(i + 2))
+			}
+			if first <= sid && sid <= first+nLeft && g+sid-first < n {
+				return GlyphID(g + sid - first), true
+			}
+			g += nLeft + 1
+		}
+	}
+	return 0, false
+}
+
+// cffStandardEncoding maps the codes of the standard encoding to their SIDs.
+var cffStandardEncoding = [256]uint8{
+	32: 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16,
+	17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32,
+	33, 34, 35, 36, 37, 38, 39, 40, 41, 42, 43, 44, 45, 46, 47, 48,
+	49, 50, 51, 52, 53, 54, 55, 56, 57, 58, 59, 60, 61, 62, 63, 64,
+	65, 66, 67, 68, 69, 70, 71, 72, 73, 74, 75, 76, 77, 78, 79, 80,
+	81, 82, 83, 84, 85, 86, 87, 88, 89, 90, 91, 92, 93, 94, 95,
+	161: 96, 97, 98, 99, 100, 101, 102, 103, 104, 105, 106, 107, 108, 109, 110,
+	177: 111, 112, 113, 114,
+	182: 115, 116, 117, 118, 119, 120, 121, 122,
+	191: 123,
+	193: 124, 125, 126, 127, 128, 129, 130, 131,
+	202: 132, 133,
+	205: 134, 135, 136, 137,
+	225: 138,
+	227: 139,
+	232: 140, 141, 142, 143,
+	241: 144,
+	245: 145,
+	248: 146, 147, 148, 149,
+}
+
+// cffIndex is a CFF INDEX, an array of variable length objects.
+type cffIndex struct {
+	count   int
+	offSize int
+	// offsets are the count+1 offsets of the objects, each offSize bytes.
+	// They are relative to the byte before data.
+	offsets []byte
+	data    []byte
+}
+
+// index parses the INDEX at b[offset:]. It returns the offset of the end of
+// the INDEX. A CFF2 INDEX's count is 32-bit, rather than 16-bit.
+func (p *cffParser) index(offset int) (cffIndex, int, error) {
+	b := p.b
+	countLen := 2
+	if p.cff2 {
+		countLen = 4
+	}
+	if offset < 0 || offset+countLen > len(b) {
+		return cffIndex{}, 0, p.invalid("INDEX at offset %d is out of bounds", offset)
+	}
+	var x cffIndex
+	if p.cff2 {
+		// Each object has at least one byte of offset, so a count larger
+		// than the table is invalid, and checking it keeps the arithmetic
+		// below from overflowing.
+		n := u32(b, int32(offset))
+		if n > uint32(len(b)) {
+			return cffIndex{}, 0, p.invalid("INDEX at offset %d is truncated", offset)
+		}
+		x.count = int(n)
+	} else {
+		x.count = int(u16(b, int32(offset)))
+	}
+	if x.count == 0 {
+		return x, offset + countLen, nil
+	}
+	if offset+countLen+1 > len(b) {
+		return cffIndex{}, 0, p.invalid("INDEX at offset %d is truncated", offset)
+	}
+	x.offSize = int(b[offset+countLen])
+	if x.offSize < 1 || 4 < x.offSize {
+		return cffIndex{}, 0, p.invalid("INDEX at offset %d has an invalid offset size %d", offset, x.offSize)
+	}
+	start := offset + countLen + 1 + (x.count+1)*x.offSize
+	if start > len(b) {
+		return cffIndex{}, 0, p.invalid("INDEX at offset %d is truncated", offset)
+	}
+	x.offsets = b[offset+countLen+1 : start]
+	end := x.offset(x.count)
+	if end < 1 || end-1 > len(b)-start {
+		return cffIndex{}, 0, p.invalid("INDEX at offset %d is truncated", offset)
+	}
+	x.data = b[start : start+end-1]
+	return x, start + end - 1, nil
+}
+
+func (x cffIndex) offset(i int) int {
+	v := 0
+	for _, c := range x.offsets[i*x.offSize : (i+1)*x.offSize] {
+		v = v<<8 | int(c)
+	}
+	return v
+}
+
+// get returns the i'th object. It returns false if i is out of range or the
+// object's offsets are invalid.
+func (x cffIndex) get(i int) ([]byte, bool) {
+	if i < 0 || x.count <= i {
+		return nil, false
+	}
+	lo, hi := x.offset(i), x.offset(i+1)
+	if lo < 1 || hi < lo || hi-1 > len(x.data) {
+		return nil, false
+	}
+	return x.data[lo-1 : hi-1], true
+}
+
+// cffDict is a parsed DICT, mapping operators to their operands.
+type cffDict map[int][]float64
+
+// int returns the i'th operand of the operator as an integer. It returns
+// false if there is no such operand, or if it is not a non-negative integer.
+func (d cffDict) int(op, i int) (int, bool) {
+	operands := d[op]
+	if i >= len(operands) {
+		return 0, false
+	}
+	v := operands[i]
+	if v < 0 || v > math.MaxInt32 || v != math.Trunc(v) {
+		return 0, false
+	}
+	return int(v), true
+}
+
+// dict parses a DICT, a sequence of operands followed by their operator.
+//
+// A CFF2 DICT's blend operators leave their operands' default values, as the
+// values that this package reads do not vary.
+func (p *cffParser) dict(b []byte) (cffDict, error) {
+	maxOperands := cffMaxOperands
+	if p.cff2 {
+		maxOperands = cff2MaxOperands
+	}
+	d := cffDict{}
+	var operands []float64
+	for i := 0; i < len(b); {
+		b0 := b[i]
+		var v float64
+		switch {
+		case b0 <= 21 || p.cff2 && b0 <= cffOpVariationStore:
+			op := int(b0)
+			i++
+			if b0 == 12 {
+				if i >= len(b) {
+					return nil, p.invalid("DICT is truncated")
+				}
+				op = 1200 + int(b[i])
+				i++
+			}
+			if op == cffOpBlend {
+				// The blend's operands are n default values, their deltas
+				// for each region and n.
+				vsindex, _ := d.int(cffOpVSIndex, 0)
+				scalars, ok := p.varStore.regionScalars(nil, vsindex, nil)
+				if !ok || len(operands) == 0 {
+					return nil, p.invalid("DICT has an invalid blend")
+				}
+				// n is checked before it is converted or multiplied, so
+				// that huge values cannot overflow.
+				nf := operands[len(operands)-1]
+				if nf != math.Trunc(nf) || nf < 0 || nf > float64((len(operands)-1)/(len(scalars)+1)) {
+					return nil, p.invalid("DICT has an invalid blend")
+				}
+				n := int(nf)
+				base := len(operands) - 1 - n*(len(scalars)+1)
+				operands = operands[:base+n]
+				continue
+			}
+			d[op] = operands
+			operands = nil
+			continue
+		case b0 == 28:
+			if i+3 > len(b) {
+				return nil, p.invalid("DICT is truncated")
+			}
+			v = float64(i16(b, int32(i+1)))
+			i += 3
+		case b0 == 29:
+			if i+5 > len(b) {
+				return nil, p.invalid("DICT is truncated")
+			}
+			v = float64(int32(u32(b, int32(i+1))))
+			i += 5
+		case b0 == 30:
+			n, ok := parseCFFReal(b[i+1:])
+			if !ok {
+				return nil, p.invalid("DICT has an invalid real number")
+			}
+			v = n.value
+			i += 1 + n.length
+		case 32 <= b0 && b0 <= 246:
+			v = float64(int(b0) - 139)
+			i++
+		case 247 <= b0 && b0 <= 254:
+			if i+2 > len(b) {
+				return nil, p.invalid("DICT is truncated")
+			}
+			if b0 <= 250 {
+				v = float64((int(b0)-247)*256 + int(b[i+1]) + 108)
+			} else {
+				v = float64(-(int(b0)-251)*256 - int(b[i+1]) - 108)
+			}
+			i += 2
+		default:
+			return nil, p.invalid("DICT has a reserved byte %d", b0)
+		}
+		if len(operands) == maxOperands {
+			return nil, p.invalid("DICT has too many operands")
+		}
+		operands = append(operands, v)
+	}
+	if len(operands) != 0 {
+		return nil, p.invalid("DICT ends with operands but no operator")
+	}
+	return d, nil
+}
+
+// cffReal is a real number DICT operand, and the length of its encoding.
+type cffReal struct {
+	value  float64
+	length int
+}
+
+// parseCFFReal parses the nibbles of a real number DICT operand. It returns
+// false if they are invalid or truncated.
+func parseCFFReal(b []byte) (cffReal, bool) {
+	var s []byte
+	for i, c := range b {
+		for _, nibble := range [2]byte{c >> 4, c & 0x0f} {
+			switch {
+			case nibble <= 9:
+				s = append(s, '0'+nibble)
+			case nibble == 0x0a:
+				s = append(s, '.')
+			case nibble == 0x0b:
+				s = append(s, 'E')
+			case nibble == 0x0c:
+				s = append(s, 'E', '-')
+			case nibble == 0x0e:
+				s = append(s, '-')
+			case nibble == 0x0f:
+				v, err := strconv.ParseFloat(string(s), 64)
+				if err != nil {
+					return cffReal{}, false
+				}
+				return cffReal{value: v, length: i + 1}, true
+			default:
+				return cffReal{}, false
+			}
+		}
+	}
+	return cffReal{}, false
+}
@@ -0,0 +1,876 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// t2 is a charstring operator, for buildCharstring.
+type t2 int
+
+// buildCharstring returns a Type 2 charstring. Each int or float64 argument
+// is an operand, each t2 argument is an operator, and each []byte argument,
+// such as a hintmask's mask, is copied as is.
+func buildCharstring(args ...interface{}) []byte {
+	var b []byte
+	for _, a := range args {
+		switch a := a.(type) {
+		case int:
+			switch {
+			case -107 <= a && a <= 107:
+				b = append(b, byte(a+139))
+			case 108 <= a && a <= 1131:
+				b = append(b, byte((a-108)>>8+247), byte(a-108))
+			case -1131 <= a && a <= -108:
+				b = append(b, byte((-a-108)>>8+251), byte(-a-108))
+			default:
+				b = append(b, t2Shortint, byte(a>>8), byte(a))
+			}
+		case float64:
+			b = append(b, 255)
+			b = append(b, be32(int(a*(1<<16)))...)
+		case t2:
+			if a >= 1200 {
+				b = append(b, 12, byte(a-1200))
+			} else {
+				b = append(b, byte(a))
+			}
+		case []byte:
+			b = append(b, a...)
+		default:
+			panic("buildCharstring: bad argument")
+		}
+	}
+	return b
+}
+
+// buildCFFIndex returns an INDEX of the given objects.
+func buildCFFIndex(objects ...[]byte) []byte {
+	if len(objects) == 0 {
+		return be16(0)
+	}
+	b := cat(be16(len(objects)), []byte{4}, be32(1))
+	var data []byte
+	for _, o := range objects {
+		data = append(data, o...)
+		b = append(b, be32(1+len(data))...)
+	}
+	return append(b, data...)
+}
+
+// cffInt returns a DICT operand, in its five byte encoding, so that the length
+// of a DICT does not depend on its offsets.
+func cffInt(v int) []byte { return cat([]byte{29}, be32(v)) }
+
+// testCFF is the content of a CFF table, for buildCFF.
+type testCFF struct {
+	charStrings [][]byte
+	globalSubrs [][]byte
+	// localSubrs are the local subroutines of each Font DICT. A font that is
+	// not CID-keyed has one, its Top DICT.
+	localSubrs [][][]byte
+	// fdSelect is the FDSelect of a CID-keyed font, or nil.
+	fdSelect []byte
+	// charset is the charset of a font that is not CID-keyed, or nil for
+	// the ISOAdobe charset.
+	charset []byte
+}
+
+// buildCFF returns a CFF table.
+func buildCFF(c testCFF) []byte {
+	if len(c.localSubrs) == 0 {
+		c.localSubrs = [][][]byte{nil}
+	}
+	// Each Private DICT is just its Subrs offset, and is immediately followed
+	// by its Subrs INDEX.
+	const privateLen = 6
+	var privates [][]byte
+	for _, subrs := range c.localSubrs {
+		privates = append(privates, cat(cffInt(privateLen), []byte{cffOpSubrs}, buildCFFIndex(subrs...)))
+	}
+
+	topDict := func(charStrings, fdSelect, fdArray, private int) []byte {
+		d := cat(cffInt(charStrings), []byte{cffOpCharStrings})
+		if c.charset != nil {
+			// The charset is where the FDSelect of a CID-keyed font is.
+			d = cat(d, cffInt(fdSelect), []byte{cffOpCharset})
+		}
+		if c.fdSelect == nil {
+			return cat(d, cffInt(privateLen), cffInt(private), []byte{cffOpPrivate})
+		}
+		return cat(d,
+			cffInt(0), cffInt(0), cffInt(0), []byte{12, cffOpROS - 1200},
+			cffInt(fdSelect), []byte{12, cffOpFDSelect - 1200},
+			cffInt(fdArray), []byte{12, cffOpFDArray - 1200})
+	}
+	fontDicts := func(private int) []byte {
+		var dicts [][]byte
+		for _, p := range privates {
+			dicts = append(dicts, cat(cffInt(privateLen), cffInt(private), []byte{cffOpPrivate}))
+			private += len(p)
+		}
+		return buildCFFIndex(dicts...)
+	}
+
+	// The offsets are computed from the lengths of everything before them.
+	head := cat([]byte{1, 0, 4, 4}, buildCFFIndex([]byte("test")))
+	charStrings := len(head) + len(buildCFFIndex(topDict(0, 0, 0, 0))) + len(be16(0)) +
+		len(buildCFFIndex(c.globalSubrs...))
+	fdSelect := charStrings + len(buildCFFIndex(c.charStrings...))
+	fdArray := fdSelect + len(c.fdSelect) + len(c.charset)
+	private := fdArray
+	if c.fdSelect != nil {
+		private += len(fontDicts(0))
+	}
+
+	b := cat(head, buildCFFIndex(topDict(charStrings, fdSelect, fdArray, private)), be16(0),
+		buildCFFIndex(c.globalSubrs...), buildCFFIndex(c.charStrings...), c.fdSelect, c.charset)
+	if c.fdSelect != nil {
+		b = append(b, fontDicts(private)...)
+	}
+	return cat(b, cat(privates...))
+}
+
+// testCFFTables returns the tables of a CFF based font, with one glyph per
+// charstring.
+func testCFFTables(c testCFF) map[string][]byte {
+	m := buildTables(make([][]byte, len(c.charStrings)), []int{500}, map[rune]GlyphID{'a': 1})
+	delete(m, "glyf")
+	delete(m, "loca")
+	m["CFF "] = buildCFF(c)
+	return m
+}
+
+// buildCFFFont returns an OpenType font file with the given tables.
+func buildCFFFont(tables map[string][]byte) []byte {
+	b := buildFont(tables)
+	copy(b, "OTTO")
+	return b
+}
+
+func testCFFFont(t *testing.T, c testCFF) *Font {
+	t.Helper()
+	f, err := Parse(buildCFFFont(testCFFTables(c)))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return f
+}
+
+// outline returns the recorded outline of a glyph.
+func outline(f *Font, glyphID GlyphID) (string, error) {
+	g, err := f.Glyph(glyphID)
+	if err != nil {
+		return "", err
+	}
+	var r recorder
+	if err := f.Outline(&r, g, identity); err != nil {
+		return "", err
+	}
+	return strings.Join(r, ", "), nil
+}
+
+func TestCFFOutline(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		charString []byte
+		want       string
+	}{{
+		desc:       "empty",
+		charString: buildCharstring(t2(t2Endchar)),
+	}, {
+		desc:       "width only",
+		charString: buildCharstring(500, t2(t2Endchar)),
+	}, {
+		desc: "square",
+		charString: buildCharstring(500, 100, 0, t2(t2Rmoveto), 400, t2(t2Vlineto), 400, -400, t2(t2Hlineto),
+			t2(t2Endchar)),
+		want: "M 100 0, L 100 400, L 500 400, L 500 0, L 100 0",
+	}, {
+		desc: "number encodings",
+		charString: buildCharstring(1.5, -2000, t2(t2Rmoveto), 150, 1000, t2(t2Rlineto), -1000, t2(t2Hlineto),
+			t2(t2Endchar)),
+		want: "M 1.5 -2000, L 151.5 -1000, L -848.5 -1000, L 1.5 -2000",
+	}, {
+		desc: "contours",
+		charString: buildCharstring(10, t2(t2Hmoveto), 10, 10, 10, t2(t2Hlineto), 20, t2(t2Vmoveto), -10,
+			t2(t2Vlineto), t2(t2Endchar)),
+		want: "M 10 0, L 20 0, L 20 10, L 30 10, L 10 0, M 30 30, L 30 20, L 30 30",
+	}, {
+		desc:       "rrcurveto",
+		charString: buildCharstring(0, 0, t2(t2Rmoveto), 100, 200, 100, 0, 100, -200, t2(t2Rrcurveto), t2(t2Endchar)),
+		want:       "M 0 0, C 100 200 200 200 300 0, L 0 0",
+	}, {
+		desc:       "hhcurveto",
+		charString: buildCharstring(0, 0, t2(t2Rmoveto), 20, 10, 10, 10, 10, t2(t2Hhcurveto), t2(t2Endchar)),
+		want:       "M 0 0, C 10 20 20 30 30 30, L 0 0",
+	}, {
+		desc:       "vvcurveto",
+		charString: buildCharstring(0, 0, t2(t2Rmoveto), 20, 10, 10, 10, 10, t2(t2Vvcurveto), t2(t2Endchar)),
+		want:       "M 0 0, C 20 10 30 20 30 30, L 0 0",
+	}, {
+		desc: "hvcurveto",
+		charString: buildCharstring(0, 0, t2(t2Rmoveto), 20, 10, 10, 20, 20, -10, 10, -20, 0, t2(t2Hvcurveto),
+			t2(t2Endchar)),
+		want: "M 0 0, C 20 0 30 10 30 30, C 30 50 20 60 0 60, L 0 0",
+	}, {
+		desc:       "vhcurveto",
+		charString: buildCharstring(0, 0, t2(t2Rmoveto), 20, 10, 10, 20, t2(t2Vhcurveto), t2(t2Endchar)),
+		want:       "M 0 0, C 0 20 10 30 30 30, L 0 0",
+	}, {
+		desc: "rcurveline",
+		charString: buildCharstring(0, 0, t2(t2Rmoveto), 10, 20, 10, 10, 10, 0, 0, -30, t2(t2Rcurveline),
+			t2(t2Endchar)),
+		want: "M 0 0, C 10 20 20 30 30 30, L 30 0, L 0 0",
+	}, {
+		desc: "rlinecurve",
+		charString: buildCharstring(0, 0, t2(t2Rmoveto), 0, 30, 10, 20, 10, 10, 10, 0, t2(t2Rlinecurve),
+			t2(t2Endchar)),
+		want: "M 0 0, L 0 30, C 10 50 20 60 30 60, L 0 0",
+	}, {
+		desc: "flex",
+		charString: buildCharstring(0, 0, t2(t2Rmoveto), 10, 20, 10, 10, 10, 0, 10, 0, 10, -10, 10, -20, 50,
+			t2(t2Flex), t2(t2Endchar)),
+		want: "M 0 0, C 10 20 20 30 30 30, C 40 30 50 20 60 0, L 0 0",
+	}, {
+		desc: "flex1",
+		charString: buildCharstring(0, 0, t2(t2Rmoveto), 10, 20, 10, 10, 10, 0, 10, 0, 10, -10, 10,
+			t2(t2Flex1), t2(t2Endchar)),
+		want: "M 0 0, C 10 20 20 30 30 30, C 40 30 50 20 60 0, L 0 0",
+	}, {
+		desc: "hflex1",
+		charString: buildCharstring(0, 0, t2(t2Rmoveto), 10, 20, 10, 10, 10, 10, 10, -10, 10,
+			t2(t2Hflex1), t2(t2Endchar)),
+		want: "M 0 0, C 10 20 20 30 30 30, C 40 30 50 20 60 0, L 0 0",
+	}, {
+		desc: "hflex",
+		charString: buildCharstring(0, 0, t2(t2Rmoveto), 10, 10, 5, 10, 10, 10, 10,
+			t2(t2Hflex), t2(t2Endchar)),
+		want: "M 0 0, C 10 0 20 5 30 5, C 40 5 50 0 60 0, L 0 0",
+	}, {
+		desc: "vertical flex1",
+		charString: buildCharstring(0, 0, t2(t2Rmoveto), 20, 10, 10, 10, 0, 10, 0, 10, -10, 10, 10,
+			t2(t2Flex1), t2(t2Endchar)),
+		want: "M 0 0, C 20 10 30 20 30 30, C 30 40 20 50 0 60, L 0 0",
+	}, {
+		// The mask byte would be an endchar operator if it were not skipped.
+		desc: "hints",
+		charString: buildCharstring(500, 0, 100, t2(t2Hstemhm), 50, 20, t2(t2Hintmask), []byte{t2Endchar},
+			10, 10, t2(t2Rmoveto), 10, 0, t2(t2Rlineto), t2(t2Cntrmask), []byte{t2Endchar}, t2(t2Endchar)),
+		want: "M 10 10, L 20 10, L 10 10",
+	}, {
+		desc: "subroutines",
+		charString: buildCharstring(100, 0, t2(t2Rmoveto), -107, t2(t2Callsubr), -107, t2(t2Callgsubr),
+			t2(t2Endchar)),
+		want: "M 100 0, L 100 400, L 500 400, L 100 0",
+	}, {
+		desc:       "operands left by a subroutine",
+		charString: buildCharstring(-106, t2(t2Callsubr), t2(t2Rmoveto), t2(t2Endchar)),
+		want:       "M 0 0",
+	}, {
+		desc:       "endchar in a subroutine",
+		charString: buildCharstring(100, 0, t2(t2Rmoveto), -105, t2(t2Callsubr), 0, 100, t2(t2Rlineto)),
+		want:       "M 100 0, L 110 0, L 100 0",
+	}}
+
+	c := testCFF{
+		globalSubrs: [][]byte{buildCharstring(400, 0, t2(t2Rlineto), t2(t2Return))},
+		localSubrs: [][][]byte{{
+			buildCharstring(0, 400, t2(t2Rlineto), t2(t2Return)),
+			buildCharstring(0, 0, t2(t2Return)),
+			buildCharstring(10, 0, t2(t2Rlineto), t2(t2Endchar)),
+		}},
+	}
+	for _, tc := range testCases {
+		c.charStrings = append(c.charStrings, tc.charString)
+	}
+	f := testCFFFont(t, c)
+	for i, tc := range testCases {
+		got, err := outline(f, GlyphID(i))
+		if err != nil {
+			t.Errorf("%s: %v", tc.desc, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestCFFGlyph(t *testing.T) {
+	f := testCFFFont(t, testCFF{charStrings: [][]byte{
+		buildCharstring(t2(t2Endchar)),
+		buildCharstring(0, 0, t2(t2Rmoveto), 100, 200, 100, 0, 100, -200, t2(t2Rrcurveto), t2(t2Endchar)),
+	}})
+	if g, err := f.Glyph(0); g != nil || err != nil {
+		t.Errorf("Glyph(0): got %v, %v, want nil, nil", g, err)
+	}
+	g, err := f.Glyph(1)
+	if err != nil {
+		t.Fatalf("Glyph(1): %v", err)
+	}
+	// The bounding box includes the control points.
+	xMin, yMin, xMax, yMax := g.bounds()
+	if got, want := [4]int{xMin, yMin, xMax, yMax}, [4]int{0, 0, 300, 200}; got != want {
+		t.Errorf("bounds: got %v, want %v", got, want)
+	}
+	if _, err := f.Glyph(2); !errors.Is(err, ErrInvalidFont) {
+		t.Errorf("Glyph(2): got %v, want an ErrInvalidFont", err)
+	}
+	var r recorder
+	if err := f.Outline(&r, g[:cffGlyphLen-1], identity); !errors.Is(err, ErrInvalidFont) {
+		t.Errorf("Outline of a truncated glyph: got %v, want an ErrInvalidFont", err)
+	}
+}
+
+func TestCFFCIDKeyed(t *testing.T) {
+	localSubrs := [][][]byte{
+		{buildCharstring(0, 0, t2(t2Rmoveto), 10, 0, t2(t2Rlineto), t2(t2Endchar))},
+		{buildCharstring(0, 0, t2(t2Rmoveto), 0, 10, t2(t2Rlineto), t2(t2Endchar))},
+	}
+	charStrings := [][]byte{
+		buildCharstring(t2(t2Endchar)),
+		buildCharstring(-107, t2(t2Callsubr)),
+		buildCharstring(-107, t2(t2Callsubr)),
+	}
+	testCases := []struct {
+		desc     string
+		fdSelect []byte
+	}{
+		{"format 0", []byte{0, 0, 0, 1}},
+		{"format 3", cat([]byte{3}, be16(2), be16(0), []byte{0}, be16(2), []byte{1}, be16(3))},
+	}
+	for _, tc := range testCases {
+		f := testCFFFont(t, testCFF{charStrings: charStrings, localSubrs: localSubrs, fdSelect: tc.fdSelect})
+		for i, want := range []string{"", "M 0 0, L 10 0, L 0 0", "M 0 0, L 0 10, L 0 0"} {
+			got, err := outline(f, GlyphID(i))
+			if err != nil {
+				t.Errorf("%s: glyph %d: %v", tc.desc, i, err)
+				continue
+			}
+			if got != want {
+				t.Errorf("%s: glyph %d:\ngot  %q\nwant %q", tc.desc, i, got, want)
+			}
+		}
+	}
+
+	// Glyph 2's Font DICT does not exist.
+	f := testCFFFont(t, testCFF{charStrings: charStrings, localSubrs: localSubrs, fdSelect: []byte{0, 0, 0, 2}})
+	if _, err := f.Glyph(2); !errors.Is(err, ErrInvalidFont) {
+		t.Errorf("invalid Font DICT: got %v, want an ErrInvalidFont", err)
+	}
+}
+
+func TestCFFGlyphErrors(t *testing.T) {
+	moveTo := buildCharstring(0, 0, t2(t2Rmoveto))
+	testCases := []struct {
+		desc       string
+		charString []byte
+	}{
+		{"no endchar", moveTo},
+		{"truncated shortint", []byte{t2Shortint, 1}},
+		{"truncated 16.16 number", []byte{255, 0, 1, 0}},
+		{"truncated two byte number", []byte{247}},
+		{"truncated two byte operator", []byte{12}},
+		{"truncated hintmask", buildCharstring(0, 10, t2(t2Hstem), t2(t2Hintmask))},
+		{"stack overflow", bytes.Repeat([]byte{139}, 49)},
+		{"rmoveto without arguments", buildCharstring(t2(t2Rmoveto), t2(t2Endchar))},
+		{"rcurveline without line", cat(moveTo, buildCharstring(1, t2(t2Rcurveline), t2(t2Endchar)))},
+		{"rlinecurve without curve", cat(moveTo, buildCharstring(1, 2, t2(t2Rlinecurve), t2(t2Endchar)))},
+		{"flex without arguments", cat(moveTo, buildCharstring(t2(t2Flex), t2(t2Endchar)))},
+		{"callsubr without arguments", buildCharstring(t2(t2Callsubr))},
+		{"invalid subroutine", buildCharstring(5, t2(t2Callsubr))},
+		{"invalid global subroutine", buildCharstring(-106, t2(t2Callgsubr))},
+		{"recursion", buildCharstring(-107, t2(t2Callsubr))},
+		{"too many operators", buildCharstring(-106, t2(t2Callsubr))},
+		{"accented character without glyphs", buildCharstring(0, 0, 65, 194, t2(t2Endchar))},
+		{"accented character with unencoded code", buildCharstring(0, 0, 0, 1, t2(t2Endchar))},
+		{"reserved operator", []byte{2}},
+		{"CFF2 operator", buildCharstring(0, 0, 0, 1, t2(t2Blend))},
+	}
+
+	// Local subroutine 0 calls itself. Subroutines 1 to 7 each call the next
+	// one 8 times, for 8⁷ calls.
+	subrs := [][]byte{buildCharstring(-107, t2(t2Callsubr), t2(t2Return))}
+	for i := 1; i < 8; i++ {
+		var s []interface{}
+		for j := 0; j < 8; j++ {
+			s = append(s, i+1-107, t2(t2Callsubr))
+		}
+		subrs = append(subrs, buildCharstring(append(s, t2(t2Return))...))
+	}
+	subrs = append(subrs, buildCharstring(t2(t2Return)))
+
+	c := testCFF{globalSubrs: [][]byte{buildCharstring(t2(t2Return))}, localSubrs: [][][]byte{subrs}}
+	for _, tc := range testCases {
+		c.charStrings = append(c.charStrings, tc.charString)
+	}
+	f := testCFFFont(t, c)
+	for i, tc := range testCases {
+		if _, err := f.Glyph(GlyphID(i)); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an ErrInvalidFont", tc.desc, err)
+		}
+	}
+}
+
+// testAccentedCFF is a CFF font whose glyphs 1 and 2 are "A" and "acute",
+// whose SIDs are 34 and 125 and whose standard encoding codes are 65 and 194.
+// Glyphs 3 and 4 compose them, with the accent 100 units right and 300 units
+// up, with and without an advance width.
+var testAccentedCFF = testCFF{
+	charStrings: [][]byte{
+		buildCharstring(t2(t2Endchar)),
+		buildCharstring(100, 0, t2(t2Rmoveto), 400, t2(t2Vlineto), 400, -400, t2(t2Hlineto), t2(t2Endchar)),
+		buildCharstring(0, 0, t2(t2Rmoveto), 50, 100, t2(t2Rlineto), t2(t2Endchar)),
+		buildCharstring(600, 100, 300, 65, 194, t2(t2Endchar)),
+		buildCharstring(100, 300, 65, 194, t2(t2Endchar)),
+	},
+	charset: cat([]byte{0}, be16(34), be16(125), be16(391), be16(392)),
+}
+
+func TestCFFAccentedCharacter(t *testing.T) {
+	charStrings := testAccentedCFF.charStrings
+	const want = "M 100 0, L 100 400, L 500 400, L 500 0, L 100 0, M 100 300, L 150 400, L 100 300"
+	for _, tc := range []struct {
+		desc    string
+		charset []byte
+	}{
+		{"format 0", testAccentedCFF.charset},
+		{"format 1", cat([]byte{1}, be16(34), []byte{0}, be16(125), []byte{0}, be16(391), []byte{1})},
+		{"format 2", cat([]byte{2}, be16(34), be16(0), be16(125), be16(2))},
+	} {
+		f := testCFFFont(t, testCFF{charStrings: charStrings, charset: tc.charset})
+		for _, g := range []GlyphID{3, 4} {
+			got, err := outline(f, g)
+			if err != nil {
+				t.Errorf("%s: glyph %d: %v", tc.desc, g, err)
+				continue
+			}
+			if got != want {
+				t.Errorf("%s: glyph %d:\ngot  %s\nwant %s", tc.desc, g, got, want)
+			}
+		}
+	}
+
+	// With glyph 4 as "A", glyphs 3 and 4 have an accented component.
+	f := testCFFFont(t, testCFF{charStrings: charStrings, charset: cat([]byte{0}, be16(1), be16(125), be16(391), be16(34))})
+	for _, g := range []GlyphID{3, 4} {
+		if _, err := f.Glyph(g); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("accented component of glyph %d: got %v, want an ErrInvalidFont", g, err)
+		}
+	}
+}
+
+func TestParseCFFErrors(t *testing.T) {
+	c := testCFF{charStrings: [][]byte{buildCharstring(t2(t2Endchar))}}
+	valid := buildCFF(c)
+	// The Top DICT starts after the header, the Name INDEX and the Top DICT
+	// INDEX's header. Its first entry is the CharStrings offset.
+	const topDict = 4 + 15 + 11
+	modify := func(offset int, v ...byte) []byte {
+		b := append([]byte(nil), valid...)
+		copy(b[offset:], v)
+		return b
+	}
+	testCases := []struct {
+		desc string
+		cff  []byte
+	}{
+		{"truncated header", valid[:3]},
+		{"major version 2", modify(0, 2)},
+		{"truncated Name INDEX", valid[:10]},
+		{"two fonts", modify(4, 0, 2)},
+		{"invalid offset size", modify(6, 5)},
+		{"no CharStrings", modify(topDict+5, 16)},
+		{"CharStrings out of bounds", modify(topDict+1, 0x7f)},
+		{"Private DICT out of bounds", modify(topDict+7, 0x7f)},
+		{"CharstringType 1", modify(topDict, 139+1, 12, 6, 139, 139)},
+		{"reserved DICT byte", modify(topDict, 22)},
+		{"invalid real number", modify(topDict, 30, 0xaa, 0xff)},
+	}
+	for _, tc := range testCases {
+		m := testCFFTables(c)
+		m["CFF "] = tc.cff
+		if _, err := Parse(buildCFFFont(m)); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an ErrInvalidFont", tc.desc, err)
+		}
+	}
+
+	for _, fdSelect := range [][]byte{{1, 0, 0}, {4, 0, 0}} {
+		m := testCFFTables(testCFF{charStrings: c.charStrings, localSubrs: [][][]byte{nil}, fdSelect: fdSelect})
+		if _, err := Parse(buildCFFFont(m)); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("FDSelect % x: got %v, want an ErrInvalidFont", fdSelect, err)
+		}
+	}
+
+	// The charset offset is the Top DICT's second entry.
+	m := testCFFTables(c)
+	m["CFF "] = buildCFF(testCFF{charStrings: c.charStrings, charset: []byte{0}})
+	m["CFF "][topDict+7] = 0x7f
+	if _, err := Parse(buildCFFFont(m)); !errors.Is(err, ErrInvalidFont) {
+		t.Errorf("charset out of bounds: got %v, want an ErrInvalidFont", err)
+	}
+
+	m = testCFFTables(testCFF{charStrings: append(c.charStrings, c.charStrings...)})
+	m["CFF "] = valid
+	var e ErrInvalidTable
+	if _, err := Parse(buildCFFFont(m)); !errors.As(err, &e) || e.Tag != cffTag {
+		t.Errorf("too few charstrings: got %v, want an ErrInvalidTable", err)
+	}
+	delete(m, "CFF ")
+	if _, err := Parse(buildCFFFont(m)); err != (ErrMissingTable{Tag: cffTag}) {
+		t.Errorf("missing CFF table: got %v, want %v", err, ErrMissingTable{Tag: cffTag})
+	}
+}
+
+func TestParseCFFDict(t *testing.T) {
+	testCases := []struct {
+		b    []byte
+		want cffDict
+	}{
+		{[]byte{139, 17}, cffDict{17: {0}}},
+		{[]byte{32, 246, 247, 0, 251, 0, 254, 255, 12, 6}, cffDict{1206: {-107, 107, 108, -108, -1131}}},
+		{[]byte{28, 0x80, 0, 29, 0x7f, 0xff, 0xff, 0xff, 0}, cffDict{0: {-32768, math.MaxInt32}}},
+		{[]byte{30, 0x1a, 0x5f, 30, 0xe2, 0xa2, 0x5c, 0x3f, 30, 0x2b, 0x3f, 1}, cffDict{1: {1.5, -2.25e-3, 2e3}}},
+		{[]byte{17, 18}, cffDict{17: nil, 18: nil}},
+	}
+	for _, tc := range testCases {
+		got, err := (&cffParser{}).dict(tc.b)
+		if err != nil {
+			t.Errorf("% x: %v", tc.b, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("% x: got %v, want %v", tc.b, got, tc.want)
+		}
+	}
+
+	for _, b := range [][]byte{
+		{22},
+		{255},
+		{28, 0},
+		{29, 0, 0, 0},
+		{247},
+		{12},
+		{139},
+		{30, 0x1a},
+		{30, 0xd0, 0xff},
+		{30, 0xaa, 0xff},
+		append(bytes.Repeat([]byte{139}, 49), 0),
+	} {
+		if _, err := (&cffParser{}).dict(b); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("% x: got %v, want an ErrInvalidFont", b, err)
+		}
+	}
+}
+
+// buildCFF2Index returns a CFF2 INDEX, whose count is 32-bit, of the given
+// objects.
+func buildCFF2Index(objects ...[]byte) []byte {
+	return cat(be16(0), buildCFFIndex(objects...))
+}
+
+// testCFF2 is the content of a CFF2 table, for buildCFF2.
+type testCFF2 struct {
+	charStrings [][]byte
+	globalSubrs [][]byte
+	// localSubrs and vsindexes are the local subroutines and default
+	// vsindex of each Font DICT.
+	localSubrs [][][]byte
+	vsindexes  []int
+	// fdSelect is nil for fonts with one Font DICT.
+	fdSelect []byte
+	varStore []byte
+}
+
+// buildCFF2 returns a CFF2 table.
+func buildCFF2(c testCFF2) []byte {
+	if len(c.localSubrs) == 0 {
+		c.localSubrs = [][][]byte{nil}
+	}
+	// Each Private DICT is its vsindex and Subrs offset, and is immediately
+	// followed by its Subrs INDEX.
+	const privateLen = 12
+	var privates [][]byte
+	for i, subrs := range c.localSubrs {
+		vsindex := 0
+		if i < len(c.vsindexes) {
+			vsindex = c.vsindexes[i]
+		}
+		privates = append(privates, cat(cffInt(vsindex), []byte{cffOpVSIndex},
+			cffInt(privateLen), []byte{cffOpSubrs}, buildCFF2Index(subrs...)))
+	}
+
+	topDict := func(charStrings, varStore, fdSelect, fdArray int) []byte {
+		d := cat(cffInt(charStrings), []byte{cffOpCharStrings}, cffInt(fdArray), []byte{12, cffOpFDArray - 1200})
+		if c.fdSelect != nil {
+			d = cat(d, cffInt(fdSelect), []byte{12, cffOpFDSelect - 1200})
+		}
+		if c.varStore != nil {
+			d = cat(d, cffInt(varStore), []byte{cffOpVariationStore})
+		}
+		return d
+	}
+	fontDicts := func(private int) []byte {
+		var dicts [][]byte
+		for _, p := range privates {
+			dicts = append(dicts, cat(cffInt(privateLen), cffInt(private), []byte{cffOpPrivate}))
+			private += len(p)
+		}
+		return buildCFF2Index(dicts...)
+	}
+	var varStore []byte
+	if c.varStore != nil {
+		varStore = cat(be16(len(c.varStore)), c.varStore)
+	}
+
+	// The offsets are computed from the lengths of everything before them.
+	topLen := len(topDict(0, 0, 0, 0))
+	varStoreOffset := 5 + topLen + len(buildCFF2Index(c.globalSubrs...))
+	charStrings := varStoreOffset + len(varStore)
+	fdSelect := charStrings + len(buildCFF2Index(c.charStrings...))
+	fdArray := fdSelect + len(c.fdSelect)
+	private := fdArray + len(fontDicts(0))
+
+	return cat([]byte{2, 0, 5}, be16(topLen), topDict(charStrings, varStoreOffset, fdSelect, fdArray),
+		buildCFF2Index(c.globalSubrs...), varStore, buildCFF2Index(c.charStrings...), c.fdSelect,
+		fontDicts(private), cat(privates...))
+}
+
+// testCFF2Tables returns the tables of a CFF2 based font, with one glyph per
+// charstring.
+func testCFF2Tables(c testCFF2) map[string][]byte {
+	m := buildTables(make([][]byte, len(c.charStrings)), []int{500}, map[rune]GlyphID{'a': 1})
+	delete(m, "glyf")
+	delete(m, "loca")
+	m["CFF2"] = buildCFF2(c)
+	return m
+}
+
+// testCFF2VarStore has one axis. Subtable 0 has a region that peaks at +1
+// and one that peaks at -1, and subtable 1 has only the first.
+var testCFF2VarStore = buildItemVariationStore(
+	[]testRegion{{{0, 1, 1}}, {{-1, -1, 0}}},
+	testVarData{regions: []int{0, 1}},
+	testVarData{regions: []int{0}},
+)
+
+func TestCFF2Outline(t *testing.T) {
+	moveTo := buildCharstring(0, 0, t2(t2Rmoveto))
+	// The line's dx is 100, plus 50 at the positive peak, or minus 20 at
+	// the negative one.
+	blend := buildCharstring(100, 0, 50, -20, 0, 0, 2, t2(t2Blend), t2(t2Rlineto))
+	// With vsindex 1, there is only the positive region.
+	blend1 := buildCharstring(100, 0, 50, 0, 2, t2(t2Blend), t2(t2Rlineto))
+	c := testCFF2{
+		charStrings: [][]byte{
+			cat(moveTo, buildCharstring(100, 0, t2(t2Rlineto))),
+			cat(moveTo, blend),
+			cat(moveTo, buildCharstring(1, t2(t2Vsindex)), blend1),
+			cat(moveTo, buildCharstring(-107, t2(t2Callsubr))),
+			cat(moveTo, blend1),
+		},
+		localSubrs: [][][]byte{{blend}, {blend1}},
+		vsindexes:  []int{0, 1},
+		// Glyph 4's Font DICT has vsindex 1.
+		fdSelect: cat([]byte{4}, be32(2), be32(0), be16(0), be32(4), be16(1), be32(5)),
+		varStore: testCFF2VarStore,
+	}
+	f, err := Parse(buildCFFFont(testCFF2Tables(c)))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	testCases := []struct {
+		coords []float32
+		want   []string
+	}{
+		{nil, []string{"100", "100", "100", "100", "100"}},
+		{[]float32{0.5}, []string{"100", "125", "125", "125", "125"}},
+		{[]float32{-1}, []string{"100", "80", "100", "80", "100"}},
+		{[]float32{-0.5, 1}, []string{"100", "90", "100", "90", "100"}},
+		// Coordinates are clamped to [-1, 1].
+		{[]float32{2}, []string{"100", "150", "150", "150", "150"}},
+	}
+	for _, tc := range testCases {
+		f.SetNormalizedCoords(tc.coords)
+		for i, x := range tc.want {
+			want := "M 0 0, L " + x + " 0, L 0 0"
+			got, err := outline(f, GlyphID(i))
+			if err != nil {
+				t.Errorf("coords %v: glyph %d: %v", tc.coords, i, err)
+				continue
+			}
+			if got != want {
+				t.Errorf("coords %v: glyph %d:\ngot  %q\nwant %q", tc.coords, i, got, want)
+			}
+		}
+	}
+
+	// The bounding box is that of the current instance.
+	f.SetNormalizedCoords([]float32{1})
+	g, err := f.Glyph(1)
+	if err != nil {
+		t.Fatalf("Glyph(1): %v", err)
+	}
+	xMin, yMin, xMax, yMax := g.bounds()
+	if got, want := [4]int{xMin, yMin, xMax, yMax}, [4]int{0, 0, 150, 0}; got != want {
+		t.Errorf("bounds: got %v, want %v", got, want)
+	}
+}
+
+func TestCFF2GlyphErrors(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		charString []byte
+	}{
+		{"endchar", buildCharstring(t2(t2Endchar))},
+		{"return", buildCharstring(t2(t2Return))},
+		{"blend without arguments", buildCharstring(t2(t2Blend))},
+		{"blend with too few arguments", buildCharstring(100, 0, 50, 2, t2(t2Blend))},
+		{"blend with a negative count", buildCharstring(-1, t2(t2Blend))},
+		{"blend with a fractional count", buildCharstring(0, 0, 0, 0.5, t2(t2Blend))},
+		{"invalid vsindex", buildCharstring(2, t2(t2Vsindex), 0, 0, t2(t2Blend))},
+		{"vsindex without arguments", buildCharstring(t2(t2Vsindex))},
+		{"stack overflow", bytes.Repeat([]byte{139}, 514)},
+	}
+	c := testCFF2{varStore: testCFF2VarStore}
+	for _, tc := range testCases {
+		c.charStrings = append(c.charStrings, tc.charString)
+	}
+	f, err := Parse(buildCFFFont(testCFF2Tables(c)))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	for i, tc := range testCases {
+		if _, err := f.Glyph(GlyphID(i)); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an ErrInvalidFont", tc.desc, err)
+		}
+	}
+
+	// A blend needs a variation store.
+	c = testCFF2{charStrings: [][]byte{buildCharstring(0, 0, 0, 1, t2(t2Blend))}}
+	if f, err = Parse(buildCFFFont(testCFF2Tables(c))); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if _, err := f.Glyph(0); !errors.Is(err, ErrInvalidFont) {
+		t.Errorf("no variation store: got %v, want an ErrInvalidFont", err)
+	}
+}
+
+func TestParseCFF2Errors(t *testing.T) {
+	c := testCFF2{charStrings: [][]byte{buildCharstring(0, 0, t2(t2Rmoveto))}, varStore: testCFF2VarStore}
+	valid := buildCFF2(c)
+	// The Top DICT follows the 5 byte header. Its entries are 6 bytes for
+	// CharStrings, 7 for FDArray and 6 for the VariationStore.
+	const topDict = 5
+	modify := func(offset int, v ...byte) []byte {
+		b := append([]byte(nil), valid...)
+		copy(b[offset:], v)
+		return b
+	}
+	testCases := []struct {
+		desc string
+		cff2 []byte
+	}{
+		{"truncated header", valid[:4]},
+		{"major version 1", modify(0, 1)},
+		{"Top DICT out of bounds", modify(3, 0x7f)},
+		{"no FDArray", modify(topDict+12, 16)},
+		{"VariationStore out of bounds", modify(topDict+14, 0x7f)},
+		{"huge Global Subr INDEX", modify(topDict+19, 0x7f)},
+	}
+	for _, tc := range testCases {
+		m := testCFF2Tables(c)
+		m["CFF2"] = tc.cff2
+		if _, err := Parse(buildCFFFont(m)); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an ErrInvalidFont", tc.desc, err)
+		}
+	}
+
+	for _, fdSelect := range [][]byte{
+		cat([]byte{4}, be32(1000)),
+		{1, 0, 0},
+		{5, 0, 0},
+	} {
+		m := testCFF2Tables(testCFF2{charStrings: c.charStrings, fdSelect: fdSelect})
+		if _, err := Parse(buildCFFFont(m)); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("FDSelect % x: got %v, want an ErrInvalidFont", fdSelect, err)
+		}
+	}
+
+	m := testCFF2Tables(testCFF2{charStrings: append(c.charStrings, c.charStrings...)})
+	m["CFF2"] = valid
+	var e ErrInvalidTable
+	if _, err := Parse(buildCFFFont(m)); !errors.As(err, &e) || e.Tag != cff2Tag {
+		t.Errorf("too few charstrings: got %v, want an ErrInvalidTable", err)
+	}
+}
+
+func TestParseCFF2Dict(t *testing.T) {
+	// The variation store's subtable 0 has two regions, and subtable 1 has
+	// one. Blends leave their default values.
+	p := &cffParser{cff2: true, varStore: itemVariationStore(testCFF2VarStore)}
+	testCases := []struct {
+		b    []byte
+		want cffDict
+	}{
+		{[]byte{239, 149, 159, 140, 23, 17}, cffDict{17: {100}}},
+		{[]byte{144, 239, 149, 159, 140, 23, 18}, cffDict{18: {5, 100}}},
+		{[]byte{140, 22, 239, 149, 140, 23, 18}, cffDict{22: {1}, 18: {100}}},
+		{[]byte{139, 24}, cffDict{24: {0}}},
+	}
+	for _, tc := range testCases {
+		got, err := p.dict(tc.b)
+		if err != nil {
+			t.Errorf("% x: %v", tc.b, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("% x: got %v, want %v", tc.b, got, tc.want)
+		}
+	}
+
+	for _, b := range [][]byte{
+		{23},
+		{140, 23},
+		{138, 23},
+		{139, 139, 140, 23, 17},
+		{141, 22, 139, 140, 23, 17},
+		// The real 2^62 and 1.5.
+		{30, 0x46, 0x11, 0x68, 0x60, 0x18, 0x42, 0x73, 0x87, 0x90, 0x4f, 23, 17},
+		{139, 139, 139, 30, 0x1a, 0x5f, 23, 17},
+		{25},
+		append(bytes.Repeat([]byte{139}, 514), 17),
+	} {
+		if _, err := p.dict(b); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("% x: got %v, want an ErrInvalidFont", b, err)
+		}
+	}
+}
+
+func TestSubrBias(t *testing.T) {
+	for n, want := range map[int]int{0: 107, 1239: 107, 1240: 1131, 33899: 1131, 33900: 32768} {
+		if got := subrBias(n); got != want {
+			t.Errorf("n=%d: got %d, want %d", n, got, want)
+		}
+	}
+}
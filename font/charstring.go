@@ -0,0 +1,595 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"fmt"
+	"math"
+
+	"golang.org/x/image/math/f32"
+)
+
+// Type 2 charstring operators. Two byte operators, whose first byte is 12,
+// are 1200 plus their second byte.
+const (
+	t2Hstem      = 1
+	t2Vstem      = 3
+	t2Vmoveto    = 4
+	t2Rlineto    = 5
+	t2Hlineto    = 6
+	t2Vlineto    = 7
+	t2Rrcurveto  = 8
+	t2Callsubr   = 10
+	t2Return     = 11
+	t2Endchar    = 14
+	t2Vsindex    = 15
+	t2Blend      = 16
+	t2Hstemhm    = 18
+	t2Hintmask   = 19
+	t2Cntrmask   = 20
+	t2Rmoveto    = 21
+	t2Hmoveto    = 22
+	t2Vstemhm    = 23
+	t2Rcurveline = 24
+	t2Rlinecurve = 25
+	t2Vvcurveto  = 26
+	t2Hhcurveto  = 27
+	t2Shortint   = 28
+	t2Callgsubr  = 29
+	t2Vhcurveto  = 30
+	t2Hvcurveto  = 31
+	t2Hflex      = 1234
+	t2Flex       = 1235
+	t2Hflex1     = 1236
+	t2Flex1      = 1237
+)
+
+const (
+	// t2MaxSubrDepth is the maximum nesting of subroutine calls.
+	t2MaxSubrDepth = 10
+	// t2MaxOps isn't part of the spec. It is a sanity check on the number of
+	// operators that a glyph's charstring, including its subroutine calls,
+	// executes, as subroutines can otherwise call each other exponentially
+	// many times.
+	t2MaxOps = 65536
+)
+
+// cffGlyphLen is the length of a CFF font's Glyph: a glyph header, whose
+// numberOfContours is zero, followed by the glyph ID.
+const cffGlyphLen = 12
+
+// glyph returns the Glyph of a CFF font's glyph, at the normalized variation
+// coordinates, or nil if it has no outline. The bounding box in its header is
+// that of the outline's points, including off-curve points.
+func (c *cff) glyph(glyphID GlyphID, coords []float32) (Glyph, error) {
+	segs, err := c.segments(glyphID, coords)
+	if err != nil || len(segs) == 0 {
+		return nil, err
+	}
+	xMin, yMin := math.Inf(+1), math.Inf(+1)
+	xMax, yMax := math.Inf(-1), math.Inf(-1)
+	for _, s := range segs {
+		ps := [3]point{s.p, s.q, s.r}
+		n := 1
+		if s.op == cubeTo {
+			n = 3
+		}
+		for _, p := range ps[:n] {
+			xMin, yMin = math.Min(xMin, float64(p.x)), math.Min(yMin, float64(p.y))
+			xMax, yMax = math.Max(xMax, float64(p.x)), math.Max(yMax, float64(p.y))
+		}
+	}
+	b := make(Glyph, cffGlyphLen)
+	for i, v := range [4]float64{math.Floor(xMin), math.Floor(yMin), math.Ceil(xMax), math.Ceil(yMax)} {
+		v = math.Max(math.MinInt16, math.Min(math.MaxInt16, v))
+		b[2+2*i], b[3+2*i] = byte(int16(v)>>8), byte(int16(v))
+	}
+	b[10], b[11] = byte(glyphID>>8), byte(glyphID)
+	return b, nil
+}
+
+// outline sends the outline of a CFF font's Glyph, at the normalized
+// variation coordinates, to dst.
+func (c *cff) outline(dst Pather, b Glyph, transform *f32.Aff3, coords []float32) error {
+	if b == nil {
+		return nil
+	}
+	if len(b) < cffGlyphLen {
+		return errGlyphTruncated
+	}
+	segs, err := c.segments(GlyphID(u16(b, 10)), coords)
+	if err != nil {
+		return err
+	}
+	for _, s := range segs {
+		switch s.op {
+		case moveTo:
+			dst.MoveTo(mul(transform, s.p))
+		case lineTo:
+			dst.LineTo(mul(transform, s.p))
+		case cubeTo:
+			dst.CubeTo(mul(transform, s.p), mul(transform, s.q), mul(transform, s.r))
+		}
+	}
+	return nil
+}
+
+// segments runs the glyph's charstring, returning its outline's segments, in
+// font units.
+func (c *cff) segments(glyphID GlyphID, coords []float32) ([]segment, error) {
+	r, err := c.interpret(glyphID, coords)
+	if err != nil {
+		return nil, err
+	}
+	if r.seac == nil {
+		return r.segs, nil
+	}
+	// An accented character is composed of two glyphs of the standard
+	// encoding: the base glyph, and the accent glyph offset by (adx, ady).
+	adx, ady, bchar, achar := r.seac[0], r.seac[1], r.seac[2], r.seac[3]
+	segs := r.segs
+	for _, component := range []struct {
+		code   float32
+		dx, dy float32
+	}{{bchar, 0, 0}, {achar, adx, ady}} {
+		g, ok := c.standardGlyph(component.code)
+		if !ok {
+			return nil, ErrInvalidGlyph{fmt.Sprintf("glyph ID %d's accented character has no glyph for code %v", glyphID, component.code)}
+		}
+		cr, err := c.interpret(g, coords)
+		if err != nil {
+			return nil, err
+		}
+		if cr.seac != nil {
+			return nil, ErrInvalidGlyph{fmt.Sprintf("glyph ID %d's accented character has an accented component", glyphID)}
+		}
+		for _, s := range cr.segs {
+			for _, p := range []*point{&s.p, &s.q, &s.r} {
+				p.x += component.dx
+				p.y += component.dy
+			}
+			segs = append(segs, s)
+		}
+	}
+	return segs, nil
+}
+
+// interpret runs the glyph's charstring.
+func (c *cff) interpret(glyphID GlyphID, coords []float32) (*t2Interpreter, error) {
+	code, ok := c.charStrings.get(int(glyphID))
+	if !ok {
+		return nil, ErrInvalidGlyph{fmt.Sprintf("glyph ID %d has no charstring", glyphID)}
+	}
+	fd := c.fd(glyphID)
+	if fd < 0 || len(c.privates) <= fd {
+		return nil, ErrInvalidGlyph{fmt.Sprintf("glyph ID %d has an invalid Font DICT", glyphID)}
+	}
+	r := &t2Interpreter{
+		globalSubrs: c.globalSubrs,
+		localSubrs:  c.privates[fd].subrs,
+		maxStack:    cffMaxOperands,
+	}
+	if c.cff2 {
+		// CFF2 charstrings have no advance widths.
+		r.cff2, r.seenWidth, r.maxStack = true, true, cff2MaxOperands
+		r.varStore, r.coords, r.vsindex = c.varStore, coords, c.privates[fd].vsindex
+	}
+	if _, err := r.run(code, 0); err != nil {
+		return nil, err
+	}
+	r.closePath()
+	return r, nil
+}
+
+// t2Interpreter is a Type 2 charstring interpreter, which also runs CFF2
+// charstrings.
+type t2Interpreter struct {
+	globalSubrs cffIndex
+	localSubrs  cffIndex
+	maxStack    int
+
+	// cff2 is whether the charstring is a CFF2 one, whose blend operators
+	// add the deltas of the varStore's regions, as they apply at the
+	// normalized coords, to their operands. vsindex selects the varStore's
+	// ItemVariationData subtable, and scalars are the scalars of its
+	// regions, or nil if they have not been computed yet.
+	cff2     bool
+	varStore itemVariationStore
+	coords   []float32
+	vsindex  int
+	scalars  []float32
+
+	stack []float32
+	// nStems is the number of stem hints, which determines the length of
+	// the hintmask and cntrmask operators' masks.
+	nStems int
+	// seenWidth is whether the first stack-clearing operator, whose operands
+	// may start with the glyph's advance width, has been seen.
+	seenWidth bool
+	nOps      int
+
+	// x and y are the current point, and start is the current contour's
+	// first point.
+	x, y     float32
+	start    point
+	inPath   bool
+	segs     []segment
+	stackBuf [cff2MaxOperands]float32
+
+	// seac is the adx, ady, bchar and achar operands of an endchar that
+	// composes an accented character, or nil.
+	seac []float32
+}
+
+// run runs the charstring code. It returns true if the charstring ended,
+// with the endchar operator, rather than returning from a subroutine. A CFF2
+// charstring has no endchar operator, and ends with its code.
+func (r *t2Interpreter) run(code []byte, depth int) (ended bool, err error) {
+	if r.stack == nil {
+		r.stack = r.stackBuf[:0]
+	}
+	for i := 0; i < len(code); {
+		b0 := code[i]
+		i++
+
+		// Operands.
+		if b0 == t2Shortint || b0 >= 32 {
+			var v float32
+			switch {
+			case b0 == t2Shortint:
+				if i+2 > len(code) {
+					return false, errGlyphTruncated
+				}
+				v = float32(i16(code, int32(i)))
+				i += 2
+			case b0 <= 246:
+				v = float32(int(b0) - 139)
+			case b0 <= 254:
+				if i+1 > len(code) {
+					return false, errGlyphTruncated
+				}
+				if b0 <= 250 {
+					v = float32((int(b0)-247)*256 + int(code[i]) + 108)
+				} else {
+					v = float32(-(int(b0)-251)*256 - int(code[i]) - 108)
+				}
+				i++
+			default:
+				// A 16.16 fixed point number.
+				if i+4 > len(code) {
+					return false, errGlyphTruncated
+				}
+				v = float32(int32(u32(code, int32(i)))) / (1 << 16)
+				i += 4
+			}
+			if len(r.stack) == r.maxStack {
+				return false, ErrInvalidGlyph{"charstring argument stack overflow"}
+			}
+			r.stack = append(r.stack, v)
+			continue
+		}
+
+		// Operators.
+		op := int(b0)
+		if op == 12 {
+			if i >= len(code) {
+				return false, errGlyphTruncated
+			}
+			op = 1200 + int(code[i])
+			i++
+		}
+		if r.nOps++; r.nOps > t2MaxOps {
+			return false, ErrInvalidGlyph{"charstring executes too many operators"}
+		}
+		args := r.stack
+
+		// CFF2 removed the return and endchar operators, and added the
+		// vsindex and blend operators.
+		cffOnly := op == t2Return || op == t2Endchar
+		cff2Only := op == t2Vsindex || op == t2Blend
+		if cffOnly && r.cff2 || cff2Only && !r.cff2 {
+			return false, ErrInvalidGlyph{fmt.Sprintf("charstring has an unsupported operator %d", op)}
+		}
+
+		switch op {
+		case t2Hstem, t2Vstem, t2Hstemhm, t2Vstemhm:
+			args = r.width(args, len(args)%2 == 1)
+			r.nStems += len(args) / 2
+
+		case t2Hintmask, t2Cntrmask:
+			// Stem hints may precede the mask, as if there were a vstem
+			// operator.
+			args = r.width(args, len(args)%2 == 1)
+			r.nStems += len(args) / 2
+			n := (r.nStems + 7) / 8
+			if i+n > len(code) {
+				return false, errGlyphTruncated
+			}
+			i += n
+
+		case t2Rmoveto:
+			if args = r.width(args, len(args) > 2); len(args) < 2 {
+				return false, errT2Args(op)
+			}
+			r.moveTo(args[0], args[1])
+		case t2Hmoveto:
+			if args = r.width(args, len(args) > 1); len(args) < 1 {
+				return false, errT2Args(op)
+			}
+			r.moveTo(args[0], 0)
+		case t2Vmoveto:
+			if args = r.width(args, len(args) > 1); len(args) < 1 {
+				return false, errT2Args(op)
+			}
+			r.moveTo(0, args[0])
+
+		case t2Rlineto:
+			for ; len(args) >= 2; args = args[2:] {
+				r.lineTo(args[0], args[1])
+			}
+		case t2Hlineto, t2Vlineto:
+			for vertical := op == t2Vlineto; len(args) >= 1; args, vertical = args[1:], !vertical {
+				if vertical {
+					r.lineTo(0, args[0])
+				} else {
+					r.lineTo(args[0], 0)
+				}
+			}
+
+		case t2Rrcurveto:
+			for ; len(args) >= 6; args = args[6:] {
+				r.cubeTo(args[0], args[1], args[2], args[3], args[4], args[5])
+			}
+		case t2Rcurveline:
+			for ; len(args) >= 8; args = args[6:] {
+				r.cubeTo(args[0], args[1], args[2], args[3], args[4], args[5])
+			}
+			if len(args) < 2 {
+				return false, errT2Args(op)
+			}
+			r.lineTo(args[0], args[1])
+		case t2Rlinecurve:
+			for ; len(args) >= 8; args = args[2:] {
+				r.lineTo(args[0], args[1])
+			}
+			if len(args) < 6 {
+				return false, errT2Args(op)
+			}
+			r.cubeTo(args[0], args[1], args[2], args[3], args[4], args[5])
+		case t2Hhcurveto:
+			var dy1 float32
+			if len(args)%2 == 1 {
+				dy1, args = args[0], args[1:]
+			}
+			for ; len(args) >= 4; args, dy1 = args[4:], 0 {
+				r.cubeTo(args[0], dy1, args[1], args[2], args[3], 0)
+			}
+		case t2Vvcurveto:
+			var dx1 float32
+			if len(args)%2 == 1 {
+				dx1, args = args[0], args[1:]
+			}
+			for ; len(args) >= 4; args, dx1 = args[4:], 0 {
+				r.cubeTo(dx1, args[0], args[1], args[2], 0, args[3])
+			}
+		case t2Hvcurveto, t2Vhcurveto:
+			// The curves alternate between starting horizontally and
+			// vertically. The last curve may have a fifth argument, for its
+			// otherwise zero final delta.
+			for vertical := op == t2Vhcurveto; len(args) >= 4; args, vertical = args[4:], !vertical {
+				var last float32
+				if len(args) == 5 {
+					last = args[4]
+				}
+				if vertical {
+					r.cubeTo(0, args[0], args[1], args[2], args[3], last)
+				} else {
+					r.cubeTo(args[0], 0, args[1], args[2], last, args[3])
+				}
+			}
+
+		case t2Flex:
+			if len(args) < 13 {
+				return false, errT2Args(op)
+			}
+			r.cubeTo(args[0], args[1], args[2], args[3], args[4], args[5])
+			r.cubeTo(args[6], args[7], args[8], args[9], args[10], args[11])
+		case t2Hflex:
+			if len(args) < 7 {
+				return false, errT2Args(op)
+			}
+			r.cubeTo(args[0], 0, args[1], args[2], args[3], 0)
+			r.cubeTo(args[4], 0, args[5], -args[2], args[6], 0)
+		case t2Hflex1:
+			if len(args) < 9 {
+				return false, errT2Args(op)
+			}
+			r.cubeTo(args[0], args[1], args[2], args[3], args[4], 0)
+			r.cubeTo(args[5], 0, args[6], args[7], args[8], -(args[1] + args[3] + args[7]))
+		case t2Flex1:
+			if len(args) < 11 {
+				return false, errT2Args(op)
+			}
+			// The last point's delta, in the direction of the larger
+			// overall delta, is the last argument. In the other direction,
+			// the curves end where they started.
+			var dx, dy float32
+			for j := 0; j < 10; j += 2 {
+				dx, dy = dx+args[j], dy+args[j+1]
+			}
+			dx6, dy6 := args[10], -dy
+			if abs32(dx) <= abs32(dy) {
+				dx6, dy6 = -dx, args[10]
+			}
+			r.cubeTo(args[0], args[1], args[2], args[3], args[4], args[5])
+			r.cubeTo(args[6], args[7], args[8], args[9], dx6, dy6)
+
+		case t2Callsubr, t2Callgsubr:
+			if len(args) < 1 {
+				return false, errT2Args(op)
+			}
+			subrs := r.localSubrs
+			if op == t2Callgsubr {
+				subrs = r.globalSubrs
+			}
+			index := int(args[len(args)-1]) + subrBias(subrs.count)
+			subr, ok := subrs.get(index)
+			if !ok {
+				return false, ErrInvalidGlyph{fmt.Sprintf("charstring calls an invalid subroutine %d", index)}
+			}
+			if depth == t2MaxSubrDepth {
+				return false, ErrInvalidGlyph{"charstring subroutine calls are nested too deeply"}
+			}
+			r.stack = args[:len(args)-1]
+			ended, err := r.run(subr, depth+1)
+			if ended || err != nil {
+				return ended, err
+			}
+			// The operands that the subroutine left on the stack are the
+			// caller's.
+			continue
+		case t2Return:
+			return false, nil
+
+		case t2Endchar:
+			r.width(args, len(args) == 1 || len(args) == 5)
+			if len(args) >= 4 {
+				r.seac = append([]float32(nil), args[len(args)-4:]...)
+			}
+			return true, nil
+
+		case t2Vsindex:
+			if len(args) < 1 {
+				return false, errT2Args(op)
+			}
+			r.vsindex, r.scalars = int(args[len(args)-1]), nil
+		case t2Blend:
+			// The operands are n default values, their deltas for each
+			// region and n. The blend leaves the n blended values on the
+			// stack.
+			if r.scalars == nil {
+				var ok bool
+				if r.scalars, ok = r.varStore.regionScalars([]float32{}, r.vsindex, r.coords); !ok {
+					return false, ErrInvalidGlyph{fmt.Sprintf("charstring has an invalid vsindex %d", r.vsindex)}
+				}
+			}
+			if len(args) < 1 {
+				return false, errT2Args(op)
+			}
+			// n is checked before it is converted or multiplied, so that
+			// huge values cannot overflow.
+			nf, k := args[len(args)-1], len(r.scalars)
+			if float64(nf) != math.Trunc(float64(nf)) || nf < 0 || float64(nf) > float64((len(args)-1)/(k+1)) {
+				return false, errT2Args(op)
+			}
+			n := int(nf)
+			base := len(args) - 1 - n*(k+1)
+			values, deltas := args[base:base+n], args[base+n:base+n*(k+1)]
+			for i := range values {
+				for j, s := range r.scalars {
+					values[i] += deltas[i*k+j] * s
+				}
+			}
+			r.stack = args[:base+n]
+			continue
+
+		default:
+			return false, ErrInvalidGlyph{fmt.Sprintf("charstring has an unsupported operator %d", op)}
+		}
+		r.stack = r.stack[:0]
+	}
+	if depth == 0 && !r.cff2 {
+		return false, ErrInvalidGlyph{"charstring has no endchar"}
+	}
+	return false, nil
+}
+
+func errT2Args(op int) error {
+	return ErrInvalidGlyph{fmt.Sprintf("charstring operator %d has too few arguments", op)}
+}
+
+// width removes the advance width, if it is present, from the arguments of
+// the first stack-clearing operator. The width is not needed, as the hmtx
+// table also has it.
+func (r *t2Interpreter) width(args []float32, present bool) []float32 {
+	if r.seenWidth {
+		return args
+	}
+	r.seenWidth = true
+	if present && len(args) > 0 {
+		return args[1:]
+	}
+	return args
+}
+
+// subrBias returns the bias added to subroutine indices, which depends on the
+// number of subroutines.
+func subrBias(n int) int {
+	switch {
+	case n < 1240:
+		return 107
+	case n < 33900:
+		return 1131
+	}
+	return 32768
+}
+
+func abs32(x float32) float32 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// closePath closes the current contour, if any, with a line back to its
+// first point.
+func (r *t2Interpreter) closePath() {
+	if r.inPath && (r.x != r.start.x || r.y != r.start.y) {
+		r.segs = append(r.segs, segment{op: lineTo, p: r.start})
+	}
+	r.inPath = false
+}
+
+func (r *t2Interpreter) moveTo(dx, dy float32) {
+	r.closePath()
+	r.x, r.y = r.x+dx, r.y+dy
+	r.start = point{r.x, r.y}
+	r.segs = append(r.segs, segment{op: moveTo, p: r.start})
+	r.inPath = true
+}
+
+// beginPath starts a contour at the current point if a drawing operator has
+// none, which is invalid but harmless.
+func (r *t2Interpreter) beginPath() {
+	if !r.inPath {
+		r.moveTo(0, 0)
+	}
+}
+
+func (r *t2Interpreter) lineTo(dx, dy float32) {
+	r.beginPath()
+	r.x, r.y = r.x+dx, r.y+dy
+	r.segs = append(r.segs, segment{op: lineTo, p: point{r.x, r.y}})
+}
+
+// cubeTo adds a cubic Bézier curve, whose control points and end point are
+// each relative to the previous point.
+func (r *t2Interpreter) cubeTo(dxa, dya, dxb, dyb, dxc, dyc float32) {
+	r.beginPath()
+	p := point{r.x + dxa, r.y + dya}
+	q := point{p.x + dxb, p.y + dyb}
+	r.x, r.y = q.x+dxc, q.y+dyc
+	r.segs = append(r.segs, segment{op: cubeTo, p: p, q: q, r: point{r.x, r.y}})
+}
@@ -0,0 +1,361 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"fmt"
+)
+
+// Platform and encoding IDs for cmap subtables and name records.
+const (
+	platformUnicode   = 0
+	platformMacintosh = 1
+	platformMicrosoft = 3
+
+	encodingUnicodeBMP            = 3
+	encodingUnicodeFull           = 4
+	encodingUnicodeVariations     = 5
+	encodingUnicodeFullLastResort = 6
+	encodingMacintoshRoman        = 0
+	encodingMicrosoftSymbol       = 0
+	encodingMicrosoftBMP          = 1
+	encodingMicrosoftUCS4         = 10
+)
+
+// cmap holds the subtables of the cmap table that are used to map Unicode code
+// points, and variation sequences, to glyph IDs.
+type cmap struct {
+	// subtable is a format 4, 6, 12 or 13 subtable, or nil.
+	subtable cmapSubtable
+	// variations is a format 14 subtable, or nil.
+	variations []byte
+	// symbol is whether subtable is a Microsoft Symbol subtable, whose code
+	// points are in the range U+F020 to U+F0FF of the Private Use Area.
+	symbol bool
+}
+
+// cmapSubtable is a subtable of the cmap table that maps Unicode code points
+// to glyph IDs.
+type cmapSubtable []byte
+
+// parseCmap parses the cmap table b. It picks the best subtable for looking up
+// Unicode code points, preferring those that cover the full Unicode range, and
+// the Unicode variation sequences subtable, if any. Symbol subtables are only
+// used when there is no Unicode subtable.
+func parseCmap(b []byte) (cmap, error) {
+	if len(b) < 4 {
+		return cmap{}, ErrTableTooShort{Tag: MakeTag("cmap"), Length: len(b), MinLength: 4}
+	}
+	n := int32(u16(b, 2))
+	if want := 4 + 8*int(n); len(b) < want {
+		return cmap{}, ErrTableTooShort{Tag: MakeTag("cmap"), Length: len(b), MinLength: want}
+	}
+	c, bestScore := cmap{}, 0
+	for i := int32(0); i < n; i++ {
+		rec := 4 + 8*i
+		pid, eid, offset := u16(b, rec+0), u16(b, rec+2), u32(b, rec+4)
+		score := 0
+		switch {
+		case pid == platformUnicode && eid == encodingUnicodeVariations:
+			s, err := cmapVariations(b, offset)
+			if err != nil {
+				return cmap{}, err
+			}
+			c.variations = s
+			continue
+		case pid == platformMicrosoft && eid == encodingMicrosoftSymbol:
+			score = 1
+		case pid == platformUnicode && eid == encodingUnicodeFullLastResort:
+			score = 2
+		case pid == platformUnicode && eid < encodingUnicodeFull:
+			score = 3
+		case pid == platformMicrosoft && eid == encodingMicrosoftBMP:
+			score = 3
+		case pid == platformUnicode && eid == encodingUnicodeFull:
+			score = 4
+		case pid == platformMicrosoft && eid == encodingMicrosoftUCS4:
+			score = 4
+		}
+		if score <= bestScore {
+			continue
+		}
+		s, err := parseCmapSubtable(b, offset)
+		if err != nil {
+			return cmap{}, err
+		}
+		if s != nil {
+			c.subtable, bestScore = s, score
+			c.symbol = score == 1
+		}
+	}
+	return c, nil
+}
+
+// parseCmapSubtable returns the cmap subtable at the given offset in the cmap
+// table b, or nil if its format is not supported.
+func parseCmapSubtable(b []byte, offset uint32) (cmapSubtable, error) {
+	if uint64(offset)+8 > uint64(len(b)) {
+		return nil, ErrInvalidTable{Tag: MakeTag("cmap"), Reason: fmt.Sprintf("subtable offset %d is out of bounds", offset)}
+	}
+	b = b[offset:]
+	length, minLength := uint32(0), uint32(0)
+	switch u16(b, 0) {
+	case 4:
+		length, minLength = uint32(u16(b, 2)), 14
+	case 6:
+		length, minLength = uint32(u16(b, 2)), 10
+	case 12, 13:
+		length, minLength = u32(b, 4), 16
+	default:
+		return nil, nil
+	}
+	if length < minLength {
+		return nil, ErrInvalidTable{Tag: MakeTag("cmap"), Reason: fmt.Sprintf("format %d subtable length %d is too short", u16(b, 0), length)}
+	}
+	if length > uint32(len(b)) {
+		return nil, ErrInvalidTable{Tag: MakeTag("cmap"), Reason: fmt.Sprintf("subtable length %d is out of bounds", length)}
+	}
+	return cmapSubtable(b[:length]), nil
+}
+
+// cmapVariations returns the format 14 cmap subtable at the given offset in
+// the cmap table b, or nil if it has another format.
+func cmapVariations(b []byte, offset uint32) ([]byte, error) {
+	if uint64(offset)+10 > uint64(len(b)) {
+		return nil, ErrInvalidTable{Tag: MakeTag("cmap"), Reason: fmt.Sprintf("subtable offset %d is out of bounds", offset)}
+	}
+	b = b[offset:]
+	if u16(b, 0) != 14 {
+		return nil, nil
+	}
+	length := u32(b, 2)
+	if length < 10 {
+		return nil, ErrInvalidTable{Tag: MakeTag("cmap"), Reason: fmt.Sprintf("format 14 subtable length %d is too short", length)}
+	}
+	if length > uint32(len(b)) {
+		return nil, ErrInvalidTable{Tag: MakeTag("cmap"), Reason: fmt.Sprintf("subtable length %d is out of bounds", length)}
+	}
+	b = b[:length]
+	if n := u32(b, 6); uint64(n) > uint64(len(b)-10)/11 {
+		return nil, ErrInvalidTable{Tag: MakeTag("cmap"), Reason: fmt.Sprintf("%d variation selector records overflow the subtable", n)}
+	}
+	return b, nil
+}
+
+// glyphIndex returns the glyph ID for r, or 0 if there is none. Symbol
+// subtables also map the code points U+0020 to U+00FF, as if they were their
+// Private Use Area code points, as Windows does.
+func (c cmap) glyphIndex(r rune) GlyphID {
+	g := c.subtable.glyphIndex(r)
+	if g == 0 && c.symbol && 0x20 <= r && r <= 0xff {
+		g = c.subtable.glyphIndex(0xf000 + r)
+	}
+	return g
+}
+
+// glyphIndexVariant returns the glyph ID for the variation sequence of r
+// followed by the variation selector vs. It returns the default glyph ID for r
+// if the font does not have a glyph specific to that sequence.
+func (c cmap) glyphIndexVariant(r, vs rune) GlyphID {
+	if r < 0 || vs < 0 || len(c.variations) == 0 {
+		return c.glyphIndex(r)
+	}
+	b := c.variations
+	cr, cvs := uint32(r), uint32(vs)
+
+	// Binary search for the variation selector record. parseCmap checked that
+	// the records are within b.
+	lo, hi := int32(0), int32(u32(b, 6))
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		rec := 10 + 11*mid
+		switch v := u24(b, rec); {
+		case cvs < v:
+			hi = mid
+		case cvs > v:
+			lo = mid + 1
+		default:
+			// Sequences in the default UVS table map to the same glyph as r
+			// does on its own, so only the non-default UVS table matters.
+			if g, ok := nonDefaultUVS(b, u32(b, rec+7), cr); ok {
+				return g
+			}
+			return c.glyphIndex(r)
+		}
+	}
+	return c.glyphIndex(r)
+}
+
+// nonDefaultUVS returns the glyph ID that the non-default UVS table at the
+// given offset in the format 14 subtable b maps the code point c to.
+func nonDefaultUVS(b []byte, offset uint32, c uint32) (GlyphID, bool) {
+	if offset == 0 || uint64(offset)+4 > uint64(len(b)) {
+		return 0, false
+	}
+	b = b[offset:]
+	n := u32(b, 0)
+	if uint64(n) > uint64(len(b)-4)/5 {
+		return 0, false
+	}
+	lo, hi := int32(0), int32(n)
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		rec := 4 + 5*mid
+		switch v := u24(b, rec); {
+		case c < v:
+			hi = mid
+		case c > v:
+			lo = mid + 1
+		default:
+			return GlyphID(u16(b, rec+3)), true
+		}
+	}
+	return 0, false
+}
+
+func (b cmapSubtable) glyphIndex(r rune) GlyphID {
+	if b == nil || r < 0 {
+		return 0
+	}
+	switch u16(b, 0) {
+	case 4:
+		return b.glyphIndex4(r)
+	case 6:
+		return b.glyphIndex6(r)
+	case 12:
+		return b.glyphIndex12(r)
+	case 13:
+		return b.glyphIndex13(r)
+	}
+	return 0
+}
+
+func (b cmapSubtable) glyphIndex4(r rune) GlyphID {
+	if r > 0xffff || len(b) < 14 {
+		return 0
+	}
+	c := uint16(r)
+	segCount := int32(u16(b, 6) / 2)
+	endCodes := int32(14)
+	startCodes := endCodes + 2*segCount + 2
+	idDeltas := startCodes + 2*segCount
+	idRangeOffsets := idDeltas + 2*segCount
+	if int(idRangeOffsets+2*segCount) > len(b) {
+		return 0
+	}
+
+	// Binary search for the first segment whose end code is >= c.
+	lo, hi := int32(0), segCount
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if u16(b, endCodes+2*mid) < c {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo == segCount || c < u16(b, startCodes+2*lo) {
+		return 0
+	}
+
+	idDelta := u16(b, idDeltas+2*lo)
+	idRangeOffset := int32(u16(b, idRangeOffsets+2*lo))
+	if idRangeOffset == 0 {
+		return GlyphID(c + idDelta)
+	}
+	// The idRangeOffset is relative to its own location in the table.
+	i := idRangeOffsets + 2*lo + idRangeOffset + 2*int32(c-u16(b, startCodes+2*lo))
+	if int(i+2) > len(b) {
+		return 0
+	}
+	if g := u16(b, i); g != 0 {
+		return GlyphID(g + idDelta)
+	}
+	return 0
+}
+
+func (b cmapSubtable) glyphIndex6(r rune) GlyphID {
+	if len(b) < 10 || r > 0xffff {
+		return 0
+	}
+	i := int32(r) - int32(u16(b, 6))
+	if i < 0 || i >= int32(u16(b, 8)) || int(10+2*i+2) > len(b) {
+		return 0
+	}
+	return GlyphID(u16(b, 10+2*i))
+}
+
+func (b cmapSubtable) glyphIndex12(r rune) GlyphID {
+	if len(b) < 16 {
+		return 0
+	}
+	c := uint32(r)
+	nGroups := u32(b, 12)
+	if uint64(nGroups) > uint64(len(b)-16)/12 {
+		return 0
+	}
+
+	// Binary search for the group containing c.
+	lo, hi := int32(0), int32(nGroups)
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		group := 16 + 12*mid
+		switch {
+		case c < u32(b, group+0):
+			hi = mid
+		case c > u32(b, group+4):
+			lo = mid + 1
+		default:
+			// Glyph IDs are 16 bits, so a larger one cannot name a glyph.
+			if g := u32(b, group+8) + c - u32(b, group+0); g <= 0xffff {
+				return GlyphID(g)
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// glyphIndex13 is like glyphIndex12, except that each group maps all of its
+// code points to the same glyph ID.
+func (b cmapSubtable) glyphIndex13(r rune) GlyphID {
+	if len(b) < 16 {
+		return 0
+	}
+	c := uint32(r)
+	nGroups := u32(b, 12)
+	if uint64(nGroups) > uint64(len(b)-16)/12 {
+		return 0
+	}
+
+	// Binary search for the group containing c.
+	lo, hi := int32(0), int32(nGroups)
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		group := 16 + 12*mid
+		switch {
+		case c < u32(b, group+0):
+			hi = mid
+		case c > u32(b, group+4):
+			lo = mid + 1
+		default:
+			if g := u32(b, group+8); g <= 0xffff {
+				return GlyphID(g)
+			}
+			return 0
+		}
+	}
+	return 0
+}
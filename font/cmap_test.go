@@ -0,0 +1,285 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"errors"
+	"testing"
+)
+
+func be24(i int) []byte {
+	return []byte{uint8(i >> 16), uint8(i >> 8), uint8(i)}
+}
+
+// testCmapRecord is an encoding record and its subtable, for buildCmap.
+type testCmapRecord struct {
+	pid, eid int
+	subtable []byte
+}
+
+// buildCmap returns a cmap table with the given encoding records.
+func buildCmap(records ...testCmapRecord) []byte {
+	header := cat(be16(0), be16(len(records)))
+	var subtables []byte
+	for _, r := range records {
+		offset := 4 + 8*len(records) + len(subtables)
+		header = append(header, cat(be16(r.pid), be16(r.eid), be32(offset))...)
+		subtables = append(subtables, r.subtable...)
+	}
+	return cat(header, subtables)
+}
+
+// buildCmap6 returns a format 6 subtable mapping the runes from firstCode
+// onwards to the given glyph IDs.
+func buildCmap6(firstCode int, glyphIDs ...int) []byte {
+	b := cat(be16(6), be16(0), be16(0), be16(firstCode), be16(len(glyphIDs)))
+	for _, g := range glyphIDs {
+		b = append(b, be16(g)...)
+	}
+	copy(b[2:], be16(len(b)))
+	return b
+}
+
+// testCmapGroup is a range of runes, for buildCmap12.
+type testCmapGroup struct {
+	start, end, glyphID int
+}
+
+// buildCmap12 returns a format 12 or 13 subtable with the given groups.
+func buildCmap12(format int, groups ...testCmapGroup) []byte {
+	b := cat(be16(format), be16(0), be32(0), be32(0), be32(len(groups)))
+	for _, g := range groups {
+		b = append(b, cat(be32(g.start), be32(g.end), be32(g.glyphID))...)
+	}
+	copy(b[4:], be32(len(b)))
+	return b
+}
+
+// testUVS is a variation selector's records, for buildCmap14.
+type testUVS struct {
+	vs int
+	// defaults are ranges of [start, start+additionalCount] runes.
+	defaults [][2]int
+	// nonDefaults are pairs of runes and glyph IDs.
+	nonDefaults [][2]int
+}
+
+// buildCmap14 returns a format 14 subtable with the given variation
+// selectors, which must be in increasing order.
+func buildCmap14(selectors ...testUVS) []byte {
+	header := cat(be16(14), be32(0), be32(len(selectors)))
+	var tables []byte
+	for _, s := range selectors {
+		offset := func(n int) int {
+			if n == 0 {
+				return 0
+			}
+			return 10 + 11*len(selectors) + len(tables)
+		}
+		defaultOffset := offset(len(s.defaults))
+		if len(s.defaults) != 0 {
+			tables = append(tables, be32(len(s.defaults))...)
+			for _, d := range s.defaults {
+				tables = append(tables, cat(be24(d[0]), []byte{uint8(d[1])})...)
+			}
+		}
+		nonDefaultOffset := offset(len(s.nonDefaults))
+		if len(s.nonDefaults) != 0 {
+			tables = append(tables, be32(len(s.nonDefaults))...)
+			for _, d := range s.nonDefaults {
+				tables = append(tables, cat(be24(d[0]), be16(d[1]))...)
+			}
+		}
+		header = append(header, cat(be24(s.vs), be32(defaultOffset), be32(nonDefaultOffset))...)
+	}
+	b := cat(header, tables)
+	copy(b[2:], be32(len(b)))
+	return b
+}
+
+func TestCmapFormats(t *testing.T) {
+	testCases := []struct {
+		desc string
+		cmap []byte
+		want map[rune]GlyphID
+	}{{
+		desc: "format 4",
+		cmap: buildCmap4(map[rune]GlyphID{'a': 1, 'b': 2}),
+		want: map[rune]GlyphID{'a': 1, 'b': 2, 'c': 0, 0x1f600: 0},
+	}, {
+		desc: "format 6",
+		cmap: buildCmap(testCmapRecord{platformMicrosoft, encodingMicrosoftBMP, buildCmap6('a', 3, 0, 1)}),
+		want: map[rune]GlyphID{'`': 0, 'a': 3, 'b': 0, 'c': 1, 'd': 0, 0x1f600: 0},
+	}, {
+		desc: "format 12",
+		cmap: buildCmap(testCmapRecord{platformMicrosoft, encodingMicrosoftUCS4, buildCmap12(12,
+			testCmapGroup{'a', 'c', 1},
+			testCmapGroup{0x1f600, 0x1f601, 3},
+		)}),
+		want: map[rune]GlyphID{'a': 1, 'b': 2, 'c': 3, 'd': 0, 0x1f600: 3, 0x1f601: 4, 0x1f602: 0},
+	}, {
+		desc: "format 13",
+		cmap: buildCmap(testCmapRecord{platformUnicode, encodingUnicodeFullLastResort, buildCmap12(13,
+			testCmapGroup{0, 0x7f, 1},
+			testCmapGroup{0x80, 0x10ffff, 2},
+		)}),
+		want: map[rune]GlyphID{0: 1, 'a': 1, 0xe9: 2, 0x1f600: 2, 0x110000: 0},
+	}, {
+		desc: "format 12 glyph IDs above 0xffff",
+		cmap: buildCmap(testCmapRecord{platformMicrosoft, encodingMicrosoftUCS4, buildCmap12(12,
+			testCmapGroup{'a', 'c', 0xfffe},
+		)}),
+		want: map[rune]GlyphID{'a': 0xfffe, 'b': 0xffff, 'c': 0},
+	}, {
+		desc: "format 13 glyph IDs above 0xffff",
+		cmap: buildCmap(testCmapRecord{platformUnicode, encodingUnicodeFullLastResort, buildCmap12(13,
+			testCmapGroup{'a', 'a', 1},
+			testCmapGroup{'b', 'b', 0x10001},
+		)}),
+		want: map[rune]GlyphID{'a': 1, 'b': 0},
+	}, {
+		desc: "full repertoire preferred over BMP",
+		cmap: buildCmap(
+			testCmapRecord{platformUnicode, encodingUnicodeBMP, buildCmap6('a', 1)},
+			testCmapRecord{platformUnicode, encodingUnicodeFull, buildCmap12(12, testCmapGroup{'a', 'a', 2})},
+			testCmapRecord{platformMicrosoft, encodingMicrosoftBMP, buildCmap6('a', 3)},
+		),
+		want: map[rune]GlyphID{'a': 2},
+	}, {
+		desc: "unsupported format ignored",
+		cmap: buildCmap(
+			testCmapRecord{platformMicrosoft, encodingMicrosoftBMP, buildCmap6('a', 1)},
+			testCmapRecord{platformMicrosoft, encodingMicrosoftUCS4, cat(be16(8), make([]byte, 8))},
+		),
+		want: map[rune]GlyphID{'a': 1},
+	}, {
+		desc: "symbol",
+		cmap: buildCmap(testCmapRecord{platformMicrosoft, encodingMicrosoftSymbol, buildCmap6(0xf061, 1, 2)}),
+		want: map[rune]GlyphID{'a': 1, 'b': 2, 'c': 0, 0xf061: 1, 0xf062: 2, 0x161: 0},
+	}, {
+		desc: "Unicode preferred over symbol",
+		cmap: buildCmap(
+			testCmapRecord{platformMicrosoft, encodingMicrosoftSymbol, buildCmap6(0xf061, 1)},
+			testCmapRecord{platformUnicode, encodingUnicodeFullLastResort, buildCmap6('a', 2)},
+		),
+		want: map[rune]GlyphID{'a': 2, 0xf061: 0},
+	}, {
+		desc: "wrong variations format ignored",
+		cmap: buildCmap(
+			testCmapRecord{platformUnicode, encodingUnicodeVariations, buildCmap6('a', 1)},
+			testCmapRecord{platformMicrosoft, encodingMicrosoftBMP, buildCmap6('a', 1)},
+		),
+		want: map[rune]GlyphID{'a': 1},
+	}}
+
+	for _, tc := range testCases {
+		c, err := parseCmap(tc.cmap)
+		if err != nil {
+			t.Errorf("%s: parseCmap: %v", tc.desc, err)
+			continue
+		}
+		for r, want := range tc.want {
+			if got := c.glyphIndex(r); got != want {
+				t.Errorf("%s: r=%U: got %d, want %d", tc.desc, r, got, want)
+			}
+		}
+	}
+}
+
+func TestGlyphIndexVariant(t *testing.T) {
+	m := buildTables(
+		[][]byte{nil, nil, nil, nil, nil},
+		[]int{0},
+		nil,
+	)
+	m["cmap"] = buildCmap(
+		testCmapRecord{platformUnicode, encodingUnicodeFull, buildCmap12(12,
+			testCmapGroup{0x2764, 0x2764, 1},
+			testCmapGroup{0x845b, 0x845b, 2},
+		)},
+		testCmapRecord{platformUnicode, encodingUnicodeVariations, buildCmap14(
+			testUVS{vs: 0xfe0e, defaults: [][2]int{{0x2764, 0}}},
+			testUVS{vs: 0xfe0f, nonDefaults: [][2]int{{0x2764, 3}}},
+			testUVS{vs: 0xe0101, defaults: [][2]int{{0x8400, 0x5b}}, nonDefaults: [][2]int{{0x845c, 4}}},
+		)},
+	)
+	f, err := Parse(buildFont(m))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	testCases := []struct {
+		r, vs rune
+		want  GlyphID
+	}{
+		{0x2764, 0, 1},
+		{0x2764, 0xfe0e, 1},
+		{0x2764, 0xfe0f, 3},
+		{0x2764, 0xe0101, 1},
+		{0x845b, 0xe0101, 2},
+		{0x845c, 0xe0101, 4},
+		{0x845b, 0xfe0f, 2},
+		{'a', 0xfe0f, 0},
+	}
+	for _, tc := range testCases {
+		if got := f.GlyphIndexVariant(tc.r, tc.vs); got != tc.want {
+			t.Errorf("r=%U, vs=%U: got %d, want %d", tc.r, tc.vs, got, tc.want)
+		}
+	}
+}
+
+func TestCmapErrors(t *testing.T) {
+	testCases := []struct {
+		desc string
+		cmap []byte
+	}{{
+		desc: "subtable offset out of bounds",
+		cmap: cat(be16(0), be16(1), be16(platformMicrosoft), be16(encodingMicrosoftBMP), be32(100)),
+	}, {
+		desc: "subtable length out of bounds",
+		cmap: buildCmap(testCmapRecord{platformMicrosoft, encodingMicrosoftUCS4,
+			cat(buildCmap12(12)[:4], be32(1000), make([]byte, 8))}),
+	}, {
+		desc: "variation selector records overflow",
+		cmap: buildCmap(testCmapRecord{platformUnicode, encodingUnicodeVariations,
+			cat(be16(14), be32(10+11), be32(2), be24(0xfe0f), be32(0), be32(0))}),
+	}, {
+		desc: "format 14 length too short",
+		cmap: buildCmap(testCmapRecord{platformUnicode, encodingUnicodeVariations,
+			cat(be16(14), be32(6), be32(0))}),
+	}, {
+		desc: "format 4 length too short",
+		cmap: buildCmap(testCmapRecord{platformMicrosoft, encodingMicrosoftBMP,
+			cat(be16(4), be16(0), make([]byte, 12))}),
+	}, {
+		desc: "format 6 length too short",
+		cmap: buildCmap(testCmapRecord{platformMicrosoft, encodingMicrosoftBMP,
+			cat(be16(6), be16(8), make([]byte, 6))}),
+	}, {
+		desc: "format 12 length too short",
+		cmap: buildCmap(testCmapRecord{platformMicrosoft, encodingMicrosoftUCS4,
+			cat(be16(12), be16(0), be32(12), make([]byte, 8))}),
+	}, {
+		desc: "format 13 length too short",
+		cmap: buildCmap(testCmapRecord{platformUnicode, encodingUnicodeFullLastResort,
+			cat(be16(13), be16(0), be32(0), make([]byte, 8))}),
+	}}
+	for _, tc := range testCases {
+		_, err := parseCmap(tc.cmap)
+		if !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an error matching ErrInvalidFont", tc.desc, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"fmt"
+)
+
+// collectionTag is the first four bytes of a font collection file, "ttcf".
+const collectionTag = 0x74746366
+
+// Collection is a parsed font collection, such as a .ttc file, which holds
+// several fonts whose tables may be shared, such as the glyphs of the faces
+// of a CJK font family that differ only in their cmap tables.
+type Collection struct {
+	data []byte
+	// offsets are the offsets of each font's offset table.
+	offsets []uint32
+}
+
+// ParseCollection parses a font collection from its encoded form. For
+// convenience, it also accepts a single font, as a collection of one font.
+// Errors for malformed collections match ErrInvalidFont.
+//
+// The returned Collection retains a reference to b, which should not be
+// modified. Like Parse, ParseCollection also accepts web fonts, including
+// WOFF2 font collections, which it decodes to a new buffer.
+func ParseCollection(b []byte) (*Collection, error) {
+	b, err := decodeWebFont(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 4 {
+		return nil, fmt.Errorf("%w: %d bytes is too short for a font header", ErrInvalidFont, len(b))
+	}
+	if u32(b, 0) != collectionTag {
+		return &Collection{data: b, offsets: []uint32{0}}, nil
+	}
+	if len(b) < 12 {
+		return nil, fmt.Errorf("%w: %d bytes is too short for a font collection header", ErrInvalidFont, len(b))
+	}
+	if major := u16(b, 4); major != 1 && major != 2 {
+		return nil, ErrUnsupportedFormat{Tag: collectionTag, Format: uint32(major)}
+	}
+	n := u32(b, 8)
+	if n == 0 {
+		return nil, fmt.Errorf("%w: font collection has no fonts", ErrInvalidFont)
+	}
+	if uint64(len(b)) < 12+4*uint64(n) {
+		return nil, fmt.Errorf("%w: font collection with %d fonts is truncated", ErrInvalidFont, n)
+	}
+	c := &Collection{data: b, offsets: make([]uint32, n)}
+	for i := range c.offsets {
+		c.offsets[i] = u32(b, int32(12+4*i))
+	}
+	return c, nil
+}
+
+// NumFonts returns the number of fonts, or faces, in the collection.
+func (c *Collection) NumFonts() int {
+	return len(c.offsets)
+}
+
+// Font parses and returns the i'th font in the collection. Its tables refer
+// to the collection's data, so that tables shared between fonts are not
+// copied.
+func (c *Collection) Font(i int) (*Font, error) {
+	if i < 0 || len(c.offsets) <= i {
+		return nil, fmt.Errorf("font-go: font index %d is out of range for a collection of %d fonts", i, len(c.offsets))
+	}
+	return parse(c.data, c.offsets[i])
+}
@@ -0,0 +1,141 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"testing"
+)
+
+// buildCollection returns a version 1 font collection of the fonts. Tables
+// with the same contents are stored once, and shared between the fonts.
+func buildCollection(fonts ...map[string][]byte) []byte {
+	dirLen := func(f map[string][]byte) int { return 12 + 16*len(f) }
+	offset := 12 + 4*len(fonts)
+	header := cat([]byte("ttcf"), be16(1), be16(0), be32(len(fonts)))
+	for _, f := range fonts {
+		header = append(header, be32(offset)...)
+		offset += dirLen(f)
+	}
+
+	var dirs, data []byte
+	for _, f := range fonts {
+		tags := make([]string, 0, len(f))
+		for tag := range f {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		dirs = append(dirs, cat(be32(0x00010000), be16(len(tags)), be16(0), be16(0), be16(0))...)
+		for _, tag := range tags {
+			t := f[tag]
+			i := bytes.Index(data, t)
+			if i < 0 || i%4 != 0 {
+				i = len(data)
+				data = append(data, t...)
+				for len(data)%4 != 0 {
+					data = append(data, 0)
+				}
+			}
+			dirs = append(dirs, tag...)
+			dirs = append(dirs, cat(be32(0), be32(offset+i), be32(len(t)))...)
+		}
+	}
+	return cat(header, dirs, data)
+}
+
+func TestParseCollection(t *testing.T) {
+	a := testTables()
+	b := testTables()
+	b["cmap"] = buildCmap4(map[rune]GlyphID{'a': 2, 'b': 1})
+	c, err := ParseCollection(buildCollection(a, b))
+	if err != nil {
+		t.Fatalf("ParseCollection: %v", err)
+	}
+	if got, want := c.NumFonts(), 2; got != want {
+		t.Fatalf("NumFonts: got %d, want %d", got, want)
+	}
+	var fonts []*Font
+	for i, want := range []GlyphID{1, 2} {
+		f, err := c.Font(i)
+		if err != nil {
+			t.Fatalf("Font(%d): %v", i, err)
+		}
+		if got := f.GlyphIndex('a'); got != want {
+			t.Errorf("Font(%d): GlyphIndex('a'): got %d, want %d", i, got, want)
+		}
+		fonts = append(fonts, f)
+	}
+	if &fonts[0].glyf[0] != &fonts[1].glyf[0] {
+		t.Errorf("the fonts' glyf tables are not shared")
+	}
+	for _, i := range []int{-1, 2} {
+		if _, err := c.Font(i); err == nil {
+			t.Errorf("Font(%d): got nil error, want non-nil", i)
+		}
+	}
+
+	// A single font is a collection of one font.
+	c, err = ParseCollection(buildFont(a))
+	if err != nil {
+		t.Fatalf("ParseCollection: single font: %v", err)
+	}
+	if n := c.NumFonts(); n != 1 {
+		t.Fatalf("single font: NumFonts: got %d, want 1", n)
+	}
+	if _, err := c.Font(0); err != nil {
+		t.Errorf("single font: Font(0): %v", err)
+	}
+
+	// Parse does not accept collections.
+	if _, err := Parse(buildCollection(a)); !errors.Is(err, ErrInvalidFont) {
+		t.Errorf("Parse: got %v, want an error matching ErrInvalidFont", err)
+	}
+}
+
+func TestParseCollectionErrors(t *testing.T) {
+	valid := buildCollection(testTables(), testTables())
+	testCases := []struct {
+		desc string
+		data []byte
+	}{
+		{"too short", []byte("ttc")},
+		{"truncated header", []byte("ttcf\x00\x01")},
+		{"unsupported version", cat([]byte("ttcf"), be16(3), be16(0), be32(1), be32(16))},
+		{"no fonts", cat([]byte("ttcf"), be16(1), be16(0), be32(0))},
+		{"truncated offsets", cat([]byte("ttcf"), be16(1), be16(0), be32(2), be32(20))},
+	}
+	for _, tc := range testCases {
+		if _, err := ParseCollection(tc.data); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an error matching ErrInvalidFont", tc.desc, err)
+		}
+	}
+
+	// Fonts are parsed lazily, so that a collection whose second font is
+	// out of bounds still has a valid first font.
+	truncated := append([]byte(nil), valid...)
+	copy(truncated[16:20], be32(len(valid)))
+	c, err := ParseCollection(truncated)
+	if err != nil {
+		t.Fatalf("ParseCollection: %v", err)
+	}
+	if _, err := c.Font(0); err != nil {
+		t.Errorf("Font(0): %v", err)
+	}
+	if _, err := c.Font(1); !errors.Is(err, ErrInvalidFont) {
+		t.Errorf("Font(1): got %v, want an error matching ErrInvalidFont", err)
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/google/font-go/raster"
+	"golang.org/x/image/math/f32"
+)
+
+const (
+	colrLen            = 14
+	baseGlyphRecordLen = 6
+	layerRecordLen     = 4
+)
+
+// ForegroundPaletteIndex is the palette index of color layers that are drawn
+// in the text's foreground color, rather than in a palette color.
+const ForegroundPaletteIndex = 0xffff
+
+// colr is the color table. Its version 0 base glyph records map color glyphs
+// to ranges of its layer records, and its version 1 base glyph paint records
+// map color glyphs to paint graphs.
+type colr struct {
+	baseGlyphs  otData
+	nBaseGlyphs int
+	layers      otData
+	nLayers     int
+
+	// data is the whole of a version 1 table. Its lists, and the paints that
+	// they and other paints refer to, are at offsets in data.
+	data          otData
+	baseGlyphList int
+	layerList     int
+	clipList      int
+	nBasePaints   int
+	nLayerPaints  int
+	nClips        int
+	varIndexMap   deltaSetIndexMap
+	varStore      itemVariationStore
+}
+
+// parseCOLR parses the COLR table b. A version 1 table's header starts with
+// that of version 0, whose layers are used for its version 0 color glyphs.
+// Its paints are checked when they are drawn.
+func parseCOLR(b []byte) (*colr, error) {
+	if len(b) < colrLen {
+		return nil, ErrTableTooShort{Tag: MakeTag("COLR"), Length: len(b), MinLength: colrLen}
+	}
+	if v := u16(b, 0); v > 1 {
+		return nil, ErrUnsupportedFormat{Tag: MakeTag("COLR"), Format: uint32(v)}
+	}
+	c := &colr{
+		nBaseGlyphs: int(u16(b, 2)),
+		nLayers:     int(u16(b, 12)),
+	}
+	for _, x := range []struct {
+		dst  *otData
+		i    int32
+		size int
+		name string
+	}{
+		{&c.baseGlyphs, 4, c.nBaseGlyphs * baseGlyphRecordLen, "base glyph records"},
+		{&c.layers, 8, c.nLayers * layerRecordLen, "layer records"},
+	} {
+		offset := uint64(u32(b, x.i))
+		if offset+uint64(x.size) > uint64(len(b)) {
+			return nil, ErrInvalidTable{Tag: MakeTag("COLR"), Reason: fmt.Sprintf("%s are out of bounds", x.name)}
+		}
+		*x.dst = b[offset : offset+uint64(x.size)]
+	}
+	if u16(b, 0) == 0 {
+		return c, nil
+	}
+
+	if len(b) < colrV1Len {
+		return nil, ErrTableTooShort{Tag: MakeTag("COLR"), Length: len(b), MinLength: colrV1Len}
+	}
+	c.data = b
+	for _, x := range []struct {
+		dst     *int
+		n       *int
+		i       int32
+		countAt int
+		headLen int
+		size    int
+		name    string
+	}{
+		{&c.baseGlyphList, &c.nBasePaints, 14, 0, 4, basePaintRecordLen, "base glyph list"},
+		{&c.layerList, &c.nLayerPaints, 18, 0, 4, 4, "layer list"},
+		{&c.clipList, &c.nClips, 22, 1, 5, clipRecordLen, "clip list"},
+	} {
+		offset := uint64(u32(b, x.i))
+		if offset == 0 {
+			continue
+		}
+		n := uint64(c.data.u32(int(offset) + x.countAt))
+		if offset+uint64(x.headLen)+n*uint64(x.size) > uint64(len(b)) {
+			return nil, ErrInvalidTable{Tag: MakeTag("COLR"), Reason: fmt.Sprintf("%s is out of bounds", x.name)}
+		}
+		*x.dst, *x.n = int(offset), int(n)
+	}
+	if c.clipList != 0 && b[c.clipList] != 1 {
+		return nil, ErrInvalidTable{Tag: MakeTag("COLR"), Reason: fmt.Sprintf("clip list format %d is not supported", b[c.clipList])}
+	}
+	for _, x := range []struct {
+		dst  *otData
+		i    int
+		name string
+	}{
+		{(*otData)(&c.varIndexMap), 26, "variation index map"},
+		{(*otData)(&c.varStore), 30, "item variation store"},
+	} {
+		*x.dst = c.data.offset32(x.i)
+		if *x.dst == nil && u32(b, int32(x.i)) != 0 {
+			return nil, ErrInvalidTable{Tag: MakeTag("COLR"), Reason: fmt.Sprintf("%s offset is out of bounds", x.name)}
+		}
+	}
+	return c, nil
+}
+
+// layerRange returns the index and number of the color glyph's layer
+// records, or zero if it is not a color glyph. The base glyph records are
+// sorted by glyph ID.
+func (c *colr) layerRange(glyphID GlyphID) (first, n int) {
+	lo, hi := 0, c.nBaseGlyphs
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		id := GlyphID(c.baseGlyphs.u16(mid * baseGlyphRecordLen))
+		switch {
+		case glyphID < id:
+			hi = mid
+		case glyphID > id:
+			lo = mid + 1
+		default:
+			i := mid*baseGlyphRecordLen + 2
+			return int(c.baseGlyphs.u16(i)), int(c.baseGlyphs.u16(i + 2))
+		}
+	}
+	return 0, 0
+}
+
+// ColorLayer is a layer of a color glyph: the outline of another glyph,
+// filled with a color.
+type ColorLayer struct {
+	// GlyphID is the glyph whose outline is the layer's shape.
+	GlyphID GlyphID
+	// PaletteIndex is the index of the layer's color in the palette, or
+	// ForegroundPaletteIndex.
+	PaletteIndex int
+}
+
+// ColorLayers returns the layers of a version 0 color glyph, from its COLR
+// table, from bottom to top. It returns nil for other glyphs, including
+// version 1 color glyphs, whose paint graphs have no such layers.
+func (f *Font) ColorLayers(glyphID GlyphID) ([]ColorLayer, error) {
+	if f.colr == nil {
+		return nil, nil
+	}
+	first, n := f.colr.layerRange(glyphID)
+	if n == 0 {
+		return nil, nil
+	}
+	if first+n > f.colr.nLayers {
+		return nil, ErrInvalidGlyph{fmt.Sprintf("glyph ID %d's color layers are out of range", glyphID)}
+	}
+	layers := make([]ColorLayer, n)
+	for i := range layers {
+		j := (first + i) * layerRecordLen
+		layers[i] = ColorLayer{
+			GlyphID:      GlyphID(f.colr.layers.u16(j)),
+			PaletteIndex: int(f.colr.layers.u16(j + 2)),
+		}
+	}
+	return layers, nil
+}
+
+// ColorOptions are optional arguments to ColorGlyph.
+type ColorOptions struct {
+	// Palette is the index of the palette, from 0 to NumPalettes()-1. Out of
+	// range values mean palette 0, the default.
+	Palette int
+	// Foreground is the color of layers whose palette index is
+	// ForegroundPaletteIndex, such as the text's color. A nil value means
+	// opaque black.
+	Foreground color.Color
+}
+
+// ColorGlyph rasterizes a color glyph at the given scale, such as from Scale.
+// The opts may be nil.
+//
+// A version 1 color glyph's paint graph is drawn, with its gradients,
+// transforms and composite modes, and clipped to the glyph's clip box, if it
+// has one. Otherwise, a version 0 color glyph's layers are drawn in their
+// colors, from bottom to top. Version 1 paint graphs take precedence, as
+// fonts can have both for the same glyph.
+//
+// The image's bounds are in pixels relative to the glyph's origin, with y
+// increasing downwards, so that drawing it at a pen position p covers its
+// bounds translated by p. Like every *image.RGBA, its colors are
+// alpha-premultiplied.
+//
+// It returns a nil image and a nil error if the glyph is not a color glyph.
+func (f *Font) ColorGlyph(glyphID GlyphID, scale float32, opts *ColorOptions) (*image.RGBA, error) {
+	palette, fg := 0, color.Color(color.Black)
+	if opts != nil {
+		if 0 <= opts.Palette && opts.Palette < f.cpal.nPalettes {
+			palette = opts.Palette
+		}
+		if opts.Foreground != nil {
+			fg = opts.Foreground
+		}
+	}
+	if f.colr != nil {
+		if off, ok := f.colr.basePaint(glyphID); ok {
+			return f.drawPaintGraph(glyphID, off, scale, palette, fg)
+		}
+	}
+	layers, err := f.ColorLayers(glyphID)
+	if layers == nil || err != nil {
+		return nil, err
+	}
+
+	// The image covers the union of the layers' bounding boxes.
+	glyphs := make([]Glyph, len(layers))
+	s := float64(scale)
+	var r image.Rectangle
+	for i, l := range layers {
+		if l.PaletteIndex != ForegroundPaletteIndex && (l.PaletteIndex >= f.cpal.nEntries || f.cpal.nPalettes == 0) {
+			return nil, ErrInvalidGlyph{fmt.Sprintf("palette index %d is out of range", l.PaletteIndex)}
+		}
+		g, err := f.Glyph(l.GlyphID)
+		if err != nil {
+			return nil, err
+		}
+		glyphs[i] = g
+		if g == nil {
+			continue
+		}
+		xMin, yMin, xMax, yMax := g.bounds()
+		r = r.Union(image.Rect(
+			int(math.Floor(+s*float64(xMin))), int(math.Floor(-s*float64(yMax))),
+			int(math.Ceil(+s*float64(xMax))), int(math.Ceil(-s*float64(yMin))),
+		))
+	}
+	dst := image.NewRGBA(r)
+	if r.Empty() {
+		return dst, nil
+	}
+
+	z := raster.New(r.Dx(), r.Dy(), scale*float32(f.head.unitsPerEm()))
+	mask := image.NewAlpha(z.Bounds())
+	transform := f32.Aff3{
+		+scale, 0, -float32(r.Min.X),
+		0, -scale, -float32(r.Min.Y),
+	}
+	for i, l := range layers {
+		if glyphs[i] == nil {
+			continue
+		}
+		z.Reset()
+		if err := f.Outline(z, glyphs[i], transform); err != nil {
+			return nil, err
+		}
+		z.Accumulate(mask)
+		c := fg
+		if l.PaletteIndex != ForegroundPaletteIndex {
+			c = f.cpal.color(palette, l.PaletteIndex)
+		}
+		draw.DrawMask(dst, r, image.NewUniform(c), image.Point{}, mask, image.Point{}, draw.Over)
+	}
+	return dst, nil
+}
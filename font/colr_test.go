@@ -0,0 +1,216 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+type testBaseGlyph struct {
+	glyphID GlyphID
+	layers  []ColorLayer
+}
+
+// buildCOLR returns a version 0 COLR table with the given base glyphs, which
+// must be sorted by glyph ID.
+func buildCOLR(baseGlyphs ...testBaseGlyph) []byte {
+	var records, layers []byte
+	n := 0
+	for _, g := range baseGlyphs {
+		records = append(records, cat(be16(int(g.glyphID)), be16(n), be16(len(g.layers)))...)
+		for _, l := range g.layers {
+			layers = append(layers, cat(be16(int(l.GlyphID)), be16(l.PaletteIndex))...)
+		}
+		n += len(g.layers)
+	}
+	return cat(be16(0), be16(len(baseGlyphs)), be32(colrLen), be32(colrLen+len(records)), be16(n),
+		records, layers)
+}
+
+// testColorTables returns the tables of testTables, with a color glyph 3 whose
+// layers are the square in the palettes' first color, and the diamond in the
+// foreground color.
+func testColorTables() map[string][]byte {
+	tables := testTables()
+	tables["COLR"] = buildCOLR(
+		testBaseGlyph{1, []ColorLayer{{1, 1}}},
+		testBaseGlyph{3, []ColorLayer{{1, 0}, {2, ForegroundPaletteIndex}}},
+	)
+	tables["CPAL"] = buildCPAL(testPalettes...)
+	return tables
+}
+
+func TestColorLayers(t *testing.T) {
+	f, err := Parse(buildFont(testColorTables()))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	testCases := []struct {
+		glyphID GlyphID
+		want    []ColorLayer
+	}{
+		{0, nil},
+		{1, []ColorLayer{{1, 1}}},
+		{2, nil},
+		{3, []ColorLayer{{1, 0}, {2, ForegroundPaletteIndex}}},
+	}
+	for _, tc := range testCases {
+		got, err := f.ColorLayers(tc.glyphID)
+		if err != nil {
+			t.Errorf("glyph %d: %v", tc.glyphID, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("glyph %d: got %v, want %v", tc.glyphID, got, tc.want)
+		}
+	}
+	if got, err := testFont(t).ColorLayers(3); got != nil || err != nil {
+		t.Errorf("without a COLR table: got %v, %v, want nil, nil", got, err)
+	}
+}
+
+func TestColorGlyph(t *testing.T) {
+	f, err := Parse(buildFont(testColorTables()))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	// At a scale of 0.25, the square and diamond are from (25, -100) to
+	// (125, 0) in pixels. The pixel at (26, -99) is only in the square, and the
+	// pixel at (75, -51) is in both.
+	corner, center := image.Pt(26, -99), image.Pt(75, -51)
+	testCases := []struct {
+		desc                   string
+		opts                   *ColorOptions
+		wantCorner, wantCenter color.RGBA
+	}{
+		{
+			"default", nil,
+			color.RGBA{0xff, 0x00, 0x00, 0xff}, color.RGBA{0x00, 0x00, 0x00, 0xff},
+		},
+		{
+			"palette 1", &ColorOptions{Palette: 1},
+			color.RGBA{0x00, 0xff, 0x00, 0xff}, color.RGBA{0x00, 0x00, 0x00, 0xff},
+		},
+		{
+			"out of range palette", &ColorOptions{Palette: 2},
+			color.RGBA{0xff, 0x00, 0x00, 0xff}, color.RGBA{0x00, 0x00, 0x00, 0xff},
+		},
+		{
+			"foreground", &ColorOptions{Foreground: color.NRGBA{0x00, 0x00, 0xff, 0x80}},
+			color.RGBA{0xff, 0x00, 0x00, 0xff}, color.RGBA{0x7f, 0x00, 0x80, 0xff},
+		},
+	}
+	for _, tc := range testCases {
+		m, err := f.ColorGlyph(3, 0.25, tc.opts)
+		if err != nil {
+			t.Errorf("%s: %v", tc.desc, err)
+			continue
+		}
+		if got, want := m.Bounds(), image.Rect(25, -100, 125, 0); got != want {
+			t.Errorf("%s: bounds: got %v, want %v", tc.desc, got, want)
+		}
+		if got := m.RGBAAt(corner.X, corner.Y); !closeRGBA(got, tc.wantCorner) {
+			t.Errorf("%s: corner: got %v, want %v", tc.desc, got, tc.wantCorner)
+		}
+		if got := m.RGBAAt(center.X, center.Y); !closeRGBA(got, tc.wantCenter) {
+			t.Errorf("%s: center: got %v, want %v", tc.desc, got, tc.wantCenter)
+		}
+		if got := m.RGBAAt(0, 0); got != (color.RGBA{}) {
+			t.Errorf("%s: outside: got %v, want transparent", tc.desc, got)
+		}
+	}
+
+	// The second palette color is half transparent blue.
+	m, err := f.ColorGlyph(1, 0.25, nil)
+	if err != nil {
+		t.Fatalf("ColorGlyph(1): %v", err)
+	}
+	if got, want := m.RGBAAt(corner.X, corner.Y), (color.RGBA{0x00, 0x00, 0x80, 0x80}); !closeRGBA(got, want) {
+		t.Errorf("ColorGlyph(1): got %v, want %v", got, want)
+	}
+
+	if m, err := f.ColorGlyph(2, 0.25, nil); m != nil || err != nil {
+		t.Errorf("ColorGlyph(2): got %v, %v, want nil, nil", m, err)
+	}
+}
+
+// closeRGBA returns whether each of a and b's channels differ by at most one,
+// allowing for rounding when blending.
+func closeRGBA(a, b color.RGBA) bool {
+	close := func(x, y uint8) bool { return x-y <= 1 || y-x <= 1 }
+	return close(a.R, b.R) && close(a.G, b.G) && close(a.B, b.B) && close(a.A, b.A)
+}
+
+func TestColorGlyphInvalid(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		layers []ColorLayer
+		cpal   bool
+	}{
+		{"palette index out of range", []ColorLayer{{1, 2}}, true},
+		{"no CPAL table", []ColorLayer{{1, 0}}, false},
+		{"glyph ID out of range", []ColorLayer{{4, 0}}, true},
+	}
+	for _, tc := range testCases {
+		tables := testTables()
+		tables["COLR"] = buildCOLR(testBaseGlyph{3, tc.layers})
+		if tc.cpal {
+			tables["CPAL"] = buildCPAL(testPalettes...)
+		}
+		f, err := Parse(buildFont(tables))
+		if err != nil {
+			t.Fatalf("%s: Parse: %v", tc.desc, err)
+		}
+		if _, err := f.ColorGlyph(3, 0.25, nil); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an ErrInvalidFont", tc.desc, err)
+		}
+	}
+
+	// The base glyph's layers are out of range.
+	tables := testTables()
+	b := buildCOLR(testBaseGlyph{3, []ColorLayer{{1, 0}}})
+	tables["COLR"] = cat(b[:colrLen+4], be16(2), b[colrLen+6:])
+	f, err := Parse(buildFont(tables))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if _, err := f.ColorLayers(3); !errors.Is(err, ErrInvalidFont) {
+		t.Errorf("layers out of range: got %v, want an ErrInvalidFont", err)
+	}
+}
+
+func TestParseCOLRErrors(t *testing.T) {
+	b := buildCOLR(testBaseGlyph{3, []ColorLayer{{1, 0}, {2, 1}}})
+	testCases := []struct {
+		desc string
+		b    []byte
+	}{
+		{"short", b[:colrLen-1]},
+		{"version", cat(be16(2), b[2:])},
+		{"truncated base glyphs", cat(b[:2], be16(5), b[4:])},
+		{"truncated layers", b[:len(b)-1]},
+	}
+	for _, tc := range testCases {
+		tables := testTables()
+		tables["COLR"] = tc.b
+		if _, err := Parse(buildFont(tables)); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an ErrInvalidFont", tc.desc, err)
+		}
+	}
+}
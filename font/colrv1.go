@@ -0,0 +1,720 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/google/font-go/raster"
+	"golang.org/x/image/math/f32"
+)
+
+// This file implements COLR version 1 color glyphs, whose paint graphs are
+// directed acyclic graphs of Paint tables. Leaf paints fill with a solid color
+// or a gradient, and the other paints clip their children to a glyph's
+// outline, transform them, or composite them.
+//
+// The graph is drawn into layers of premultiplied float32 colors, one per
+// pixel, with the rasterizer's coverage masks for clipping.
+
+const (
+	colrV1Len          = 34
+	basePaintRecordLen = 6
+	clipRecordLen      = 7
+)
+
+// Paint formats. Each odd format from 3 to 31 is the variable version of the
+// format before it, whose values have variation deltas.
+const (
+	paintColrLayers               = 1
+	paintSolid                    = 2
+	paintLinearGradient           = 4
+	paintRadialGradient           = 6
+	paintSweepGradient            = 8
+	paintGlyph                    = 10
+	paintColrGlyph                = 11
+	paintTransform                = 12
+	paintTranslate                = 14
+	paintScale                    = 16
+	paintScaleAroundCenter        = 18
+	paintScaleUniform             = 20
+	paintScaleUniformAroundCenter = 22
+	paintRotate                   = 24
+	paintRotateAroundCenter       = 26
+	paintSkew                     = 28
+	paintSkewAroundCenter         = 30
+	paintComposite                = 32
+)
+
+const (
+	// maxPaintDepth limits the nesting of paint graphs, which can otherwise
+	// be cyclic in malformed fonts.
+	maxPaintDepth = 64
+	// maxPaints limits the number of paints drawn for a glyph. Paints can be
+	// reused, so a small graph can otherwise draw exponentially many paints.
+	maxPaints = 1 << 11
+	// maxPaintEms limits how far from a glyph's origin paints are drawn, in
+	// ems, so that malformed clip boxes and transforms cannot make huge
+	// images.
+	maxPaintEms = 2
+)
+
+// noVarIndexBase is the varIndexBase of values that do not vary.
+const noVarIndexBase = 0xffffffff
+
+// paint is a decoded Paint table, with its variation deltas applied. Paints
+// are at offsets in the COLR table, and so are their child paints and color
+// lines.
+type paint struct {
+	// format is the paint's format. Variable formats are decoded as their
+	// non-variable formats, except that varColorLine is set for gradients.
+	format uint8
+	// child is the paint that a PaintGlyph clips, or that a transform
+	// transforms, or a PaintComposite's source. backdrop is a
+	// PaintComposite's backdrop.
+	child, backdrop int
+	// glyphID is the glyph of a PaintGlyph or a PaintColrGlyph.
+	glyphID GlyphID
+	// firstLayer and nLayers are a PaintColrLayers' range of the layer list.
+	firstLayer, nLayers int
+	// paletteIndex and alpha are a PaintSolid's color.
+	paletteIndex int
+	alpha        float32
+	// colorLine is a gradient's color line, and geometry holds its points:
+	// x0, y0, x1, y1, x2, y2 for a linear gradient, x0, y0, r0, x1, y1, r1
+	// for a radial gradient, and the center, start and end angles for a
+	// sweep gradient.
+	colorLine    int
+	varColorLine bool
+	geometry     [6]float32
+	// transform is the transform of PaintTransform and its variants.
+	transform f32.Aff3
+	// mode is a PaintComposite's composite mode.
+	mode uint8
+}
+
+// paint decodes the paint at offset off, with the variation deltas at the
+// normalized coordinates.
+func (c *colr) paint(off int, coords []float32) (paint, error) {
+	if off <= 0 || off >= len(c.data) {
+		return paint{}, ErrInvalidGlyph{fmt.Sprintf("paint offset %d is out of bounds", off)}
+	}
+	b := c.data[off:]
+	p := paint{format: b[0]}
+	variable := paintSolid < p.format && p.format < paintComposite && p.format%2 == 1 && p.format != paintColrGlyph
+	if variable {
+		p.format--
+	}
+	// deltas returns the deltas of n values, whose varIndexBase is at b[i:].
+	deltas := func(i, n int) (d [6]float32) {
+		if variable {
+			c.deltas(d[:n], b.u32(i), coords)
+		}
+		return d
+	}
+	child := func(i int) int { return off + int(b.u24(i)) }
+	fword := func(i int, delta float32) float32 { return float32(b.i16(i)) + delta }
+	f2 := func(i int, delta float32) float32 { return f2dot14(b.i16(i)) + delta/(1<<14) }
+	fixed := func(i int, delta float32) float32 { return (float32(int32(b.u32(i))) + delta) / (1 << 16) }
+
+	switch p.format {
+	case paintColrLayers:
+		p.nLayers, p.firstLayer = int(b.u8(1)), int(b.u32(2))
+	case paintSolid:
+		d := deltas(5, 1)
+		p.paletteIndex, p.alpha = int(b.u16(1)), f2(3, d[0])
+	case paintLinearGradient, paintRadialGradient:
+		d := deltas(16, 6)
+		p.colorLine, p.varColorLine = child(1), variable
+		for i := range p.geometry {
+			// The radii of a radial gradient are unsigned.
+			if p.format == paintRadialGradient && i%3 == 2 {
+				p.geometry[i] = float32(b.u16(4+2*i)) + d[i]
+			} else {
+				p.geometry[i] = fword(4+2*i, d[i])
+			}
+		}
+	case paintSweepGradient:
+		d := deltas(12, 4)
+		p.colorLine, p.varColorLine = child(1), variable
+		p.geometry = [6]float32{fword(4, d[0]), fword(6, d[1]), f2(8, d[2]), f2(10, d[3])}
+	case paintGlyph:
+		p.child, p.glyphID = child(1), GlyphID(b.u16(4))
+	case paintColrGlyph:
+		p.glyphID = GlyphID(b.u16(1))
+	case paintTransform:
+		// The Affine2x3 table's values are xx, yx, xy, yy, dx and dy.
+		t := int(b.u24(4))
+		d := deltas(t+24, 6)
+		p.transform = f32.Aff3{
+			fixed(t+0, d[0]), fixed(t+8, d[2]), fixed(t+16, d[4]),
+			fixed(t+4, d[1]), fixed(t+12, d[3]), fixed(t+20, d[5]),
+		}
+	case paintTranslate:
+		d := deltas(8, 2)
+		p.transform = f32.Aff3{1, 0, fword(4, d[0]), 0, 1, fword(6, d[1])}
+	case paintScale, paintScaleAroundCenter:
+		k := int(p.format-paintScale) / 2
+		d := deltas(8+4*k, 2+2*k)
+		p.transform = f32.Aff3{f2(4, d[0]), 0, 0, 0, f2(6, d[1]), 0}
+		if p.format == paintScaleAroundCenter {
+			p.transform = aroundCenter(p.transform, fword(8, d[2]), fword(10, d[3]))
+		}
+	case paintScaleUniform, paintScaleUniformAroundCenter:
+		k := int(p.format-paintScaleUniform) / 2
+		d := deltas(6+4*k, 1+2*k)
+		s := f2(4, d[0])
+		p.transform = f32.Aff3{s, 0, 0, 0, s, 0}
+		if p.format == paintScaleUniformAroundCenter {
+			p.transform = aroundCenter(p.transform, fword(6, d[1]), fword(8, d[2]))
+		}
+	case paintRotate, paintRotateAroundCenter:
+		// Angles are in half turns, counter-clockwise.
+		k := int(p.format-paintRotate) / 2
+		d := deltas(6+4*k, 1+2*k)
+		sin, cos := math.Sincos(math.Pi * float64(f2(4, d[0])))
+		p.transform = f32.Aff3{float32(cos), float32(-sin), 0, float32(sin), float32(cos), 0}
+		if p.format == paintRotateAroundCenter {
+			p.transform = aroundCenter(p.transform, fword(6, d[1]), fword(8, d[2]))
+		}
+	case paintSkew, paintSkewAroundCenter:
+		// A positive x skew angle tilts vertical lines counter-clockwise, to
+		// the left.
+		k := int(p.format-paintSkew) / 2
+		d := deltas(8+4*k, 2+2*k)
+		x := math.Tan(math.Pi * float64(f2(4, d[0])))
+		y := math.Tan(math.Pi * float64(f2(6, d[1])))
+		p.transform = f32.Aff3{1, float32(-x), 0, float32(y), 1, 0}
+		if p.format == paintSkewAroundCenter {
+			p.transform = aroundCenter(p.transform, fword(8, d[2]), fword(10, d[3]))
+		}
+	case paintComposite:
+		p.child, p.mode, p.backdrop = child(1), b.u8(4), child(5)
+		if p.mode > compositeHSLLuminosity {
+			return paint{}, ErrInvalidGlyph{fmt.Sprintf("composite mode %d is not supported", p.mode)}
+		}
+	default:
+		return paint{}, ErrInvalidGlyph{fmt.Sprintf("paint format %d is not supported", b[0])}
+	}
+	if p.format >= paintTransform && p.format < paintComposite {
+		p.child = child(1)
+	}
+	return p, nil
+}
+
+// aroundCenter returns the transform t about the center (cx, cy), rather
+// than about the origin.
+func aroundCenter(t f32.Aff3, cx, cy float32) f32.Aff3 {
+	t[2] = cx - t[0]*cx - t[1]*cy
+	t[5] = cy - t[3]*cx - t[4]*cy
+	return t
+}
+
+// deltas sets dst to the deltas of the values with variation indexes from
+// varIndexBase, at the normalized coordinates. Without a variation index map,
+// the indexes hold the outer and inner indexes in their high and low 16 bits.
+func (c *colr) deltas(dst []float32, varIndexBase uint32, coords []float32) {
+	for i := range dst {
+		dst[i] = 0
+	}
+	if coords == nil || c.varStore == nil || varIndexBase == noVarIndexBase {
+		return
+	}
+	for i := range dst {
+		index := uint64(varIndexBase) + uint64(i)
+		if index >= noVarIndexBase {
+			return
+		}
+		outer, inner := int(index>>16), int(index&0xffff)
+		if c.varIndexMap != nil {
+			outer, inner = c.varIndexMap.get(int(index & math.MaxInt32))
+		}
+		dst[i] = c.varStore.delta(outer, inner, coords)
+	}
+}
+
+// basePaint returns the offset of a version 1 color glyph's root paint. The
+// base glyph paint records are sorted by glyph ID.
+func (c *colr) basePaint(glyphID GlyphID) (int, bool) {
+	lo, hi := 0, c.nBasePaints
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		i := c.baseGlyphList + 4 + mid*basePaintRecordLen
+		id := GlyphID(c.data.u16(i))
+		switch {
+		case glyphID < id:
+			hi = mid
+		case glyphID > id:
+			lo = mid + 1
+		default:
+			return c.baseGlyphList + int(c.data.u32(i+2)), true
+		}
+	}
+	return 0, false
+}
+
+// clipBox returns the clip box of a version 1 color glyph, in font units, as
+// xMin, yMin, xMax and yMax. The clip records are sorted by glyph ID ranges,
+// which do not overlap.
+func (c *colr) clipBox(glyphID GlyphID, coords []float32) (box [4]float32, ok bool) {
+	lo, hi := 0, c.nClips
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		i := c.clipList + 5 + mid*clipRecordLen
+		switch {
+		case glyphID < GlyphID(c.data.u16(i)):
+			hi = mid
+		case glyphID > GlyphID(c.data.u16(i+2)):
+			lo = mid + 1
+		default:
+			b := c.data[c.clipList:].offset24(i + 4 - c.clipList)
+			var d [4]float32
+			switch b.u8(0) {
+			case 1:
+			case 2:
+				c.deltas(d[:], b.u32(9), coords)
+			default:
+				return box, false
+			}
+			for j := range box {
+				box[j] = float32(b.i16(1+2*j)) + d[j]
+			}
+			return box, true
+		}
+	}
+	return box, false
+}
+
+// layer is an image being drawn, with premultiplied red, green, blue and
+// alpha values from 0 to 1 for each pixel.
+type layer []float32
+
+// paintRenderer draws a glyph's paint graph into layers of w×h pixels.
+type paintRenderer struct {
+	f       *Font
+	c       *colr
+	palette int
+	// fg is the premultiplied foreground color.
+	fg   [4]float32
+	w, h int
+	z    raster.Rasterizer
+	mask *image.Alpha
+	// stack holds the offsets of the paints being drawn, to detect cycles,
+	// and n counts the paints drawn so far.
+	stack []int
+	n     int
+	// freeLayers and freeMasks are layers and coverage masks to reuse.
+	freeLayers []layer
+	freeMasks  [][]float32
+}
+
+// drawPaintGraph draws the paint graph at offset off of a version 1 color
+// glyph, as ColorGlyph does.
+//
+// Without a clip box, the image covers the outlines of the glyphs in the
+// graph. Either way, nothing is drawn more than maxPaintEms from the origin.
+func (f *Font) drawPaintGraph(glyphID GlyphID, off int, scale float32, palette int, fg color.Color) (*image.RGBA, error) {
+	r := &paintRenderer{f: f, c: f.colr, palette: palette}
+	fr, fg16, fb, fa := fg.RGBA()
+	r.fg = [4]float32{float32(fr) / 0xffff, float32(fg16) / 0xffff, float32(fb) / 0xffff, float32(fa) / 0xffff}
+
+	pixels := f32.Aff3{+scale, 0, 0, 0, -scale, 0}
+	box, hasClipBox := f.colr.clipBox(glyphID, f.coords)
+	var bounds [4]float32
+	if hasClipBox {
+		bounds = transformBox(&pixels, box)
+	} else {
+		var err error
+		if bounds, err = r.bounds(off, pixels); err != nil {
+			return nil, err
+		}
+		r.n = 0
+	}
+	em := float32(maxPaintEms * f.head.unitsPerEm())
+	limit := transformBox(&pixels, [4]float32{-em, -em, +em, +em})
+	for i := range bounds {
+		bounds[i] = min32(max32(bounds[i], limit[i%2]), limit[2+i%2])
+	}
+	rect := image.Rect(
+		int(math.Floor(float64(bounds[0]))), int(math.Floor(float64(bounds[1]))),
+		int(math.Ceil(float64(bounds[2]))), int(math.Ceil(float64(bounds[3]))),
+	)
+	dst := image.NewRGBA(rect)
+	if rect.Empty() {
+		return dst, nil
+	}
+
+	r.w, r.h = rect.Dx(), rect.Dy()
+	r.z = raster.New(r.w, r.h, scale*float32(f.head.unitsPerEm()))
+	r.mask = image.NewAlpha(r.z.Bounds())
+	t := f32.Aff3{
+		+scale, 0, -float32(rect.Min.X),
+		0, -scale, -float32(rect.Min.Y),
+	}
+	var clip []float32
+	if hasClipBox {
+		clip = r.boxMask(box, t, nil)
+	}
+	l := r.newLayer()
+	if err := r.draw(l, off, t, clip); err != nil {
+		return nil, err
+	}
+	for i, v := range l {
+		dst.Pix[i] = uint8(clamp01(v)*0xff + 0.5)
+	}
+	return dst, nil
+}
+
+// push starts drawing the paint at offset off, checking that the paint graph
+// is not too large or cyclic.
+func (r *paintRenderer) push(off int) error {
+	if r.n++; r.n > maxPaints {
+		return ErrInvalidGlyph{fmt.Sprintf("paint graph has more than %d paints", maxPaints)}
+	}
+	if len(r.stack) == maxPaintDepth {
+		return ErrInvalidGlyph{fmt.Sprintf("paint graph is nested more than %d deep", maxPaintDepth)}
+	}
+	for _, o := range r.stack {
+		if o == off {
+			return ErrInvalidGlyph{fmt.Sprintf("paint at offset %d is its own descendant", off)}
+		}
+	}
+	r.stack = append(r.stack, off)
+	return nil
+}
+
+func (r *paintRenderer) pop() { r.stack = r.stack[:len(r.stack)-1] }
+
+// layerPaint returns the offset of the i'th paint of the layer list.
+func (r *paintRenderer) layerPaint(p *paint, i int) (int, error) {
+	if p.firstLayer+p.nLayers > r.c.nLayerPaints {
+		return 0, ErrInvalidGlyph{fmt.Sprintf("layers %d to %d are out of range", p.firstLayer, p.firstLayer+p.nLayers-1)}
+	}
+	return r.c.layerList + int(r.c.data.u32(r.c.layerList+4+4*(p.firstLayer+i))), nil
+}
+
+// bounds returns the bounding box, in pixels, of the glyph outlines that the
+// paint at offset off clips to, with the transform from font units. Fills
+// that are not clipped are unbounded, and are left out.
+func (r *paintRenderer) bounds(off int, t f32.Aff3) (box [4]float32, err error) {
+	box = emptyBox
+	if err := r.push(off); err != nil {
+		return box, err
+	}
+	defer r.pop()
+	p, err := r.c.paint(off, r.f.coords)
+	if err != nil {
+		return box, err
+	}
+
+	switch p.format {
+	case paintColrLayers:
+		for i := 0; i < p.nLayers; i++ {
+			l, err := r.layerPaint(&p, i)
+			if err != nil {
+				return box, err
+			}
+			b, err := r.bounds(l, t)
+			if err != nil {
+				return box, err
+			}
+			box = unionBox(box, b)
+		}
+	case paintGlyph:
+		g, err := r.f.Glyph(p.glyphID)
+		if err != nil || g == nil {
+			return box, err
+		}
+		xMin, yMin, xMax, yMax := g.bounds()
+		return transformBox(&t, [4]float32{float32(xMin), float32(yMin), float32(xMax), float32(yMax)}), nil
+	case paintColrGlyph:
+		if off, ok := r.c.basePaint(p.glyphID); ok {
+			box, err = r.bounds(off, t)
+			if clip, ok := r.c.clipBox(p.glyphID, r.f.coords); ok {
+				box = intersectBox(box, transformBox(&t, clip))
+			}
+		}
+	case paintComposite:
+		var b [4]float32
+		if b, err = r.bounds(p.backdrop, t); err == nil {
+			box, err = r.bounds(p.child, t)
+			box = unionBox(box, b)
+		}
+	default:
+		if p.format >= paintTransform {
+			return r.bounds(p.child, concat(&t, &p.transform))
+		}
+	}
+	return box, err
+}
+
+// draw draws the paint at offset off over dst, with the transform from font
+// units to pixels. The clip holds the coverage of each pixel, and a nil clip
+// means full coverage.
+func (r *paintRenderer) draw(dst layer, off int, t f32.Aff3, clip []float32) error {
+	if err := r.push(off); err != nil {
+		return err
+	}
+	defer r.pop()
+	p, err := r.c.paint(off, r.f.coords)
+	if err != nil {
+		return err
+	}
+
+	switch p.format {
+	case paintColrLayers:
+		for i := 0; i < p.nLayers; i++ {
+			l, err := r.layerPaint(&p, i)
+			if err != nil {
+				return err
+			}
+			if err := r.draw(dst, l, t, clip); err != nil {
+				return err
+			}
+		}
+	case paintSolid:
+		c, err := r.color(p.paletteIndex, p.alpha)
+		if err != nil {
+			return err
+		}
+		r.fill(dst, clip, nil, func(point) ([4]float32, bool) { return c, true })
+	case paintLinearGradient, paintRadialGradient, paintSweepGradient:
+		l, err := r.colorLine(p.colorLine, p.varColorLine)
+		if err != nil || len(l.stops) == 0 {
+			return err
+		}
+		inv, ok := invert(&t)
+		if !ok {
+			return nil
+		}
+		r.fill(dst, clip, &inv, l.shader(p.format, &p.geometry))
+	case paintGlyph:
+		g, err := r.f.Glyph(p.glyphID)
+		if err != nil || g == nil {
+			return err
+		}
+		r.z.Reset()
+		if err := r.f.Outline(r.z, g, t); err != nil {
+			return err
+		}
+		m := r.accumulate(clip)
+		defer r.freeMask(m)
+		return r.draw(dst, p.child, t, m)
+	case paintColrGlyph:
+		off, ok := r.c.basePaint(p.glyphID)
+		if !ok {
+			return nil
+		}
+		if box, ok := r.c.clipBox(p.glyphID, r.f.coords); ok {
+			clip = r.boxMask(box, t, clip)
+			defer r.freeMask(clip)
+		}
+		return r.draw(dst, off, t, clip)
+	case paintComposite:
+		// The source and backdrop are drawn into their own layers, and the
+		// composited result is clipped.
+		src, backdrop := r.newLayer(), r.newLayer()
+		defer r.freeLayer(src)
+		defer r.freeLayer(backdrop)
+		if err := r.draw(backdrop, p.backdrop, t, nil); err != nil {
+			return err
+		}
+		if err := r.draw(src, p.child, t, nil); err != nil {
+			return err
+		}
+		composite(p.mode, backdrop, src)
+		for i := 0; i < len(dst); i += 4 {
+			coverage := float32(1)
+			if clip != nil {
+				coverage = clip[i/4]
+			}
+			if backdrop[i+3] != 0 {
+				srcOver(dst[i:i+4], backdrop[i:i+4], coverage)
+			}
+		}
+	default:
+		return r.draw(dst, p.child, concat(&t, &p.transform), clip)
+	}
+	return nil
+}
+
+// color returns the premultiplied color of the palette entry, or the
+// foreground color, with its alpha multiplied by alpha.
+func (r *paintRenderer) color(paletteIndex int, alpha float32) ([4]float32, error) {
+	var c [4]float32
+	if paletteIndex == ForegroundPaletteIndex {
+		c = r.fg
+	} else {
+		if paletteIndex >= r.f.cpal.nEntries || r.f.cpal.nPalettes == 0 {
+			return c, ErrInvalidGlyph{fmt.Sprintf("palette index %d is out of range", paletteIndex)}
+		}
+		n := r.f.cpal.color(r.palette, paletteIndex)
+		a := float32(n.A) / 0xff
+		c = [4]float32{float32(n.R) / 0xff * a, float32(n.G) / 0xff * a, float32(n.B) / 0xff * a, a}
+	}
+	alpha = clamp01(alpha)
+	for i := range c {
+		c[i] *= alpha
+	}
+	return c, nil
+}
+
+// fill draws the colors of a shader over dst. The shader is called with the
+// centers of the pixels, transformed by inv, if not nil.
+func (r *paintRenderer) fill(dst layer, clip []float32, inv *f32.Aff3, shader func(point) ([4]float32, bool)) {
+	for y, i := 0, 0; y < r.h; y++ {
+		for x := 0; x < r.w; x, i = x+1, i+1 {
+			coverage := float32(1)
+			if clip != nil {
+				if coverage = clip[i]; coverage == 0 {
+					continue
+				}
+			}
+			p := point{float32(x) + 0.5, float32(y) + 0.5}
+			if inv != nil {
+				v := mul(inv, p)
+				p = point{v[0], v[1]}
+			}
+			if c, ok := shader(p); ok {
+				srcOver(dst[4*i:4*i+4], c[:], coverage)
+			}
+		}
+	}
+}
+
+// accumulate returns the rasterizer's coverage, multiplied by the clip's.
+func (r *paintRenderer) accumulate(clip []float32) []float32 {
+	r.z.Accumulate(r.mask)
+	var m []float32
+	if n := len(r.freeMasks); n > 0 {
+		m, r.freeMasks = r.freeMasks[n-1], r.freeMasks[:n-1]
+	} else {
+		m = make([]float32, r.w*r.h)
+	}
+	for i, a := range r.mask.Pix {
+		m[i] = float32(a) / 0xff
+		if clip != nil {
+			m[i] *= clip[i]
+		}
+	}
+	return m
+}
+
+func (r *paintRenderer) freeMask(m []float32) { r.freeMasks = append(r.freeMasks, m) }
+
+// newLayer returns a transparent layer.
+func (r *paintRenderer) newLayer() layer {
+	n := len(r.freeLayers)
+	if n == 0 {
+		return make(layer, 4*r.w*r.h)
+	}
+	l := r.freeLayers[n-1]
+	r.freeLayers = r.freeLayers[:n-1]
+	for i := range l {
+		l[i] = 0
+	}
+	return l
+}
+
+func (r *paintRenderer) freeLayer(l layer) { r.freeLayers = append(r.freeLayers, l) }
+
+// boxMask returns the coverage of a box in font units, with the transform to
+// pixels, multiplied by the clip's.
+func (r *paintRenderer) boxMask(box [4]float32, t f32.Aff3, clip []float32) []float32 {
+	r.z.Reset()
+	r.z.MoveTo(mul(&t, point{box[0], box[1]}))
+	r.z.LineTo(mul(&t, point{box[2], box[1]}))
+	r.z.LineTo(mul(&t, point{box[2], box[3]}))
+	r.z.LineTo(mul(&t, point{box[0], box[3]}))
+	r.z.ClosePath()
+	return r.accumulate(clip)
+}
+
+// srcOver composites the premultiplied color src, scaled by the coverage,
+// over dst.
+func srcOver(dst, src []float32, coverage float32) {
+	a := 1 - src[3]*coverage
+	for i := 0; i < 4; i++ {
+		dst[i] = src[i]*coverage + dst[i]*a
+	}
+}
+
+// invert returns the inverse of the transform, if it is invertible.
+func invert(t *f32.Aff3) (f32.Aff3, bool) {
+	det := float64(t[0])*float64(t[4]) - float64(t[1])*float64(t[3])
+	if det == 0 || math.IsNaN(det) || math.IsInf(det, 0) {
+		return f32.Aff3{}, false
+	}
+	a, b, c := float64(t[0])/det, float64(t[1])/det, float64(t[2])
+	d, e, f := float64(t[3])/det, float64(t[4])/det, float64(t[5])
+	return f32.Aff3{
+		float32(+e), float32(-b), float32(b*f - e*c),
+		float32(-d), float32(+a), float32(d*c - a*f),
+	}, true
+}
+
+// emptyBox is the identity of unionBox.
+var emptyBox = [4]float32{
+	float32(math.Inf(+1)), float32(math.Inf(+1)),
+	float32(math.Inf(-1)), float32(math.Inf(-1)),
+}
+
+// transformBox returns the bounding box of a transformed box. Boxes are
+// xMin, yMin, xMax and yMax.
+func transformBox(t *f32.Aff3, b [4]float32) [4]float32 {
+	box := emptyBox
+	for _, p := range [4]point{{b[0], b[1]}, {b[2], b[1]}, {b[2], b[3]}, {b[0], b[3]}} {
+		v := mul(t, p)
+		box = unionBox(box, [4]float32{v[0], v[1], v[0], v[1]})
+	}
+	return box
+}
+
+func unionBox(a, b [4]float32) [4]float32 {
+	return [4]float32{min32(a[0], b[0]), min32(a[1], b[1]), max32(a[2], b[2]), max32(a[3], b[3])}
+}
+
+func intersectBox(a, b [4]float32) [4]float32 {
+	return [4]float32{max32(a[0], b[0]), max32(a[1], b[1]), min32(a[2], b[2]), min32(a[3], b[3])}
+}
+
+// min32 and max32 return the smaller and larger of a and b, or b if either is
+// NaN.
+func min32(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max32(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func clamp01(x float32) float32 {
+	switch {
+	case x > 1:
+		return 1
+	case x > 0:
+		return x
+	}
+	return 0
+}
@@ -0,0 +1,630 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"errors"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+// testPaint is a Paint table of a test paint graph, or a ColorLine or
+// Affine2x3 table. Its children are at 24-bit offsets in b.
+type testPaint struct {
+	b        []byte
+	children []testChild
+}
+
+// testChild is a child of a testPaint, whose offset is at b[at:].
+type testChild struct {
+	at int
+	p  *testPaint
+}
+
+func tSolid(paletteIndex int, alpha float32) *testPaint {
+	return &testPaint{b: cat([]byte{paintSolid}, be16(paletteIndex), beF2Dot14(alpha))}
+}
+
+func tGlyph(glyphID GlyphID, child *testPaint) *testPaint {
+	return &testPaint{b: cat([]byte{paintGlyph}, be24(0), be16(int(glyphID))), children: []testChild{{1, child}}}
+}
+
+func tColrLayers(first, n int) *testPaint {
+	return &testPaint{b: cat([]byte{paintColrLayers, byte(n)}, be32(first))}
+}
+
+func tColrGlyph(glyphID GlyphID) *testPaint {
+	return &testPaint{b: cat([]byte{paintColrGlyph}, be16(int(glyphID)))}
+}
+
+type testStop struct {
+	offset       float32
+	paletteIndex int
+	alpha        float32
+}
+
+func tColorLine(extend byte, stops ...testStop) *testPaint {
+	b := cat([]byte{extend}, be16(len(stops)))
+	for _, s := range stops {
+		b = append(b, cat(beF2Dot14(s.offset), be16(s.paletteIndex), beF2Dot14(s.alpha))...)
+	}
+	return &testPaint{b: b}
+}
+
+// tGradient returns a linear, radial or sweep gradient. Its values are
+// FWORDs, except for a sweep gradient's angles, which are F2DOT14s.
+func tGradient(format byte, colorLine *testPaint, values ...float32) *testPaint {
+	b := cat([]byte{format}, be24(0))
+	for i, v := range values {
+		if format == paintSweepGradient && i >= 2 {
+			b = append(b, beF2Dot14(v)...)
+		} else {
+			b = append(b, be16(int(v))...)
+		}
+	}
+	return &testPaint{b: b, children: []testChild{{1, colorLine}}}
+}
+
+// nF2Dot14 is the number of F2DOT14 values of each transform paint format,
+// which are before its FWORD values.
+var nF2Dot14 = map[byte]int{
+	paintTranslate:                0,
+	paintScale:                    2,
+	paintScaleAroundCenter:        2,
+	paintScaleUniform:             1,
+	paintScaleUniformAroundCenter: 1,
+	paintRotate:                   1,
+	paintRotateAroundCenter:       1,
+	paintSkew:                     2,
+	paintSkewAroundCenter:         2,
+}
+
+// tTransform returns a transform paint of the given format, with its F2DOT14
+// and FWORD values. PaintTransform's values are the Affine2x3 table's.
+func tTransform(format byte, child *testPaint, values ...float32) *testPaint {
+	p := &testPaint{b: cat([]byte{format}, be24(0)), children: []testChild{{1, child}}}
+	if format == paintTransform {
+		var affine []byte
+		for _, v := range values {
+			affine = append(affine, beFixed16(v)...)
+		}
+		p.b = append(p.b, be24(0)...)
+		p.children = append(p.children, testChild{4, &testPaint{b: affine}})
+		return p
+	}
+	for i, v := range values {
+		if i < nF2Dot14[format] {
+			p.b = append(p.b, beF2Dot14(v)...)
+		} else {
+			p.b = append(p.b, be16(int(v))...)
+		}
+	}
+	return p
+}
+
+func tComposite(src *testPaint, mode byte, backdrop *testPaint) *testPaint {
+	return &testPaint{
+		b:        cat([]byte{paintComposite}, be24(0), []byte{mode}, be24(0)),
+		children: []testChild{{1, src}, {5, backdrop}},
+	}
+}
+
+type testBasePaint struct {
+	glyphID GlyphID
+	p       *testPaint
+}
+
+type testClip struct {
+	start, end GlyphID
+	box        []byte
+}
+
+func tClipBox(xMin, yMin, xMax, yMax int) []byte {
+	return cat([]byte{1}, be16(xMin), be16(yMin), be16(xMax), be16(yMax))
+}
+
+// testCOLRv1 is a version 1 COLR table's lists and variation data.
+type testCOLRv1 struct {
+	basePaints  []testBasePaint
+	layers      []*testPaint
+	clips       []testClip
+	varIndexMap []byte
+	varStore    []byte
+}
+
+// buildCOLRv1 returns a version 1 COLR table, without version 0 color
+// glyphs. The paints are after the lists, each after the paints that refer
+// to it, as their offsets are unsigned.
+func buildCOLRv1(c testCOLRv1) []byte {
+	b := make([]byte, colrV1Len)
+	copy(b, be16(1))
+
+	baseGlyphList := len(b)
+	b = append(b, be32(len(c.basePaints))...)
+	for _, p := range c.basePaints {
+		b = append(b, cat(be16(int(p.glyphID)), be32(0))...)
+	}
+	layerList := len(b)
+	b = append(b, be32(len(c.layers))...)
+	b = append(b, make([]byte, 4*len(c.layers))...)
+	clipList := 0
+	if c.clips != nil {
+		clipList = len(b)
+		b = append(b, cat([]byte{1}, be32(len(c.clips)))...)
+		boxes := len(b) + clipRecordLen*len(c.clips)
+		for _, clip := range c.clips {
+			b = append(b, cat(be16(int(clip.start)), be16(int(clip.end)), be24(boxes-clipList))...)
+			boxes += len(clip.box)
+		}
+		for _, clip := range c.clips {
+			b = append(b, clip.box...)
+		}
+	}
+
+	// Lay out the paints in reverse post-order, which is a topological order.
+	var order []*testPaint
+	seen := map[*testPaint]bool{}
+	var visit func(p *testPaint)
+	visit = func(p *testPaint) {
+		if seen[p] {
+			return
+		}
+		seen[p] = true
+		for _, c := range p.children {
+			visit(c.p)
+		}
+		order = append(order, p)
+	}
+	for _, p := range c.basePaints {
+		visit(p.p)
+	}
+	for _, p := range c.layers {
+		visit(p)
+	}
+	pos := map[*testPaint]int{}
+	for i := len(order) - 1; i >= 0; i-- {
+		pos[order[i]] = len(b)
+		b = append(b, order[i].b...)
+	}
+	for p, at := range pos {
+		for _, c := range p.children {
+			copy(b[at+c.at:], be24(pos[c.p]-at))
+		}
+	}
+	for i, p := range c.basePaints {
+		copy(b[baseGlyphList+4+6*i+2:], be32(pos[p.p]-baseGlyphList))
+	}
+	for i, p := range c.layers {
+		copy(b[layerList+4+4*i:], be32(pos[p]-layerList))
+	}
+
+	copy(b[14:], cat(be32(baseGlyphList), be32(layerList), be32(clipList)))
+	if c.varIndexMap != nil {
+		copy(b[26:], be32(len(b)))
+		b = append(b, c.varIndexMap...)
+	}
+	if c.varStore != nil {
+		copy(b[30:], be32(len(b)))
+		b = append(b, c.varStore...)
+	}
+	return b
+}
+
+// testV1Palette is red, blue, green, yellow and half transparent white.
+var testV1Palette = []color.NRGBA{
+	{0xff, 0x00, 0x00, 0xff},
+	{0x00, 0x00, 0xff, 0xff},
+	{0x00, 0xc0, 0x00, 0xff},
+	{0xff, 0xd0, 0x00, 0xff},
+	{0xff, 0xff, 0xff, 0x80},
+}
+
+// testColorV1Tables returns the tables of testTables, with a version 1 color
+// glyph for each golden image. The square glyph 1 is from (100, 0) to (500,
+// 400) and the diamond glyph 2 is inscribed in it.
+func testColorV1Tables() map[string][]byte {
+	const red, blue, green, yellow, white = 0, 1, 2, 3, 4
+	redToBlue := tColorLine(extendPad, testStop{0, red, 1}, testStop{1, blue, 1})
+	rgb := func(extend byte) *testPaint {
+		return tColorLine(extend, testStop{0, red, 1}, testStop{0.5, green, 1}, testStop{1, blue, 1})
+	}
+	redSquare := tGlyph(1, tSolid(red, 1))
+	tables := testTables()
+	tables["CPAL"] = buildCPAL(testV1Palette)
+	tables["COLR"] = buildCOLRv1(testCOLRv1{
+		basePaints: []testBasePaint{
+			{100, tColrLayers(0, 2)},
+			{101, tGlyph(1, tGradient(paintLinearGradient, redToBlue, 200, 0, 400, 0, 200, 400))},
+			{102, tGlyph(1, tGradient(paintLinearGradient, rgb(extendRepeat), 200, 100, 300, 100, 250, 400))},
+			{103, tGlyph(1, tGradient(paintLinearGradient, rgb(extendReflect), 200, 100, 300, 100, 250, 400))},
+			{104, tGlyph(1, tGradient(paintRadialGradient, rgb(extendPad), 300, 200, 0, 300, 200, 200))},
+			{105, tGlyph(1, tGradient(paintRadialGradient, redToBlue, 200, 200, 20, 400, 200, 100))},
+			{106, tGlyph(1, tGradient(paintSweepGradient, rgb(extendPad), 300, 200, 0, 1.5))},
+			{107, tColrLayers(2, 3)},
+			{108, tTransform(paintTransform,
+				tGlyph(2, tGradient(paintLinearGradient, rgb(extendPad), 100, 0, 500, 0, 100, 400)),
+				0.5, 0, 0.5, 1, 100, 0)},
+			{109, tComposite(tGlyph(2, tSolid(blue, 1)), compositeDestOut, redSquare)},
+			{110, tComposite(
+				tGlyph(2, tGradient(paintLinearGradient, rgb(extendPad), 100, 0, 500, 0, 100, 400)),
+				compositeMultiply,
+				tGlyph(1, tSolid(yellow, 1)))},
+			{111, tComposite(tGlyph(2, tSolid(white, 1)), compositeXor, redSquare)},
+			{112, tColrLayers(5, 2)},
+			{113, tGlyph(1, tSolid(green, 1))},
+			{114, tGlyph(1, tGradient(paintRadialGradient, rgb(extendRepeat), 300, 200, 0, 300, 200, 80))},
+		},
+		layers: []*testPaint{
+			// Layers 0 and 1 are glyph 100's.
+			redSquare,
+			tGlyph(2, tSolid(ForegroundPaletteIndex, 0.5)),
+			// Layers 2 to 4 are glyph 107's.
+			tTransform(paintRotateAroundCenter, tGlyph(1, tSolid(yellow, 1)), 0.25, 300, 200),
+			tTransform(paintScaleAroundCenter, tGlyph(2, tSolid(blue, 0.75)), 0.5, 1, 300, 200),
+			tTransform(paintTranslate, tTransform(paintSkew, tGlyph(1, tSolid(green, 0.5)), 0.125, 0), 0, -100),
+			// Layers 5 and 6 are glyph 112's.
+			tTransform(paintTranslate, tColrGlyph(113), -50, 0),
+			tTransform(paintScaleUniformAroundCenter, tColrGlyph(101), 0.5, 400, 200),
+		},
+		clips: []testClip{
+			{113, 113, tClipBox(100, 0, 300, 400)},
+			{114, 114, tClipBox(150, 50, 450, 350)},
+		},
+	})
+	return tables
+}
+
+func testColorV1Font(t *testing.T) *Font {
+	f, err := Parse(buildFont(testColorV1Tables()))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return f
+}
+
+// TestColorGlyphGolden compares version 1 color glyphs with the golden images
+// in testdata/colrv1. Run with -update to rewrite them, and check the new
+// images by eye.
+func TestColorGlyphGolden(t *testing.T) {
+	f := testColorV1Font(t)
+	testCases := []struct {
+		name    string
+		glyphID GlyphID
+		opts    *ColorOptions
+	}{
+		{"solid", 100, &ColorOptions{Foreground: color.RGBA{0x00, 0x80, 0x00, 0xff}}},
+		{"linear-pad", 101, nil},
+		{"linear-repeat", 102, nil},
+		{"linear-reflect", 103, nil},
+		{"radial", 104, nil},
+		{"radial-two-point", 105, nil},
+		{"radial-repeat-clip-box", 114, nil},
+		{"sweep", 106, nil},
+		{"transforms", 107, nil},
+		{"affine", 108, nil},
+		{"composite-dest-out", 109, nil},
+		{"composite-multiply", 110, nil},
+		{"composite-xor", 111, nil},
+		{"colr-glyph", 112, nil},
+	}
+	for _, tc := range testCases {
+		got, err := f.ColorGlyph(tc.glyphID, 0.25, tc.opts)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		filename := filepath.Join("testdata", "colrv1", tc.name+".png")
+		if *updateGolden {
+			if err := writePNG(filename, got); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := readPNG(filename)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		// The images are compared allowing for floating point differences.
+		if got.Bounds().Size() != want.Bounds().Size() {
+			t.Errorf("%s: size: got %v, want %v", tc.name, got.Bounds().Size(), want.Bounds().Size())
+			continue
+		}
+		if !imagesClose(got, want, 2) {
+			t.Errorf("%s: image differs from %s", tc.name, filename)
+		}
+	}
+}
+
+func writePNG(filename string, m image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, m); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readPNG(filename string) (*image.RGBA, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := png.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	// PNG images are not premultiplied, so convert through color.RGBA.
+	rgba := image.NewRGBA(m.Bounds())
+	for y := m.Bounds().Min.Y; y < m.Bounds().Max.Y; y++ {
+		for x := m.Bounds().Min.X; x < m.Bounds().Max.X; x++ {
+			rgba.Set(x, y, m.At(x, y))
+		}
+	}
+	return rgba, nil
+}
+
+// imagesClose returns whether the images, of the same size, have channels
+// that differ by at most tolerance.
+func imagesClose(a, b *image.RGBA, tolerance int) bool {
+	for y := 0; y < a.Bounds().Dy(); y++ {
+		pa := a.Pix[y*a.Stride : y*a.Stride+4*a.Bounds().Dx()]
+		pb := b.Pix[y*b.Stride : y*b.Stride+4*b.Bounds().Dx()]
+		for i := range pa {
+			if d := int(pa[i]) - int(pb[i]); d < -tolerance || d > tolerance {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestColorGlyphV1Bounds(t *testing.T) {
+	f := testColorV1Font(t)
+	testCases := []struct {
+		glyphID GlyphID
+		want    image.Rectangle
+	}{
+		// The square, at a scale of 0.25.
+		{101, image.Rect(25, -100, 125, 0)},
+		// The clip box from (150, 50) to (450, 350).
+		{114, image.Rect(37, -88, 113, -12)},
+		// Glyph 113's clip box, translated to (50, 0) to (250, 400), and the
+		// square scaled by half around (400, 200), from (250, 100) to (450,
+		// 300).
+		{112, image.Rect(12, -100, 113, 0)},
+	}
+	for _, tc := range testCases {
+		m, err := f.ColorGlyph(tc.glyphID, 0.25, nil)
+		if err != nil {
+			t.Errorf("glyph %d: %v", tc.glyphID, err)
+			continue
+		}
+		if got := m.Bounds(); got != tc.want {
+			t.Errorf("glyph %d: got %v, want %v", tc.glyphID, got, tc.want)
+		}
+	}
+}
+
+func TestColorLineAt(t *testing.T) {
+	red, blue := [4]float32{1, 0, 0, 1}, [4]float32{0, 0, 0.5, 0.5}
+	purple := [4]float32{0.5, 0, 0.25, 0.75}
+	testCases := []struct {
+		extend uint8
+		t      float32
+		want   [4]float32
+	}{
+		{extendPad, -1, red},
+		{extendPad, 0.25, red},
+		{extendPad, 0.5, purple},
+		{extendPad, 1.25, blue},
+		{extendRepeat, 0.5, purple},
+		{extendRepeat, 0.75, red},
+		{extendRepeat, 1, purple},
+		{extendRepeat, 1.5, purple},
+		{extendRepeat, -0.5, purple},
+		{extendReflect, 0.5, purple},
+		{extendReflect, 1, purple},
+		{extendReflect, 1.5, purple},
+		{extendReflect, -0.25, blue},
+		{extendReflect, 2.25, red},
+	}
+	for _, tc := range testCases {
+		l := colorLine{extend: tc.extend, stops: []colorStop{{0.25, red}, {0.75, blue}}}
+		if got := l.at(tc.t); got != tc.want {
+			t.Errorf("extend %d, t=%v: got %v, want %v", tc.extend, tc.t, got, tc.want)
+		}
+	}
+
+	// Stops at the same offset make a sharp edge.
+	l := colorLine{stops: []colorStop{{0, red}, {0.5, red}, {0.5, blue}, {1, blue}}}
+	if got := l.at(0.49); got != red {
+		t.Errorf("before the edge: got %v, want %v", got, red)
+	}
+	if got := l.at(0.5); got != blue {
+		t.Errorf("at the edge: got %v, want %v", got, blue)
+	}
+}
+
+func TestComposite(t *testing.T) {
+	// The source is half transparent red and the backdrop is opaque gray.
+	src, dst := [4]float32{0.5, 0, 0, 0.5}, [4]float32{0.5, 0.5, 0.5, 1}
+	testCases := []struct {
+		mode uint8
+		want [4]float32
+	}{
+		{compositeClear, [4]float32{0, 0, 0, 0}},
+		{compositeSrc, src},
+		{compositeDest, dst},
+		{compositeSrcOver, [4]float32{0.75, 0.25, 0.25, 1}},
+		{compositeDestOver, dst},
+		{compositeSrcIn, src},
+		{compositeDestOut, [4]float32{0.25, 0.25, 0.25, 0.5}},
+		{compositeXor, [4]float32{0.25, 0.25, 0.25, 0.5}},
+		{compositePlus, [4]float32{1, 0.5, 0.5, 1}},
+		{compositeMultiply, [4]float32{0.5, 0.25, 0.25, 1}},
+		{compositeScreen, [4]float32{0.75, 0.5, 0.5, 1}},
+		{compositeDarken, [4]float32{0.5, 0.25, 0.25, 1}},
+		{compositeLighten, [4]float32{0.75, 0.5, 0.5, 1}},
+		{compositeDifference, [4]float32{0.5, 0.5, 0.5, 1}},
+		// Gray has no saturation, so blending its hue leaves it unchanged.
+		{compositeHSLHue, dst},
+		// Red's luminosity is 0.3.
+		{compositeHSLLuminosity, [4]float32{0.4, 0.4, 0.4, 1}},
+	}
+	for _, tc := range testCases {
+		d, s := layer(dst[:]), layer(src[:])
+		d = append(layer(nil), d...)
+		composite(tc.mode, d, s)
+		for i := range d {
+			if diff := d[i] - tc.want[i]; diff < -1e-6 || diff > 1e-6 {
+				t.Errorf("mode %d: got %v, want %v", tc.mode, d, tc.want)
+				break
+			}
+		}
+	}
+}
+
+func TestPaintGraphInvalid(t *testing.T) {
+	redSquare := tGlyph(1, tSolid(0, 1))
+	deep := redSquare
+	for i := 0; i < maxPaintDepth; i++ {
+		deep = tTransform(paintTranslate, deep, 0, 0)
+	}
+	// Each of layers 0 to 29 draws the next two layers, so glyph 200 draws
+	// exponentially many paints.
+	var fibonacci []*testPaint
+	for i := 0; i < 30; i++ {
+		fibonacci = append(fibonacci, tColrLayers(i+1, 2))
+	}
+	fibonacci = append(fibonacci, redSquare, redSquare)
+
+	testCases := []struct {
+		desc   string
+		p      *testPaint
+		layers []*testPaint
+	}{
+		{"cycle", tColrGlyph(200), nil},
+		{"layer cycle", tColrLayers(0, 1), []*testPaint{tColrLayers(0, 1)}},
+		{"deep", deep, nil},
+		{"too many paints", tColrLayers(0, 2), fibonacci},
+		{"layers out of range", tColrLayers(0, 2), []*testPaint{redSquare}},
+		{"unknown format", &testPaint{b: []byte{paintComposite + 1}}, nil},
+		{"unknown composite mode", tComposite(redSquare, compositeHSLLuminosity+1, redSquare), nil},
+		{"palette index out of range", tGlyph(1, tSolid(len(testV1Palette), 1)), nil},
+		{"paint offset out of bounds", &testPaint{b: cat([]byte{paintGlyph}, be24(0xffffff), be16(1))}, nil},
+		{
+			"color line out of bounds",
+			tGlyph(1, tGradient(paintLinearGradient, &testPaint{b: cat([]byte{extendPad}, be16(100))}, 0, 0, 1, 0, 0, 1)),
+			nil,
+		},
+	}
+	for _, tc := range testCases {
+		tables := testTables()
+		tables["CPAL"] = buildCPAL(testV1Palette)
+		tables["COLR"] = buildCOLRv1(testCOLRv1{basePaints: []testBasePaint{{200, tc.p}}, layers: tc.layers})
+		f, err := Parse(buildFont(tables))
+		if err != nil {
+			t.Errorf("%s: Parse: %v", tc.desc, err)
+			continue
+		}
+		if _, err := f.ColorGlyph(200, 0.25, nil); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an ErrInvalidFont", tc.desc, err)
+		}
+	}
+}
+
+func TestParseCOLRv1Errors(t *testing.T) {
+	b := buildCOLRv1(testCOLRv1{
+		basePaints: []testBasePaint{{3, tGlyph(1, tSolid(0, 1))}},
+		clips:      []testClip{{3, 3, tClipBox(0, 0, 100, 100)}},
+	})
+	clipList := int(u32(b, 22))
+	testCases := []struct {
+		desc string
+		b    []byte
+	}{
+		{"short", b[:colrV1Len-1]},
+		{"base glyph list out of bounds", cat(b[:colrV1Len], be32(1000), b[colrV1Len+4:])},
+		{"layer list out of bounds", cat(b[:18], be32(len(b)), b[22:])},
+		{"clip list format", cat(b[:clipList], []byte{2}, b[clipList+1:])},
+		{"item variation store out of bounds", cat(b[:30], be32(len(b)), b[34:])},
+	}
+	for _, tc := range testCases {
+		tables := testTables()
+		tables["COLR"] = tc.b
+		if _, err := Parse(buildFont(tables)); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an ErrInvalidFont", tc.desc, err)
+		}
+	}
+}
+
+func TestVariablePaints(t *testing.T) {
+	// The deltas at the wght axis' maximum make the square half transparent
+	// and move it right by 100 font units, or 25 pixels.
+	varSolid := &testPaint{b: cat([]byte{paintSolid + 1}, be16(0), beF2Dot14(1), be32(0))}
+	varTranslate := &testPaint{
+		b:        cat([]byte{paintTranslate + 1}, be24(0), be16(0), be16(0), be32(1)),
+		children: []testChild{{1, tGlyph(1, varSolid)}},
+	}
+	tables := testTables()
+	tables["CPAL"] = buildCPAL(testV1Palette)
+	tables["COLR"] = buildCOLRv1(testCOLRv1{
+		basePaints: []testBasePaint{{200, varTranslate}},
+		varStore: buildItemVariationStore(
+			[]testRegion{{{0, 1, 1}, {0, 0, 0}}},
+			testVarData{regions: []int{0}, wordCount: 1, rows: [][]int{{-1 << 13}, {100}, {0}}},
+		),
+	})
+	f := testVariableFont(t, tables)
+
+	testCases := []struct {
+		coords     []float32
+		wantBounds image.Rectangle
+		wantColor  color.RGBA
+	}{
+		{nil, image.Rect(25, -100, 125, 0), color.RGBA{0xff, 0x00, 0x00, 0xff}},
+		{[]float32{1, 0}, image.Rect(50, -100, 150, 0), color.RGBA{0x80, 0x00, 0x00, 0x80}},
+	}
+	for _, tc := range testCases {
+		f.SetNormalizedCoords(tc.coords)
+		m, err := f.ColorGlyph(200, 0.25, nil)
+		if err != nil {
+			t.Errorf("coords %v: %v", tc.coords, err)
+			continue
+		}
+		if got := m.Bounds(); got != tc.wantBounds {
+			t.Errorf("coords %v: bounds: got %v, want %v", tc.coords, got, tc.wantBounds)
+		}
+		c := tc.wantBounds.Min.Add(image.Pt(50, 50))
+		if got := m.RGBAAt(c.X, c.Y); !closeRGBA(got, tc.wantColor) {
+			t.Errorf("coords %v: got %v, want %v", tc.coords, got, tc.wantColor)
+		}
+	}
+}
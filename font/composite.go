@@ -0,0 +1,233 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import "math"
+
+// Composite modes of PaintComposite. The modes up to compositePlus are
+// Porter-Duff compositing operators, and the others are the separable and
+// non-separable blend modes of the W3C Compositing and Blending spec.
+const (
+	compositeClear = iota
+	compositeSrc
+	compositeDest
+	compositeSrcOver
+	compositeDestOver
+	compositeSrcIn
+	compositeDestIn
+	compositeSrcOut
+	compositeDestOut
+	compositeSrcAtop
+	compositeDestAtop
+	compositeXor
+	compositePlus
+	compositeScreen
+	compositeOverlay
+	compositeDarken
+	compositeLighten
+	compositeColorDodge
+	compositeColorBurn
+	compositeHardLight
+	compositeSoftLight
+	compositeDifference
+	compositeExclusion
+	compositeMultiply
+	compositeHSLHue
+	compositeHSLSaturation
+	compositeHSLColor
+	compositeHSLLuminosity
+)
+
+// composite sets each pixel of the backdrop dst to that of the source src
+// composited with it.
+func composite(mode uint8, dst, src layer) {
+	for i := 0; i < len(dst); i += 4 {
+		d, s := dst[i:i+4:i+4], src[i:i+4:i+4]
+		sa, da := s[3], d[3]
+		if sa == 0 && da == 0 {
+			// Every mode leaves transparent pixels transparent.
+			continue
+		}
+		if mode <= compositePlus {
+			// The result is fs*s + fd*d, for each Porter-Duff operator's
+			// fractions of the source and destination.
+			var fs, fd float32
+			switch mode {
+			case compositeSrc:
+				fs = 1
+			case compositeDest:
+				fd = 1
+			case compositeSrcOver:
+				fs, fd = 1, 1-sa
+			case compositeDestOver:
+				fs, fd = 1-da, 1
+			case compositeSrcIn:
+				fs = da
+			case compositeDestIn:
+				fd = sa
+			case compositeSrcOut:
+				fs = 1 - da
+			case compositeDestOut:
+				fd = 1 - sa
+			case compositeSrcAtop:
+				fs, fd = da, 1-sa
+			case compositeDestAtop:
+				fs, fd = 1-da, sa
+			case compositeXor:
+				fs, fd = 1-da, 1-sa
+			case compositePlus:
+				fs, fd = 1, 1
+			}
+			for j := range d {
+				d[j] = min32(fs*s[j]+fd*d[j], 1)
+			}
+			continue
+		}
+
+		// The blend modes blend unpremultiplied colors, cs and cd, where
+		// both the source and the backdrop are opaque. Elsewhere, the
+		// source and backdrop colors show through as with compositeSrcOver.
+		var cs, cd [3]float32
+		for j := range cs {
+			if sa != 0 {
+				cs[j] = s[j] / sa
+			}
+			if da != 0 {
+				cd[j] = d[j] / da
+			}
+		}
+		b := blend(mode, cs, cd)
+		for j := range b {
+			d[j] = clamp01((1-da)*s[j] + (1-sa)*d[j] + sa*da*b[j])
+		}
+		d[3] = sa + da - sa*da
+	}
+}
+
+// blend returns the blend of the unpremultiplied source and backdrop colors.
+func blend(mode uint8, cs, cd [3]float32) (b [3]float32) {
+	switch mode {
+	case compositeHSLHue:
+		return setLum(setSat(cs, sat(cd)), lum(cd))
+	case compositeHSLSaturation:
+		return setLum(setSat(cd, sat(cs)), lum(cd))
+	case compositeHSLColor:
+		return setLum(cs, lum(cd))
+	case compositeHSLLuminosity:
+		return setLum(cd, lum(cs))
+	}
+	for j := range b {
+		b[j] = blendChannel(mode, cs[j], cd[j])
+	}
+	return b
+}
+
+// blendChannel returns the blend of one channel of the source and backdrop
+// colors, for the separable blend modes.
+func blendChannel(mode uint8, s, d float32) float32 {
+	switch mode {
+	case compositeScreen:
+		return s + d - s*d
+	case compositeOverlay:
+		return blendChannel(compositeHardLight, d, s)
+	case compositeDarken:
+		return min32(s, d)
+	case compositeLighten:
+		return max32(s, d)
+	case compositeColorDodge:
+		switch {
+		case d == 0:
+			return 0
+		case s >= 1:
+			return 1
+		}
+		return min32(1, d/(1-s))
+	case compositeColorBurn:
+		switch {
+		case d >= 1:
+			return 1
+		case s == 0:
+			return 0
+		}
+		return 1 - min32(1, (1-d)/s)
+	case compositeHardLight:
+		if s <= 0.5 {
+			return d * 2 * s
+		}
+		return blendChannel(compositeScreen, 2*s-1, d)
+	case compositeSoftLight:
+		if s <= 0.5 {
+			return d - (1-2*s)*d*(1-d)
+		}
+		e := float32(math.Sqrt(float64(d)))
+		if d <= 0.25 {
+			e = ((16*d-12)*d + 4) * d
+		}
+		return d + (2*s-1)*(e-d)
+	case compositeDifference:
+		if s > d {
+			return s - d
+		}
+		return d - s
+	case compositeExclusion:
+		return s + d - 2*s*d
+	case compositeMultiply:
+		return s * d
+	}
+	return s
+}
+
+// lum, setLum, sat and setSat implement the non-separable blend modes, which
+// combine the hue, saturation and luminosity of the source and backdrop.
+
+func lum(c [3]float32) float32 { return 0.3*c[0] + 0.59*c[1] + 0.11*c[2] }
+
+func setLum(c [3]float32, l float32) [3]float32 {
+	d := l - lum(c)
+	for i := range c {
+		c[i] += d
+	}
+	// Clip the color to the range from 0 to 1, keeping its luminosity.
+	l = lum(c)
+	n := min32(c[0], min32(c[1], c[2]))
+	x := max32(c[0], max32(c[1], c[2]))
+	for i := range c {
+		if n < 0 {
+			c[i] = l + (c[i]-l)*l/(l-n)
+		}
+		if x > 1 {
+			c[i] = l + (c[i]-l)*(1-l)/(x-l)
+		}
+	}
+	return c
+}
+
+func sat(c [3]float32) float32 {
+	return max32(c[0], max32(c[1], c[2])) - min32(c[0], min32(c[1], c[2]))
+}
+
+func setSat(c [3]float32, s float32) [3]float32 {
+	// The largest channel becomes s, the smallest 0, and the middle one is
+	// scaled proportionally.
+	n := min32(c[0], min32(c[1], c[2]))
+	x := max32(c[0], max32(c[1], c[2]))
+	var r [3]float32
+	if x > n {
+		for i := range c {
+			r[i] = (c[i] - n) * s / (x - n)
+		}
+	}
+	return r
+}
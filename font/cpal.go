@@ -0,0 +1,87 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"fmt"
+	"image/color"
+)
+
+const cpalLen = 12
+
+// cpal is the color palette table, which has the colors of color glyphs.
+// Each palette has nEntries colors, which are consecutive color records
+// starting at the palette's index.
+type cpal struct {
+	nEntries  int
+	nPalettes int
+	indexes   otData
+	colors    otData
+}
+
+// parseCPAL parses the CPAL table b. The version 1 table's palette types and
+// labels are ignored.
+func parseCPAL(b []byte) (cpal, error) {
+	if len(b) < cpalLen {
+		return cpal{}, ErrTableTooShort{Tag: MakeTag("CPAL"), Length: len(b), MinLength: cpalLen}
+	}
+	if v := u16(b, 0); v > 1 {
+		return cpal{}, ErrUnsupportedFormat{Tag: MakeTag("CPAL"), Format: uint32(v)}
+	}
+	p := cpal{
+		nEntries:  int(u16(b, 2)),
+		nPalettes: int(u16(b, 4)),
+	}
+	if n := cpalLen + 2*p.nPalettes; len(b) < n {
+		return cpal{}, ErrTableTooShort{Tag: MakeTag("CPAL"), Length: len(b), MinLength: n}
+	}
+	nColors, colors := int(u16(b, 6)), uint64(u32(b, 8))
+	if colors+4*uint64(nColors) > uint64(len(b)) {
+		return cpal{}, ErrInvalidTable{Tag: MakeTag("CPAL"), Reason: "color records are out of bounds"}
+	}
+	p.indexes = b[cpalLen : cpalLen+2*p.nPalettes]
+	p.colors = b[colors : colors+4*uint64(nColors)]
+	for i := 0; i < p.nPalettes; i++ {
+		if int(p.indexes.u16(2*i))+p.nEntries > nColors {
+			return cpal{}, ErrInvalidTable{Tag: MakeTag("CPAL"), Reason: fmt.Sprintf("palette %d is out of bounds", i)}
+		}
+	}
+	return p, nil
+}
+
+// color returns the entry'th color of the palette. parseCPAL checked that the
+// palettes' colors are in bounds.
+func (p *cpal) color(palette, entry int) color.NRGBA {
+	i := 4 * (int(p.indexes.u16(2*palette)) + entry)
+	// Color records are in BGRA order.
+	return color.NRGBA{R: p.colors[i+2], G: p.colors[i+1], B: p.colors[i], A: p.colors[i+3]}
+}
+
+// NumPalettes returns the number of the font's color palettes, in its CPAL
+// table.
+func (f *Font) NumPalettes() int { return f.cpal.nPalettes }
+
+// Palette returns the colors of the font's i'th color palette. Palette 0 is
+// the default. It returns nil if i is out of range.
+func (f *Font) Palette(i int) []color.NRGBA {
+	if i < 0 || i >= f.cpal.nPalettes {
+		return nil
+	}
+	colors := make([]color.NRGBA, f.cpal.nEntries)
+	for j := range colors {
+		colors[j] = f.cpal.color(i, j)
+	}
+	return colors
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"errors"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+// buildCPAL returns a version 0 CPAL table with the given palettes, which must
+// have the same number of entries. Each palette has its own color records.
+func buildCPAL(palettes ...[]color.NRGBA) []byte {
+	nEntries := 0
+	if len(palettes) > 0 {
+		nEntries = len(palettes[0])
+	}
+	var indexes, colors []byte
+	for i, p := range palettes {
+		indexes = append(indexes, be16(i*nEntries)...)
+		for _, c := range p {
+			colors = append(colors, c.B, c.G, c.R, c.A)
+		}
+	}
+	return cat(be16(0), be16(nEntries), be16(len(palettes)), be16(len(colors)/4),
+		be32(cpalLen+len(indexes)), indexes, colors)
+}
+
+var testPalettes = [][]color.NRGBA{
+	{{0xff, 0x00, 0x00, 0xff}, {0x00, 0x00, 0xff, 0x80}},
+	{{0x00, 0xff, 0x00, 0xff}, {0x00, 0x00, 0x00, 0x00}},
+}
+
+func TestPalette(t *testing.T) {
+	tables := testTables()
+	tables["CPAL"] = buildCPAL(testPalettes...)
+	f, err := Parse(buildFont(tables))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got, want := f.NumPalettes(), 2; got != want {
+		t.Errorf("NumPalettes: got %d, want %d", got, want)
+	}
+	for i, want := range testPalettes {
+		if got := f.Palette(i); !reflect.DeepEqual(got, want) {
+			t.Errorf("Palette(%d): got %v, want %v", i, got, want)
+		}
+	}
+	for _, i := range []int{-1, 2} {
+		if got := f.Palette(i); got != nil {
+			t.Errorf("Palette(%d): got %v, want nil", i, got)
+		}
+	}
+	if got := testFont(t).NumPalettes(); got != 0 {
+		t.Errorf("NumPalettes without a CPAL table: got %d, want 0", got)
+	}
+}
+
+func TestParseCPALErrors(t *testing.T) {
+	b := buildCPAL(testPalettes...)
+	testCases := []struct {
+		desc string
+		b    []byte
+	}{
+		{"short", b[:cpalLen-1]},
+		{"version", cat(be16(2), b[2:])},
+		{"truncated indexes", b[:cpalLen+3]},
+		{"truncated colors", b[:len(b)-1]},
+		{"palette out of bounds", cat(b[:cpalLen+2], be16(3), b[cpalLen+4:])},
+	}
+	for _, tc := range testCases {
+		tables := testTables()
+		tables["CPAL"] = tc.b
+		if _, err := Parse(buildFont(tables)); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an ErrInvalidFont", tc.desc, err)
+		}
+	}
+}
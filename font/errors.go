@@ -0,0 +1,110 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidFont is the error returned, possibly wrapped, for malformed font
+// data. All of the Err* error types in this package match ErrInvalidFont when
+// checked with errors.Is, so that callers who do not need the details can
+// write:
+//
+//	if errors.Is(err, font.ErrInvalidFont) { etc }
+var ErrInvalidFont = errors.New("font-go: invalid font")
+
+// ErrMissingTable is the error for a font that lacks a required table.
+type ErrMissingTable struct {
+	Tag Tag
+}
+
+func (e ErrMissingTable) Error() string {
+	return fmt.Sprintf("font-go: missing %q table", e.Tag)
+}
+
+func (e ErrMissingTable) Is(target error) bool { return target == ErrInvalidFont }
+
+// ErrTableOutOfBounds is the error for a table whose offset and length, given
+// by the table directory, extend past the end of the font data.
+type ErrTableOutOfBounds struct {
+	Tag    Tag
+	Offset uint32
+	Length uint32
+}
+
+func (e ErrTableOutOfBounds) Error() string {
+	return fmt.Sprintf("font-go: %q table (offset %d, length %d) is out of bounds", e.Tag, e.Offset, e.Length)
+}
+
+func (e ErrTableOutOfBounds) Is(target error) bool { return target == ErrInvalidFont }
+
+// ErrTableTooShort is the error for a table that is shorter than its format,
+// or the rest of the font, requires.
+type ErrTableTooShort struct {
+	Tag       Tag
+	Length    int
+	MinLength int
+}
+
+func (e ErrTableTooShort) Error() string {
+	return fmt.Sprintf("font-go: %q table has length %d, want at least %d", e.Tag, e.Length, e.MinLength)
+}
+
+func (e ErrTableTooShort) Is(target error) bool { return target == ErrInvalidFont }
+
+// ErrUnsupportedFormat is the error for data that may be valid, but whose
+// format or version is not supported by this package. A zero Tag means the
+// format of the font file as a whole, such as a 'typ1' PostScript font.
+type ErrUnsupportedFormat struct {
+	Tag    Tag
+	Format uint32
+}
+
+func (e ErrUnsupportedFormat) Error() string {
+	if e.Tag == 0 {
+		return fmt.Sprintf("font-go: unsupported font format %#08x", e.Format)
+	}
+	return fmt.Sprintf("font-go: unsupported %q table format %d", e.Tag, e.Format)
+}
+
+func (e ErrUnsupportedFormat) Is(target error) bool { return target == ErrInvalidFont }
+
+// ErrInvalidTable is the error for a table that is well-formed, as far as its
+// length is concerned, but whose contents are invalid.
+type ErrInvalidTable struct {
+	Tag    Tag
+	Reason string
+}
+
+func (e ErrInvalidTable) Error() string {
+	return fmt.Sprintf("font-go: invalid %q table: %s", e.Tag, e.Reason)
+}
+
+func (e ErrInvalidTable) Is(target error) bool { return target == ErrInvalidFont }
+
+// ErrInvalidGlyph is the error for malformed glyph data.
+type ErrInvalidGlyph struct {
+	Reason string
+}
+
+func (e ErrInvalidGlyph) Error() string {
+	return "font-go: invalid glyph: " + e.Reason
+}
+
+func (e ErrInvalidGlyph) Is(target error) bool { return target == ErrInvalidFont }
+
+var errGlyphTruncated = ErrInvalidGlyph{"glyph data is truncated"}
@@ -0,0 +1,209 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"image"
+	"math"
+
+	"github.com/google/font-go/raster"
+	xfont "golang.org/x/image/font"
+	"golang.org/x/image/math/f32"
+	"golang.org/x/image/math/fixed"
+)
+
+// FaceOptions are optional arguments to NewFace.
+type FaceOptions struct {
+	// Size is the font size in points, as in "a 10 point font size". A zero
+	// value means to use a 12 point font size.
+	Size float64
+	// DPI is the dots-per-inch resolution. A zero value means to use 72 DPI.
+	DPI float64
+}
+
+// Face is a Font at a particular size. It implements the
+// golang.org/x/image/font.Face interface, so that it can be used with a
+// golang.org/x/image/font.Drawer.
+//
+// A Face is not safe for concurrent use by multiple goroutines, as the mask
+// returned by Glyph is re-used by subsequent calls.
+type Face struct {
+	f     *Font
+	ppem  float32
+	scale float32
+	mask  image.Alpha
+	z     raster.Rasterizer
+	// kern is the GPOS table's pair adjustment lookups for kerning.
+	kern []lookup
+}
+
+var _ xfont.Face = (*Face)(nil)
+
+// NewFace returns a Face for f. The opts may be nil.
+func NewFace(f *Font, opts *FaceOptions) *Face {
+	size, dpi := 12.0, 72.0
+	if opts != nil {
+		if opts.Size > 0 {
+			size = opts.Size
+		}
+		if opts.DPI > 0 {
+			dpi = opts.DPI
+		}
+	}
+	ppem := float32(size * dpi / 72)
+	return &Face{
+		f:     f,
+		ppem:  ppem,
+		scale: f.Scale(ppem),
+		kern:  f.kernLookups(),
+	}
+}
+
+// Close satisfies the golang.org/x/image/font.Face interface.
+func (a *Face) Close() error { return nil }
+
+// Glyph satisfies the golang.org/x/image/font.Face interface. The returned
+// mask is only valid until the next call to Glyph. Runes that the font does
+// not map are drawn with its .notdef glyph, glyph 0, as they are measured by
+// GlyphBounds and GlyphAdvance. It returns !ok if the glyph is malformed.
+func (a *Face) Glyph(dot fixed.Point26_6, r rune) (
+	dr image.Rectangle, mask image.Image, maskp image.Point, advance fixed.Int26_6, ok bool) {
+
+	glyphID := a.f.GlyphIndex(r)
+	m, err := a.f.HMetrics(glyphID)
+	if err != nil {
+		return image.Rectangle{}, nil, image.Point{}, 0, false
+	}
+	advance = a.toInt26_6(m.AdvanceWidth)
+
+	g, err := a.f.Glyph(glyphID)
+	if err != nil {
+		return image.Rectangle{}, nil, image.Point{}, 0, false
+	}
+	x := float64(dot.X) / 64
+	y := float64(dot.Y) / 64
+	xMin, yMin, xMax, yMax := g.bounds()
+	dr = image.Rectangle{
+		Min: image.Point{
+			X: int(math.Floor(x + a.pixels(xMin))),
+			Y: int(math.Floor(y - a.pixels(yMax))),
+		},
+		Max: image.Point{
+			X: int(math.Ceil(x + a.pixels(xMax))),
+			Y: int(math.Ceil(y - a.pixels(yMin))),
+		},
+	}
+	if g == nil || dr.Empty() {
+		a.mask = image.Alpha{Pix: a.mask.Pix[:0]}
+		return image.Rectangle{}, &a.mask, image.Point{}, advance, true
+	}
+
+	w, h := dr.Dx(), dr.Dy()
+	if a.z == nil || a.z.Bounds() != (image.Rectangle{Max: image.Point{w, h}}) {
+		a.z = raster.New(w, h, a.ppem)
+	} else {
+		a.z.Reset()
+	}
+	err = a.f.Outline(a.z, g, f32.Aff3{
+		+a.scale, 0, float32(x - float64(dr.Min.X)),
+		0, -a.scale, float32(y - float64(dr.Min.Y)),
+	})
+	if err != nil {
+		return image.Rectangle{}, nil, image.Point{}, 0, false
+	}
+	if n := w * h; cap(a.mask.Pix) < n {
+		a.mask.Pix = make([]uint8, n)
+	} else {
+		a.mask.Pix = a.mask.Pix[:n]
+		for i := range a.mask.Pix {
+			a.mask.Pix[i] = 0
+		}
+	}
+	a.mask.Stride = w
+	a.mask.Rect = a.z.Bounds()
+	a.z.Accumulate(&a.mask)
+	return dr, &a.mask, image.Point{}, advance, true
+}
+
+// GlyphBounds satisfies the golang.org/x/image/font.Face interface.
+func (a *Face) GlyphBounds(r rune) (bounds fixed.Rectangle26_6, advance fixed.Int26_6, ok bool) {
+	glyphID := a.f.GlyphIndex(r)
+	m, err := a.f.HMetrics(glyphID)
+	if err != nil {
+		return fixed.Rectangle26_6{}, 0, false
+	}
+	g, err := a.f.Glyph(glyphID)
+	if err != nil {
+		return fixed.Rectangle26_6{}, 0, false
+	}
+	xMin, yMin, xMax, yMax := g.bounds()
+	bounds = fixed.Rectangle26_6{
+		Min: fixed.Point26_6{
+			X: fixed.Int26_6(math.Floor(+a.pixels(xMin) * 64)),
+			Y: fixed.Int26_6(math.Floor(-a.pixels(yMax) * 64)),
+		},
+		Max: fixed.Point26_6{
+			X: fixed.Int26_6(math.Ceil(+a.pixels(xMax) * 64)),
+			Y: fixed.Int26_6(math.Ceil(-a.pixels(yMin) * 64)),
+		},
+	}
+	return bounds, a.toInt26_6(m.AdvanceWidth), true
+}
+
+// GlyphAdvance satisfies the golang.org/x/image/font.Face interface.
+func (a *Face) GlyphAdvance(r rune) (advance fixed.Int26_6, ok bool) {
+	m, err := a.f.HMetrics(a.f.GlyphIndex(r))
+	if err != nil {
+		return 0, false
+	}
+	return a.toInt26_6(m.AdvanceWidth), true
+}
+
+// Kern satisfies the golang.org/x/image/font.Face interface. It is the change
+// to the first glyph's advance by the pair adjustments of the GPOS table's
+// kern feature or, if the font has no GPOS table, by the legacy kern table.
+// Unlike Position, it applies no other lookups, such as contextual kerning.
+func (a *Face) Kern(r0, r1 rune) fixed.Int26_6 {
+	g0, g1 := a.f.GlyphIndex(r0), a.f.GlyphIndex(r1)
+	if a.f.gpos.lookups == nil {
+		return a.toInt26_6(a.f.kern.kern(g0, g1))
+	}
+	return a.toInt26_6(a.f.pairAdjustment(a.kern, g0, g1))
+}
+
+// Metrics satisfies the golang.org/x/image/font.Face interface.
+func (a *Face) Metrics() xfont.Metrics {
+	h := a.f.hhea
+	return xfont.Metrics{
+		Height:  a.toInt26_6(h.ascender() - h.descender() + h.lineGap()),
+		Ascent:  a.toInt26_6(+h.ascender()),
+		Descent: a.toInt26_6(-h.descender()),
+		CaretSlope: image.Point{
+			X: h.caretSlopeRun(),
+			Y: h.caretSlopeRise(),
+		},
+	}
+}
+
+// pixels converts from font units to pixels. It multiplies before dividing,
+// instead of using a.scale, so that exact results are not subject to rounding.
+func (a *Face) pixels(v int) float64 {
+	return float64(v) * float64(a.ppem) / float64(a.f.head.unitsPerEm())
+}
+
+// toInt26_6 converts from font units to 26.6 fixed point pixels.
+func (a *Face) toInt26_6(v int) fixed.Int26_6 {
+	return fixed.Int26_6(math.Round(a.pixels(v) * 64))
+}
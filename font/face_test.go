@@ -0,0 +1,208 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"image"
+	"testing"
+
+	xfont "golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+func TestFaceMetrics(t *testing.T) {
+	// At 100 ppem and 1000 units per em, one font unit is 0.1 pixels.
+	a := NewFace(testFont(t), &FaceOptions{Size: 100, DPI: 72})
+
+	got := a.Metrics()
+	want := xfont.Metrics{
+		Height:     fixed.I(100),
+		Ascent:     fixed.I(80),
+		Descent:    fixed.I(20),
+		CaretSlope: image.Point{0, 1},
+	}
+	if got != want {
+		t.Errorf("Metrics:\ngot  %+v\nwant %+v", got, want)
+	}
+
+	bounds, advance, ok := a.GlyphBounds('a')
+	wantBounds := fixed.R(10, -40, 50, 0)
+	if !ok || bounds != wantBounds || advance != fixed.I(60) {
+		t.Errorf("GlyphBounds('a'): got %v, %v, %t, want %v, %v, true",
+			bounds, advance, ok, wantBounds, fixed.I(60))
+	}
+
+	if advance, ok := a.GlyphAdvance(' '); !ok || advance != fixed.I(70) {
+		t.Errorf("GlyphAdvance(' '): got %v, %t, want %v, true", advance, ok, fixed.I(70))
+	}
+	// Unmapped runes are measured as the .notdef glyph.
+	if advance, ok := a.GlyphAdvance('c'); !ok || advance != fixed.I(50) {
+		t.Errorf("GlyphAdvance('c'): got %v, %t, want %v, true", advance, ok, fixed.I(50))
+	}
+}
+
+func TestFaceNotdef(t *testing.T) {
+	m := buildTables(
+		[][]byte{buildSimpleGlyph(testSquare), buildSimpleGlyph(testDiamond)},
+		[]int{600, 700},
+		map[rune]GlyphID{'b': 1},
+	)
+	f, err := Parse(buildFont(m))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	a := NewFace(f, &FaceOptions{Size: 100, DPI: 72})
+	dr, mask, _, advance, ok := a.Glyph(fixed.P(5, 80), 'c')
+	if !ok || dr != image.Rect(15, 40, 55, 80) || advance != fixed.I(60) {
+		t.Fatalf("Glyph('c'): got %v, %v, %t, want %v, %v, true", dr, advance, ok, image.Rect(15, 40, 55, 80), fixed.I(60))
+	}
+	if got := mask.(*image.Alpha).AlphaAt(20, 20).A; got != 0xff {
+		t.Errorf("Glyph('c'): got mask alpha %#02x inside the square, want 0xff", got)
+	}
+	if _, _, ok := a.GlyphBounds('c'); !ok {
+		t.Errorf("GlyphBounds('c'): got !ok, want ok")
+	}
+}
+
+func TestFaceDrawer(t *testing.T) {
+	dst := image.NewAlpha(image.Rect(0, 0, 200, 100))
+	d := xfont.Drawer{
+		Dst:  dst,
+		Src:  image.Opaque,
+		Face: NewFace(testFont(t), &FaceOptions{Size: 100, DPI: 72}),
+		Dot:  fixed.P(5, 80),
+	}
+	if got, want := d.MeasureString("a b"), fixed.I(60+70+70); got != want {
+		t.Errorf("MeasureString: got %v, want %v", got, want)
+	}
+	d.DrawString("a b")
+	if got, want := d.Dot, fixed.P(5+60+70+70, 80); got != want {
+		t.Errorf("Dot: got %v, want %v", got, want)
+	}
+
+	testCases := []struct {
+		x, y int
+		want uint8
+	}{
+		// Inside and outside the square for 'a', which spans x in [15, 55]
+		// and y in [40, 80].
+		{35, 60, 0xff},
+		{12, 60, 0x00},
+		{35, 30, 0x00},
+		{35, 90, 0x00},
+		// The space draws nothing.
+		{100, 60, 0x00},
+		// Inside the diamond for 'b', which spans x in [145, 185].
+		{165, 60, 0xff},
+		{147, 42, 0x00},
+	}
+	for _, tc := range testCases {
+		if got := dst.AlphaAt(tc.x, tc.y).A; got != tc.want {
+			t.Errorf("(%d, %d): got %#02x, want %#02x", tc.x, tc.y, got, tc.want)
+		}
+	}
+}
+
+func TestFaceGlyphMask(t *testing.T) {
+	a := NewFace(testFont(t), &FaceOptions{Size: 100, DPI: 72})
+	_, mask, _, _, ok := a.Glyph(fixed.P(5, 80), 'a')
+	if !ok {
+		t.Fatalf("Glyph('a'): got !ok, want ok")
+	}
+	square := append([]uint8(nil), mask.(*image.Alpha).Pix...)
+	pix := &mask.(*image.Alpha).Pix[0]
+
+	// Glyph reuses the mask's pixels, which must not keep the square's
+	// corners when it draws the diamond.
+	_, mask, _, _, ok = a.Glyph(fixed.P(5, 80), 'b')
+	if !ok {
+		t.Fatalf("Glyph('b'): got !ok, want ok")
+	}
+	m := mask.(*image.Alpha)
+	if &m.Pix[0] != pix {
+		t.Errorf("Glyph('b'): mask pixels were reallocated")
+	}
+	if got := m.AlphaAt(m.Rect.Min.X, m.Rect.Min.Y).A; got != 0 {
+		t.Errorf("Glyph('b'): got mask alpha %#02x at the corner, want 0", got)
+	}
+
+	_, mask, _, _, _ = a.Glyph(fixed.P(5, 80), 'a')
+	if got := mask.(*image.Alpha).Pix; string(got) != string(square) {
+		t.Errorf("Glyph('a'): mask changed after drawing another glyph")
+	}
+}
+
+func TestFaceKern(t *testing.T) {
+	m := testTables()
+	m["kern"] = buildKernMicrosoft(0x0001, buildKern0(testKernPair{1, 2, -50}))
+	f, err := Parse(buildFont(m))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	a := NewFace(f, &FaceOptions{Size: 100, DPI: 72})
+	if got, want := a.Kern('a', 'b'), fixed.I(-5); got != want {
+		t.Errorf("Kern('a', 'b'): got %v, want %v", got, want)
+	}
+	if got := a.Kern('b', 'a'); got != 0 {
+		t.Errorf("Kern('b', 'a'): got %v, want 0", got)
+	}
+
+	d := xfont.Drawer{Face: a}
+	if got, want := d.MeasureString("ab"), fixed.I(60+70-5); got != want {
+		t.Errorf("MeasureString: got %v, want %v", got, want)
+	}
+
+	// Fonts that kern with GPOS pair adjustments, which Position applies
+	// instead of the kern table.
+	m["GPOS"] = buildLayoutTable(
+		[]testScript{{tag: "DFLT", features: []int{0}}},
+		[]testFeature{{"kern", []int{0}}},
+		buildLookup(gposPair, 0, buildTable(
+			be16(1), off16(buildCoverage(1)), be16(valueXAdvance), be16(0), be16(1),
+			off16(cat(be16(1), be16(2), be16(-80))),
+		)),
+	)
+	if f, err = Parse(buildFont(m)); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	a = NewFace(f, &FaceOptions{Size: 100, DPI: 72})
+	if got, want := a.Kern('a', 'b'), fixed.I(-8); got != want {
+		t.Errorf("GPOS: Kern('a', 'b'): got %v, want %v", got, want)
+	}
+	if got := a.Kern('b', 'a'); got != 0 {
+		t.Errorf("GPOS: Kern('b', 'a'): got %v, want 0", got)
+	}
+
+	// The pair adjustments of every kern lookup add up, and those of other
+	// features do not apply.
+	pair := func(v int) []byte {
+		return buildLookup(gposPair, 0, buildTable(
+			be16(1), off16(buildCoverage(1)), be16(valueXAdvance), be16(0), be16(1),
+			off16(cat(be16(1), be16(2), be16(v))),
+		))
+	}
+	m["GPOS"] = buildLayoutTable(
+		[]testScript{{tag: "DFLT", features: []int{0, 1}}},
+		[]testFeature{{"dist", []int{2}}, {"kern", []int{0, 1}}},
+		pair(-80), pair(-20), pair(-1000),
+	)
+	if f, err = Parse(buildFont(m)); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	a = NewFace(f, &FaceOptions{Size: 100, DPI: 72})
+	if got, want := a.Kern('a', 'b'), fixed.I(-10); got != want {
+		t.Errorf("GPOS lookups: Kern('a', 'b'): got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,987 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package font implements a parser for TrueType and OpenType fonts.
+package font
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"golang.org/x/image/math/f32"
+)
+
+// Flags for simple (non-compound) glyphs.
+const (
+	flagOnCurve      = 1 << 0 // 0x0001
+	flagXShortVector = 1 << 1 // 0x0002
+	flagYShortVector = 1 << 2 // 0x0004
+	flagRepeat       = 1 << 3 // 0x0008
+
+	// The same flag bits are overloaded to have two meanings, dependent on the
+	// value of the flag{X,Y}ShortVector bits.
+	flagPositiveXShortVector = 1 << 4 // 0x0010
+	flagThisXIsSame          = 1 << 4 // 0x0010
+	flagPositiveYShortVector = 1 << 5 // 0x0020
+	flagThisYIsSame          = 1 << 5 // 0x0020
+	flagOverlapSimple        = 1 << 6 // 0x0040
+)
+
+// Flags for compound glyphs.
+const (
+	flagArg1And2AreWords        = 1 << 0  // 0x0001
+	flagArgsAreXYValues         = 1 << 1  // 0x0002
+	flagRoundXYToGrid           = 1 << 2  // 0x0004
+	flagWeHaveAScale            = 1 << 3  // 0x0008
+	flagUnused4                 = 1 << 4  // 0x0010
+	flagMoreComponents          = 1 << 5  // 0x0020
+	flagWeHaveAnXAndYScale      = 1 << 6  // 0x0040
+	flagWeHaveATwoByTwo         = 1 << 7  // 0x0080
+	flagWeHaveInstructions      = 1 << 8  // 0x0100
+	flagUseMyMetrics            = 1 << 9  // 0x0200
+	flagOverlapCompound         = 1 << 10 // 0x0400
+	flagScaledComponentOffset   = 1 << 11 // 0x0800
+	flagUnscaledComponentOffset = 1 << 12 // 0x1000
+)
+
+func max(x, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+func i16(b []byte, i int32) int16 {
+	return int16(uint16(b[i+0])<<8 | uint16(b[i+1])<<0)
+}
+
+func u16(b []byte, i int32) uint16 {
+	return uint16(b[i+0])<<8 | uint16(b[i+1])<<0
+}
+
+func u24(b []byte, i int32) uint32 {
+	return uint32(b[i+0])<<16 | uint32(b[i+1])<<8 | uint32(b[i+2])<<0
+}
+
+func u32(b []byte, i int32) uint32 {
+	return uint32(b[i+0])<<24 | uint32(b[i+1])<<16 | uint32(b[i+2])<<8 | uint32(b[i+3])<<0
+}
+
+// Tag is a four byte tag, such as a table tag, stored as a big-endian uint32.
+type Tag uint32
+
+// MakeTag returns the Tag for the four byte string s, such as "glyf". It
+// panics if s is not four bytes long.
+func MakeTag(s string) Tag {
+	if len(s) != 4 {
+		panic("font-go: tag string is not four bytes long")
+	}
+	return Tag(s[0])<<24 | Tag(s[1])<<16 | Tag(s[2])<<8 | Tag(s[3])
+}
+
+// String returns the tag's four byte string.
+func (t Tag) String() string {
+	return string([]byte{byte(t >> 24), byte(t >> 16), byte(t >> 8), byte(t)})
+}
+
+// sfnt versions, the first four bytes of a font file.
+const (
+	sfntVersionTrueType = 0x00010000
+	sfntVersionApple    = 0x74727565 // "true".
+	sfntVersionCFF      = 0x4f54544f // "OTTO".
+)
+
+// Minimum table lengths.
+const (
+	headLen     = 54
+	maxpLen05   = 6
+	maxpLen10   = 32
+	dirEntryLen = 16
+)
+
+// Parse parses a TrueType, CFF or CFF2 based OpenType font from its encoded
+// form.
+// Errors for malformed fonts match ErrInvalidFont, when checked with
+// errors.Is, and are one of the Err* types in this package, when checked with
+// errors.As.
+//
+// The returned Font retains a reference to b, which should not be modified.
+//
+// Parse also accepts WOFF and WOFF2 web fonts, which it decodes to a new
+// buffer, so that the returned Font does not refer to b.
+//
+// Font collections, such as .ttc files, are parsed by ParseCollection.
+func Parse(b []byte) (*Font, error) {
+	b, err := decodeWebFont(b)
+	if err != nil {
+		return nil, err
+	}
+	return parse(b, 0)
+}
+
+// parse parses the font whose offset table starts at b[offset:]. Table offsets
+// are relative to the start of b, which, for font collections, is the start
+// of the collection.
+func parse(b []byte, offset uint32) (*Font, error) {
+	if uint64(len(b)) < uint64(offset)+12 {
+		return nil, fmt.Errorf("%w: %d bytes is too short for an sfnt header at offset %d", ErrInvalidFont, len(b), offset)
+	}
+	dir := b[offset:]
+	version := u32(dir, 0)
+	switch version {
+	case sfntVersionTrueType, sfntVersionApple, sfntVersionCFF:
+	default:
+		return nil, ErrUnsupportedFormat{Format: version}
+	}
+	n := int(u16(dir, 4))
+	if len(dir) < 12+n*dirEntryLen {
+		return nil, fmt.Errorf("%w: table directory with %d entries is truncated", ErrInvalidFont, n)
+	}
+	f := &Font{}
+	for i := 0; i < n; i++ {
+		header := dir[12+dirEntryLen*(i+0) : 12+dirEntryLen*(i+1)]
+		tag := Tag(u32(header, 0))
+		offset := u32(header, 8)
+		length := u32(header, 12)
+		if uint64(offset)+uint64(length) > uint64(len(b)) {
+			return nil, ErrTableOutOfBounds{Tag: tag, Offset: offset, Length: length}
+		}
+		table := b[offset : offset+length]
+
+		switch tag.String() {
+		case "avar":
+			a, err := parseAvar(table)
+			if err != nil {
+				return nil, err
+			}
+			f.avar = a
+		case "CFF ":
+			c, err := parseCFF(table)
+			if err != nil {
+				return nil, err
+			}
+			f.cff = c
+		case "CFF2":
+			c, err := parseCFF2(table)
+			if err != nil {
+				return nil, err
+			}
+			f.cff = c
+		case "cmap":
+			c, err := parseCmap(table)
+			if err != nil {
+				return nil, err
+			}
+			f.cmap = c
+		case "COLR":
+			c, err := parseCOLR(table)
+			if err != nil {
+				return nil, err
+			}
+			f.colr = c
+		case "CPAL":
+			p, err := parseCPAL(table)
+			if err != nil {
+				return nil, err
+			}
+			f.cpal = p
+		case "fvar":
+			v, err := parseFvar(table)
+			if err != nil {
+				return nil, err
+			}
+			f.fvar = v
+		case "GDEF":
+			g, err := parseGDEF(table)
+			if err != nil {
+				return nil, err
+			}
+			f.gdef = g
+		case "GPOS":
+			t, err := parseLayoutTable("GPOS", table, gposExtension)
+			if err != nil {
+				return nil, err
+			}
+			f.gpos = t
+		case "GSUB":
+			t, err := parseLayoutTable("GSUB", table, gsubExtension)
+			if err != nil {
+				return nil, err
+			}
+			f.gsub = t
+		case "glyf":
+			f.glyf = glyf(table)
+		case "gvar":
+			g, err := parseGvar(table)
+			if err != nil {
+				return nil, err
+			}
+			f.gvar = g
+		case "head":
+			f.head = head(table)
+		case "hhea":
+			f.hhea = hhea(table)
+		case "hmtx":
+			f.hmtx = hmtx(table)
+		case "HVAR":
+			h, err := parseHVAR(table)
+			if err != nil {
+				return nil, err
+			}
+			f.hvar = h
+		case "kern":
+			k, err := parseKern(table)
+			if err != nil {
+				return nil, err
+			}
+			f.kern = k
+		case "loca":
+			f.loca = loca(table)
+		case "maxp":
+			f.maxp = maxp(table)
+		case "name":
+			n, err := parseName(table)
+			if err != nil {
+				return nil, err
+			}
+			f.name = n
+		case "OS/2":
+			f.os2 = os2(table)
+		case "post":
+			p, err := parsePost(table)
+			if err != nil {
+				return nil, err
+			}
+			f.post = p
+		case "vhea":
+			f.vhea = vhea(table)
+		case "vmtx":
+			f.vmtx = vmtx(table)
+		}
+	}
+	if version == sfntVersionCFF && f.cff == nil {
+		return nil, ErrMissingTable{Tag: cffTag}
+	}
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// validate checks that the required tables are present and consistent with
+// each other, so that later look-ups can rely on their lengths. Fonts with a
+// CFF or CFF2 table need no glyf or loca table.
+func (f *Font) validate() error {
+	for _, t := range []struct {
+		tag  string
+		data []byte
+	}{
+		{"glyf", f.glyf},
+		{"head", f.head},
+		{"hhea", f.hhea},
+		{"hmtx", f.hmtx},
+		{"loca", f.loca},
+		{"maxp", f.maxp},
+	} {
+		if t.data == nil && !(f.cff != nil && (t.tag == "glyf" || t.tag == "loca")) {
+			return ErrMissingTable{Tag: MakeTag(t.tag)}
+		}
+	}
+
+	if len(f.head) < headLen {
+		return ErrTableTooShort{Tag: MakeTag("head"), Length: len(f.head), MinLength: headLen}
+	}
+	if u := f.head.unitsPerEm(); u < 16 || 16384 < u {
+		return ErrInvalidTable{Tag: MakeTag("head"), Reason: fmt.Sprintf("unitsPerEm %d is out of range", u)}
+	}
+	indexToLocFormat := f.head.indexToLocFormat()
+	if indexToLocFormat != 0 && indexToLocFormat != 1 {
+		return ErrUnsupportedFormat{Tag: MakeTag("head"), Format: uint32(indexToLocFormat)}
+	}
+
+	if len(f.maxp) < maxpLen05 {
+		return ErrTableTooShort{Tag: MakeTag("maxp"), Length: len(f.maxp), MinLength: maxpLen05}
+	}
+	switch v := u32(f.maxp, 0); v {
+	case 0x00005000:
+	case 0x00010000:
+		if len(f.maxp) < maxpLen10 {
+			return ErrTableTooShort{Tag: MakeTag("maxp"), Length: len(f.maxp), MinLength: maxpLen10}
+		}
+	default:
+		return ErrUnsupportedFormat{Tag: MakeTag("maxp"), Format: v}
+	}
+
+	numGlyphs := f.maxp.numGlyphs()
+	if f.cff != nil {
+		if n := f.cff.charStrings.count; n < numGlyphs {
+			return ErrInvalidTable{Tag: f.cff.tag(), Reason: fmt.Sprintf("%d charstrings is fewer than %d glyphs", n, numGlyphs)}
+		}
+	} else if want := (numGlyphs + 1) * (2 << uint(indexToLocFormat)); len(f.loca) < want {
+		return ErrTableTooShort{Tag: MakeTag("loca"), Length: len(f.loca), MinLength: want}
+	}
+
+	if len(f.hhea) < hheaLen {
+		return ErrTableTooShort{Tag: MakeTag("hhea"), Length: len(f.hhea), MinLength: hheaLen}
+	}
+	n := f.hhea.numberOfHMetrics()
+	if n == 0 && numGlyphs > 0 {
+		return ErrInvalidTable{Tag: MakeTag("hhea"), Reason: "numberOfHMetrics is zero"}
+	}
+	if want := 4*n + 2*max(numGlyphs-n, 0); len(f.hmtx) < want {
+		return ErrTableTooShort{Tag: MakeTag("hmtx"), Length: len(f.hmtx), MinLength: want}
+	}
+
+	if f.vhea != nil {
+		if len(f.vhea) < vheaLen {
+			return ErrTableTooShort{Tag: MakeTag("vhea"), Length: len(f.vhea), MinLength: vheaLen}
+		}
+		n := f.vhea.numOfLongVerMetrics()
+		if n == 0 && numGlyphs > 0 {
+			return ErrInvalidTable{Tag: MakeTag("vhea"), Reason: "numOfLongVerMetrics is zero"}
+		}
+		if f.vmtx == nil {
+			return ErrMissingTable{Tag: MakeTag("vmtx")}
+		}
+		if want := 4*n + 2*max(numGlyphs-n, 0); len(f.vmtx) < want {
+			return ErrTableTooShort{Tag: MakeTag("vmtx"), Length: len(f.vmtx), MinLength: want}
+		}
+	}
+	return nil
+}
+
+// GlyphID is a glyph index in a Font.
+type GlyphID uint16
+
+// Font is a parsed TrueType, CFF or CFF2 based OpenType font.
+type Font struct {
+	avar avar
+	cff  *cff
+	cmap cmap
+	colr *colr
+	cpal cpal
+	fvar fvar
+	gdef gdef
+	glyf glyf
+	gpos layoutTable
+	gsub layoutTable
+	gvar *gvar
+	head head
+	hhea hhea
+	hmtx hmtx
+	hvar *hvar
+	kern kern
+	loca loca
+	maxp maxp
+	name name
+	os2  os2
+	post post
+	vhea vhea
+	vmtx vmtx
+
+	// coords are the normalized variation coordinates, one per variation
+	// axis, in the range [-1, 1]. Nil coords are the default instance.
+	coords []float32
+}
+
+// SetNormalizedCoords sets the instance of a variable font that f's outlines,
+// metrics and positioning are for, as normalized coordinates, one per
+// variation axis, in the range [-1, 1]. Coordinates outside that range are
+// clamped, and missing ones are zero. Nil coords select the default instance.
+//
+// SetVariation sets the instance from user coordinates instead, such as 700
+// for a bold weight.
+func (f *Font) SetNormalizedCoords(coords []float32) {
+	if len(coords) == 0 {
+		f.coords = nil
+		return
+	}
+	f.coords = make([]float32, len(coords))
+	for i, c := range coords {
+		switch {
+		case c < -1:
+			c = -1
+		case c > 1:
+			c = 1
+		case c != c:
+			// NaN.
+			c = 0
+		}
+		f.coords[i] = c
+	}
+}
+
+// Scale returns the factor that converts from font units to pixels at the
+// given pixels per em.
+func (f *Font) Scale(ppem float32) float32 {
+	return ppem / float32(f.head.unitsPerEm())
+}
+
+// Glyph returns the glyph data for the given glyph ID. It returns nil data and
+// a nil error if the glyph has no outline, such as for a space.
+//
+// For a TrueType variable font at other than its default instance, the glyph
+// data is that of the varied glyph, without hinting instructions.
+func (f *Font) Glyph(glyphID GlyphID) (Glyph, error) {
+	return f.glyph(glyphID, nil, &compoundWalk{})
+}
+
+// glyph is like Glyph, for a sub-glyph of the compound glyphs whose IDs are
+// path, if any. w counts the sub-glyphs visited so far.
+func (f *Font) glyph(glyphID GlyphID, path []GlyphID, w *compoundWalk) (Glyph, error) {
+	if int(glyphID) >= f.maxp.numGlyphs() {
+		return nil, ErrInvalidGlyph{fmt.Sprintf("glyph ID %d is out of range", glyphID)}
+	}
+	if f.cff != nil {
+		return f.cff.glyph(glyphID, f.coords)
+	}
+	b, err := f.glyfData(glyphID)
+	if b == nil || err != nil || f.gvar == nil || f.coords == nil {
+		return b, err
+	}
+	b, _, err = f.varyGlyph(glyphID, b, path, w)
+	return b, err
+}
+
+// glyfData returns the glyph's data in the glyf table, before any variation.
+func (f *Font) glyfData(glyphID GlyphID) (Glyph, error) {
+	// validate checked that the loca table is long enough for every glyph ID
+	// less than numGlyphs.
+	lo, hi := f.loca.glyfRange(glyphID, f.head.indexToLocFormat())
+	if lo == hi {
+		return nil, nil
+	}
+	if lo > hi || hi > uint32(len(f.glyf)) {
+		return nil, ErrInvalidGlyph{fmt.Sprintf("glyph ID %d has an invalid glyf range [%d, %d)", glyphID, lo, hi)}
+	}
+	if n := hi - lo; n < minGlyphDataLen || maxGlyphDataLen < n {
+		return nil, ErrInvalidGlyph{fmt.Sprintf("glyph ID %d has an invalid length %d", glyphID, n)}
+	}
+	return Glyph(f.glyf[lo:hi]), nil
+}
+
+// GlyphIndex returns the glyph ID for the given rune. It returns 0, the
+// .notdef glyph, if the font has no cmap table or no glyph for r.
+func (f *Font) GlyphIndex(r rune) GlyphID {
+	return f.cmap.glyphIndex(r)
+}
+
+// GlyphIndexVariant returns the glyph ID for the Unicode variation sequence of
+// the rune r followed by the variation selector vs, such as U+FE0F for emoji
+// presentation. If the font has no glyph specific to that sequence, it returns
+// GlyphIndex(r), as the variation selector should then be ignored.
+func (f *Font) GlyphIndexVariant(r, vs rune) GlyphID {
+	return f.cmap.glyphIndexVariant(r, vs)
+}
+
+type glyf []byte
+
+type head []byte
+
+func (b head) indexToLocFormat() int { return int(u16(b, 50)) }
+func (b head) unitsPerEm() int       { return int(u16(b, 18)) }
+
+type loca []byte
+
+// glyfRange returns the range of the glyph's data in the glyf table. The
+// caller must check that the loca table has an entry for glyphID + 1.
+func (b loca) glyfRange(glyphID GlyphID, indexToLocFormat int) (lo, hi uint32) {
+	if indexToLocFormat == 0 {
+		lo = 2 * uint32(u16(b, 2*int32(glyphID)+0))
+		hi = 2 * uint32(u16(b, 2*int32(glyphID)+2))
+	} else {
+		lo = u32(b, 4*int32(glyphID)+0)
+		hi = u32(b, 4*int32(glyphID)+4)
+	}
+	return lo, hi
+}
+
+type maxp []byte
+
+func (b maxp) numGlyphs() int { return int(u16(b, 4)) }
+
+// Glyph is a glyph's encoded data, a slice of the font's glyf table.
+//
+// For CFF and CFF2 based fonts, whose glyphs are charstrings rather than glyf
+// data, a Glyph is a glyf header, with no contours and the bounding box of the
+// charstring's outline at the font's variation coordinates, followed by the
+// glyph ID.
+type Glyph []byte
+
+// SizeAndTransform returns the pixel size of the glyph's bounding box, at the
+// given scale, and the transform from font units to the pixel coordinates of a
+// rasterizer of that size. Pixel coordinates have y increasing downwards.
+func (b Glyph) SizeAndTransform(scale float32) (width, height int, t f32.Aff3) {
+	if b == nil {
+		return 0, 0, f32.Aff3{}
+	}
+	s := float64(scale)
+	bbox := image.Rectangle{
+		Min: image.Point{
+			X: int(math.Floor(+s * float64(i16(b, 2)))),
+			Y: int(math.Floor(-s * float64(i16(b, 8)))),
+		},
+		Max: image.Point{
+			X: int(math.Ceil(+s * float64(i16(b, 6)))),
+			Y: int(math.Ceil(-s * float64(i16(b, 4)))),
+		},
+	}
+	return bbox.Dx(), bbox.Dy(), f32.Aff3{
+		+scale, 0, -float32(bbox.Min.X),
+		0, -scale, -float32(bbox.Min.Y),
+	}
+}
+
+// bounds returns the glyph's bounding box in font units, with y increasing
+// upwards.
+func (b Glyph) bounds() (xMin, yMin, xMax, yMax int) {
+	if b == nil {
+		return 0, 0, 0, 0
+	}
+	return int(i16(b, 2)), int(i16(b, 4)), int(i16(b, 6)), int(i16(b, 8))
+}
+
+// glyphIter returns an iterator over the glyph's contours or sub-glyphs. If
+// the glyph data is malformed, the iterator yields nothing and its err field
+// is set.
+//
+// For simple glyphs, it checks the contour end points and the flags, so that
+// the total length of the flags and coordinates is known to be in bounds, and
+// the nextContour and nextPoint methods need no further bounds checks. For
+// compound glyphs, nextSubGlyph checks each sub-glyph record as it goes.
+func (b Glyph) glyphIter() glyphIter {
+	if b == nil {
+		return glyphIter{}
+	}
+	if len(b) < minGlyphDataLen {
+		return glyphIter{err: errGlyphTruncated}
+	}
+	nContours := int32(i16(b, 0))
+	if nContours < 0 {
+		if nContours != -1 {
+			// Negative values other than -1 are invalid.
+			return glyphIter{err: ErrInvalidGlyph{fmt.Sprintf("invalid number of contours %d", nContours)}}
+		}
+		// We have a compound glyph.
+		return glyphIter{
+			data:      b,
+			endIndex:  initialIndex,
+			nContours: nContours,
+		}
+	}
+	if nContours == 0 {
+		return glyphIter{}
+	}
+
+	// We have a simple glyph.
+	index := initialIndex + 2*int(nContours)
+	if index > len(b) {
+		return glyphIter{err: errGlyphTruncated}
+	}
+	// The contour end points must be strictly increasing, so that every
+	// contour has at least one point and the total is nPoints.
+	for i, prevEnd := initialIndex, -1; i < index; i += 2 {
+		end := int(u16(b, int32(i)))
+		if end <= prevEnd {
+			return glyphIter{err: ErrInvalidGlyph{"contour end points are not increasing"}}
+		}
+		prevEnd = end
+	}
+	// The +1 for nPoints is because the np index in the file format is
+	// inclusive, but Go's slice[:index] semantics are exclusive.
+	nPoints := 1 + int(u16(b, int32(index-2)))
+
+	// Skip the hinting instructions.
+	if index+2 > len(b) {
+		return glyphIter{err: errGlyphTruncated}
+	}
+	insnLen := int(u16(b, int32(index)))
+	index += 2 + insnLen
+	if index > len(b) {
+		return glyphIter{err: errGlyphTruncated}
+	}
+
+	flagIndex := index
+	xDataLen := 0
+	yDataLen := 0
+	for i := 0; ; {
+		if i > nPoints {
+			return glyphIter{err: ErrInvalidGlyph{"flag repeat count exceeds the number of points"}}
+		}
+		if i == nPoints {
+			break
+		}
+
+		repeatCount := 1
+		if index >= len(b) {
+			return glyphIter{err: errGlyphTruncated}
+		}
+		flag := b[index]
+		index++
+		if flag&flagRepeat != 0 {
+			if index >= len(b) {
+				return glyphIter{err: errGlyphTruncated}
+			}
+			repeatCount += int(b[index])
+			index++
+		}
+
+		xSize := 0
+		if flag&flagXShortVector != 0 {
+			xSize = 1
+		} else if flag&flagThisXIsSame == 0 {
+			xSize = 2
+		}
+		xDataLen += xSize * repeatCount
+
+		ySize := 0
+		if flag&flagYShortVector != 0 {
+			ySize = 1
+		} else if flag&flagThisYIsSame == 0 {
+			ySize = 2
+		}
+		yDataLen += ySize * repeatCount
+
+		i += repeatCount
+	}
+
+	if index+xDataLen+yDataLen > len(b) {
+		return glyphIter{err: errGlyphTruncated}
+	}
+	return glyphIter{
+		data:      b,
+		endIndex:  int32(initialIndex),
+		flagIndex: int32(flagIndex),
+		xIndex:    int32(index),
+		yIndex:    int32(index + xDataLen),
+		nContours: nContours,
+		// The -1 is because the contour-end index in the file format is
+		// inclusive, but Go's slice[:index] semantics are exclusive.
+		prevEnd: -1,
+	}
+}
+
+const (
+	initialIndex    = 10
+	minGlyphDataLen = 10
+	// maxGlyphDataLen isn't part of the spec. It is a sanity check. A slice of
+	// glyph data is typically hundreds of bytes, including hinting bytecode.
+	maxGlyphDataLen = 1024 * 1024
+)
+
+type glyphIter struct {
+	data []byte
+	err  error
+
+	// Various indices into the data slice.
+	//
+	// For simple glyphs, endIndex points to the uint16 that is the inclusive
+	// point index of the current contour's end.
+	//
+	// For compound glyphs, endIndex points to the next sub-glyph and the other
+	// xxxIndex fields are unused.
+	endIndex  int32
+	flagIndex int32
+	xIndex    int32
+	yIndex    int32
+
+	nContours int32 // -1 for compound glyphs.
+	c         int32
+	nPoints   int32
+	p         int32
+	prevEnd   int32
+
+	// Explicit points.
+	x, y    int16
+	on      bool
+	flag    uint8
+	repeats uint8
+
+	// Segments, including implicit points.
+	seg                segment
+	firstOnCurve       point
+	firstOffCurve      point
+	lastOffCurve       point
+	firstOnCurveValid  bool
+	firstOffCurveValid bool
+	lastOffCurveValid  bool
+	closing            bool
+	allDone            bool
+
+	// Sub-glyphs. The subTransform of a point matching sub-glyph, whose
+	// subArgs are point numbers rather than an offset, has no translation.
+	subGlyphID   GlyphID
+	subFlags     uint16
+	subArgs      [2]int
+	subTransform f32.Aff3
+}
+
+func (g *glyphIter) compoundGlyph() bool { return g.nContours < 0 }
+
+func (g *glyphIter) nextContour() (ok bool) {
+	if g.c == g.nContours {
+		return false
+	}
+	g.c++
+
+	end := int32(u16(g.data, g.endIndex))
+	g.endIndex += 2
+	g.nPoints = end - g.prevEnd
+	g.p = 0
+	g.prevEnd = end
+
+	g.firstOnCurveValid = false
+	g.firstOffCurveValid = false
+	g.lastOffCurveValid = false
+	g.closing = false
+	g.allDone = false
+
+	return true
+}
+
+func (g *glyphIter) nextPoint() (ok bool) {
+	// There are no bounds checks in this method, as glyphIter checked that
+	// the flags and coordinates for nPoints points are within g.data.
+	if g.p == g.nPoints {
+		return false
+	}
+	g.p++
+
+	if g.repeats > 0 {
+		g.repeats--
+	} else {
+		g.flag = g.data[g.flagIndex]
+		g.flagIndex++
+		if g.flag&flagRepeat != 0 {
+			g.repeats = g.data[g.flagIndex]
+			g.flagIndex++
+		}
+	}
+
+	if g.flag&flagXShortVector != 0 {
+		if g.flag&flagPositiveXShortVector != 0 {
+			g.x += int16(g.data[g.xIndex])
+		} else {
+			g.x -= int16(g.data[g.xIndex])
+		}
+		g.xIndex += 1
+	} else if g.flag&flagThisXIsSame == 0 {
+		g.x += i16(g.data, g.xIndex)
+		g.xIndex += 2
+	}
+
+	if g.flag&flagYShortVector != 0 {
+		if g.flag&flagPositiveYShortVector != 0 {
+			g.y += int16(g.data[g.yIndex])
+		} else {
+			g.y -= int16(g.data[g.yIndex])
+		}
+		g.yIndex += 1
+	} else if g.flag&flagThisYIsSame == 0 {
+		g.y += i16(g.data, g.yIndex)
+		g.yIndex += 2
+	}
+
+	g.on = g.flag&flagOnCurve != 0
+	return true
+}
+
+func (g *glyphIter) nextSegment() (ok bool) {
+	for {
+		if g.closing {
+			if g.allDone {
+				return false
+			}
+
+			switch {
+			case !g.firstOffCurveValid && !g.lastOffCurveValid:
+				g.allDone = true
+				g.seg = segment{op: lineTo, p: g.firstOnCurve}
+			case !g.firstOffCurveValid && g.lastOffCurveValid:
+				g.allDone = true
+				g.seg = segment{op: quadTo, p: g.lastOffCurve, q: g.firstOnCurve}
+			case g.firstOffCurveValid && !g.lastOffCurveValid:
+				g.allDone = true
+				g.seg = segment{op: quadTo, p: g.firstOffCurve, q: g.firstOnCurve}
+			case g.firstOffCurveValid && g.lastOffCurveValid:
+				g.lastOffCurveValid = false
+				g.seg = segment{
+					op: quadTo,
+					p:  g.lastOffCurve,
+					q:  midPoint(g.lastOffCurve, g.firstOffCurve),
+				}
+			}
+			return true
+		}
+
+		if !g.nextPoint() {
+			g.closing = true
+			continue
+		}
+
+		p := point{float32(g.x), float32(g.y)}
+		if !g.firstOnCurveValid {
+			if g.on {
+				g.firstOnCurve = p
+				g.firstOnCurveValid = true
+				g.seg = segment{op: moveTo, p: p}
+				return true
+			} else if !g.firstOffCurveValid {
+				g.firstOffCurve = p
+				g.firstOffCurveValid = true
+				continue
+			} else {
+				midp := midPoint(g.firstOffCurve, p)
+				g.firstOnCurve = midp
+				g.firstOnCurveValid = true
+				g.lastOffCurve = p
+				g.lastOffCurveValid = true
+				g.seg = segment{op: moveTo, p: midp}
+				return true
+			}
+
+		} else if !g.lastOffCurveValid {
+			if !g.on {
+				g.lastOffCurve = p
+				g.lastOffCurveValid = true
+				continue
+			} else {
+				g.seg = segment{op: lineTo, p: p}
+				return true
+			}
+
+		} else {
+			if !g.on {
+				midp := midPoint(g.lastOffCurve, p)
+				g.seg = segment{op: quadTo, p: g.lastOffCurve, q: midp}
+				g.lastOffCurve = p
+				g.lastOffCurveValid = true
+				return true
+			} else {
+				g.seg = segment{op: quadTo, p: g.lastOffCurve, q: p}
+				g.lastOffCurveValid = false
+				return true
+			}
+		}
+	}
+}
+
+func (g *glyphIter) nextSubGlyph() (ok bool) {
+	if g.endIndex < 0 {
+		return false
+	}
+
+	i, data := g.endIndex, g.data
+	if int(i+4) > len(data) {
+		return g.fail(errGlyphTruncated)
+	}
+	flags := u16(data, i+0)
+	g.subFlags = flags
+	g.subGlyphID = GlyphID(u16(data, i+2))
+	i += 4
+
+	n := int32(2)
+	if flags&flagArg1And2AreWords != 0 {
+		n = 4
+	}
+	if flags&flagWeHaveAScale != 0 {
+		n += 2
+	} else if flags&flagWeHaveAnXAndYScale != 0 {
+		n += 4
+	} else if flags&flagWeHaveATwoByTwo != 0 {
+		n += 8
+	}
+	if int(i+n) > len(data) {
+		return g.fail(errGlyphTruncated)
+	}
+
+	// The arguments are signed offsets, or unsigned point numbers.
+	xy := flags&flagArgsAreXYValues != 0
+	switch {
+	case flags&flagArg1And2AreWords == 0 && xy:
+		g.subArgs = [2]int{int(int8(data[i+0])), int(int8(data[i+1]))}
+		i += 2
+	case flags&flagArg1And2AreWords == 0:
+		g.subArgs = [2]int{int(data[i+0]), int(data[i+1])}
+		i += 2
+	case xy:
+		g.subArgs = [2]int{int(i16(data, i+0)), int(i16(data, i+2))}
+		i += 4
+	default:
+		g.subArgs = [2]int{int(u16(data, i+0)), int(u16(data, i+2))}
+		i += 4
+	}
+
+	// The scales are 2.14 fixed point numbers. A 2x2 matrix's elements are
+	// xscale, scale01, scale10 and yscale, which transform a point (x, y) to
+	// (xscale*x + scale10*y, scale01*x + yscale*y).
+	g.subTransform = f32.Aff3{
+		1, 0, 0,
+		0, 1, 0,
+	}
+	if flags&flagWeHaveAScale != 0 {
+		t := f2dot14(i16(data, i+0))
+		g.subTransform[0] = t
+		g.subTransform[4] = t
+		i += 2
+	} else if flags&flagWeHaveAnXAndYScale != 0 {
+		g.subTransform[0] = f2dot14(i16(data, i+0))
+		g.subTransform[4] = f2dot14(i16(data, i+2))
+		i += 4
+	} else if flags&flagWeHaveATwoByTwo != 0 {
+		g.subTransform[0] = f2dot14(i16(data, i+0))
+		g.subTransform[3] = f2dot14(i16(data, i+2))
+		g.subTransform[1] = f2dot14(i16(data, i+4))
+		g.subTransform[4] = f2dot14(i16(data, i+6))
+		i += 8
+	}
+
+	if xy {
+		dx, dy := float32(g.subArgs[0]), float32(g.subArgs[1])
+		// The offset is unscaled unless the flags say otherwise.
+		if flags&(flagScaledComponentOffset|flagUnscaledComponentOffset) == flagScaledComponentOffset {
+			m := &g.subTransform
+			dx, dy = m[0]*dx+m[1]*dy, m[3]*dx+m[4]*dy
+		}
+		g.subTransform[2] = dx
+		g.subTransform[5] = dy
+	}
+
+	if flags&flagMoreComponents == 0 {
+		// The remainder of the glyf data are hinting instructions, which we skip.
+		g.endIndex = -1
+	} else {
+		g.endIndex = i
+	}
+	return true
+}
+
+// pointMatching returns whether any of the compound glyph's remaining
+// sub-glyphs are positioned by point matching. It does not advance g.
+func (g glyphIter) pointMatching() bool {
+	for g.nextSubGlyph() {
+		if g.subFlags&flagArgsAreXYValues == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// fail stops the iteration with the given error.
+func (g *glyphIter) fail(err error) (ok bool) {
+	g.err = err
+	g.endIndex = -1
+	return false
+}
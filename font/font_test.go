@@ -0,0 +1,965 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/math/f32"
+)
+
+// The functions below construct small fonts for testing, so that the tests do
+// not depend on font files being installed.
+
+func be16(v int) []byte { return []byte{byte(v >> 8), byte(v)} }
+func be32(v int) []byte { return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)} }
+
+func cat(bs ...[]byte) []byte {
+	var ret []byte
+	for _, b := range bs {
+		ret = append(ret, b...)
+	}
+	return ret
+}
+
+// buildFont returns an sfnt font file containing the given tables, keyed by
+// their four byte tag.
+func buildFont(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	header := cat(be32(0x00010000), be16(len(tags)), be16(0), be16(0), be16(0))
+	offset := 12 + 16*len(tags)
+	var records, data []byte
+	for _, tag := range tags {
+		t := tables[tag]
+		records = append(records, tag...)
+		records = append(records, cat(be32(0), be32(offset+len(data)), be32(len(t)))...)
+		data = append(data, t...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	return cat(header, records, data)
+}
+
+type testPoint struct {
+	x, y int
+	on   bool
+}
+
+// buildSimpleGlyph returns the glyf data for a simple glyph with the given
+// contours, using the shortest encoding for each coordinate and repeating
+// identical flags.
+func buildSimpleGlyph(contours ...[]testPoint) []byte {
+	xMin, yMin, xMax, yMax := 0, 0, 0, 0
+	first := true
+	var ends, flags, xs, ys []byte
+	n, prevX, prevY := 0, 0, 0
+	for _, c := range contours {
+		for _, p := range c {
+			if first || p.x < xMin {
+				xMin = p.x
+			}
+			if first || p.y < yMin {
+				yMin = p.y
+			}
+			if first || p.x > xMax {
+				xMax = p.x
+			}
+			if first || p.y > yMax {
+				yMax = p.y
+			}
+			first = false
+
+			flag := byte(0)
+			if p.on {
+				flag |= flagOnCurve
+			}
+			dx, dy := p.x-prevX, p.y-prevY
+			prevX, prevY = p.x, p.y
+			switch {
+			case dx == 0:
+				flag |= flagThisXIsSame
+			case -0xff <= dx && dx <= +0xff:
+				flag |= flagXShortVector
+				if dx > 0 {
+					flag |= flagPositiveXShortVector
+				} else {
+					dx = -dx
+				}
+				xs = append(xs, byte(dx))
+			default:
+				xs = append(xs, be16(dx)...)
+			}
+			switch {
+			case dy == 0:
+				flag |= flagThisYIsSame
+			case -0xff <= dy && dy <= +0xff:
+				flag |= flagYShortVector
+				if dy > 0 {
+					flag |= flagPositiveYShortVector
+				} else {
+					dy = -dy
+				}
+				ys = append(ys, byte(dy))
+			default:
+				ys = append(ys, be16(dy)...)
+			}
+			flags = append(flags, flag)
+		}
+		n += len(c)
+		ends = append(ends, be16(n-1)...)
+	}
+	var repeated []byte
+	for i := 0; i < len(flags); {
+		j := i + 1
+		for j < len(flags) && j-i <= 0xff && flags[j] == flags[i] {
+			j++
+		}
+		if j-i > 1 {
+			repeated = append(repeated, flags[i]|flagRepeat, byte(j-i-1))
+		} else {
+			repeated = append(repeated, flags[i])
+		}
+		i = j
+	}
+	return cat(
+		be16(len(contours)), be16(xMin), be16(yMin), be16(xMax), be16(yMax),
+		ends, be16(0), repeated, xs, ys,
+	)
+}
+
+// buildTables returns the tables of a font with the given glyphs, advance
+// widths and cmap format 4 mapping from runes to glyph IDs. Its units per em
+// is 1000.
+func buildTables(glyphs [][]byte, advances []int, runes map[rune]GlyphID) map[string][]byte {
+	var glyfData, locaData []byte
+	for _, g := range glyphs {
+		locaData = append(locaData, be32(len(glyfData))...)
+		glyfData = append(glyfData, g...)
+		for len(glyfData)%4 != 0 {
+			glyfData = append(glyfData, 0)
+		}
+	}
+	locaData = append(locaData, be32(len(glyfData))...)
+
+	// Each glyph's left side bearing is its xMin.
+	var hmtxData []byte
+	for i, g := range glyphs {
+		lsb := []byte{0, 0}
+		if len(g) >= 4 {
+			lsb = g[2:4]
+		}
+		if i < len(advances) {
+			hmtxData = append(hmtxData, be16(advances[i])...)
+		}
+		hmtxData = append(hmtxData, lsb...)
+	}
+
+	return map[string][]byte{
+		"cmap": buildCmap4(runes),
+		"glyf": glyfData,
+		"head": cat(make([]byte, 18), be16(1000), make([]byte, 30), be16(1), be16(0)),
+		"hhea": cat(be32(0x00010000), be16(800), be16(-200), be16(0), make([]byte, 8),
+			be16(1), be16(0), make([]byte, 12), be16(len(advances))),
+		"hmtx": hmtxData,
+		"loca": locaData,
+		"maxp": cat(be32(0x00005000), be16(len(glyphs))),
+	}
+}
+
+// buildCmap4 returns a cmap table with a single format 4 subtable, with one
+// segment per rune.
+func buildCmap4(runes map[rune]GlyphID) []byte {
+	keys := make([]int, 0, len(runes))
+	for r := range runes {
+		keys = append(keys, int(r))
+	}
+	sort.Ints(keys)
+	keys = append(keys, 0xffff)
+
+	var ends, starts, deltas, offsets []byte
+	for _, k := range keys {
+		ends = append(ends, be16(k)...)
+		starts = append(starts, be16(k)...)
+		delta := 1
+		if k != 0xffff {
+			delta = int(runes[rune(k)]) - k
+		}
+		deltas = append(deltas, be16(delta)...)
+		offsets = append(offsets, be16(0)...)
+	}
+	segCountX2 := 2 * len(keys)
+	sub := cat(be16(4), be16(0), be16(0), be16(segCountX2), be16(0), be16(0), be16(0),
+		ends, be16(0), starts, deltas, offsets)
+	copy(sub[2:], be16(len(sub)))
+	return cat(be16(0), be16(1), be16(platformMicrosoft), be16(encodingMicrosoftBMP), be32(12), sub)
+}
+
+type testComponent struct {
+	glyphID GlyphID
+	dx, dy  int
+}
+
+// buildCompoundGlyph returns the glyf data for a compound glyph with the given
+// components, each offset by (dx, dy).
+func buildCompoundGlyph(xMin, yMin, xMax, yMax int, components ...testComponent) []byte {
+	b := cat(be16(-1), be16(xMin), be16(yMin), be16(xMax), be16(yMax))
+	for i, c := range components {
+		flags := flagArg1And2AreWords | flagArgsAreXYValues
+		if i != len(components)-1 {
+			flags |= flagMoreComponents
+		}
+		b = append(b, cat(be16(flags), be16(int(c.glyphID)), be16(c.dx), be16(c.dy))...)
+	}
+	return b
+}
+
+var (
+	testSquare = []testPoint{
+		{100, 0, true}, {100, 400, true}, {500, 400, true}, {500, 0, true},
+	}
+	testDiamond = []testPoint{
+		{300, 0, true}, {100, 200, false}, {300, 400, true}, {500, 200, false},
+	}
+)
+
+// testTables returns the tables of a font with four glyphs: an empty .notdef,
+// a square for 'a', a curved diamond for 'b' and an empty space.
+func testTables() map[string][]byte {
+	return buildTables(
+		[][]byte{nil, buildSimpleGlyph(testSquare), buildSimpleGlyph(testDiamond), nil},
+		[]int{500, 600, 700},
+		map[rune]GlyphID{'a': 1, 'b': 2, ' ': 3},
+	)
+}
+
+func testFont(t *testing.T) *Font {
+	f, err := Parse(buildFont(testTables()))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return f
+}
+
+// recorder is a Pather that records the segments of a path.
+type recorder []string
+
+func (r *recorder) MoveTo(p f32.Vec2) { *r = append(*r, fmt.Sprintf("M %v %v", p[0], p[1])) }
+func (r *recorder) LineTo(p f32.Vec2) { *r = append(*r, fmt.Sprintf("L %v %v", p[0], p[1])) }
+func (r *recorder) QuadTo(p, q f32.Vec2) {
+	*r = append(*r, fmt.Sprintf("Q %v %v %v %v", p[0], p[1], q[0], q[1]))
+}
+func (r *recorder) CubeTo(p, q, s f32.Vec2) {
+	*r = append(*r, fmt.Sprintf("C %v %v %v %v %v %v", p[0], p[1], q[0], q[1], s[0], s[1]))
+}
+
+var identity = f32.Aff3{1, 0, 0, 0, 1, 0}
+
+func TestOutline(t *testing.T) {
+	f := testFont(t)
+	testCases := []struct {
+		glyphID GlyphID
+		want    string
+	}{
+		{0, ""},
+		{1, "M 100 0, L 100 400, L 500 400, L 500 0, L 100 0"},
+		{2, "M 300 0, Q 100 200 300 400, Q 500 200 300 0"},
+		{3, ""},
+	}
+	for _, tc := range testCases {
+		g, err := f.Glyph(tc.glyphID)
+		if err != nil {
+			t.Errorf("glyphID=%d: Glyph: %v", tc.glyphID, err)
+			continue
+		}
+		var r recorder
+		if err := f.Outline(&r, g, identity); err != nil {
+			t.Errorf("glyphID=%d: Outline: %v", tc.glyphID, err)
+			continue
+		}
+		if got := strings.Join(r, ", "); got != tc.want {
+			t.Errorf("glyphID=%d:\ngot  %q\nwant %q", tc.glyphID, got, tc.want)
+		}
+	}
+
+	if _, err := f.Glyph(4); !errors.Is(err, ErrInvalidFont) {
+		t.Errorf("glyphID=4: got %v, want an ErrInvalidFont", err)
+	}
+}
+
+func TestGlyphIndex(t *testing.T) {
+	f := testFont(t)
+	testCases := []struct {
+		r    rune
+		want GlyphID
+	}{
+		{'a', 1},
+		{'b', 2},
+		{' ', 3},
+		{'c', 0},
+		{0x10000, 0},
+	}
+	for _, tc := range testCases {
+		if got := f.GlyphIndex(tc.r); got != tc.want {
+			t.Errorf("r=%q: got %d, want %d", tc.r, got, tc.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		modify func(tables map[string][]byte)
+		want   error
+	}{{
+		desc:   "missing head",
+		modify: func(m map[string][]byte) { delete(m, "head") },
+		want:   ErrMissingTable{Tag: MakeTag("head")},
+	}, {
+		desc:   "missing loca",
+		modify: func(m map[string][]byte) { delete(m, "loca") },
+		want:   ErrMissingTable{Tag: MakeTag("loca")},
+	}, {
+		desc:   "missing hhea",
+		modify: func(m map[string][]byte) { delete(m, "hhea") },
+		want:   ErrMissingTable{Tag: MakeTag("hhea")},
+	}, {
+		desc:   "missing hmtx",
+		modify: func(m map[string][]byte) { delete(m, "hmtx") },
+		want:   ErrMissingTable{Tag: MakeTag("hmtx")},
+	}, {
+		desc:   "short head",
+		modify: func(m map[string][]byte) { m["head"] = m["head"][:50] },
+		want:   ErrTableTooShort{Tag: MakeTag("head"), Length: 50, MinLength: 54},
+	}, {
+		desc:   "short maxp",
+		modify: func(m map[string][]byte) { m["maxp"] = m["maxp"][:4] },
+		want:   ErrTableTooShort{Tag: MakeTag("maxp"), Length: 4, MinLength: 6},
+	}, {
+		desc:   "short maxp version 1.0",
+		modify: func(m map[string][]byte) { m["maxp"][1] = 1; m["maxp"][2] = 0 },
+		want:   ErrTableTooShort{Tag: MakeTag("maxp"), Length: 6, MinLength: 32},
+	}, {
+		desc:   "short loca",
+		modify: func(m map[string][]byte) { m["loca"] = m["loca"][:16] },
+		want:   ErrTableTooShort{Tag: MakeTag("loca"), Length: 16, MinLength: 20},
+	}, {
+		desc:   "short hmtx",
+		modify: func(m map[string][]byte) { m["hmtx"] = m["hmtx"][:12] },
+		want:   ErrTableTooShort{Tag: MakeTag("hmtx"), Length: 12, MinLength: 14},
+	}, {
+		desc:   "short cmap",
+		modify: func(m map[string][]byte) { m["cmap"] = m["cmap"][:8] },
+		want:   ErrTableTooShort{Tag: MakeTag("cmap"), Length: 8, MinLength: 12},
+	}, {
+		desc:   "zero unitsPerEm",
+		modify: func(m map[string][]byte) { m["head"][18] = 0; m["head"][19] = 0 },
+		want:   ErrInvalidTable{Tag: MakeTag("head"), Reason: "unitsPerEm 0 is out of range"},
+	}, {
+		desc:   "bad indexToLocFormat",
+		modify: func(m map[string][]byte) { m["head"][51] = 2 },
+		want:   ErrUnsupportedFormat{Tag: MakeTag("head"), Format: 2},
+	}}
+
+	for _, tc := range testCases {
+		tables := testTables()
+		tc.modify(tables)
+		_, err := Parse(buildFont(tables))
+		if !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an ErrInvalidFont", tc.desc, err)
+			continue
+		}
+		if err != tc.want {
+			t.Errorf("%s: got %#v, want %#v", tc.desc, err, tc.want)
+		}
+	}
+}
+
+func TestParseTableOutOfBounds(t *testing.T) {
+	b := buildFont(testTables())
+	// Truncating the font data cuts off the last table, "maxp".
+	b = b[:len(b)-8]
+	_, err := Parse(b)
+	var e ErrTableOutOfBounds
+	if !errors.As(err, &e) {
+		t.Fatalf("got %v, want an ErrTableOutOfBounds", err)
+	}
+	if e.Tag != MakeTag("maxp") {
+		t.Errorf("Tag: got %q, want %q", e.Tag, "maxp")
+	}
+}
+
+func TestParseUnsupportedFormat(t *testing.T) {
+	b := buildFont(testTables())
+	copy(b, "typ1")
+	_, err := Parse(b)
+	if want := (ErrUnsupportedFormat{Format: uint32(MakeTag("typ1"))}); err != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+}
+
+// outlineErr returns the error from outlining the glyph data b in f, recovering
+// from any panic as an error.
+func outlineErr(f *Font, b Glyph) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	var r recorder
+	return f.Outline(&r, b, identity)
+}
+
+// testGlyphCorpus returns well-formed glyph data: simple glyphs with short,
+// long and repeated coordinates, and compound glyphs.
+func testGlyphCorpus() []Glyph {
+	// The flags of the points along the bottom edge are repeated, and the
+	// large jumps need two byte coordinates.
+	var long []testPoint
+	for i := 0; i < 10; i++ {
+		long = append(long, testPoint{10 * i, 0, true})
+	}
+	long = append(long, testPoint{2000, 1000, false}, testPoint{0, 1000, true})
+	return []Glyph{
+		buildSimpleGlyph(testSquare),
+		buildSimpleGlyph(testDiamond),
+		buildSimpleGlyph(testSquare, testDiamond, long),
+		buildCompoundGlyph(0, 0, 1000, 400, testComponent{1, 0, 0}, testComponent{2, 500, 0}),
+		buildCompoundGlyph(0, 0, 500, 400, testComponent{1, 0, 0}),
+	}
+}
+
+func TestGlyphCorpusTruncated(t *testing.T) {
+	f := testFont(t)
+	for i, g := range testGlyphCorpus() {
+		if err := outlineErr(f, g); err != nil {
+			t.Fatalf("glyph #%d: %v", i, err)
+		}
+		for n := minGlyphDataLen; n < len(g); n++ {
+			err := outlineErr(f, g[:n])
+			if !errors.Is(err, ErrInvalidFont) {
+				t.Errorf("glyph #%d truncated to %d bytes: got %v, want an ErrInvalidFont", i, n, err)
+			}
+		}
+	}
+}
+
+func TestGlyphCorpusCorrupted(t *testing.T) {
+	f := testFont(t)
+	for i, g := range testGlyphCorpus() {
+		for j := range g {
+			for _, v := range []byte{0x00, 0x01, 0x08, 0x7f, 0x80, 0xff, ^g[j]} {
+				c := append(Glyph(nil), g...)
+				c[j] = v
+				err := outlineErr(f, c)
+				if err != nil && !errors.Is(err, ErrInvalidFont) {
+					t.Errorf("glyph #%d with byte %d set to %#02x: %v", i, j, v, err)
+				}
+			}
+		}
+	}
+}
+
+func TestGlyphInvalid(t *testing.T) {
+	f := testFont(t)
+	testCases := []struct {
+		desc string
+		data Glyph
+	}{{
+		desc: "too short",
+		data: buildSimpleGlyph(testSquare)[:9],
+	}, {
+		desc: "invalid number of contours",
+		data: cat(be16(-2), make([]byte, 8)),
+	}, {
+		desc: "decreasing contour end points",
+		data: cat(be16(2), make([]byte, 8), be16(3), be16(1), be16(0), make([]byte, 16)),
+	}, {
+		desc: "equal contour end points",
+		data: cat(be16(2), make([]byte, 8), be16(3), be16(3), be16(0), make([]byte, 16)),
+	}, {
+		desc: "flag repeat count too large",
+		data: cat(be16(1), make([]byte, 8), be16(3), be16(0),
+			[]byte{flagOnCurve | flagRepeat | flagThisXIsSame | flagThisYIsSame, 4}),
+	}, {
+		desc: "instructions out of bounds",
+		data: cat(be16(1), make([]byte, 8), be16(0), be16(100), []byte{0}),
+	}, {
+		desc: "component glyph ID out of range",
+		data: buildCompoundGlyph(0, 0, 0, 0, testComponent{100, 0, 0}),
+	}, {
+		desc: "matched point out of range",
+		data: buildComponentRecords(0, 0, 0, 0,
+			testComponentRecord{flagArgsAreXYValues, 1, [2]int{0, 0}, nil},
+			testComponentRecord{0, 2, [2]int{4, 0}, nil},
+		),
+	}}
+	for _, tc := range testCases {
+		if err := outlineErr(f, tc.data); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an ErrInvalidFont", tc.desc, err)
+		}
+	}
+}
+
+// testComponentRecord is a compound glyph's component record. Its arguments
+// are 16-bit if flags has flagArg1And2AreWords, and its scale or matrix is
+// given as float32s.
+type testComponentRecord struct {
+	flags   int
+	glyphID GlyphID
+	args    [2]int
+	scale   []float32
+}
+
+// buildComponentRecords returns the glyf data for a compound glyph with the
+// given component records, setting their flagMoreComponents flags.
+func buildComponentRecords(xMin, yMin, xMax, yMax int, records ...testComponentRecord) []byte {
+	b := cat(be16(-1), be16(xMin), be16(yMin), be16(xMax), be16(yMax))
+	for i, r := range records {
+		flags := r.flags
+		if i != len(records)-1 {
+			flags |= flagMoreComponents
+		}
+		b = append(b, cat(be16(flags), be16(int(r.glyphID)))...)
+		if flags&flagArg1And2AreWords != 0 {
+			b = append(b, cat(be16(r.args[0]), be16(r.args[1]))...)
+		} else {
+			b = append(b, byte(r.args[0]), byte(r.args[1]))
+		}
+		for _, s := range r.scale {
+			b = append(b, beF2Dot14(s)...)
+		}
+	}
+	return b
+}
+
+func TestCompoundGlyphTransforms(t *testing.T) {
+	const xy = flagArgsAreXYValues
+	testCases := []struct {
+		desc    string
+		records []testComponentRecord
+		want    string
+	}{{
+		desc:    "scale",
+		records: []testComponentRecord{{xy | flagWeHaveAScale, 1, [2]int{10, 0}, []float32{0.5}}},
+		want:    "M 60 0, L 60 200, L 260 200, L 260 0, L 60 0",
+	}, {
+		desc:    "x and y scale",
+		records: []testComponentRecord{{xy | flagWeHaveAnXAndYScale, 1, [2]int{0, 0}, []float32{1.5, -0.25}}},
+		want:    "M 150 0, L 150 -100, L 750 -100, L 750 0, L 150 0",
+	}, {
+		// The matrix rotates by 90 degrees counter-clockwise.
+		desc:    "2x2",
+		records: []testComponentRecord{{xy | flagWeHaveATwoByTwo, 1, [2]int{0, 0}, []float32{0, 1, -1, 0}}},
+		want:    "M 0 100, L -400 100, L -400 500, L 0 500, L 0 100",
+	}, {
+		desc: "scaled offset",
+		records: []testComponentRecord{
+			{xy | flagWeHaveAScale | flagScaledComponentOffset, 1, [2]int{100, -20}, []float32{0.5}},
+		},
+		want: "M 100 -10, L 100 190, L 300 190, L 300 -10, L 100 -10",
+	}, {
+		desc: "unscaled offset",
+		records: []testComponentRecord{
+			{xy | flagWeHaveAScale | flagUnscaledComponentOffset, 1, [2]int{100, -20}, []float32{0.5}},
+		},
+		want: "M 150 -20, L 150 180, L 350 180, L 350 -20, L 150 -20",
+	}, {
+		desc: "word offset",
+		records: []testComponentRecord{
+			{xy | flagArg1And2AreWords, 1, [2]int{-1000, 1000}, nil},
+		},
+		want: "M -900 1000, L -900 1400, L -500 1400, L -500 1000, L -900 1000",
+	}, {
+		// The diamond's first point, (300, 0), matches the square's third
+		// point, (500, 400).
+		desc: "point matching",
+		records: []testComponentRecord{
+			{xy, 1, [2]int{0, 0}, nil},
+			{0, 2, [2]int{2, 0}, nil},
+		},
+		want: "M 100 0, L 100 400, L 500 400, L 500 0, L 100 0, " +
+			"M 500 400, Q 300 600 500 800, Q 700 600 500 400",
+	}, {
+		// The matched point of the scaled diamond is (150, 0).
+		desc: "scaled point matching",
+		records: []testComponentRecord{
+			{xy, 1, [2]int{0, 0}, nil},
+			{flagArg1And2AreWords | flagWeHaveAScale, 2, [2]int{2, 0}, []float32{0.5}},
+		},
+		want: "M 100 0, L 100 400, L 500 400, L 500 0, L 100 0, " +
+			"M 500 400, Q 400 500 500 600, Q 600 500 500 400",
+	}}
+	f := testFont(t)
+	for _, tc := range testCases {
+		var r recorder
+		if err := f.Outline(&r, buildComponentRecords(0, 0, 0, 0, tc.records...), identity); err != nil {
+			t.Errorf("%s: %v", tc.desc, err)
+			continue
+		}
+		if got := strings.Join(r, ", "); got != tc.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestCompoundGlyphRoundXYToGrid(t *testing.T) {
+	f := testFont(t)
+	transform := f32.Aff3{0.25, 0, 0, 0, -0.25, 100}
+	for _, tc := range []struct {
+		flags int
+		want  string
+	}{
+		{flagArgsAreXYValues, "M 27.5 97.5, L 27.5 -2.5, L 127.5 -2.5, L 127.5 97.5, L 27.5 97.5"},
+		{flagArgsAreXYValues | flagRoundXYToGrid, "M 28 97, L 28 -3, L 128 -3, L 128 97, L 28 97"},
+	} {
+		b := buildComponentRecords(0, 0, 0, 0, testComponentRecord{tc.flags, 1, [2]int{10, 10}, nil})
+		var r recorder
+		if err := f.Outline(&r, b, transform); err != nil {
+			t.Errorf("flags=%#x: %v", tc.flags, err)
+			continue
+		}
+		if got := strings.Join(r, ", "); got != tc.want {
+			t.Errorf("flags=%#x:\ngot  %q\nwant %q", tc.flags, got, tc.want)
+		}
+	}
+}
+
+func TestUseMyMetrics(t *testing.T) {
+	f, err := Parse(buildFont(buildTables(
+		[][]byte{
+			nil,
+			buildSimpleGlyph(testSquare),
+			buildSimpleGlyph(testDiamond),
+			buildComponentRecords(100, 0, 500, 400,
+				testComponentRecord{flagArgsAreXYValues, 1, [2]int{0, 0}, nil},
+				testComponentRecord{flagArgsAreXYValues | flagUseMyMetrics, 2, [2]int{0, 0}, nil},
+			),
+			buildCompoundGlyph(100, 0, 500, 400, testComponent{1, 0, 0}),
+		},
+		[]int{500, 600, 700, 900, 1000},
+		nil,
+	)))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	for _, tc := range []struct {
+		glyphID GlyphID
+		want    HMetrics
+	}{
+		{3, HMetrics{700, 100}},
+		{4, HMetrics{1000, 100}},
+	} {
+		if got, err := f.HMetrics(tc.glyphID); err != nil || got != tc.want {
+			t.Errorf("glyphID=%d: got %v, %v, want %v", tc.glyphID, got, err, tc.want)
+		}
+	}
+}
+
+// TestDejaVuCompoundGlyphs checks the compound glyphs of the subsets of the
+// DejaVu fonts in testdata/dejavu. Their components have offsets, rounding to
+// the grid, USE_MY_METRICS and, in DejaVu Sans Mono Bold's 'ď', x and y
+// F2Dot14 scales. The DejaVu fonts have no point matching components, which
+// TestCompoundGlyphTransforms covers instead.
+//
+// Each glyph's outline, in font units and at 16 pixels per em, where the
+// component offsets are rounded to whole pixels, is compared with a golden
+// file. Run with -update to rewrite them.
+func TestDejaVuCompoundGlyphs(t *testing.T) {
+	fonts := map[string]*Font{}
+	for _, name := range []string{"DejaVuSans", "DejaVuSansMono-Bold", "DejaVuSerif"} {
+		b, err := os.ReadFile(filepath.Join("testdata", "dejavu", name+"-subset.ttf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fonts[name], err = Parse(b); err != nil {
+			t.Fatalf("%s: Parse: %v", name, err)
+		}
+	}
+
+	// Each compound glyph's outline, including its off-curve points, is
+	// within a unit of the glyph's bounding box.
+	for name, f := range fonts {
+		n := 0
+		for id := GlyphID(0); int(id) < f.maxp.numGlyphs(); id++ {
+			g, err := f.Glyph(id)
+			if err != nil {
+				t.Fatalf("%s: glyphID=%d: Glyph: %v", name, id, err)
+			}
+			if it := g.glyphIter(); !it.compoundGlyph() {
+				continue
+			}
+			n++
+			var bp boundsPather
+			if err := f.Outline(&bp, g, identity); err != nil {
+				t.Fatalf("%s: glyphID=%d: Outline: %v", name, id, err)
+			}
+			xMin, yMin, xMax, yMax := g.bounds()
+			if math.Abs(float64(bp.min.x)-float64(xMin)) > 1 || math.Abs(float64(bp.min.y)-float64(yMin)) > 1 ||
+				math.Abs(float64(bp.max.x)-float64(xMax)) > 1 || math.Abs(float64(bp.max.y)-float64(yMax)) > 1 {
+				t.Errorf("%s: glyphID=%d: outline bounds are %v, %v, want %d, %d, %d, %d",
+					name, id, bp.min, bp.max, xMin, yMin, xMax, yMax)
+			}
+		}
+		if n == 0 {
+			t.Errorf("%s: no compound glyphs", name)
+		}
+	}
+
+	testCases := []struct {
+		name   string
+		r      rune
+		bounds [4]float32
+		want   HMetrics
+	}{
+		{"DejaVuSans", 'é', [4]float32{113, -29, 1151, 1638}, HMetrics{1260, 113}},
+		{"DejaVuSans", 'À', [4]float32{16, 0, 1384, 1899}, HMetrics{1401, 16}},
+		// The ring acute is itself a compound glyph.
+		{"DejaVuSans", 'ǻ', [4]float32{123, -29, 1244, 1907}, HMetrics{1255, 123}},
+		{"DejaVuSans", '¼', [4]float32{137, -29, 1919, 1520}, HMetrics{1985, 137}},
+		{"DejaVuSansMono-Bold", 'ď', [4]float32{90, -29, 1456.4742, 1556}, HMetrics{1233, 90}},
+		{"DejaVuSansMono-Bold", 'ò', [4]float32{98, -29, 1135, 1640}, HMetrics{1233, 98}},
+		{"DejaVuSerif", 'Ḗ', [4]float32{113, 0, 1331, 2138}, HMetrics{1495, 113}},
+	}
+	for _, tc := range testCases {
+		f := fonts[tc.name]
+		id := f.GlyphIndex(tc.r)
+		g, err := f.Glyph(id)
+		if err != nil {
+			t.Errorf("%s: %q: Glyph: %v", tc.name, tc.r, err)
+			continue
+		}
+		var bp boundsPather
+		if err := f.Outline(&bp, g, identity); err != nil {
+			t.Errorf("%s: %q: Outline: %v", tc.name, tc.r, err)
+			continue
+		}
+		if got := [4]float32{bp.min.x, bp.min.y, bp.max.x, bp.max.y}; got != tc.bounds {
+			t.Errorf("%s: %q: bounds: got %v, want %v", tc.name, tc.r, got, tc.bounds)
+		}
+		if got, err := f.HMetrics(id); err != nil || got != tc.want {
+			t.Errorf("%s: %q: HMetrics: got %v, %v, want %v", tc.name, tc.r, got, err, tc.want)
+		}
+
+		var r recorder
+		for _, transform := range []f32.Aff3{identity, {1.0 / 128, 0, 0, 0, 1.0 / 128, 0}} {
+			r = append(r, "---")
+			if err := f.Outline(&r, g, transform); err != nil {
+				t.Errorf("%s: %q: Outline: %v", tc.name, tc.r, err)
+			}
+		}
+		filename := filepath.Join("testdata", "dejavu", fmt.Sprintf("%s-%04X.txt", tc.name, tc.r))
+		if *updateGolden {
+			if err := os.WriteFile(filename, []byte(strings.Join(r, "\n")+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(filename)
+		if err != nil {
+			t.Errorf("%s: %q: %v", tc.name, tc.r, err)
+			continue
+		}
+		if !outlinesClose(r, strings.Split(strings.TrimSuffix(string(want), "\n"), "\n"), 1e-3) {
+			t.Errorf("%s: %q: outline differs from %s", tc.name, tc.r, filename)
+		}
+	}
+}
+
+// outlinesClose returns whether the recorded outlines a and b have the same
+// segments, with coordinates that differ by at most tolerance, to allow for
+// floating point differences between architectures.
+func outlinesClose(a, b []string, tolerance float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		fa, fb := strings.Fields(a[i]), strings.Fields(b[i])
+		if len(fa) != len(fb) {
+			return false
+		}
+		for j := range fa {
+			if fa[j] == fb[j] {
+				continue
+			}
+			x, errX := strconv.ParseFloat(fa[j], 32)
+			y, errY := strconv.ParseFloat(fb[j], 32)
+			if errX != nil || errY != nil || math.Abs(x-y) > tolerance {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// testCyclicTables returns the tables of a font whose compound glyphs nest too
+// deeply or form cycles:
+//
+//   - Glyph 2 is a sub-glyph of itself, which also has its metrics.
+//   - Glyphs 3 and 4 are sub-glyphs of each other.
+//   - Glyphs 5 to 24 are a chain, each a compound glyph of the next, and
+//     glyph 24 is a compound glyph of the square.
+func testCyclicTables() map[string][]byte {
+	glyphs := [][]byte{
+		nil,
+		buildSimpleGlyph(testSquare),
+		buildComponentRecords(0, 0, 0, 0,
+			testComponentRecord{flagArgsAreXYValues | flagUseMyMetrics, 2, [2]int{10, 0}, nil}),
+		buildCompoundGlyph(0, 0, 0, 0, testComponent{4, 0, 0}),
+		buildCompoundGlyph(0, 0, 0, 0, testComponent{3, 0, 0}),
+	}
+	for id := GlyphID(5); id < 24; id++ {
+		glyphs = append(glyphs, buildCompoundGlyph(100, 0, 500, 400, testComponent{id + 1, 0, 0}))
+	}
+	glyphs = append(glyphs, buildCompoundGlyph(100, 0, 500, 400, testComponent{1, 0, 0}))
+	return buildTables(glyphs, []int{500, 600, 700}, map[rune]GlyphID{'a': 2, 'b': 3, 'c': 5})
+}
+
+func TestCompoundGlyphCycles(t *testing.T) {
+	tables := testCyclicTables()
+	f, err := Parse(buildFont(tables))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	testCases := []struct {
+		glyphID GlyphID
+		ok      bool
+	}{
+		{2, false},
+		{3, false},
+		{4, false},
+		{5, false},
+		// The square is the maxComponentDepth'th glyph of the chain from
+		// glyph 24 - maxComponentDepth + 2.
+		{24 - maxComponentDepth + 1, false},
+		{24 - maxComponentDepth + 2, true},
+		{24, true},
+	}
+	for _, tc := range testCases {
+		g, err := f.Glyph(tc.glyphID)
+		if err != nil {
+			t.Errorf("glyphID=%d: Glyph: %v", tc.glyphID, err)
+			continue
+		}
+		err = f.Outline(&recorder{}, g, identity)
+		if tc.ok && err != nil {
+			t.Errorf("glyphID=%d: Outline: %v", tc.glyphID, err)
+		} else if !tc.ok && !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("glyphID=%d: Outline: got %v, want an ErrInvalidFont", tc.glyphID, err)
+		}
+	}
+
+	// Glyph 2's metrics are its own.
+	if got, err := f.HMetrics(2); err != nil || got != (HMetrics{700, 0}) {
+		t.Errorf("HMetrics: got %v, %v, want {700 0}", got, err)
+	}
+
+	// Varying a compound glyph outlines its sub-glyphs.
+	tables["gvar"] = buildGvar(1, nil, testGlyphVar{}, testGlyphVar{}, testGlyphVar{tuples: []testTuple{{
+		peak: []float32{1},
+		dx:   []int{10, 0, 0, 0, 0},
+		dy:   []int{0, 0, 0, 0, 0},
+	}}})
+	f = testVariableFont(t, tables)
+	f.SetVariation(map[Tag]float32{MakeTag("wght"): 900})
+	if _, err := f.Glyph(2); !errors.Is(err, ErrInvalidFont) {
+		t.Errorf("varied glyph: got %v, want an ErrInvalidFont", err)
+	}
+}
+
+// testFanOutTables returns the tables of a font whose compound glyphs share
+// their sub-glyphs: glyphs 2 to 11 are a chain, each a compound glyph of 8
+// copies of the next, and glyph 11 is a compound glyph of 8 squares. Glyph 2
+// has 8^10 squares, without nesting too deeply or forming a cycle.
+func testFanOutTables() map[string][]byte {
+	glyphs := [][]byte{nil, buildSimpleGlyph(testSquare)}
+	for id := GlyphID(2); id < 12; id++ {
+		sub := id + 1
+		if id == 11 {
+			sub = 1
+		}
+		var components []testComponent
+		for i := 0; i < 8; i++ {
+			components = append(components, testComponent{sub, 10 * i, 0})
+		}
+		glyphs = append(glyphs, buildCompoundGlyph(100, 0, 570, 400, components...))
+	}
+	return buildTables(glyphs, []int{500}, nil)
+}
+
+func TestCompoundGlyphFanOut(t *testing.T) {
+	tables := testFanOutTables()
+	f, err := Parse(buildFont(tables))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	testCases := []struct {
+		glyphID GlyphID
+		ok      bool
+	}{
+		{2, false},
+		{7, false},
+		// Glyph 9 has 8 + 8^2 + 8^3 sub-glyphs.
+		{9, true},
+		{11, true},
+	}
+	for _, tc := range testCases {
+		g, err := f.Glyph(tc.glyphID)
+		if err != nil {
+			t.Errorf("glyphID=%d: Glyph: %v", tc.glyphID, err)
+			continue
+		}
+		err = f.Outline(&recorder{}, g, identity)
+		if tc.ok && err != nil {
+			t.Errorf("glyphID=%d: Outline: %v", tc.glyphID, err)
+		} else if !tc.ok && !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("glyphID=%d: Outline: got %v, want an ErrInvalidFont", tc.glyphID, err)
+		}
+	}
+
+	// Varying a compound glyph outlines its sub-glyphs again at every level.
+	var vars []testGlyphVar
+	for id := 0; id < 12; id++ {
+		v := testGlyphVar{}
+		if id >= 2 {
+			v.tuples = []testTuple{{peak: []float32{1}, points: []int{0}, dx: []int{10}, dy: []int{0}}}
+		}
+		vars = append(vars, v)
+	}
+	tables["gvar"] = buildGvar(1, nil, vars...)
+	f = testVariableFont(t, tables)
+	f.SetVariation(map[Tag]float32{MakeTag("wght"): 900})
+	if _, err := f.Glyph(2); !errors.Is(err, ErrInvalidFont) {
+		t.Errorf("varied glyph: got %v, want an ErrInvalidFont", err)
+	}
+	if g, err := f.Glyph(11); err != nil {
+		t.Errorf("varied glyph 11: Glyph: %v", err)
+	} else if err := f.Outline(&recorder{}, g, identity); err != nil {
+		t.Errorf("varied glyph 11: Outline: %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"errors"
+	"image"
+	"testing"
+
+	"github.com/google/font-go/raster"
+)
+
+// maxFuzzPixels limits the size of the masks that FuzzParse rasterizes, as a
+// glyph's bounding box is not limited by the rest of the glyph data.
+const maxFuzzPixels = 1 << 16
+
+// FuzzParse parses arbitrary bytes, as a font or a font collection, and, if
+// that succeeds, outlines and rasterizes every glyph. It checks that nothing
+// panics, and that all errors are ErrInvalidFont errors.
+//
+// The seed corpus is in testdata/fuzz/FuzzParse, in addition to the fonts
+// added below.
+func FuzzParse(f *testing.F) {
+	f.Add(buildFont(testTables()))
+	f.Add(buildFont(buildTables(
+		[][]byte{
+			nil,
+			buildSimpleGlyph(testSquare),
+			buildSimpleGlyph(testDiamond),
+			buildCompoundGlyph(0, 0, 1000, 400, testComponent{1, 0, 0}, testComponent{2, 500, 0}),
+		},
+		[]int{500, 600, 700, 1000},
+		map[rune]GlyphID{'a': 1, 'b': 2, 'c': 3},
+	)))
+	f.Add(buildFont(buildTables(
+		[][]byte{
+			nil,
+			buildSimpleGlyph(testSquare),
+			buildSimpleGlyph(testDiamond),
+			buildComponentRecords(0, 0, 1000, 800,
+				testComponentRecord{flagArgsAreXYValues | flagRoundXYToGrid | flagWeHaveAScale, 1, [2]int{10, 0}, []float32{0.5}},
+				testComponentRecord{flagUseMyMetrics | flagWeHaveATwoByTwo, 2, [2]int{2, 0}, []float32{0, 1, -1, 0}},
+			),
+		},
+		[]int{500, 600, 700, 1000},
+		map[rune]GlyphID{'a': 1, 'b': 2, 'c': 3},
+	)))
+	f.Add(buildFont(testCyclicTables()))
+	f.Add(buildCollection(testTables(), testTables()))
+	f.Add(buildWOFF(testTables()))
+	m, glyf := testWOFF2Font(1)
+	f.Add(buildWOFF2(0x00010000, woff2Tables(m, map[string][]byte{"glyf": glyf, "loca": nil}), nil))
+	f.Add(buildCFFFont(testCFFTables(testCFF{
+		charStrings: [][]byte{
+			buildCharstring(t2(t2Endchar)),
+			buildCharstring(500, 0, 100, t2(t2Hstemhm), t2(t2Hintmask), []byte{0x80}, 100, 0, t2(t2Rmoveto),
+				-107, t2(t2Callsubr), 0, 300, 300, 0, 0, -300, t2(t2Rrcurveto), t2(t2Endchar)),
+		},
+		localSubrs: [][][]byte{{buildCharstring(0, 400, t2(t2Rlineto), t2(t2Return))}},
+	})))
+	f.Add(buildCFFFont(testCFFTables(testAccentedCFF)))
+	f.Add(buildCFFFont(testCFF2Tables(testCFF2{
+		charStrings: [][]byte{
+			nil,
+			buildCharstring(100, 0, t2(t2Rmoveto), 0, 400, 50, -20, 0, 0, 2, t2(t2Blend), t2(t2Rlineto),
+				-107, t2(t2Callsubr)),
+		},
+		localSubrs: [][][]byte{{buildCharstring(400, 0, t2(t2Rlineto))}},
+		varStore:   testCFF2VarStore,
+	})))
+	gvarTables := testGvarTables()
+	gvarTables["fvar"] = buildFvar(testAxes, []testInstance{{258, 259, []float32{700, 100}}}, true)
+	gvarTables["avar"] = buildAvar([][2]float32{{-1, -1}, {0, 0}, {0.5, 0.25}, {1, 1}})
+	gvarTables["HVAR"] = buildHVAR(true)
+	f.Add(buildFont(gvarTables))
+	shortGvarTables := testShortGvarTables()
+	shortGvarTables["fvar"] = gvarTables["fvar"]
+	f.Add(buildFont(shortGvarTables))
+	f.Add(buildFont(testColorTables()))
+	f.Add(buildFont(testColorV1Tables()))
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		// ParseCollection also accepts single fonts.
+		c, err := ParseCollection(b)
+		if err != nil {
+			checkInvalidFont(t, err)
+			return
+		}
+		for i := 0; i < c.NumFonts() && i < 4; i++ {
+			fnt, err := c.Font(i)
+			if err != nil {
+				checkInvalidFont(t, err)
+				continue
+			}
+			fuzzFont(t, fnt)
+		}
+	})
+}
+
+// fuzzFont exercises the parsed font's methods, and outlines and rasterizes
+// every glyph.
+func fuzzFont(t *testing.T, fnt *Font) {
+	for _, r := range []rune{0, ' ', 'a', 0xffff, 0x10000, 0x10ffff} {
+		fnt.HMetrics(fnt.GlyphIndex(r))
+		fnt.VMetrics(fnt.GlyphIndex(r))
+		fnt.GlyphIndexVariant(r, 0xfe0f)
+	}
+
+	fnt.LineMetrics(16)
+	fnt.OS2()
+	fnt.Post()
+	for _, lang := range []string{"", "de-CH"} {
+		fnt.Name(NameFamily, lang)
+	}
+	for left := GlyphID(0); left < 4; left++ {
+		for right := GlyphID(0); right < 4; right++ {
+			fnt.Kern(left, right, 16)
+		}
+	}
+	var run []GlyphID
+	for i, n := 0, fnt.maxp.numGlyphs(); i < 2*n && i < 16; i++ {
+		run = append(run, GlyphID(i%n))
+	}
+	for _, rtl := range []bool{false, true} {
+		if _, err := fnt.Position(run, &LayoutOptions{RightToLeft: rtl}); err != nil {
+			t.Errorf("Position: %v", err)
+		}
+	}
+	fnt.Substitute(run, nil)
+	if _, err := fnt.Shape(run, nil); err != nil {
+		checkInvalidFont(t, err)
+	}
+	for i := 0; i <= fnt.NumPalettes() && i < 4; i++ {
+		fnt.Palette(i)
+	}
+	// Version 1 color glyphs need not be glyphs of the font.
+	if c := fnt.colr; c != nil {
+		for i := 0; i < c.nBasePaints && i < 16; i++ {
+			id := GlyphID(c.data.u16(c.baseGlyphList + 4 + i*basePaintRecordLen))
+			if _, err := fnt.ColorGlyph(id, 1.0/1024, nil); err != nil {
+				checkInvalidFont(t, err)
+			}
+		}
+	}
+
+	scale := fnt.Scale(16)
+	fnt.VariationAxes()
+	for _, inst := range fnt.NamedInstances() {
+		fnt.SetVariation(inst.Coords)
+	}
+	fnt.SetNormalizedCoords([]float32{0.5})
+	for i, n := 0, fnt.maxp.numGlyphs(); i < n; i++ {
+		fnt.GlyphClass(GlyphID(i))
+		fnt.MarkAttachClass(GlyphID(i))
+		fnt.LigatureCarets(GlyphID(i))
+		fnt.GlyphName(GlyphID(i))
+		if _, err := fnt.HMetrics(GlyphID(i)); err != nil {
+			checkInvalidFont(t, err)
+		}
+
+		// At this scale, every color glyph is at most 64 pixels wide and high.
+		if _, err := fnt.ColorGlyph(GlyphID(i), 1.0/1024, nil); err != nil {
+			checkInvalidFont(t, err)
+		}
+
+		g, err := fnt.Glyph(GlyphID(i))
+		if err != nil {
+			checkInvalidFont(t, err)
+			continue
+		}
+		w, h, transform := g.SizeAndTransform(scale)
+		if w <= 0 || h <= 0 || w*h > maxFuzzPixels {
+			var r recorder
+			checkInvalidFont(t, fnt.Outline(&r, g, transform))
+			continue
+		}
+		for _, z := range []raster.Rasterizer{raster.NewFixed(w, h), raster.NewFloating(w, h)} {
+			checkInvalidFont(t, fnt.Outline(z, g, transform))
+			z.Accumulate(image.NewAlpha(z.Bounds()))
+		}
+	}
+}
+
+func checkInvalidFont(t *testing.T, err error) {
+	if err != nil && !errors.Is(err, ErrInvalidFont) {
+		t.Fatalf("got %v, want nil or an ErrInvalidFont", err)
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	fvarLen     = 16
+	fvarAxisLen = 20
+	// fvarInstanceLen is the length of an instance record without its
+	// coordinates and optional PostScript name ID.
+	fvarInstanceLen = 4
+	avarLen         = 8
+
+	axisFlagHidden = 0x0001
+	noPostScriptID = 0xffff
+)
+
+// fixed16 converts a 16.16 fixed point number to a float32.
+func fixed16(x uint32) float32 { return float32(int32(x)) / (1 << 16) }
+
+// fvar is the font variations table, which has a variable font's axes and
+// named instances.
+type fvar struct {
+	// axes and instances are the axis and instance records, of axisSize and
+	// instanceSize bytes each.
+	axes         otData
+	nAxes        int
+	axisSize     int
+	instances    otData
+	nInstances   int
+	instanceSize int
+}
+
+// parseFvar parses the fvar table b.
+func parseFvar(b []byte) (fvar, error) {
+	if len(b) < fvarLen {
+		return fvar{}, ErrTableTooShort{Tag: MakeTag("fvar"), Length: len(b), MinLength: fvarLen}
+	}
+	if major := u16(b, 0); major != 1 {
+		return fvar{}, ErrUnsupportedFormat{Tag: MakeTag("fvar"), Format: uint32(major)}
+	}
+	v := fvar{
+		nAxes:        int(u16(b, 8)),
+		axisSize:     int(u16(b, 10)),
+		nInstances:   int(u16(b, 12)),
+		instanceSize: int(u16(b, 14)),
+	}
+	if v.axisSize < fvarAxisLen {
+		return fvar{}, ErrInvalidTable{Tag: MakeTag("fvar"), Reason: fmt.Sprintf("axis size %d is too small", v.axisSize)}
+	}
+	if n := fvarInstanceLen + 4*v.nAxes; v.instanceSize < n {
+		return fvar{}, ErrInvalidTable{Tag: MakeTag("fvar"), Reason: fmt.Sprintf("instance size %d is too small", v.instanceSize)}
+	}
+	// The instance records follow the axis records.
+	axes := int(u16(b, 4))
+	instances := axes + v.nAxes*v.axisSize
+	if end := instances + v.nInstances*v.instanceSize; end > len(b) {
+		return fvar{}, ErrTableTooShort{Tag: MakeTag("fvar"), Length: len(b), MinLength: end}
+	}
+	v.axes, v.instances = b[axes:instances], b[instances:]
+	return v, nil
+}
+
+// avar is the axis variations table, which maps each axis's normalized
+// coordinates with a piecewise linear function.
+type avar otData
+
+// parseAvar parses the avar table b.
+func parseAvar(b []byte) (avar, error) {
+	if len(b) < avarLen {
+		return nil, ErrTableTooShort{Tag: MakeTag("avar"), Length: len(b), MinLength: avarLen}
+	}
+	if major := u16(b, 0); major != 1 {
+		return nil, ErrUnsupportedFormat{Tag: MakeTag("avar"), Format: uint32(major)}
+	}
+	// Each axis's segment map is its number of mappings, followed by the
+	// mappings.
+	offset := avarLen
+	for i, n := 0, int(u16(b, 6)); i < n; i++ {
+		if offset+2 > len(b) {
+			return nil, ErrTableTooShort{Tag: MakeTag("avar"), Length: len(b), MinLength: offset + 2}
+		}
+		offset += 2 + 4*int(u16(b, int32(offset)))
+	}
+	if offset > len(b) {
+		return nil, ErrTableTooShort{Tag: MakeTag("avar"), Length: len(b), MinLength: offset}
+	}
+	return avar(b), nil
+}
+
+// mapCoord maps the axis's normalized coordinate c.
+func (a avar) mapCoord(axis int, c float32) float32 {
+	b := otData(a)
+	if axis >= int(b.u16(6)) {
+		return c
+	}
+	offset := avarLen
+	for i := 0; i < axis; i++ {
+		offset += 2 + 4*int(b.u16(offset))
+	}
+	n := int(b.u16(offset))
+	maps := offset + 2
+	from := func(i int) float32 { return f2dot14(b.i16(maps + 4*i)) }
+	to := func(i int) float32 { return f2dot14(b.i16(maps + 4*i + 2)) }
+	if n == 0 {
+		return c
+	}
+	// Coordinates outside the mapped range keep their offset from the
+	// nearest end.
+	if c <= from(0) {
+		return c + to(0) - from(0)
+	}
+	for i := 1; i < n; i++ {
+		if c > from(i) {
+			continue
+		}
+		if from(i) == from(i-1) {
+			return to(i)
+		}
+		return to(i-1) + (c-from(i-1))*(to(i)-to(i-1))/(from(i)-from(i-1))
+	}
+	return c + to(n-1) - from(n-1)
+}
+
+// VariationAxis is an axis of a variable font's design space, such as its
+// weight or width.
+type VariationAxis struct {
+	// Tag identifies the axis, such as "wght" for weight.
+	Tag Tag
+	// Min, Default and Max are the axis's range and default value, in user
+	// coordinates, such as from 100 to 900 for weight.
+	Min, Default, Max float32
+	// Name is the name ID of the axis's name.
+	Name NameID
+	// Hidden is whether the font recommends not showing the axis in user
+	// interfaces.
+	Hidden bool
+}
+
+// NamedInstance is a named position in a variable font's design space, such
+// as "Bold Condensed".
+type NamedInstance struct {
+	// Subfamily is the name ID of the instance's subfamily name.
+	Subfamily NameID
+	// PostScript is the name ID of the instance's PostScript name, or 0xffff
+	// if it has none.
+	PostScript NameID
+	// Coords are the instance's user coordinates on each axis.
+	Coords map[Tag]float32
+}
+
+// VariationAxes returns the axes of a variable font. It returns nil for
+// other fonts.
+func (f *Font) VariationAxes() []VariationAxis {
+	if f.fvar.nAxes == 0 {
+		return nil
+	}
+	axes := make([]VariationAxis, f.fvar.nAxes)
+	for i := range axes {
+		b := f.fvar.axes[i*f.fvar.axisSize:]
+		axes[i] = VariationAxis{
+			Tag:     b.tag(0),
+			Min:     fixed16(b.u32(4)),
+			Default: fixed16(b.u32(8)),
+			Max:     fixed16(b.u32(12)),
+			Hidden:  b.u16(16)&axisFlagHidden != 0,
+			Name:    NameID(b.u16(18)),
+		}
+	}
+	return axes
+}
+
+// NamedInstances returns the named instances of a variable font. Pass an
+// instance's Coords to SetVariation to select it.
+func (f *Font) NamedInstances() []NamedInstance {
+	if f.fvar.nInstances == 0 {
+		return nil
+	}
+	axes := f.VariationAxes()
+	instances := make([]NamedInstance, f.fvar.nInstances)
+	for i := range instances {
+		b := f.fvar.instances[i*f.fvar.instanceSize:]
+		inst := NamedInstance{
+			Subfamily:  NameID(b.u16(0)),
+			PostScript: noPostScriptID,
+			Coords:     make(map[Tag]float32, len(axes)),
+		}
+		for j, a := range axes {
+			inst.Coords[a.Tag] = fixed16(b.u32(fvarInstanceLen + 4*j))
+		}
+		// The PostScript name ID is optional.
+		if n := fvarInstanceLen + 4*len(axes); f.fvar.instanceSize >= n+2 {
+			inst.PostScript = NameID(b.u16(n))
+		}
+		instances[i] = inst
+	}
+	return instances
+}
+
+// SetVariation sets the instance of a variable font that f's outlines and
+// metrics are for, as user coordinates, such as 700 for a bold weight, keyed
+// by axis tag. Coordinates are clamped to their axis's range, and missing
+// axes are at their default value. Nil coords select the default instance.
+func (f *Font) SetVariation(coords map[Tag]float32) {
+	axes := f.VariationAxes()
+	normalized := make([]float32, len(axes))
+	isDefault := true
+	for i, a := range axes {
+		v, ok := coords[a.Tag]
+		if !ok {
+			continue
+		}
+		var n float32
+		switch {
+		case v < a.Default && a.Min < a.Default:
+			n = (float32(math.Max(float64(v), float64(a.Min))) - a.Default) / (a.Default - a.Min)
+		case v > a.Default && a.Max > a.Default:
+			n = (float32(math.Min(float64(v), float64(a.Max))) - a.Default) / (a.Max - a.Default)
+		}
+		n = f.avar.mapCoord(i, n)
+		// Normalized coordinates have the precision of a 2.14 fixed point
+		// number.
+		n = float32(math.Round(float64(n)*(1<<14))) / (1 << 14)
+		normalized[i] = n
+		if n != 0 {
+			isDefault = false
+		}
+	}
+	if isDefault {
+		normalized = nil
+	}
+	f.SetNormalizedCoords(normalized)
+}
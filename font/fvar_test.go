@@ -0,0 +1,205 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func beFixed16(x float32) []byte { return be32(int(math.Round(float64(x) * (1 << 16)))) }
+
+type testAxis struct {
+	tag           string
+	min, def, max float32
+	hidden        bool
+	name          NameID
+}
+
+type testInstance struct {
+	subfamily, postScript NameID
+	coords                []float32
+}
+
+// buildFvar returns an fvar table with the given axes and instances. The
+// instances have PostScript name IDs if withPostScript is true.
+func buildFvar(axes []testAxis, instances []testInstance, withPostScript bool) []byte {
+	instanceSize := fvarInstanceLen + 4*len(axes)
+	if withPostScript {
+		instanceSize += 2
+	}
+	b := cat(be16(1), be16(0), be16(fvarLen), be16(2), be16(len(axes)), be16(fvarAxisLen),
+		be16(len(instances)), be16(instanceSize))
+	for _, a := range axes {
+		flags := 0
+		if a.hidden {
+			flags = axisFlagHidden
+		}
+		b = append(b, cat([]byte(a.tag), beFixed16(a.min), beFixed16(a.def), beFixed16(a.max),
+			be16(flags), be16(int(a.name)))...)
+	}
+	for _, inst := range instances {
+		b = append(b, cat(be16(int(inst.subfamily)), be16(0))...)
+		for _, c := range inst.coords {
+			b = append(b, beFixed16(c)...)
+		}
+		if withPostScript {
+			b = append(b, be16(int(inst.postScript))...)
+		}
+	}
+	return b
+}
+
+// buildAvar returns an avar table with a segment map of (from, to) pairs for
+// each axis.
+func buildAvar(maps ...[][2]float32) []byte {
+	b := cat(be16(1), be16(0), be16(0), be16(len(maps)))
+	for _, m := range maps {
+		b = append(b, be16(len(m))...)
+		for _, p := range m {
+			b = append(b, cat(beF2Dot14(p[0]), beF2Dot14(p[1]))...)
+		}
+	}
+	return b
+}
+
+var testAxes = []testAxis{
+	{"wght", 100, 400, 900, false, 256},
+	{"wdth", 50, 100, 100, true, 257},
+}
+
+func testVariableFont(t *testing.T, tables map[string][]byte) *Font {
+	if tables == nil {
+		tables = testTables()
+	}
+	tables["fvar"] = buildFvar(testAxes, []testInstance{
+		{258, 259, []float32{700, 100}},
+		{260, 261, []float32{400, 75}},
+	}, true)
+	f, err := Parse(buildFont(tables))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return f
+}
+
+func TestVariationAxes(t *testing.T) {
+	f := testVariableFont(t, nil)
+	want := []VariationAxis{
+		{Tag: MakeTag("wght"), Min: 100, Default: 400, Max: 900, Name: 256},
+		{Tag: MakeTag("wdth"), Min: 50, Default: 100, Max: 100, Name: 257, Hidden: true},
+	}
+	if got := f.VariationAxes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("VariationAxes:\ngot  %v\nwant %v", got, want)
+	}
+	if got := testFont(t).VariationAxes(); got != nil {
+		t.Errorf("VariationAxes of a non-variable font: got %v, want nil", got)
+	}
+}
+
+func TestNamedInstances(t *testing.T) {
+	f := testVariableFont(t, nil)
+	wght, wdth := MakeTag("wght"), MakeTag("wdth")
+	want := []NamedInstance{
+		{Subfamily: 258, PostScript: 259, Coords: map[Tag]float32{wght: 700, wdth: 100}},
+		{Subfamily: 260, PostScript: 261, Coords: map[Tag]float32{wght: 400, wdth: 75}},
+	}
+	if got := f.NamedInstances(); !reflect.DeepEqual(got, want) {
+		t.Errorf("NamedInstances:\ngot  %v\nwant %v", got, want)
+	}
+
+	// The PostScript name IDs are optional.
+	tables := testTables()
+	tables["fvar"] = buildFvar(testAxes[:1], []testInstance{{258, 0, []float32{700}}}, false)
+	f, err := Parse(buildFont(tables))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want = []NamedInstance{{Subfamily: 258, PostScript: noPostScriptID, Coords: map[Tag]float32{wght: 700}}}
+	if got := f.NamedInstances(); !reflect.DeepEqual(got, want) {
+		t.Errorf("NamedInstances without PostScript names:\ngot  %v\nwant %v", got, want)
+	}
+}
+
+func TestSetVariation(t *testing.T) {
+	wght, wdth := MakeTag("wght"), MakeTag("wdth")
+	testCases := []struct {
+		desc   string
+		avar   []byte
+		coords map[Tag]float32
+		want   []float32
+	}{
+		{"nil", nil, nil, nil},
+		{"default", nil, map[Tag]float32{wght: 400, wdth: 100}, nil},
+		{"max", nil, map[Tag]float32{wght: 900}, []float32{1, 0}},
+		{"between", nil, map[Tag]float32{wght: 650, wdth: 75}, []float32{0.5, -0.5}},
+		{"min", nil, map[Tag]float32{wght: 100}, []float32{-1, 0}},
+		{"clamped", nil, map[Tag]float32{wght: 2000, wdth: 0}, []float32{1, -1}},
+		// The wdth axis has no range above its default.
+		{"no range", nil, map[Tag]float32{wdth: 200}, nil},
+		{"unknown axis", nil, map[Tag]float32{MakeTag("slnt"): -10}, nil},
+		{"rounded", nil, map[Tag]float32{wght: 400 + 500.0/3}, []float32{5461.0 / (1 << 14), 0}},
+		{
+			"avar",
+			buildAvar([][2]float32{{-1, -1}, {0, 0}, {0.5, 0.25}, {1, 1}}),
+			map[Tag]float32{wght: 525, wdth: 75},
+			[]float32{0.125, -0.5},
+		},
+		{
+			"avar above",
+			buildAvar([][2]float32{{-1, -1}, {0, 0}, {0.5, 0.25}, {1, 1}}),
+			map[Tag]float32{wght: 775},
+			[]float32{0.625, 0},
+		},
+	}
+	for _, tc := range testCases {
+		tables := testTables()
+		if tc.avar != nil {
+			tables["avar"] = tc.avar
+		}
+		f := testVariableFont(t, tables)
+		f.SetVariation(tc.coords)
+		if !reflect.DeepEqual(f.coords, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.desc, f.coords, tc.want)
+		}
+	}
+}
+
+func TestParseFvarAvarErrors(t *testing.T) {
+	axes := buildFvar(testAxes, nil, false)
+	testCases := []struct {
+		desc, tag string
+		b         []byte
+	}{
+		{"short fvar", "fvar", make([]byte, fvarLen-1)},
+		{"fvar version", "fvar", cat(be16(2), axes[2:])},
+		{"small axis", "fvar", cat(axes[:10], be16(fvarAxisLen-1), axes[12:])},
+		{"small instance", "fvar", cat(axes[:14], be16(fvarInstanceLen), axes[16:])},
+		{"truncated axes", "fvar", axes[:len(axes)-1]},
+		{"short avar", "avar", make([]byte, avarLen-1)},
+		{"avar version", "avar", cat(be16(2), be16(0), be16(0), be16(0))},
+		{"truncated segment map", "avar", buildAvar([][2]float32{{-1, -1}, {1, 1}})[:avarLen+5]},
+		{"missing segment map", "avar", cat(be16(1), be16(0), be16(0), be16(1))},
+	}
+	for _, tc := range testCases {
+		tables := testTables()
+		tables[tc.tag] = tc.b
+		if _, err := Parse(buildFont(tables)); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an ErrInvalidFont", tc.desc, err)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"fmt"
+	"math"
+)
+
+// GlyphClass is a glyph's class in the GDEF table, which GSUB and GPOS lookups
+// use to ignore glyphs, such as marks between the components of a ligature.
+type GlyphClass int
+
+const (
+	// GlyphClassUnknown is the class of glyphs that the font does not
+	// classify, including all glyphs of fonts without a GDEF table.
+	GlyphClassUnknown GlyphClass = 0
+	// GlyphClassBase is the class of single characters, such as "a".
+	GlyphClassBase GlyphClass = 1
+	// GlyphClassLigature is the class of glyphs for multiple characters, such
+	// as "fi".
+	GlyphClassLigature GlyphClass = 2
+	// GlyphClassMark is the class of combining marks, such as an acute
+	// accent.
+	GlyphClassMark GlyphClass = 3
+	// GlyphClassComponent is the class of parts of characters, such as the
+	// two halves of a split vowel.
+	GlyphClassComponent GlyphClass = 4
+)
+
+// gdefLen returns the length of the GDEF header for the minor version.
+func gdefLen(minor uint16) int {
+	switch {
+	case minor >= 3:
+		return 18
+	case minor == 2:
+		return 14
+	}
+	return 12
+}
+
+// gdef is the GDEF table's subtables.
+type gdef struct {
+	glyphClasses      otData
+	ligCarets         otData
+	markAttachClasses otData
+	markGlyphSets     otData
+	varStore          itemVariationStore
+}
+
+// parseGDEF parses the header of the GDEF table b.
+func parseGDEF(b []byte) (gdef, error) {
+	if len(b) < 4 {
+		return gdef{}, ErrTableTooShort{Tag: MakeTag("GDEF"), Length: len(b), MinLength: 4}
+	}
+	if major := u16(b, 0); major != 1 {
+		return gdef{}, ErrUnsupportedFormat{Tag: MakeTag("GDEF"), Format: uint32(major)}
+	}
+	minor := u16(b, 2)
+	if n := gdefLen(minor); len(b) < n {
+		return gdef{}, ErrTableTooShort{Tag: MakeTag("GDEF"), Length: len(b), MinLength: n}
+	}
+	var g gdef
+	var varStore otData
+	for _, x := range []struct {
+		dst   *otData
+		i     int
+		wide  bool
+		minor uint16
+		name  string
+	}{
+		{&g.glyphClasses, 4, false, 0, "glyph class definition"},
+		{&g.ligCarets, 8, false, 0, "ligature caret list"},
+		{&g.markAttachClasses, 10, false, 0, "mark attachment class definition"},
+		{&g.markGlyphSets, 12, false, 2, "mark glyph sets"},
+		{&varStore, 14, true, 3, "item variation store"},
+	} {
+		if minor < x.minor {
+			continue
+		}
+		if x.wide {
+			*x.dst = otData(b).offset32(x.i)
+			if *x.dst == nil && u32(b, int32(x.i)) != 0 {
+				return gdef{}, ErrInvalidTable{Tag: MakeTag("GDEF"), Reason: fmt.Sprintf("%s offset is out of bounds", x.name)}
+			}
+			continue
+		}
+		*x.dst = otData(b).offset16(x.i)
+		if *x.dst == nil && u16(b, int32(x.i)) != 0 {
+			return gdef{}, ErrInvalidTable{Tag: MakeTag("GDEF"), Reason: fmt.Sprintf("%s offset is out of bounds", x.name)}
+		}
+	}
+	g.varStore = itemVariationStore(varStore)
+	return g, nil
+}
+
+func (g *gdef) glyphClass(glyphID GlyphID) GlyphClass {
+	return GlyphClass(g.glyphClasses.class(glyphID))
+}
+
+func (g *gdef) markAttachClass(glyphID GlyphID) int {
+	return g.markAttachClasses.class(glyphID)
+}
+
+// inMarkGlyphSet returns whether the glyph is in the mark glyph set with the
+// given index.
+func (g *gdef) inMarkGlyphSet(set int, glyphID GlyphID) bool {
+	if g.markGlyphSets.u16(0) != 1 || set >= int(g.markGlyphSets.u16(2)) {
+		return false
+	}
+	return g.markGlyphSets.offset32(4+4*set).coverageIndex(glyphID) >= 0
+}
+
+// GlyphClass returns the glyph's class in the font's GDEF table. It returns
+// GlyphClassUnknown if the font has no GDEF table or does not classify the
+// glyph.
+func (f *Font) GlyphClass(glyphID GlyphID) GlyphClass {
+	return f.gdef.glyphClass(glyphID)
+}
+
+// MarkAttachClass returns the mark attachment class of the glyph in the
+// font's GDEF table, which lookups use to select the marks that they do not
+// ignore. It returns 0 if the glyph has no mark attachment class.
+func (f *Font) MarkAttachClass(glyphID GlyphID) int {
+	return f.gdef.markAttachClass(glyphID)
+}
+
+// LigatureCarets returns the positions, in font units from the glyph's
+// origin, of the carets between the components of a ligature glyph, such as
+// the two carets of "ffi". It returns nil for glyphs that are not ligatures or
+// that have no caret positions. The positions include the variation deltas at
+// the font's variation coordinates. Carets that refer to a point of the
+// glyph's outline that does not exist are omitted.
+func (f *Font) LigatureCarets(glyphID GlyphID) []int {
+	b := f.gdef.ligCarets
+	ci := b.offset16(0).coverageIndex(glyphID)
+	if ci < 0 || ci >= int(b.u16(2)) {
+		return nil
+	}
+	lig := b.offset16(4 + 2*ci)
+	n := int(lig.u16(0))
+	var carets []int
+	for i := 0; i < n; i++ {
+		c := lig.offset16(2 + 2*i)
+		switch c.u16(0) {
+		case 1:
+			carets = append(carets, int(c.i16(2)))
+		case 2:
+			if x, ok := f.glyphPointX(glyphID, int(c.u16(2))); ok {
+				carets = append(carets, x)
+			}
+		case 3:
+			x := float32(c.i16(2))
+			// Only a VariationIndex table, and not a hinting Device table,
+			// applies. It holds the outer and inner indices of the delta.
+			if d := c.offset16(4); d.u16(4) == 0x8000 {
+				x += f.gdef.varStore.delta(int(d.u16(0)), int(d.u16(2)), f.coords)
+			}
+			carets = append(carets, int(math.Round(float64(x))))
+		}
+	}
+	return carets
+}
+
+// glyphPointX returns the x coordinate of the point with the given index in
+// the simple glyph's outline.
+func (f *Font) glyphPointX(glyphID GlyphID, index int) (int, bool) {
+	g, err := f.Glyph(glyphID)
+	if err != nil {
+		return 0, false
+	}
+	it := g.glyphIter()
+	if it.err != nil || it.compoundGlyph() {
+		return 0, false
+	}
+	for i := 0; it.nextContour(); {
+		for ; it.nextPoint(); i++ {
+			if i == index {
+				return int(it.x), true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,201 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testGDEF is the subtables of a GDEF table, for buildGDEF. Nil subtables are
+// null offsets.
+type testGDEF struct {
+	glyphClasses      []byte
+	ligCarets         []byte
+	markAttachClasses []byte
+	markGlyphSets     []byte
+	varStore          []byte
+}
+
+// buildGDEF returns a version 1.3 GDEF table.
+func buildGDEF(g testGDEF) []byte {
+	return buildTable(
+		be16(1), be16(3),
+		off16(g.glyphClasses), off16(nil), off16(g.ligCarets), off16(g.markAttachClasses),
+		off16(g.markGlyphSets), off32(g.varStore),
+	)
+}
+
+// buildMarkGlyphSets returns a MarkGlyphSetsDef table with a set for each of
+// the coverage tables.
+func buildMarkGlyphSets(coverages ...[]byte) []byte {
+	fields := []interface{}{be16(1), be16(len(coverages))}
+	for _, c := range coverages {
+		fields = append(fields, off32(c))
+	}
+	return buildTable(fields...)
+}
+
+// testGDEFClasses are the glyph classes of testGDEFFont. Glyphs 6 and 7 are
+// marks, in mark attachment classes 1 and 2, and only glyph 7 is in mark
+// glyph set 0.
+var testGDEFClasses = testGDEF{
+	glyphClasses:      buildClassDef(map[GlyphID]int{1: 1, 2: 1, 3: 2, 4: 4, 6: 3, 7: 3}),
+	markAttachClasses: buildClassDef(map[GlyphID]int{6: 1, 7: 2}),
+	markGlyphSets:     buildMarkGlyphSets(buildCoverage(7)),
+}
+
+// testGDEFFont returns a font, built from testLayoutTables, with the GDEF
+// table and the GSUB table.
+func testGDEFFont(t *testing.T, g testGDEF, gsub []byte) *Font {
+	t.Helper()
+	m := testLayoutTables()
+	m["GDEF"] = buildGDEF(g)
+	if gsub != nil {
+		m["GSUB"] = gsub
+	}
+	f, err := Parse(buildFont(m))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return f
+}
+
+func TestGlyphClass(t *testing.T) {
+	f := testGDEFFont(t, testGDEFClasses, nil)
+	wantClasses := []GlyphClass{0, 1, 1, 2, 4, 0, 3, 3}
+	wantMarkClasses := []int{0, 0, 0, 0, 0, 0, 1, 2}
+	for i := range wantClasses {
+		if got, want := f.GlyphClass(GlyphID(i)), wantClasses[i]; got != want {
+			t.Errorf("GlyphClass(%d): got %d, want %d", i, got, want)
+		}
+		if got, want := f.MarkAttachClass(GlyphID(i)), wantMarkClasses[i]; got != want {
+			t.Errorf("MarkAttachClass(%d): got %d, want %d", i, got, want)
+		}
+	}
+
+	f = testFont(t)
+	if got := f.GlyphClass(1); got != GlyphClassUnknown {
+		t.Errorf("no GDEF: GlyphClass(1): got %d, want %d", got, GlyphClassUnknown)
+	}
+}
+
+func TestLigatureCarets(t *testing.T) {
+	// Glyph 3's outline is testSquare, whose point 2 is at x = 500.
+	ligCarets := buildTable(
+		off16(buildCoverage(3, 4)), be16(2),
+		off16(buildTable(be16(4),
+			off16(cat(be16(1), be16(250))),
+			off16(cat(be16(2), be16(2))),
+			off16(cat(be16(2), be16(9))),
+			off16(buildTable(be16(3), be16(300), off16(cat(be16(0), be16(0), be16(0x8000))))),
+		)),
+		off16(buildTable(be16(1),
+			// A hinting Device table is ignored.
+			off16(buildTable(be16(3), be16(600), off16(cat(be16(12), be16(12), be16(1), be16(0))))),
+		)),
+	)
+	f := testGDEFFont(t, testGDEF{
+		ligCarets: ligCarets,
+		varStore: buildItemVariationStore(
+			[]testRegion{{{0, 1, 1}}},
+			testVarData{regions: []int{0}, rows: [][]int{{100}}},
+		),
+	}, nil)
+
+	testCases := []struct {
+		glyphID GlyphID
+		coords  []float32
+		want    []int
+	}{
+		{3, nil, []int{250, 500, 300}},
+		{3, []float32{1}, []int{250, 500, 400}},
+		{3, []float32{0.25}, []int{250, 500, 325}},
+		{3, []float32{-1}, []int{250, 500, 300}},
+		{4, []float32{1}, []int{600}},
+		{1, nil, nil},
+	}
+	for _, tc := range testCases {
+		f.coords = tc.coords
+		if got := f.LigatureCarets(tc.glyphID); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("glyph %d, coords %v: got %v, want %v", tc.glyphID, tc.coords, got, tc.want)
+		}
+	}
+}
+
+func TestLookupFlags(t *testing.T) {
+	f := testGDEFFont(t, testGDEFClasses, nil)
+	r := layoutRun{glyphs: []GlyphID{0, 1, 3, 4, 6, 7}, gdef: &f.gdef}
+	testCases := []struct {
+		desc string
+		l    lookup
+		want []bool
+	}{
+		{"none", lookup{}, []bool{false, false, false, false, false, false}},
+		{"ignore base glyphs", lookup{flag: lookupIgnoreBaseGlyphs}, []bool{false, true, false, false, false, false}},
+		{"ignore ligatures", lookup{flag: lookupIgnoreLigatures}, []bool{false, false, true, false, false, false}},
+		{"ignore marks", lookup{flag: lookupIgnoreMarks}, []bool{false, false, false, false, true, true}},
+		{"mark attachment type 1", lookup{flag: 1 << 8}, []bool{false, false, false, false, false, true}},
+		{"mark attachment type 2", lookup{flag: 2 << 8}, []bool{false, false, false, false, true, false}},
+		{"mark filtering set", lookup{flag: lookupUseMarkFilteringSet}, []bool{false, false, false, false, true, false}},
+		{"missing mark filtering set", lookup{flag: lookupUseMarkFilteringSet, markFilteringSet: 1}, []bool{false, false, false, false, true, true}},
+	}
+	for _, tc := range testCases {
+		for i, want := range tc.want {
+			if got := r.skip(i, &tc.l); got != want {
+				t.Errorf("%s: glyph %d: got %t, want %t", tc.desc, r.glyphs[i], got, want)
+			}
+		}
+	}
+
+	// A ligature lookup that ignores marks forms a ligature across them, and
+	// keeps them after the ligature.
+	ligature := buildLigatureSubst([]GlyphID{50, 1, 2})
+	gsub := buildLayoutTable(
+		[]testScript{{tag: "DFLT", features: []int{0, 1}}},
+		[]testFeature{{"liga", []int{0}}, {"test", []int{1}}},
+		buildLookup(gsubLigature, lookupIgnoreMarks, ligature),
+		buildLookup(gsubLigature, 0, ligature),
+	)
+	f = testGDEFFont(t, testGDEFClasses, gsub)
+	if got, want := f.Substitute([]GlyphID{1, 6, 7, 2}, nil), []GlyphID{50, 6, 7}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ignore marks: got %v, want %v", got, want)
+	}
+	noLiga := &LayoutOptions{Features: map[Tag]bool{MakeTag("liga"): false, MakeTag("test"): true}}
+	if got, want := f.Substitute([]GlyphID{1, 6, 2}, noLiga), []GlyphID{1, 6, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("no flags: got %v, want %v", got, want)
+	}
+}
+
+func TestParseGDEFErrors(t *testing.T) {
+	testCases := []struct {
+		desc string
+		gdef []byte
+	}{
+		{"too short", be16(1)},
+		{"unsupported version", cat(be16(2), be16(0), make([]byte, 8))},
+		{"version 1.3 too short", cat(be16(1), be16(3), make([]byte, 10))},
+		{"out of bounds offset", cat(be16(1), be16(0), be16(100), make([]byte, 6))},
+		{"out of bounds variation store", cat(be16(1), be16(3), make([]byte, 10), be32(100))},
+	}
+	for _, tc := range testCases {
+		m := testLayoutTables()
+		m["GDEF"] = tc.gdef
+		if _, err := Parse(buildFont(m)); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an error matching ErrInvalidFont", tc.desc, err)
+		}
+	}
+}
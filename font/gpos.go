@@ -0,0 +1,535 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// GPOS lookup types.
+const (
+	gposSingle         = 1
+	gposPair           = 2
+	gposCursive        = 3
+	gposMarkToBase     = 4
+	gposMarkToLigature = 5
+	gposMarkToMark     = 6
+	gposContext        = 7
+	gposChainedContext = 8
+	gposExtension      = 9
+)
+
+// gposDefaultFeatures are the positioning features that are on unless
+// LayoutOptions turn them off.
+var gposDefaultFeatures = []string{"abvm", "blwm", "curs", "dist", "kern", "mark", "mkmk"}
+
+// Value record format bits. The device table offsets are skipped, as they
+// only matter for hinting at particular sizes and for variable fonts.
+const (
+	valueXPlacement = 0x0001
+	valueYPlacement = 0x0002
+	valueXAdvance   = 0x0004
+	valueYAdvance   = 0x0008
+)
+
+// GlyphPosition is a glyph in a run laid out by Position, in font units.
+// Multiply by the Font's Scale to convert to pixels.
+type GlyphPosition struct {
+	GlyphID GlyphID
+	// XAdvance and YAdvance are how far to move the pen after drawing the
+	// glyph. In horizontal text, YAdvance is usually zero.
+	XAdvance, YAdvance int
+	// XOffset and YOffset are how far to move the glyph from the pen
+	// position, without moving the pen. Y increases upwards.
+	XOffset, YOffset int
+}
+
+// Attachment types, for resolving the positions of attached glyphs once all
+// lookups are applied.
+const (
+	attachNone = iota
+	attachMark
+	attachCursive
+)
+
+// gposRun is a glyph run that GPOS lookups are applied to.
+type gposRun struct {
+	layoutRun
+	t     *layoutTable
+	pos   []GlyphPosition
+	rtl   bool
+	depth int
+
+	// attachType and attachTo record, for each glyph, what it is attached
+	// to, if anything: a mark's base glyph, or a cursive glyph's parent.
+	attachType []uint8
+	attachTo   []int
+	// components is, if not nil, the ligature components of the glyphs, as
+	// recorded by gsubRun.
+	components []int
+}
+
+// Position lays out the glyphs as a single run of horizontal text. It starts
+// with each glyph's advance width from the hmtx table, and then applies the
+// GPOS table's lookups for the selected features, such as kerning, cursive
+// attachment and mark attachment. If the font has no GPOS table, it applies
+// the legacy kern table, unless the "kern" feature is turned off. The opts may
+// be nil.
+//
+// The returned positions are in the same, logical, order as the glyphs. For
+// right to left text, they should be drawn in reverse order.
+//
+// Position does not know which component of a ligature a mark belongs to, so
+// it attaches marks to the last component of ligatures. Use Shape to attach
+// marks that were between the components of a ligature to their component.
+func (f *Font) Position(glyphs []GlyphID, opts *LayoutOptions) ([]GlyphPosition, error) {
+	return f.position(glyphs, nil, opts)
+}
+
+// position implements Position, attaching marks to the ligature components,
+// if not nil.
+func (f *Font) position(glyphs []GlyphID, components []int, opts *LayoutOptions) ([]GlyphPosition, error) {
+	if opts == nil {
+		opts = &LayoutOptions{}
+	}
+	pos := make([]GlyphPosition, len(glyphs))
+	for i, g := range glyphs {
+		m, err := f.HMetrics(g)
+		if err != nil {
+			return nil, err
+		}
+		pos[i] = GlyphPosition{GlyphID: g, XAdvance: m.AdvanceWidth}
+	}
+
+	if f.gpos.lookups == nil {
+		if on, ok := opts.Features[MakeTag("kern")]; on || !ok {
+			for i := 0; i+1 < len(pos); i++ {
+				pos[i].XAdvance += f.kern.kern(glyphs[i], glyphs[i+1])
+			}
+		}
+		return pos, nil
+	}
+
+	r := &gposRun{
+		layoutRun:  layoutRun{glyphs: append([]GlyphID(nil), glyphs...), gdef: &f.gdef},
+		t:          &f.gpos,
+		pos:        pos,
+		rtl:        opts.RightToLeft,
+		attachType: make([]uint8, len(glyphs)),
+		attachTo:   make([]int, len(glyphs)),
+		components: components,
+	}
+	for _, li := range f.gpos.lookupIndices(opts, gposDefaultFeatures) {
+		l := f.gpos.lookup(li)
+		for i := 0; i < len(pos); {
+			if r.skip(i, &l) {
+				i++
+				continue
+			}
+			if next, ok := r.apply(&l, i); ok {
+				i = next
+			} else {
+				i++
+			}
+		}
+	}
+	for i := range pos {
+		r.resolve(i)
+	}
+	return pos, nil
+}
+
+// kernLookups returns the pair adjustment lookups of the kern feature, for
+// the font's default script and language system.
+func (f *Font) kernLookups() []lookup {
+	var ls []lookup
+	for _, li := range f.gpos.lookupIndices(&LayoutOptions{}, []string{"kern"}) {
+		if l := f.gpos.lookup(li); l.typ == gposPair {
+			ls = append(ls, l)
+		}
+	}
+	return ls
+}
+
+// pairAdjustment returns the change to the advance of the left glyph, when
+// followed by the right glyph, by the pair adjustment lookups ls. It is a
+// cheaper Position for a single pair of glyphs and only those lookups.
+func (f *Font) pairAdjustment(ls []lookup, left, right GlyphID) int {
+	glyphs := [2]GlyphID{left, right}
+	var pos [2]GlyphPosition
+	r := gposRun{
+		layoutRun: layoutRun{glyphs: glyphs[:], gdef: &f.gdef},
+		t:         &f.gpos,
+		pos:       pos[:],
+	}
+	for i := range ls {
+		if !r.skip(0, &ls[i]) {
+			r.apply(&ls[i], 0)
+		}
+	}
+	return pos[0].XAdvance
+}
+
+// apply applies the first of the lookup's subtables that matches at index i
+// of the run. If one does, it returns the index to continue from.
+func (r *gposRun) apply(l *lookup, i int) (next int, ok bool) {
+	for _, s := range l.subtables {
+		switch l.typ {
+		case gposSingle:
+			next, ok = r.applySingle(s, i)
+		case gposPair:
+			next, ok = r.applyPair(s, l, i)
+		case gposCursive:
+			next, ok = r.applyCursive(s, l, i)
+		case gposMarkToBase:
+			next, ok = r.applyMarkToBase(s, l, i, false)
+		case gposMarkToLigature:
+			next, ok = r.applyMarkToBase(s, l, i, true)
+		case gposMarkToMark:
+			next, ok = r.applyMarkToMark(s, l, i)
+		case gposContext:
+			next, ok = r.applyContext(s, l, i, false)
+		case gposChainedContext:
+			next, ok = r.applyContext(s, l, i, true)
+		}
+		if ok {
+			return next, true
+		}
+	}
+	return 0, false
+}
+
+// valueRecordLen returns the length of a value record with the given format.
+func valueRecordLen(format uint16) int {
+	return 2 * bits.OnesCount16(format&0xff)
+}
+
+// applyValue adds the value record at b[off:], with the given format, to the
+// position of the glyph at index i.
+func (r *gposRun) applyValue(i int, b otData, off int, format uint16) {
+	p := &r.pos[i]
+	for _, x := range []struct {
+		bit uint16
+		dst *int
+	}{
+		{valueXPlacement, &p.XOffset},
+		{valueYPlacement, &p.YOffset},
+		{valueXAdvance, &p.XAdvance},
+		{valueYAdvance, &p.YAdvance},
+	} {
+		if format&x.bit != 0 {
+			*x.dst += int(b.i16(off))
+			off += 2
+		}
+	}
+}
+
+func (r *gposRun) applySingle(b otData, i int) (int, bool) {
+	ci := b.offset16(2).coverageIndex(r.glyphs[i])
+	if ci < 0 {
+		return 0, false
+	}
+	format := b.u16(4)
+	switch b.u16(0) {
+	case 1:
+		r.applyValue(i, b, 6, format)
+	case 2:
+		if ci >= int(b.u16(6)) {
+			return 0, false
+		}
+		r.applyValue(i, b, 8+ci*valueRecordLen(format), format)
+	default:
+		return 0, false
+	}
+	return i + 1, true
+}
+
+func (r *gposRun) applyPair(b otData, l *lookup, i int) (int, bool) {
+	ci := b.offset16(2).coverageIndex(r.glyphs[i])
+	if ci < 0 {
+		return 0, false
+	}
+	j := r.next(i, l)
+	if j < 0 {
+		return 0, false
+	}
+	format1, format2 := b.u16(4), b.u16(6)
+	len1, len2 := valueRecordLen(format1), valueRecordLen(format2)
+
+	var values otData
+	switch b.u16(0) {
+	case 1:
+		// Each pair set lists, in order, the second glyphs that follow the
+		// first glyph, with their values.
+		if ci >= int(b.u16(8)) {
+			return 0, false
+		}
+		set := b.offset16(10 + 2*ci)
+		recLen := 2 + len1 + len2
+		n := int(set.u16(0))
+		k := sort.Search(n, func(k int) bool { return GlyphID(set.u16(2+recLen*k)) >= r.glyphs[j] })
+		if k == n || GlyphID(set.u16(2+recLen*k)) != r.glyphs[j] {
+			return 0, false
+		}
+		values = set[min(2+recLen*k+2, len(set)):]
+	case 2:
+		class1 := b.offset16(8).class(r.glyphs[i])
+		class2 := b.offset16(10).class(r.glyphs[j])
+		n1, n2 := int(b.u16(12)), int(b.u16(14))
+		if class1 >= n1 || class2 >= n2 {
+			return 0, false
+		}
+		off := 16 + (class1*n2+class2)*(len1+len2)
+		if off >= len(b) {
+			return 0, false
+		}
+		values = b[off:]
+	default:
+		return 0, false
+	}
+
+	r.applyValue(i, values, 0, format1)
+	r.applyValue(j, values, len1, format2)
+	if len2 != 0 {
+		return j + 1, true
+	}
+	return j, true
+}
+
+// anchor returns the coordinates of the Anchor table b. Formats 2 and 3 add a
+// contour point and device tables, used for hinting, to format 1.
+func anchor(b otData) (x, y int, ok bool) {
+	if b == nil || b.u16(0) < 1 || 3 < b.u16(0) {
+		return 0, 0, false
+	}
+	return int(b.i16(2)), int(b.i16(4)), true
+}
+
+// applyCursive connects the entry anchor of the glyph at index i to the exit
+// anchor of the previous glyph.
+func (r *gposRun) applyCursive(b otData, l *lookup, i int) (int, bool) {
+	coverage := b.offset16(2)
+	n := int(b.u16(4))
+	ci := coverage.coverageIndex(r.glyphs[i])
+	if ci < 0 || ci >= n {
+		return 0, false
+	}
+	entryX, entryY, ok := anchor(b.offset16(6 + 4*ci))
+	if !ok {
+		return 0, false
+	}
+	j := r.prev(i, l)
+	if j < 0 {
+		return 0, false
+	}
+	cj := coverage.coverageIndex(r.glyphs[j])
+	if cj < 0 || cj >= n {
+		return 0, false
+	}
+	exitX, exitY, ok := anchor(b.offset16(6 + 4*cj + 2))
+	if !ok {
+		return 0, false
+	}
+
+	// Adjust the advances so that the previous glyph's exit anchor meets
+	// this glyph's entry anchor.
+	if !r.rtl {
+		r.pos[j].XAdvance = exitX + r.pos[j].XOffset
+		d := entryX + r.pos[i].XOffset
+		r.pos[i].XAdvance -= d
+		r.pos[i].XOffset -= d
+	} else {
+		d := exitX + r.pos[j].XOffset
+		r.pos[j].XAdvance -= d
+		r.pos[j].XOffset -= d
+		r.pos[i].XAdvance = entryX + r.pos[i].XOffset
+	}
+
+	// Attach one glyph to the other vertically. Unless the lookup flags say
+	// otherwise, the later glyph is the child.
+	child, parent, dy := i, j, exitY-entryY
+	if l.flag&lookupRightToLeft != 0 {
+		child, parent, dy = j, i, entryY-exitY
+	}
+	r.attachType[child] = attachCursive
+	r.attachTo[child] = parent
+	r.pos[child].YOffset = dy
+	return i + 1, true
+}
+
+// applyMarkToBase attaches the mark at index i to the previous base glyph,
+// or, if lig is true, to the previous ligature's component that the mark
+// belongs to, or its last component if that is not known. The base is the
+// previous glyph that is not a mark.
+func (r *gposRun) applyMarkToBase(b otData, l *lookup, i int, lig bool) (int, bool) {
+	mi := b.offset16(2).coverageIndex(r.glyphs[i])
+	if mi < 0 {
+		return 0, false
+	}
+	j := i
+	for {
+		if j = r.prev(j, l); j < 0 {
+			return 0, false
+		}
+		if !r.isMark(l, r.glyphs[j]) {
+			break
+		}
+	}
+	bi := b.offset16(4).coverageIndex(r.glyphs[j])
+	if bi < 0 {
+		return 0, false
+	}
+	nClasses := int(b.u16(6))
+	marks, bases := b.offset16(8), b.offset16(10)
+	if bi >= int(bases.u16(0)) {
+		return 0, false
+	}
+
+	var anchors otData
+	off := 0
+	if !lig {
+		anchors, off = bases, 2+2*nClasses*bi
+	} else {
+		anchors = bases.offset16(2 + 2*bi)
+		c := int(anchors.u16(0))
+		if c == 0 {
+			return 0, false
+		}
+		if r.components != nil && 0 < r.components[i] && r.components[i] < c {
+			c = r.components[i]
+		}
+		off = 2 + 2*nClasses*(c-1)
+	}
+	return r.attachMark(marks, mi, anchors, off, nClasses, i, j)
+}
+
+// isMark returns whether the glyph is a mark, by its GDEF glyph class. For
+// fonts without glyph classes, it returns whether the glyph is in the mark
+// coverage of any of the mark attachment lookup's subtables. Marks may be
+// split between subtables by the anchors they attach with, such as above and
+// below marks, so looking at just one subtable is not enough.
+func (r *gposRun) isMark(l *lookup, g GlyphID) bool {
+	if r.gdef.glyphClasses != nil {
+		return r.gdef.glyphClass(g) == GlyphClassMark
+	}
+	for _, s := range l.subtables {
+		if s.offset16(2).coverageIndex(g) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// applyMarkToMark attaches the mark at index i to the previous mark.
+func (r *gposRun) applyMarkToMark(b otData, l *lookup, i int) (int, bool) {
+	mi := b.offset16(2).coverageIndex(r.glyphs[i])
+	if mi < 0 {
+		return 0, false
+	}
+	j := r.prev(i, l)
+	if j < 0 {
+		return 0, false
+	}
+	bi := b.offset16(4).coverageIndex(r.glyphs[j])
+	if bi < 0 {
+		return 0, false
+	}
+	nClasses := int(b.u16(6))
+	marks, bases := b.offset16(8), b.offset16(10)
+	if bi >= int(bases.u16(0)) {
+		return 0, false
+	}
+	return r.attachMark(marks, mi, bases, 2+2*nClasses*bi, nClasses, i, j)
+}
+
+// attachMark attaches the mark at index i, with the given index in the
+// MarkArray table marks, to the glyph at index j. The anchors for each mark
+// class of that glyph are at anchors[off:], as offsets relative to anchors.
+func (r *gposRun) attachMark(marks otData, mi int, anchors otData, off, nClasses, i, j int) (int, bool) {
+	if mi >= int(marks.u16(0)) {
+		return 0, false
+	}
+	class := int(marks.u16(2 + 4*mi))
+	if class >= nClasses {
+		return 0, false
+	}
+	markX, markY, ok := anchor(marks.offset16(2 + 4*mi + 2))
+	if !ok {
+		return 0, false
+	}
+	baseX, baseY, ok := anchor(anchors.offset16(off + 2*class))
+	if !ok {
+		return 0, false
+	}
+	r.pos[i].XOffset = baseX - markX
+	r.pos[i].YOffset = baseY - markY
+	r.attachType[i] = attachMark
+	r.attachTo[i] = j
+	return i + 1, true
+}
+
+// applyContext applies a context or chained context subtable at index i.
+func (r *gposRun) applyContext(b otData, l *lookup, i int, chained bool) (int, bool) {
+	if r.depth >= maxContextDepth {
+		return 0, false
+	}
+	input, records, ok := r.matchContext(b, chained, i, l)
+	if !ok || len(input) == 0 {
+		return 0, false
+	}
+	r.depth++
+	for _, rec := range records {
+		if rec.seqIndex >= len(input) {
+			continue
+		}
+		nested := r.t.lookup(rec.lookupIndex)
+		r.apply(&nested, input[rec.seqIndex])
+	}
+	r.depth--
+	return input[len(input)-1] + 1, true
+}
+
+// resolve makes the offsets of the glyph at index i, if it is attached to
+// another glyph, relative to its own pen position instead of to the other
+// glyph's. It first resolves the other glyph's position, recursively.
+func (r *gposRun) resolve(i int) {
+	typ := r.attachType[i]
+	if typ == attachNone {
+		return
+	}
+	r.attachType[i] = attachNone
+	j := r.attachTo[i]
+	r.resolve(j)
+
+	p, q := &r.pos[i], &r.pos[j]
+	if typ == attachCursive {
+		p.YOffset += q.YOffset
+		return
+	}
+	p.XOffset += q.XOffset
+	p.YOffset += q.YOffset
+	// The pen has moved from the base glyph to the mark by the advances in
+	// between, in logical order for left to right text.
+	if !r.rtl {
+		for k := j; k < i; k++ {
+			p.XOffset -= r.pos[k].XAdvance
+		}
+	} else {
+		for k := j + 1; k <= i; k++ {
+			p.XOffset += r.pos[k].XAdvance
+		}
+	}
+}
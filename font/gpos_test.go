@@ -0,0 +1,410 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func buildAnchor(x, y int) []byte {
+	return cat(be16(1), be16(x), be16(y))
+}
+
+// buildMarkArray returns a MarkArray table for marks with the given classes
+// and anchors.
+func buildMarkArray(marks ...[3]int) []byte {
+	fields := []interface{}{be16(len(marks))}
+	for _, m := range marks {
+		fields = append(fields, be16(m[0]), off16(buildAnchor(m[1], m[2])))
+	}
+	return buildTable(fields...)
+}
+
+// buildAnchorArray returns a BaseArray or Mark2Array table, or a
+// LigatureAttach table, with rows of anchors, indexed by mark class. A nil
+// anchor is a null offset.
+func buildAnchorArray(rows ...[][]byte) []byte {
+	fields := []interface{}{be16(len(rows))}
+	for _, row := range rows {
+		for _, a := range row {
+			fields = append(fields, off16(a))
+		}
+	}
+	return buildTable(fields...)
+}
+
+// testGPOS returns a font, built from testLayoutTables, whose GPOS table has
+// one feature, "test", with the given lookups.
+func testGPOS(t *testing.T, lookups ...[]byte) *Font {
+	t.Helper()
+	indices := make([]int, len(lookups))
+	for i := range indices {
+		indices[i] = i
+	}
+	m := testLayoutTables()
+	m["GPOS"] = buildLayoutTable(
+		[]testScript{{tag: "DFLT", features: []int{0}}},
+		[]testFeature{{"test", indices}},
+		lookups...,
+	)
+	f, err := Parse(buildFont(m))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return f
+}
+
+var testGPOSOptions = &LayoutOptions{Features: map[Tag]bool{MakeTag("test"): true}}
+
+func TestPosition(t *testing.T) {
+	singleFormat1 := buildTable(be16(1), off16(buildCoverage(2)), be16(valueXPlacement|valueXAdvance), be16(10), be16(20))
+	singleFormat2 := buildTable(be16(2), off16(buildCoverage(1, 3)), be16(valueYPlacement), be16(2), be16(5), be16(7))
+	pairFormat1 := buildTable(
+		be16(1), off16(buildCoverage(1)), be16(valueXAdvance), be16(0), be16(1),
+		off16(cat(be16(2), be16(2), be16(-50), be16(3), be16(-60))),
+	)
+	pairFormat1Second := buildTable(
+		be16(1), off16(buildCoverage(2)), be16(valueXAdvance), be16(valueXPlacement), be16(1),
+		off16(cat(be16(1), be16(3), be16(-30), be16(15))),
+	)
+	pairFormat2 := buildTable(
+		be16(2), off16(buildCoverage(1, 2)), be16(valueXAdvance), be16(0),
+		off16(buildClassDef(map[GlyphID]int{1: 1, 2: 1})),
+		off16(buildClassDef(map[GlyphID]int{3: 1})),
+		be16(2), be16(2),
+		be16(0), be16(0), be16(0), be16(-40),
+	)
+	cursive := buildTable(
+		be16(1), off16(buildCoverage(4, 5)), be16(2),
+		off16(buildAnchor(0, 0)), off16(buildAnchor(700, 100)),
+		off16(buildAnchor(50, 0)), off16(buildAnchor(850, 0)),
+	)
+	markToBase := buildTable(
+		be16(1), off16(buildCoverage(6)), off16(buildCoverage(1, 2)), be16(1),
+		off16(buildMarkArray([3]int{0, 100, 0})),
+		off16(buildAnchorArray([][]byte{buildAnchor(250, 700)}, [][]byte{buildAnchor(300, 650)})),
+	)
+	markToLigature := buildTable(
+		be16(1), off16(buildCoverage(6)), off16(buildCoverage(3)), be16(1),
+		off16(buildMarkArray([3]int{0, 100, 0})),
+		off16(buildTable(be16(1), off16(buildAnchorArray(
+			[][]byte{buildAnchor(100, 500)},
+			[][]byte{buildAnchor(500, 500)},
+		)))),
+	)
+	markToMark := buildTable(
+		be16(1), off16(buildCoverage(7)), off16(buildCoverage(6)), be16(1),
+		off16(buildMarkArray([3]int{0, 100, 0})),
+		off16(buildAnchorArray([][]byte{buildAnchor(100, 900)})),
+	)
+
+	testCases := []struct {
+		desc    string
+		lookups [][]byte
+		opts    *LayoutOptions
+		glyphs  []GlyphID
+		want    []GlyphPosition
+	}{{
+		desc:    "single",
+		lookups: [][]byte{buildLookup(gposSingle, 0, singleFormat1, singleFormat2)},
+		glyphs:  []GlyphID{1, 2, 3, 4},
+		want:    []GlyphPosition{{1, 500, 0, 0, 5}, {2, 620, 0, 10, 0}, {3, 700, 0, 0, 7}, {4, 800, 0, 0, 0}},
+	}, {
+		desc:    "pair format 1",
+		lookups: [][]byte{buildLookup(gposPair, 0, pairFormat1)},
+		glyphs:  []GlyphID{1, 2, 1, 3, 1},
+		want:    []GlyphPosition{{1, 450, 0, 0, 0}, {2, 600, 0, 0, 0}, {1, 440, 0, 0, 0}, {3, 700, 0, 0, 0}, {1, 500, 0, 0, 0}},
+	}, {
+		desc:    "pair format 1 with second value",
+		lookups: [][]byte{buildLookup(gposPair, 0, pairFormat1Second)},
+		glyphs:  []GlyphID{2, 3, 3},
+		want:    []GlyphPosition{{2, 570, 0, 0, 0}, {3, 700, 0, 15, 0}, {3, 700, 0, 0, 0}},
+	}, {
+		desc:    "pair format 2",
+		lookups: [][]byte{buildLookup(gposPair, 0, pairFormat2)},
+		glyphs:  []GlyphID{1, 3, 2, 3, 3},
+		want:    []GlyphPosition{{1, 460, 0, 0, 0}, {3, 700, 0, 0, 0}, {2, 560, 0, 0, 0}, {3, 700, 0, 0, 0}, {3, 700, 0, 0, 0}},
+	}, {
+		desc:    "extension",
+		lookups: [][]byte{buildLookup(gposExtension, 0, buildTable(be16(1), be16(gposPair), off32(pairFormat1)))},
+		glyphs:  []GlyphID{1, 2},
+		want:    []GlyphPosition{{1, 450, 0, 0, 0}, {2, 600, 0, 0, 0}},
+	}, {
+		desc:    "cursive",
+		lookups: [][]byte{buildLookup(gposCursive, 0, cursive)},
+		glyphs:  []GlyphID{4, 5},
+		want:    []GlyphPosition{{4, 700, 0, 0, 0}, {5, 850, 0, -50, 100}},
+	}, {
+		desc:    "cursive right to left",
+		lookups: [][]byte{buildLookup(gposCursive, lookupRightToLeft, cursive)},
+		opts:    &LayoutOptions{RightToLeft: true},
+		glyphs:  []GlyphID{4, 5},
+		want:    []GlyphPosition{{4, 100, 0, -700, -100}, {5, 50, 0, 0, 0}},
+	}, {
+		desc:    "mark to base",
+		lookups: [][]byte{buildLookup(gposMarkToBase, 0, markToBase)},
+		glyphs:  []GlyphID{1, 6, 2, 6},
+		want:    []GlyphPosition{{1, 500, 0, 0, 0}, {6, 0, 0, -350, 700}, {2, 600, 0, 0, 0}, {6, 0, 0, -400, 650}},
+	}, {
+		desc:    "mark to base right to left",
+		lookups: [][]byte{buildLookup(gposMarkToBase, 0, markToBase)},
+		opts:    &LayoutOptions{RightToLeft: true},
+		glyphs:  []GlyphID{1, 6},
+		want:    []GlyphPosition{{1, 500, 0, 0, 0}, {6, 0, 0, 150, 700}},
+	}, {
+		desc:    "mark to base without base",
+		lookups: [][]byte{buildLookup(gposMarkToBase, 0, markToBase)},
+		glyphs:  []GlyphID{6, 3, 6},
+		want:    []GlyphPosition{{6, 0, 0, 0, 0}, {3, 700, 0, 0, 0}, {6, 0, 0, 0, 0}},
+	}, {
+		desc:    "mark to ligature",
+		lookups: [][]byte{buildLookup(gposMarkToLigature, 0, markToLigature)},
+		glyphs:  []GlyphID{3, 6},
+		want:    []GlyphPosition{{3, 700, 0, 0, 0}, {6, 0, 0, -300, 500}},
+	}, {
+		desc: "mark to mark",
+		lookups: [][]byte{
+			buildLookup(gposMarkToBase, 0, markToBase),
+			buildLookup(gposMarkToMark, 0, markToMark),
+		},
+		glyphs: []GlyphID{1, 6, 7},
+		want:   []GlyphPosition{{1, 500, 0, 0, 0}, {6, 0, 0, -350, 700}, {7, 0, 0, -350, 1600}},
+	}}
+
+	for _, tc := range testCases {
+		f := testGPOS(t, tc.lookups...)
+		opts := tc.opts
+		if opts == nil {
+			opts = &LayoutOptions{}
+		}
+		opts.Features = testGPOSOptions.Features
+		got, err := f.Position(tc.glyphs, opts)
+		if err != nil {
+			t.Errorf("%s: %v", tc.desc, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s:\ngot  %v\nwant %v", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestPositionContext(t *testing.T) {
+	// Lookup 0 is only applied by the contextual lookups.
+	nested := buildLookup(gposSingle, 0, buildTable(be16(1), off16(buildCoverage(2)), be16(valueXAdvance), be16(100)))
+	testCases := []struct {
+		desc     string
+		subtable []byte
+		chained  bool
+		// needsContext is whether the rule also needs glyph 3 before, and
+		// glyph 4 after, the input sequence of glyphs 1 and 2.
+		needsContext bool
+	}{{
+		desc: "context format 1",
+		subtable: buildTable(be16(1), off16(buildCoverage(1)), be16(1),
+			off16(buildTable(be16(1), off16(cat(be16(2), be16(1), be16(2), be16(1), be16(0)))))),
+	}, {
+		desc: "context format 2",
+		subtable: buildTable(be16(2), off16(buildCoverage(1)), off16(buildClassDef(map[GlyphID]int{1: 1, 2: 2})), be16(2),
+			off16(nil), off16(buildTable(be16(1), off16(cat(be16(2), be16(1), be16(2), be16(1), be16(0)))))),
+	}, {
+		desc: "context format 3",
+		subtable: buildTable(be16(3), be16(2), be16(1),
+			off16(buildCoverage(1)), off16(buildCoverage(2)), be16(1), be16(0)),
+	}, {
+		desc:    "chained context format 1",
+		chained: true,
+		subtable: buildTable(be16(1), off16(buildCoverage(1)), be16(1),
+			off16(buildTable(be16(1), off16(cat(
+				be16(0), be16(2), be16(2), be16(0), be16(1), be16(1), be16(0)))))),
+	}, {
+		desc:    "chained context format 3",
+		chained: true,
+		subtable: buildTable(be16(3),
+			be16(0),
+			be16(2), off16(buildCoverage(1)), off16(buildCoverage(2)),
+			be16(0),
+			be16(1), be16(1), be16(0)),
+	}, {
+		desc:         "chained context format 3 with backtrack and lookahead",
+		chained:      true,
+		needsContext: true,
+		subtable: buildTable(be16(3),
+			be16(1), off16(buildCoverage(3)),
+			be16(2), off16(buildCoverage(1)), off16(buildCoverage(2)),
+			be16(1), off16(buildCoverage(4)),
+			be16(1), be16(1), be16(0)),
+	}}
+
+	for _, tc := range testCases {
+		typ := gposContext
+		if tc.chained {
+			typ = gposChainedContext
+		}
+		m := testLayoutTables()
+		m["GPOS"] = buildLayoutTable(
+			[]testScript{{tag: "DFLT", features: []int{0}}},
+			[]testFeature{{"test", []int{1}}},
+			nested, buildLookup(typ, 0, tc.subtable),
+		)
+		f, err := Parse(buildFont(m))
+		if err != nil {
+			t.Fatalf("%s: Parse: %v", tc.desc, err)
+		}
+		for _, run := range []struct {
+			glyphs []GlyphID
+			match  bool
+		}{
+			{[]GlyphID{3, 1, 2, 4}, true},
+			{[]GlyphID{3, 2, 2, 4}, false},
+			{[]GlyphID{1, 2}, !tc.needsContext},
+			{[]GlyphID{1, 3, 2}, false},
+		} {
+			got, err := f.Position(run.glyphs, testGPOSOptions)
+			if err != nil {
+				t.Fatalf("%s: Position: %v", tc.desc, err)
+			}
+			// The nested lookup adds 100 to glyph 2's advance of 600.
+			want := []int{0, 500, 600, 700, 800}
+			if run.match {
+				want[2] = 700
+			}
+			for i, g := range run.glyphs {
+				if got[i].XAdvance != want[g] {
+					t.Errorf("%s: glyphs %v: glyph %d: got advance %d, want %d",
+						tc.desc, run.glyphs, i, got[i].XAdvance, want[g])
+				}
+			}
+		}
+	}
+}
+
+func TestPositionEmptyContext(t *testing.T) {
+	// A context format 3 subtable with no input coverage matches nothing.
+	m := testLayoutTables()
+	m["GPOS"] = buildLayoutTable(
+		[]testScript{{tag: "DFLT", features: []int{0}}},
+		[]testFeature{{"test", []int{0}}},
+		buildLookup(gposContext, 0, buildTable(be16(3), be16(0), be16(0))),
+	)
+	f, err := Parse(buildFont(m))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	got, err := f.Position([]GlyphID{1, 2}, testGPOSOptions)
+	if err != nil {
+		t.Fatalf("Position: %v", err)
+	}
+	for i, want := range []int{500, 600} {
+		if got[i].XAdvance != want {
+			t.Errorf("glyph %d: got advance %d, want %d", i, got[i].XAdvance, want)
+		}
+	}
+}
+
+func TestPositionLegacyKern(t *testing.T) {
+	m := testTables()
+	m["kern"] = buildKernMicrosoft(0x0001, buildKern0(testKernPair{1, 2, -50}))
+	f, err := Parse(buildFont(m))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	got, err := f.Position([]GlyphID{1, 2, 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []GlyphPosition{{1, 550, 0, 0, 0}, {2, 700, 0, 0, 0}, {1, 600, 0, 0, 0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	got, err = f.Position([]GlyphID{1, 2}, &LayoutOptions{Features: map[Tag]bool{MakeTag("kern"): false}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].XAdvance != 600 {
+		t.Errorf("kern off: got advance %d, want 600", got[0].XAdvance)
+	}
+
+	if _, err := f.Position([]GlyphID{1, 99}, nil); !errors.Is(err, ErrInvalidFont) {
+		t.Errorf("invalid glyph: got %v, want an error matching ErrInvalidFont", err)
+	}
+}
+
+func TestShapeLigatureComponents(t *testing.T) {
+	m := testLayoutTables()
+	m["GDEF"] = buildGDEF(testGDEFClasses)
+	m["GSUB"] = buildLayoutTable(
+		[]testScript{{tag: "DFLT", features: []int{0}}},
+		[]testFeature{{"liga", []int{0}}},
+		buildLookup(gsubLigature, lookupIgnoreMarks, buildLigatureSubst([]GlyphID{3, 1, 2})),
+	)
+	m["GPOS"] = buildLayoutTable(
+		[]testScript{{tag: "DFLT", features: []int{0}}},
+		[]testFeature{{"mark", []int{0}}},
+		buildLookup(gposMarkToLigature, 0, buildTable(
+			be16(1), off16(buildCoverage(6)), off16(buildCoverage(3)), be16(1),
+			off16(buildMarkArray([3]int{0, 100, 0})),
+			off16(buildTable(be16(1), off16(buildAnchorArray(
+				[][]byte{buildAnchor(100, 500)},
+				[][]byte{buildAnchor(500, 500)},
+			)))),
+		)),
+	)
+	f, err := Parse(buildFont(m))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	testCases := []struct {
+		desc   string
+		glyphs []GlyphID
+		want   []GlyphPosition
+	}{{
+		desc:   "mark on the first component",
+		glyphs: []GlyphID{1, 6, 2},
+		want:   []GlyphPosition{{3, 700, 0, 0, 0}, {6, 0, 0, -700, 500}},
+	}, {
+		desc:   "mark on the last component",
+		glyphs: []GlyphID{1, 2, 6},
+		want:   []GlyphPosition{{3, 700, 0, 0, 0}, {6, 0, 0, -300, 500}},
+	}, {
+		desc:   "marks on both components",
+		glyphs: []GlyphID{1, 6, 2, 6, 1},
+		want:   []GlyphPosition{{3, 700, 0, 0, 0}, {6, 0, 0, -700, 500}, {6, 0, 0, -300, 500}, {1, 500, 0, 0, 0}},
+	}}
+	for _, tc := range testCases {
+		got, err := f.Shape(tc.glyphs, nil)
+		if err != nil {
+			t.Errorf("%s: %v", tc.desc, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s:\ngot  %v\nwant %v", tc.desc, got, tc.want)
+		}
+	}
+
+	// Without Shape's record of the components, Position attaches the mark
+	// to the last component.
+	got, err := f.Position(f.Substitute([]GlyphID{1, 6, 2}, nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []GlyphPosition{{3, 700, 0, 0, 0}, {6, 0, 0, -300, 500}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Position:\ngot  %v\nwant %v", got, want)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Extend modes of a color line, which determine the colors outside the range
+// of its stops.
+const (
+	extendPad     = 0
+	extendRepeat  = 1
+	extendReflect = 2
+)
+
+const (
+	colorStopLen    = 6
+	varColorStopLen = 10
+)
+
+// colorStop is a gradient's color at an offset along its color line, with
+// premultiplied red, green, blue and alpha values.
+type colorStop struct {
+	offset float32
+	color  [4]float32
+}
+
+// colorLine is a gradient's colors, with its stops sorted by offset.
+type colorLine struct {
+	extend uint8
+	stops  []colorStop
+}
+
+// colorLine decodes the ColorLine, or VarColorLine, at offset off.
+func (r *paintRenderer) colorLine(off int, variable bool) (colorLine, error) {
+	if off <= 0 || off >= len(r.c.data) {
+		return colorLine{}, ErrInvalidGlyph{fmt.Sprintf("color line offset %d is out of bounds", off)}
+	}
+	b := r.c.data[off:]
+	stopLen := colorStopLen
+	if variable {
+		stopLen = varColorStopLen
+	}
+	n := int(b.u16(1))
+	if 3+n*stopLen > len(b) {
+		return colorLine{}, ErrInvalidGlyph{fmt.Sprintf("color line at offset %d is out of bounds", off)}
+	}
+	// Unknown extend modes are treated as pad.
+	l := colorLine{extend: b[0], stops: make([]colorStop, n)}
+	for i := range l.stops {
+		s := b[3+i*stopLen:]
+		var d [2]float32
+		if variable {
+			r.c.deltas(d[:], s.u32(6), r.f.coords)
+		}
+		c, err := r.color(int(s.u16(2)), f2dot14(s.i16(4))+d[1]/(1<<14))
+		if err != nil {
+			return colorLine{}, err
+		}
+		l.stops[i] = colorStop{f2dot14(s.i16(0)) + d[0]/(1<<14), c}
+	}
+	sort.SliceStable(l.stops, func(i, j int) bool { return l.stops[i].offset < l.stops[j].offset })
+	return l, nil
+}
+
+// at returns the color line's color at offset t. Colors between stops are
+// interpolated in premultiplied form.
+func (l *colorLine) at(t float32) [4]float32 {
+	first, last := l.stops[0], l.stops[len(l.stops)-1]
+	if d := last.offset - first.offset; d > 0 && (l.extend == extendRepeat || l.extend == extendReflect) {
+		u := float64((t - first.offset) / d)
+		if l.extend == extendRepeat {
+			u -= math.Floor(u)
+		} else if u = math.Mod(math.Abs(u), 2); u > 1 {
+			u = 2 - u
+		}
+		t = first.offset + float32(u)*d
+	}
+	if !(t > first.offset) {
+		return first.color
+	}
+	for i := 1; i < len(l.stops); i++ {
+		s0, s1 := l.stops[i-1], l.stops[i]
+		if t >= s1.offset {
+			continue
+		}
+		u := (t - s0.offset) / (s1.offset - s0.offset)
+		var c [4]float32
+		for j := range c {
+			c[j] = s0.color[j] + u*(s1.color[j]-s0.color[j])
+		}
+		return c
+	}
+	return last.color
+}
+
+// shader returns a function that returns the gradient's color at a point in
+// font units, and whether the gradient covers that point.
+func (l *colorLine) shader(format uint8, g *[6]float32) func(point) ([4]float32, bool) {
+	none := func(point) ([4]float32, bool) { return [4]float32{}, false }
+	switch format {
+	case paintLinearGradient:
+		// The gradient is perpendicular to the line from p0 to p2, so its
+		// colors vary along the projection of p1 - p0 onto that line's
+		// normal, from p0 to p3.
+		x0, y0 := float64(g[0]), float64(g[1])
+		dx, dy := float64(g[2])-x0, float64(g[3])-y0
+		nx, ny := -(float64(g[5]) - y0), float64(g[4])-x0
+		if nn := nx*nx + ny*ny; nn != 0 {
+			k := (dx*nx + dy*ny) / nn
+			dx, dy = k*nx, k*ny
+		}
+		dd := dx*dx + dy*dy
+		if dd == 0 {
+			return none
+		}
+		return func(p point) ([4]float32, bool) {
+			t := ((float64(p.x)-x0)*dx + (float64(p.y)-y0)*dy) / dd
+			return l.at(float32(t)), true
+		}
+
+	case paintRadialGradient:
+		// The gradient's circles are interpolated from (x0, y0, r0) to (x1,
+		// y1, r1), and a point's color is that of the circle through it with
+		// the largest offset t and a non-negative radius. That t solves
+		// a*t² - 2*b*t + c = 0, with b depending on the point.
+		x0, y0, r0 := float64(g[0]), float64(g[1]), float64(g[2])
+		cx, cy, dr := float64(g[3])-x0, float64(g[4])-y0, float64(g[5])-r0
+		a := cx*cx + cy*cy - dr*dr
+		return func(p point) ([4]float32, bool) {
+			px, py := float64(p.x)-x0, float64(p.y)-y0
+			b := px*cx + py*cy + r0*dr
+			c := px*px + py*py - r0*r0
+			var t float64
+			if math.Abs(a) < 1e-9 {
+				if b == 0 {
+					return [4]float32{}, false
+				}
+				t = c / (2 * b)
+			} else {
+				disc := b*b - a*c
+				if disc < 0 {
+					return [4]float32{}, false
+				}
+				s := math.Sqrt(disc)
+				t0, t1 := (b+s)/a, (b-s)/a
+				if t0 < t1 {
+					t0, t1 = t1, t0
+				}
+				if t = t0; r0+t*dr < 0 {
+					t = t1
+				}
+			}
+			if r0+t*dr < 0 {
+				return [4]float32{}, false
+			}
+			return l.at(float32(t)), true
+		}
+
+	case paintSweepGradient:
+		// The angles are in half turns, counter-clockwise from the positive x
+		// axis.
+		cx, cy := float64(g[0]), float64(g[1])
+		start, end := 180*float64(g[2]), 180*float64(g[3])
+		if start == end {
+			return none
+		}
+		return func(p point) ([4]float32, bool) {
+			angle := math.Atan2(float64(p.y)-cy, float64(p.x)-cx) * 180 / math.Pi
+			if angle < 0 {
+				angle += 360
+			}
+			return l.at(float32((angle - start) / (end - start))), true
+		}
+	}
+	return none
+}
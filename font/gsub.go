@@ -0,0 +1,318 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+// GSUB lookup types.
+const (
+	gsubSingle                = 1
+	gsubMultiple              = 2
+	gsubAlternate             = 3
+	gsubLigature              = 4
+	gsubContext               = 5
+	gsubChainedContext        = 6
+	gsubExtension             = 7
+	gsubReverseChainedContext = 8
+)
+
+// gsubDefaultFeatures are the substitution features that are on unless
+// LayoutOptions turn them off.
+var gsubDefaultFeatures = []string{"calt", "ccmp", "clig", "liga", "locl", "rclt", "rlig"}
+
+// gsubMaxLenFactor and gsubMinMaxLen limit how long multiple substitutions can
+// make a run, relative to its original length, as malformed fonts could
+// otherwise grow it exponentially.
+const (
+	gsubMaxLenFactor = 32
+	gsubMinMaxLen    = 8192
+)
+
+// gsubRun is a glyph run that GSUB lookups are applied to.
+type gsubRun struct {
+	layoutRun
+	t      *layoutTable
+	depth  int
+	maxLen int
+
+	// components records, for each glyph, the ligature component that it
+	// belongs to, for marks that were between the components of a ligature.
+	// It is the component's index plus one, or zero for other glyphs.
+	components []int
+}
+
+// Substitute applies the GSUB table's lookups for the selected features to
+// the glyphs, such as replacing "f" and "i" with an "fi" ligature, and returns
+// the resultant glyphs. The input glyphs are not modified. The opts may be
+// nil.
+//
+// Features that depend on a glyph's position in a word, such as the "init",
+// "medi" and "fina" forms of Arabic, are off by default, as choosing them
+// needs more context than a glyph run. Alternate substitutions, such as for
+// "salt", pick the first alternate.
+func (f *Font) Substitute(glyphs []GlyphID, opts *LayoutOptions) []GlyphID {
+	return f.substitute(glyphs, opts).glyphs
+}
+
+// substitute implements Substitute, returning the run with the ligature
+// components of its marks.
+func (f *Font) substitute(glyphs []GlyphID, opts *LayoutOptions) *gsubRun {
+	if opts == nil {
+		opts = &LayoutOptions{}
+	}
+	r := &gsubRun{
+		layoutRun:  layoutRun{glyphs: append([]GlyphID(nil), glyphs...), gdef: &f.gdef},
+		t:          &f.gsub,
+		maxLen:     max(gsubMinMaxLen, gsubMaxLenFactor*len(glyphs)),
+		components: make([]int, len(glyphs)),
+	}
+	if f.gsub.lookups == nil {
+		return r
+	}
+	for _, li := range f.gsub.lookupIndices(opts, gsubDefaultFeatures) {
+		l := f.gsub.lookup(li)
+		if l.typ == gsubReverseChainedContext {
+			// Reverse chained substitutions apply from the end of the run to
+			// the start, and never change its length.
+			for i := len(r.glyphs) - 1; i >= 0; i-- {
+				if !r.skip(i, &l) {
+					r.apply(&l, i)
+				}
+			}
+			continue
+		}
+		for i := 0; i < len(r.glyphs); {
+			if r.skip(i, &l) {
+				i++
+				continue
+			}
+			if next, ok := r.apply(&l, i); ok {
+				i = next
+			} else {
+				i++
+			}
+		}
+	}
+	return r
+}
+
+// apply applies the first of the lookup's subtables that matches at index i
+// of the run. If one does, it returns the index to continue from.
+func (r *gsubRun) apply(l *lookup, i int) (next int, ok bool) {
+	for _, s := range l.subtables {
+		switch l.typ {
+		case gsubSingle:
+			next, ok = r.applySingle(s, i)
+		case gsubMultiple:
+			next, ok = r.applyMultiple(s, i)
+		case gsubAlternate:
+			next, ok = r.applyAlternate(s, i)
+		case gsubLigature:
+			next, ok = r.applyLigature(s, l, i)
+		case gsubContext:
+			next, ok = r.applyContext(s, l, i, false)
+		case gsubChainedContext:
+			next, ok = r.applyContext(s, l, i, true)
+		case gsubReverseChainedContext:
+			next, ok = r.applyReverseChainedContext(s, l, i)
+		}
+		if ok {
+			return next, true
+		}
+	}
+	return 0, false
+}
+
+func (r *gsubRun) applySingle(b otData, i int) (int, bool) {
+	ci := b.offset16(2).coverageIndex(r.glyphs[i])
+	if ci < 0 {
+		return 0, false
+	}
+	switch b.u16(0) {
+	case 1:
+		// The delta is added modulo 65536.
+		r.glyphs[i] += GlyphID(b.u16(4))
+	case 2:
+		if ci >= int(b.u16(4)) {
+			return 0, false
+		}
+		r.glyphs[i] = GlyphID(b.u16(6 + 2*ci))
+	default:
+		return 0, false
+	}
+	return i + 1, true
+}
+
+func (r *gsubRun) applyMultiple(b otData, i int) (int, bool) {
+	ci := b.offset16(2).coverageIndex(r.glyphs[i])
+	if ci < 0 || b.u16(0) != 1 || ci >= int(b.u16(4)) {
+		return 0, false
+	}
+	seq := b.offset16(6 + 2*ci)
+	n := int(seq.u16(0))
+	if len(r.glyphs)-1+n > r.maxLen {
+		return 0, false
+	}
+	replacement := make([]GlyphID, n)
+	for k := range replacement {
+		replacement[k] = GlyphID(seq.u16(2 + 2*k))
+	}
+	r.replace(i, i+1, replacement)
+	return i + n, true
+}
+
+func (r *gsubRun) applyAlternate(b otData, i int) (int, bool) {
+	ci := b.offset16(2).coverageIndex(r.glyphs[i])
+	if ci < 0 || b.u16(0) != 1 || ci >= int(b.u16(4)) {
+		return 0, false
+	}
+	set := b.offset16(6 + 2*ci)
+	if set.u16(0) == 0 {
+		return 0, false
+	}
+	r.glyphs[i] = GlyphID(set.u16(2))
+	return i + 1, true
+}
+
+// applyLigature replaces the glyph at index i and the following components of
+// the first ligature that matches with the ligature glyph. Glyphs between the
+// components that the lookup ignores, such as marks, are kept, after the
+// ligature, and record the component that they follow.
+func (r *gsubRun) applyLigature(b otData, l *lookup, i int) (int, bool) {
+	ci := b.offset16(2).coverageIndex(r.glyphs[i])
+	if ci < 0 || b.u16(0) != 1 || ci >= int(b.u16(4)) {
+		return 0, false
+	}
+	set := b.offset16(6 + 2*ci)
+	n := int(set.u16(0))
+	for k := 0; k < n; k++ {
+		lig := set.offset16(2 + 2*k)
+		nComponents := int(lig.u16(2))
+		if nComponents == 0 {
+			continue
+		}
+		matched, ok := r.matchSeq(i, nComponents, +1, l, func(k, i int) bool {
+			return k == 0 || r.glyphs[i] == GlyphID(lig.u16(4+2*(k-1)))
+		})
+		if !ok {
+			continue
+		}
+		r.glyphs[i] = GlyphID(lig.u16(0))
+		for k := 1; k < len(matched); k++ {
+			for j := matched[k-1] + 1; j < matched[k]; j++ {
+				r.components[j] = k
+			}
+		}
+		// Remove the other components, from last to first, so that the
+		// earlier indices stay valid.
+		for k := len(matched) - 1; k > 0; k-- {
+			r.replace(matched[k], matched[k]+1, nil)
+		}
+		return i + 1, true
+	}
+	return 0, false
+}
+
+// applyContext applies a context or chained context subtable at index i.
+func (r *gsubRun) applyContext(b otData, l *lookup, i int, chained bool) (int, bool) {
+	if r.depth >= maxContextDepth {
+		return 0, false
+	}
+	input, records, ok := r.matchContext(b, chained, i, l)
+	if !ok || len(input) == 0 {
+		return 0, false
+	}
+	r.depth++
+	for _, rec := range records {
+		if rec.seqIndex >= len(input) {
+			continue
+		}
+		pos := input[rec.seqIndex]
+		before := len(r.glyphs)
+		nested := r.t.lookup(rec.lookupIndex)
+		if nested.typ == gsubReverseChainedContext {
+			continue
+		}
+		if _, ok := r.apply(&nested, pos); !ok {
+			continue
+		}
+		input = adjustInput(input, rec.seqIndex, len(r.glyphs)-before)
+	}
+	r.depth--
+	return input[len(input)-1] + 1, true
+}
+
+// adjustInput updates the run indices of a context's input sequence after a
+// nested lookup at input[seqIndex] changed the run's length by delta. New
+// glyphs, from a multiple substitution, become part of the input sequence,
+// following input[seqIndex]. Removed glyphs, from a ligature substitution,
+// are removed from the input sequence.
+func adjustInput(input []int, seqIndex, delta int) []int {
+	if delta == 0 {
+		return input
+	}
+	next := seqIndex + 1
+	if delta < 0 {
+		// Only the input glyphs after seqIndex can have been removed.
+		if n := len(input) - next; -delta > n {
+			delta = -n
+		}
+		input = append(input[:next], input[next-delta:]...)
+	} else {
+		inserted := make([]int, delta)
+		for k := range inserted {
+			inserted[k] = input[seqIndex] + 1 + k
+		}
+		input = append(input[:next], append(inserted, input[next:]...)...)
+		next += delta
+	}
+	for k := next; k < len(input); k++ {
+		input[k] += delta
+	}
+	return input
+}
+
+// applyReverseChainedContext applies a reverse chained context single
+// substitution subtable at index i.
+func (r *gsubRun) applyReverseChainedContext(b otData, l *lookup, i int) (int, bool) {
+	ci := b.offset16(2).coverageIndex(r.glyphs[i])
+	if ci < 0 || b.u16(0) != 1 {
+		return 0, false
+	}
+	nBacktrack := int(b.u16(4))
+	backtrack := 6
+	nLookahead := int(b.u16(backtrack + 2*nBacktrack))
+	lookahead := backtrack + 2*nBacktrack + 2
+	substitutes := lookahead + 2*nLookahead
+	if ci >= int(b.u16(substitutes)) {
+		return 0, false
+	}
+	coverage := func(base int) func(k, i int) bool {
+		return func(k, i int) bool { return b.offset16(base+2*k).coverageIndex(r.glyphs[i]) >= 0 }
+	}
+	if _, ok := r.matchSeq(r.prev(i, l), nBacktrack, -1, l, coverage(backtrack)); !ok {
+		return 0, false
+	}
+	if _, ok := r.matchSeq(r.next(i, l), nLookahead, +1, l, coverage(lookahead)); !ok {
+		return 0, false
+	}
+	r.glyphs[i] = GlyphID(b.u16(substitutes + 2 + 2*ci))
+	return i - 1, true
+}
+
+// replace replaces the glyphs in r.glyphs[i:j] with the replacement, which
+// belong to no ligature component.
+func (r *gsubRun) replace(i, j int, replacement []GlyphID) {
+	r.glyphs = append(r.glyphs[:i], append(replacement, r.glyphs[j:]...)...)
+	r.components = append(r.components[:i], append(make([]int, len(replacement)), r.components[j:]...)...)
+}
@@ -0,0 +1,280 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testGSUB returns a font, built from testLayoutTables, whose GSUB table has
+// the given features, whose lookup indices index the lookups.
+func testGSUB(t *testing.T, features []testFeature, lookups ...[]byte) *Font {
+	t.Helper()
+	indices := make([]int, len(features))
+	for i := range indices {
+		indices[i] = i
+	}
+	m := testLayoutTables()
+	m["GSUB"] = buildLayoutTable(
+		[]testScript{{tag: "DFLT", features: indices}},
+		features,
+		lookups...,
+	)
+	f, err := Parse(buildFont(m))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return f
+}
+
+// buildLigatureSubst returns a ligature substitution subtable. Each ligature
+// is the ligature glyph followed by its components.
+func buildLigatureSubst(ligatures ...[]GlyphID) []byte {
+	// Group the ligatures into sets by their first component, in the order
+	// that the first components first appear, which must be increasing.
+	var firsts []GlyphID
+	sets := map[GlyphID][]interface{}{}
+	for _, l := range ligatures {
+		first := l[1]
+		if _, ok := sets[first]; !ok {
+			firsts = append(firsts, first)
+		}
+		lig := cat(be16(int(l[0])), be16(len(l)-1))
+		for _, c := range l[2:] {
+			lig = append(lig, be16(int(c))...)
+		}
+		sets[first] = append(sets[first], off16(lig))
+	}
+	fields := []interface{}{be16(1), off16(buildCoverage(firsts...)), be16(len(firsts))}
+	for _, first := range firsts {
+		set := append([]interface{}{be16(len(sets[first]))}, sets[first]...)
+		fields = append(fields, off16(buildTable(set...)))
+	}
+	return buildTable(fields...)
+}
+
+func TestSubstitute(t *testing.T) {
+	singleFormat1 := buildTable(be16(1), off16(buildCoverage(1, 2)), be16(10))
+	singleFormat1Wrap := buildTable(be16(1), off16(buildCoverage(3)), be16(-1))
+	singleFormat2 := buildTable(be16(2), off16(buildCoverage(3, 4)), be16(2), be16(30), be16(40))
+	multiple := buildTable(be16(1), off16(buildCoverage(1, 2)), be16(2),
+		off16(cat(be16(3), be16(4), be16(5), be16(6))), off16(be16(0)))
+	alternate := buildTable(be16(1), off16(buildCoverage(1)), be16(1),
+		off16(cat(be16(2), be16(20), be16(21))))
+	ligature := buildLigatureSubst(
+		[]GlyphID{50, 1, 2, 3},
+		[]GlyphID{51, 1, 2},
+		[]GlyphID{52, 4, 5},
+	)
+	reverse := buildTable(be16(1), off16(buildCoverage(1, 2)),
+		be16(1), off16(buildCoverage(3)),
+		be16(1), off16(buildCoverage(4)),
+		be16(2), be16(11), be16(12))
+	// The lookahead of reverseRun covers its own substitutes, so that, as
+	// reverse chained lookups apply from the end of the run, each substitution
+	// enables the one before it.
+	reverseRun := buildTable(be16(1), off16(buildCoverage(1, 2)),
+		be16(0),
+		be16(1), off16(buildCoverage(2, 4)),
+		be16(2), be16(4), be16(4))
+
+	testCases := []struct {
+		desc    string
+		lookups [][]byte
+		glyphs  []GlyphID
+		want    []GlyphID
+	}{{
+		desc:    "single format 1",
+		lookups: [][]byte{buildLookup(gsubSingle, 0, singleFormat1)},
+		glyphs:  []GlyphID{1, 2, 3},
+		want:    []GlyphID{11, 12, 3},
+	}, {
+		desc:    "single format 1 wraps around",
+		lookups: [][]byte{buildLookup(gsubSingle, 0, singleFormat1Wrap)},
+		glyphs:  []GlyphID{3},
+		want:    []GlyphID{2},
+	}, {
+		desc:    "single format 2",
+		lookups: [][]byte{buildLookup(gsubSingle, 0, singleFormat2)},
+		glyphs:  []GlyphID{4, 1, 3},
+		want:    []GlyphID{40, 1, 30},
+	}, {
+		desc:    "multiple",
+		lookups: [][]byte{buildLookup(gsubMultiple, 0, multiple)},
+		glyphs:  []GlyphID{7, 1, 2, 1},
+		want:    []GlyphID{7, 4, 5, 6, 4, 5, 6},
+	}, {
+		desc:    "alternate",
+		lookups: [][]byte{buildLookup(gsubAlternate, 0, alternate)},
+		glyphs:  []GlyphID{1, 2},
+		want:    []GlyphID{20, 2},
+	}, {
+		desc:    "ligature",
+		lookups: [][]byte{buildLookup(gsubLigature, 0, ligature)},
+		glyphs:  []GlyphID{1, 2, 3, 1, 2, 4, 5, 1},
+		want:    []GlyphID{50, 51, 52, 1},
+	}, {
+		desc:    "extension",
+		lookups: [][]byte{buildLookup(gsubExtension, 0, buildTable(be16(1), be16(gsubLigature), off32(ligature)))},
+		glyphs:  []GlyphID{4, 5},
+		want:    []GlyphID{52},
+	}, {
+		desc:    "reverse chained context",
+		lookups: [][]byte{buildLookup(gsubReverseChainedContext, 0, reverse)},
+		glyphs:  []GlyphID{3, 1, 4, 1, 4, 3, 2},
+		want:    []GlyphID{3, 11, 4, 1, 4, 3, 2},
+	}, {
+		desc:    "reverse chained context sees its own substitutions",
+		lookups: [][]byte{buildLookup(gsubReverseChainedContext, 0, reverseRun)},
+		glyphs:  []GlyphID{1, 2, 1, 2},
+		want:    []GlyphID{4, 4, 4, 2},
+	}, {
+		desc: "lookup order",
+		lookups: [][]byte{
+			buildLookup(gsubSingle, 0, singleFormat2),
+			buildLookup(gsubLigature, 0, ligature),
+		},
+		glyphs: []GlyphID{4, 5, 1, 2},
+		want:   []GlyphID{40, 5, 51},
+	}}
+
+	for _, tc := range testCases {
+		indices := make([]int, len(tc.lookups))
+		for i := range indices {
+			indices[i] = i
+		}
+		f := testGSUB(t, []testFeature{{"test", indices}}, tc.lookups...)
+		glyphs := append([]GlyphID(nil), tc.glyphs...)
+		got := f.Substitute(glyphs, testGPOSOptions)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s:\ngot  %v\nwant %v", tc.desc, got, tc.want)
+		}
+		if !reflect.DeepEqual(glyphs, tc.glyphs) {
+			t.Errorf("%s: input modified to %v", tc.desc, glyphs)
+		}
+	}
+}
+
+func TestSubstituteContext(t *testing.T) {
+	single := buildLookup(gsubSingle, 0, buildTable(be16(1), off16(buildCoverage(1, 2, 3, 4)), be16(10)))
+	multiple := buildLookup(gsubMultiple, 0, buildTable(be16(1), off16(buildCoverage(1)), be16(1),
+		off16(cat(be16(2), be16(1), be16(1)))))
+	ligature := buildLookup(gsubLigature, 0, buildLigatureSubst([]GlyphID{50, 1, 2}))
+	// context returns a chained context format 3 subtable whose input sequence
+	// is glyphs 1, 2 and 3, after glyph 4, with the sequence lookup records.
+	context := func(records ...int) []byte {
+		fields := []interface{}{be16(3),
+			be16(1), off16(buildCoverage(4)),
+			be16(3), off16(buildCoverage(1)), off16(buildCoverage(2)), off16(buildCoverage(3)),
+			be16(0),
+			be16(len(records) / 2),
+		}
+		for _, r := range records {
+			fields = append(fields, be16(r))
+		}
+		return buildLookup(gsubChainedContext, 0, buildTable(fields...))
+	}
+
+	testCases := []struct {
+		desc    string
+		records []int
+		glyphs  []GlyphID
+		want    []GlyphID
+	}{{
+		desc:    "single",
+		records: []int{2, 0, 0, 0},
+		glyphs:  []GlyphID{4, 1, 2, 3, 1, 2, 3},
+		want:    []GlyphID{4, 11, 2, 13, 1, 2, 3},
+	}, {
+		desc:    "no match without backtrack",
+		records: []int{0, 0},
+		glyphs:  []GlyphID{1, 2, 3},
+		want:    []GlyphID{1, 2, 3},
+	}, {
+		// The multiple substitution's new glyph joins the input sequence, so
+		// that sequence index 1 is then the new glyph, and index 3 is glyph 3.
+		desc:    "multiple then single",
+		records: []int{0, 1, 1, 0, 3, 0},
+		glyphs:  []GlyphID{4, 1, 2, 3},
+		want:    []GlyphID{4, 1, 11, 2, 13},
+	}, {
+		// The ligature removes glyph 2 from the input sequence, so that
+		// sequence index 1 is then glyph 3.
+		desc:    "ligature then single",
+		records: []int{0, 2, 1, 0},
+		glyphs:  []GlyphID{4, 1, 2, 3, 2},
+		want:    []GlyphID{4, 50, 13, 2},
+	}}
+
+	for _, tc := range testCases {
+		f := testGSUB(t, []testFeature{{"test", []int{3}}}, single, multiple, ligature, context(tc.records...))
+		got := f.Substitute(tc.glyphs, testGPOSOptions)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s:\ngot  %v\nwant %v", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestSubstituteEmptyContext(t *testing.T) {
+	// A context format 3 subtable with no input coverage matches nothing.
+	f := testGSUB(t, []testFeature{{"test", []int{0}}},
+		buildLookup(gsubContext, 0, buildTable(be16(3), be16(0), be16(0))))
+	want := []GlyphID{1, 2}
+	if got := f.Substitute([]GlyphID{1, 2}, testGPOSOptions); !reflect.DeepEqual(got, want) {
+		t.Errorf("Substitute: got %v, want %v", got, want)
+	}
+	if _, err := f.Shape([]GlyphID{1, 2}, testGPOSOptions); err != nil {
+		t.Errorf("Shape: %v", err)
+	}
+}
+
+func TestSubstituteFeatures(t *testing.T) {
+	f := testGSUB(t,
+		[]testFeature{{"liga", []int{0}}, {"smcp", []int{1}}, {"ss01", []int{2}}},
+		buildLookup(gsubLigature, 0, buildLigatureSubst([]GlyphID{50, 1, 2})),
+		buildLookup(gsubSingle, 0, buildTable(be16(1), off16(buildCoverage(1, 2, 3)), be16(100))),
+		buildLookup(gsubSingle, 0, buildTable(be16(2), off16(buildCoverage(3)), be16(1), be16(7))),
+	)
+	testCases := []struct {
+		features map[string]bool
+		want     []GlyphID
+	}{
+		{nil, []GlyphID{50, 3}},
+		{map[string]bool{"liga": false}, []GlyphID{1, 2, 3}},
+		{map[string]bool{"smcp": true}, []GlyphID{50, 103}},
+		{map[string]bool{"liga": false, "smcp": true}, []GlyphID{101, 102, 103}},
+		{map[string]bool{"ss01": true}, []GlyphID{50, 7}},
+		{map[string]bool{"ss01": true, "smcp": true}, []GlyphID{50, 103}},
+	}
+	for _, tc := range testCases {
+		opts := &LayoutOptions{Features: map[Tag]bool{}}
+		for tag, on := range tc.features {
+			opts.Features[MakeTag(tag)] = on
+		}
+		if got := f.Substitute([]GlyphID{1, 2, 3}, opts); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("features %v: got %v, want %v", tc.features, got, tc.want)
+		}
+	}
+
+	// A font without a GSUB table returns a copy of the glyphs.
+	f, err := Parse(buildFont(testTables()))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got, want := f.Substitute([]GlyphID{1, 2}, nil), []GlyphID{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("no GSUB: got %v, want %v", got, want)
+	}
+}
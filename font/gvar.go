@@ -0,0 +1,664 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"fmt"
+	"math"
+
+	"golang.org/x/image/math/f32"
+)
+
+const (
+	gvarLen = 20
+	// glyphVarDataLen and tupleHeaderLen are the lengths of a glyph's
+	// variation data header, and of a tuple variation header without its
+	// coordinates.
+	glyphVarDataLen = 4
+	tupleHeaderLen  = 4
+	// nPhantomPoints is the number of phantom points that follow a glyph's
+	// points, for its horizontal and vertical origins and advances.
+	nPhantomPoints = 4
+)
+
+// Flags of the gvar table, of a glyph's variation data and of its tuple
+// variation headers.
+const (
+	gvarLongOffsets        = 0x0001
+	gvarSharedPointNumbers = 0x8000
+	gvarTupleCountMask     = 0x0fff
+
+	tupleEmbeddedPeak       = 0x8000
+	tupleIntermediateRegion = 0x4000
+	tuplePrivatePoints      = 0x2000
+	tupleIndexMask          = 0x0fff
+)
+
+// Flags of packed point numbers' and deltas' control bytes.
+const (
+	pointsAreWords = 0x80
+	pointRunMask   = 0x7f
+	deltasAreZero  = 0x80
+	deltasAreWords = 0x40
+	deltasAreLong  = deltasAreZero | deltasAreWords
+	deltaRunMask   = 0x3f
+)
+
+// gvar is the glyph variations table, which has the deltas that vary the
+// points of a TrueType variable font's glyphs.
+type gvar struct {
+	nAxes int
+	// sharedTuples are peak coordinates that tuple variations may refer to
+	// by index.
+	sharedTuples  otData
+	nSharedTuples int
+	// offsets are the glyphCount+1 offsets, 16-bit halved or 32-bit, of the
+	// glyphs' variation data, relative to data.
+	offsets    []byte
+	long       bool
+	glyphCount int
+	data       []byte
+}
+
+// parseGvar parses the gvar table b.
+func parseGvar(b []byte) (*gvar, error) {
+	if len(b) < gvarLen {
+		return nil, ErrTableTooShort{Tag: MakeTag("gvar"), Length: len(b), MinLength: gvarLen}
+	}
+	if major := u16(b, 0); major != 1 {
+		return nil, ErrUnsupportedFormat{Tag: MakeTag("gvar"), Format: uint32(major)}
+	}
+	g := &gvar{
+		nAxes:         int(u16(b, 4)),
+		nSharedTuples: int(u16(b, 6)),
+		glyphCount:    int(u16(b, 12)),
+		long:          u16(b, 14)&gvarLongOffsets != 0,
+	}
+	offsetSize := 2
+	if g.long {
+		offsetSize = 4
+	}
+	if n := gvarLen + (g.glyphCount+1)*offsetSize; len(b) < n {
+		return nil, ErrTableTooShort{Tag: MakeTag("gvar"), Length: len(b), MinLength: n}
+	}
+	g.offsets = b[gvarLen : gvarLen+(g.glyphCount+1)*offsetSize]
+
+	sharedTuples := uint64(u32(b, 8))
+	if sharedTuples+uint64(2*g.nAxes*g.nSharedTuples) > uint64(len(b)) {
+		return nil, ErrInvalidTable{Tag: MakeTag("gvar"), Reason: "shared tuples are out of bounds"}
+	}
+	g.sharedTuples = b[sharedTuples:]
+	data := uint64(u32(b, 16))
+	if data > uint64(len(b)) {
+		return nil, ErrInvalidTable{Tag: MakeTag("gvar"), Reason: "glyph variation data is out of bounds"}
+	}
+	g.data = b[data:]
+	return g, nil
+}
+
+// glyphData returns the glyph's variation data, or nil if it has none.
+func (g *gvar) glyphData(glyphID GlyphID) ([]byte, error) {
+	if int(glyphID) >= g.glyphCount {
+		return nil, nil
+	}
+	var lo, hi uint32
+	if g.long {
+		lo, hi = u32(g.offsets, 4*int32(glyphID)), u32(g.offsets, 4*int32(glyphID)+4)
+	} else {
+		lo, hi = 2*uint32(u16(g.offsets, 2*int32(glyphID))), 2*uint32(u16(g.offsets, 2*int32(glyphID)+2))
+	}
+	if lo > hi || hi > uint32(len(g.data)) {
+		return nil, ErrInvalidGlyph{fmt.Sprintf("glyph ID %d has an invalid gvar range [%d, %d)", glyphID, lo, hi)}
+	}
+	if lo == hi {
+		return nil, nil
+	}
+	return g.data[lo:hi], nil
+}
+
+// deltas returns the deltas of the glyph's points at the normalized
+// coordinates, or nil if none apply. The points are the outline's points, or a
+// compound glyph's component offsets, followed by the four phantom points.
+//
+// Tuple variations with deltas for only some points infer the others' deltas
+// from those of their neighbours in the same contour, whose last points'
+// indexes are ends. orig are the points' coordinates before variation.
+func (g *gvar) deltas(glyphID GlyphID, coords []float32, orig []point, ends []int) ([]point, error) {
+	b, err := g.glyphData(glyphID)
+	if b == nil || err != nil {
+		return nil, err
+	}
+	errInvalid := ErrInvalidGlyph{fmt.Sprintf("glyph ID %d has invalid gvar data", glyphID)}
+	if len(b) < glyphVarDataLen {
+		return nil, errInvalid
+	}
+	tupleCount, dataOffset := int(u16(b, 0)), int(u16(b, 2))
+	if dataOffset < glyphVarDataLen || dataOffset > len(b) {
+		return nil, errInvalid
+	}
+	headers, data := otData(b[glyphVarDataLen:dataOffset]), b[dataOffset:]
+	nPoints := len(orig)
+
+	var sharedPoints []int
+	if tupleCount&gvarSharedPointNumbers != 0 {
+		if sharedPoints, data, err = parsePackedPoints(data); err != nil {
+			return nil, errInvalid
+		}
+	}
+
+	var deltas, tuple []point
+	var touched []bool
+	var xs, ys []float32
+	peak := make([]float32, g.nAxes)
+	for i, h := 0, 0; i < tupleCount&gvarTupleCountMask; i++ {
+		if h+tupleHeaderLen > len(headers) {
+			return nil, errInvalid
+		}
+		size, index := int(headers.u16(h)), int(headers.u16(h+2))
+		h += tupleHeaderLen
+		if index&tupleEmbeddedPeak != 0 {
+			if h+2*g.nAxes > len(headers) {
+				return nil, errInvalid
+			}
+			for a := range peak {
+				peak[a] = f2dot14(headers.i16(h + 2*a))
+			}
+			h += 2 * g.nAxes
+		} else if n := index & tupleIndexMask; n < g.nSharedTuples {
+			for a := range peak {
+				peak[a] = f2dot14(g.sharedTuples.i16(2 * (n*g.nAxes + a)))
+			}
+		} else {
+			return nil, errInvalid
+		}
+		start, end := h, h+2*g.nAxes
+		intermediate := index&tupleIntermediateRegion != 0
+		if intermediate {
+			h += 4 * g.nAxes
+		}
+		if h > len(headers) || size > len(data) {
+			return nil, errInvalid
+		}
+		tupleData := data[:size]
+		data = data[size:]
+
+		scalar := float32(1)
+		for a, p := range peak {
+			var c float32
+			if a < len(coords) {
+				c = coords[a]
+			}
+			lo, hi := float32(math.Min(0, float64(p))), float32(math.Max(0, float64(p)))
+			if intermediate {
+				lo, hi = f2dot14(headers.i16(start+2*a)), f2dot14(headers.i16(end+2*a))
+			}
+			if scalar *= axisScalar(c, lo, p, hi); scalar == 0 {
+				break
+			}
+		}
+		if scalar == 0 {
+			continue
+		}
+
+		points := sharedPoints
+		if index&tuplePrivatePoints != 0 {
+			if points, tupleData, err = parsePackedPoints(tupleData); err != nil {
+				return nil, errInvalid
+			}
+		}
+		n := len(points)
+		if points == nil {
+			n = nPoints
+		}
+		if xs, tupleData, err = parsePackedDeltas(xs[:0], tupleData, n); err != nil {
+			return nil, errInvalid
+		}
+		if ys, _, err = parsePackedDeltas(ys[:0], tupleData, n); err != nil {
+			return nil, errInvalid
+		}
+
+		if deltas == nil {
+			deltas = make([]point, nPoints)
+		}
+		if points == nil {
+			for j := range deltas {
+				deltas[j].x += scalar * xs[j]
+				deltas[j].y += scalar * ys[j]
+			}
+			continue
+		}
+		if tuple == nil {
+			tuple, touched = make([]point, nPoints), make([]bool, nPoints)
+		}
+		for j := range tuple {
+			tuple[j], touched[j] = point{}, false
+		}
+		for j, p := range points {
+			// Point numbers past the glyph's points are ignored.
+			if p < nPoints {
+				tuple[p] = point{xs[j], ys[j]}
+				touched[p] = true
+			}
+		}
+		interpolateUntouched(tuple, touched, orig, ends)
+		for j := range deltas {
+			deltas[j].x += scalar * tuple[j].x
+			deltas[j].y += scalar * tuple[j].y
+		}
+	}
+	return deltas, nil
+}
+
+// parsePackedPoints parses packed point numbers, returning them and the rest
+// of b. It returns nil point numbers for all of the glyph's points.
+func parsePackedPoints(b []byte) (points []int, rest []byte, err error) {
+	if len(b) < 1 {
+		return nil, nil, errGlyphTruncated
+	}
+	n := int(b[0])
+	b = b[1:]
+	if n == 0 {
+		return nil, b, nil
+	}
+	if n&pointsAreWords != 0 {
+		if len(b) < 1 {
+			return nil, nil, errGlyphTruncated
+		}
+		n = (n&pointRunMask)<<8 | int(b[0])
+		b = b[1:]
+	}
+	// The point numbers are runs of deltas from the previous point number.
+	points = make([]int, 0, n)
+	p := 0
+	for len(points) < n {
+		if len(b) < 1 {
+			return nil, nil, errGlyphTruncated
+		}
+		control := b[0]
+		run, size := int(control&pointRunMask)+1, 1
+		if control&pointsAreWords != 0 {
+			size = 2
+		}
+		b = b[1:]
+		if len(points)+run > n || len(b) < run*size {
+			return nil, nil, errGlyphTruncated
+		}
+		for i := 0; i < run; i++ {
+			if size == 2 {
+				p += int(u16(b, int32(2*i)))
+			} else {
+				p += int(b[i])
+			}
+			points = append(points, p)
+		}
+		b = b[run*size:]
+	}
+	return points, b, nil
+}
+
+// parsePackedDeltas appends n packed deltas to dst, returning them and the
+// rest of b.
+func parsePackedDeltas(dst []float32, b []byte, n int) (deltas []float32, rest []byte, err error) {
+	for i := 0; i < n; {
+		if len(b) < 1 {
+			return nil, nil, errGlyphTruncated
+		}
+		control := b[0]
+		b = b[1:]
+		run, size := int(control&deltaRunMask)+1, 1
+		switch control & deltasAreLong {
+		case deltasAreZero:
+			size = 0
+		case deltasAreWords:
+			size = 2
+		case deltasAreLong:
+			size = 4
+		}
+		if i+run > n || len(b) < run*size {
+			return nil, nil, errGlyphTruncated
+		}
+		for j := 0; j < run; j++ {
+			var d int32
+			switch size {
+			case 1:
+				d = int32(int8(b[j]))
+			case 2:
+				d = int32(i16(b, int32(2*j)))
+			case 4:
+				d = int32(u32(b, int32(4*j)))
+			}
+			dst = append(dst, float32(d))
+		}
+		b = b[run*size:]
+		i += run
+	}
+	return dst, b, nil
+}
+
+// interpolateUntouched infers the deltas of the points that a tuple variation
+// has no deltas for, which is called IUP. In each contour, an untouched
+// point's delta is interpolated from those of the nearest touched points
+// before and after it, separately for x and y. Points outside the contours,
+// such as phantom points, are left untouched.
+func interpolateUntouched(deltas []point, touched []bool, orig []point, ends []int) {
+	start := 0
+	for _, end := range ends {
+		if end >= len(deltas) {
+			break
+		}
+		// Find the first touched point, and then interpolate the untouched
+		// points between each pair of touched points, wrapping around.
+		first := -1
+		for i := start; i <= end; i++ {
+			if touched[i] {
+				first = i
+				break
+			}
+		}
+		if first >= 0 {
+			prev := first
+			for k := 1; k <= end-start+1; k++ {
+				i := start + (first-start+k)%(end-start+1)
+				if !touched[i] {
+					continue
+				}
+				for j := prev + 1; ; j++ {
+					if j > end {
+						j = start
+					}
+					if j == i {
+						break
+					}
+					deltas[j].x = iup(orig[j].x, orig[prev].x, orig[i].x, deltas[prev].x, deltas[i].x)
+					deltas[j].y = iup(orig[j].y, orig[prev].y, orig[i].y, deltas[prev].y, deltas[i].y)
+				}
+				prev = i
+			}
+		}
+		start = end + 1
+	}
+}
+
+// iup returns the delta of a coordinate c, interpolated from those of the
+// reference coordinates a and b, whose deltas are da and db.
+func iup(c, a, b, da, db float32) float32 {
+	if a == b {
+		if da == db {
+			return da
+		}
+		return 0
+	}
+	if a > b {
+		a, b, da, db = b, a, db, da
+	}
+	switch {
+	case c <= a:
+		return da
+	case c >= b:
+		return db
+	}
+	return da + (c-a)*(db-da)/(b-a)
+}
+
+// varyGlyph returns the glyph b, with the gvar deltas at f's coordinates
+// applied to its points, and its phantom points. The varied glyph's points
+// are rounded to integers, and it has no hinting instructions.
+//
+// The phantom points are the glyph's horizontal origin and advance, and its
+// vertical origin and advance. A varied compound glyph's bounding box depends
+// on its varied sub-glyphs, and the glyph is a sub-glyph of the compound
+// glyphs whose IDs are path, if any. w counts the sub-glyphs visited so far.
+func (f *Font) varyGlyph(glyphID GlyphID, b Glyph, path []GlyphID, w *compoundWalk) (Glyph, [nPhantomPoints]point, error) {
+	var phantom [nPhantomPoints]point
+	var orig []point
+	var ends []int
+	var on []bool
+	var components []int
+	xMin, yMin, xMax, yMax := b.bounds()
+
+	g := b.glyphIter()
+	if g.err != nil {
+		return nil, phantom, g.err
+	}
+	if g.compoundGlyph() {
+		// A compound glyph's points are its components' offsets.
+		var err error
+		if components, err = b.componentOffsets(); err != nil {
+			return nil, phantom, err
+		}
+		for i := 0; i < len(components); i += 2 {
+			orig = append(orig, point{float32(components[i]), float32(components[i+1])})
+		}
+	} else {
+		for g.nextContour() {
+			for g.nextPoint() {
+				orig = append(orig, point{float32(g.x), float32(g.y)})
+				on = append(on, g.on)
+			}
+			ends = append(ends, len(orig)-1)
+		}
+	}
+
+	// validate checked that the hmtx table is long enough for every glyph ID
+	// less than numGlyphs.
+	h := f.hmtx.hMetrics(glyphID, f.hhea.numberOfHMetrics())
+	phantom[0] = point{float32(xMin - h.LeftSideBearing), 0}
+	phantom[1] = point{phantom[0].x + float32(h.AdvanceWidth), 0}
+	if f.vhea != nil {
+		v := f.vmtx.vMetrics(glyphID, f.vhea.numOfLongVerMetrics())
+		phantom[2] = point{0, float32(yMax + v.TopSideBearing)}
+		phantom[3] = point{0, phantom[2].y - float32(v.AdvanceHeight)}
+	}
+	orig = append(orig, phantom[:]...)
+
+	deltas, err := f.gvar.deltas(glyphID, f.coords, orig, ends)
+	if err != nil || deltas == nil {
+		return b, phantom, err
+	}
+	n := len(orig) - nPhantomPoints
+	for i := range phantom {
+		phantom[i].x += deltas[n+i].x
+		phantom[i].y += deltas[n+i].y
+	}
+	if b == nil {
+		return nil, phantom, nil
+	}
+
+	pts := make([][2]int16, n)
+	for i := range pts {
+		pts[i] = [2]int16{roundInt16(orig[i].x + deltas[i].x), roundInt16(orig[i].y + deltas[i].y)}
+	}
+	if components != nil {
+		path = append(path[:len(path):len(path)], glyphID)
+		vb, err := f.encodeCompoundGlyph(b, xMin, yMin, xMax, yMax, pts, path, w)
+		return vb, phantom, err
+	}
+	return encodeSimpleGlyph(ends, pts, on), phantom, nil
+}
+
+func roundInt16(x float32) int16 {
+	return int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, math.Round(float64(x)))))
+}
+
+// encodeSimpleGlyph returns the glyf data of a simple glyph, with no hinting
+// instructions and each coordinate as a 16-bit delta.
+func encodeSimpleGlyph(ends []int, pts [][2]int16, on []bool) Glyph {
+	n := len(pts)
+	b := make(Glyph, initialIndex+2*len(ends)+2+n+4*n)
+	var xMin, yMin, xMax, yMax int16
+	for i, p := range pts {
+		if i == 0 || p[0] < xMin {
+			xMin = p[0]
+		}
+		if i == 0 || p[1] < yMin {
+			yMin = p[1]
+		}
+		if i == 0 || p[0] > xMax {
+			xMax = p[0]
+		}
+		if i == 0 || p[1] > yMax {
+			yMax = p[1]
+		}
+	}
+	put16(b, 0, uint16(len(ends)))
+	put16(b, 2, uint16(xMin))
+	put16(b, 4, uint16(yMin))
+	put16(b, 6, uint16(xMax))
+	put16(b, 8, uint16(yMax))
+	i := initialIndex
+	for _, e := range ends {
+		put16(b, i, uint16(e))
+		i += 2
+	}
+	// The instruction length, at b[i:i+2], is zero.
+	flags, xs := i+2, i+2+n
+	ys := xs + 2*n
+	var prev [2]int16
+	for j, p := range pts {
+		if on[j] {
+			b[flags+j] = flagOnCurve
+		}
+		put16(b, xs+2*j, uint16(p[0]-prev[0]))
+		put16(b, ys+2*j, uint16(p[1]-prev[1]))
+		prev = p
+	}
+	return b
+}
+
+// encodeCompoundGlyph returns the compound glyph b, with its components'
+// offsets replaced by offsets, as 16-bit arguments, and without hinting
+// instructions. Its bounding box is that of its varied outline. The glyph IDs
+// of b and the compound glyphs that it is a sub-glyph of are path, and w
+// counts the sub-glyphs visited so far.
+func (f *Font) encodeCompoundGlyph(b Glyph, xMin, yMin, xMax, yMax int, offsets [][2]int16, path []GlyphID, w *compoundWalk) (Glyph, error) {
+	v := append(Glyph(nil), b[:initialIndex]...)
+	for c, i := 0, int32(initialIndex); ; c++ {
+		flags := u16(b, i)
+		n := int32(2)
+		if flags&flagArg1And2AreWords != 0 {
+			n = 4
+		}
+		transform := i + 4 + n
+		end := transform + int32(transformLen(flags))
+		last := flags&flagMoreComponents == 0
+		if last {
+			flags &^= flagWeHaveInstructions
+		}
+		// Point matching components keep their arguments, which are point
+		// numbers rather than offsets.
+		args := b[i+4 : transform]
+		if flags&flagArgsAreXYValues != 0 {
+			flags |= flagArg1And2AreWords
+			args = []byte{
+				byte(offsets[c][0] >> 8), byte(offsets[c][0]),
+				byte(offsets[c][1] >> 8), byte(offsets[c][1]),
+			}
+		}
+		v = append(v, byte(flags>>8), byte(flags), b[i+2], b[i+3])
+		v = append(v, args...)
+		v = append(v, b[transform:end]...)
+		if last {
+			break
+		}
+		i = end
+	}
+
+	// The bounding box is that of the varied outline's points.
+	var bp boundsPather
+	if err := f.outline(&bp, v, f32.Aff3{1, 0, 0, 0, 1, 0}, path, w); err != nil {
+		return nil, err
+	}
+	if bp.valid {
+		xMin, yMin = int(math.Floor(float64(bp.min.x))), int(math.Floor(float64(bp.min.y)))
+		xMax, yMax = int(math.Ceil(float64(bp.max.x))), int(math.Ceil(float64(bp.max.y)))
+	}
+	for j, x := range [4]int{xMin, yMin, xMax, yMax} {
+		put16(v, 2+2*j, uint16(roundInt16(float32(x))))
+	}
+	return v, nil
+}
+
+// transformLen returns the length of a component's scale or matrix.
+func transformLen(flags uint16) int {
+	switch {
+	case flags&flagWeHaveAScale != 0:
+		return 2
+	case flags&flagWeHaveAnXAndYScale != 0:
+		return 4
+	case flags&flagWeHaveATwoByTwo != 0:
+		return 8
+	}
+	return 0
+}
+
+// componentOffsets returns the x and y arguments of each of the compound
+// glyph's components, which are offsets or, for point matching components,
+// point numbers. It checks that the component records are in bounds.
+func (b Glyph) componentOffsets() ([]int, error) {
+	var args []int
+	for i := int32(initialIndex); ; {
+		if int(i+4) > len(b) {
+			return nil, errGlyphTruncated
+		}
+		flags := u16(b, i)
+		n := int32(2)
+		if flags&flagArg1And2AreWords != 0 {
+			n = 4
+		}
+		end := i + 4 + n + int32(transformLen(flags))
+		if int(end) > len(b) {
+			return nil, errGlyphTruncated
+		}
+		switch {
+		case flags&flagArgsAreXYValues == 0:
+			args = append(args, 0, 0)
+		case n == 4:
+			args = append(args, int(i16(b, i+4)), int(i16(b, i+6)))
+		default:
+			args = append(args, int(int8(b[i+4])), int(int8(b[i+5])))
+		}
+		if flags&flagMoreComponents == 0 {
+			return args, nil
+		}
+		i = end
+	}
+}
+
+func put16(b []byte, i int, v uint16) {
+	b[i], b[i+1] = byte(v>>8), byte(v)
+}
+
+// boundsPather is a Pather that records the bounding box of the points it is
+// sent, including off-curve points.
+type boundsPather struct {
+	min, max point
+	valid    bool
+}
+
+func (p *boundsPather) add(v ...f32.Vec2) {
+	for _, q := range v {
+		if !p.valid {
+			p.min, p.max, p.valid = point{q[0], q[1]}, point{q[0], q[1]}, true
+			continue
+		}
+		p.min.x, p.min.y = float32(math.Min(float64(p.min.x), float64(q[0]))), float32(math.Min(float64(p.min.y), float64(q[1])))
+		p.max.x, p.max.y = float32(math.Max(float64(p.max.x), float64(q[0]))), float32(math.Max(float64(p.max.y), float64(q[1])))
+	}
+}
+
+func (p *boundsPather) MoveTo(q f32.Vec2)       { p.add(q) }
+func (p *boundsPather) LineTo(q f32.Vec2)       { p.add(q) }
+func (p *boundsPather) QuadTo(q, r f32.Vec2)    { p.add(q, r) }
+func (p *boundsPather) CubeTo(q, r, s f32.Vec2) { p.add(q, r, s) }
@@ -0,0 +1,452 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testTuple is a tuple variation of a glyph.
+type testTuple struct {
+	// peak is the tuple's embedded peak, or nil for the shared tuple at
+	// sharedIndex.
+	peak        []float32
+	sharedIndex int
+	// start and end are the tuple's intermediate region, if not nil.
+	start, end []float32
+	// points are the tuple's private point numbers. Nil points use the
+	// glyph's shared point numbers, if any, or else all points.
+	points []int
+	dx, dy []int
+}
+
+// testGlyphVar is a glyph's variation data.
+type testGlyphVar struct {
+	sharedPoints []int
+	tuples       []testTuple
+}
+
+// buildPackedPoints returns packed point numbers, in runs of bytes or words.
+func buildPackedPoints(points []int) []byte {
+	var b []byte
+	if n := len(points); n < 0x80 {
+		b = []byte{byte(n)}
+	} else {
+		b = be16(n | pointsAreWords<<8)
+	}
+	// Each run has up to 128 deltas from the previous point number.
+	for i, prev := 0, 0; i < len(points); {
+		j, words := i, false
+		for p := prev; j < len(points) && j-i <= pointRunMask; j++ {
+			words = words || points[j]-p > 0xff
+			p = points[j]
+		}
+		control := byte(j - i - 1)
+		if words {
+			control |= pointsAreWords
+		}
+		b = append(b, control)
+		for ; i < j; i++ {
+			if words {
+				b = append(b, be16(points[i]-prev)...)
+			} else {
+				b = append(b, byte(points[i]-prev))
+			}
+			prev = points[i]
+		}
+	}
+	return b
+}
+
+// buildPackedDeltas returns packed deltas, with one run for each delta.
+func buildPackedDeltas(deltas []int) []byte {
+	var b []byte
+	for _, d := range deltas {
+		switch {
+		case d == 0:
+			b = append(b, deltasAreZero)
+		case -0x80 <= d && d < 0x80:
+			b = append(b, 0, byte(int8(d)))
+		case -0x8000 <= d && d < 0x8000:
+			b = append(b, deltasAreWords)
+			b = append(b, be16(d)...)
+		default:
+			b = append(b, deltasAreLong)
+			b = append(b, be32(d)...)
+		}
+	}
+	return b
+}
+
+// buildGvar returns a gvar table with the given shared tuples and variation
+// data for each glyph.
+func buildGvar(nAxes int, sharedTuples [][]float32, glyphs ...testGlyphVar) []byte {
+	var shared []byte
+	for _, tuple := range sharedTuples {
+		for _, c := range tuple {
+			shared = append(shared, beF2Dot14(c)...)
+		}
+	}
+	var offsets, data []byte
+	for _, g := range glyphs {
+		offsets = append(offsets, be32(len(data))...)
+		if g.tuples == nil {
+			continue
+		}
+		var headers, serialized []byte
+		tupleCount := len(g.tuples)
+		if g.sharedPoints != nil {
+			tupleCount |= gvarSharedPointNumbers
+			serialized = buildPackedPoints(g.sharedPoints)
+		}
+		for _, tuple := range g.tuples {
+			var d []byte
+			index := tuple.sharedIndex
+			if tuple.points != nil {
+				index |= tuplePrivatePoints
+				d = buildPackedPoints(tuple.points)
+			}
+			d = append(d, cat(buildPackedDeltas(tuple.dx), buildPackedDeltas(tuple.dy))...)
+			serialized = append(serialized, d...)
+
+			var coords []byte
+			if tuple.peak != nil {
+				index |= tupleEmbeddedPeak
+				for _, c := range tuple.peak {
+					coords = append(coords, beF2Dot14(c)...)
+				}
+			}
+			if tuple.start != nil {
+				index |= tupleIntermediateRegion
+				for _, c := range append(tuple.start, tuple.end...) {
+					coords = append(coords, beF2Dot14(c)...)
+				}
+			}
+			headers = append(headers, cat(be16(len(d)), be16(index), coords)...)
+		}
+		data = append(data, cat(be16(tupleCount), be16(glyphVarDataLen+len(headers)), headers, serialized)...)
+	}
+	offsets = append(offsets, be32(len(data))...)
+
+	sharedOffset := gvarLen + len(offsets)
+	return cat(be16(1), be16(0), be16(nAxes), be16(len(sharedTuples)), be32(sharedOffset),
+		be16(len(glyphs)), be16(gvarLongOffsets), be32(sharedOffset+len(shared)),
+		offsets, shared, data)
+}
+
+// testGvarTables returns the tables of a variable font with the glyphs of
+// testTables and a compound glyph of the square, whose gvar variations are:
+//
+//   - At wght 900, the square is 100 units wider, and its advance width is
+//     100 more.
+//   - At wght 100, the diamond's top and sides are 100 and 50 units higher.
+//     Only its first and third points have deltas, and the other points'
+//     deltas are inferred.
+//   - Between wght 400 and 900, with a peak at 650, the diamond moves 40
+//     units right.
+//   - At wght 900, the space's advance width is 50 more.
+//   - At wght 900, the compound glyph's component moves by (10, 20).
+func testGvarTables() map[string][]byte {
+	tables := buildTables(
+		[][]byte{
+			nil,
+			buildSimpleGlyph(testSquare),
+			buildSimpleGlyph(testDiamond),
+			nil,
+			buildCompoundGlyph(100, 0, 500, 400, testComponent{1, 0, 0}),
+		},
+		[]int{500, 600, 700, 700, 600},
+		map[rune]GlyphID{'a': 1, 'b': 2, ' ': 3, 'c': 4},
+	)
+	tables["gvar"] = buildGvar(1, [][]float32{{-1}},
+		testGlyphVar{},
+		testGlyphVar{tuples: []testTuple{{
+			peak: []float32{1},
+			dx:   []int{0, 0, 100, 100, 0, 100, 0, 0},
+			dy:   []int{0, 0, 0, 0, 0, 0, 0, 0},
+		}}},
+		testGlyphVar{tuples: []testTuple{{
+			sharedIndex: 0,
+			points:      []int{0, 2},
+			dx:          []int{0, 0},
+			dy:          []int{0, 100},
+		}, {
+			peak:  []float32{0.5},
+			start: []float32{0},
+			end:   []float32{1},
+			dx:    []int{40, 40, 40, 40, 0, 0, 0, 0},
+			dy:    []int{0, 0, 0, 0, 0, 0, 0, 0},
+		}}},
+		testGlyphVar{sharedPoints: []int{1}, tuples: []testTuple{{
+			peak: []float32{1},
+			dx:   []int{50},
+			dy:   []int{0},
+		}}},
+		testGlyphVar{tuples: []testTuple{{
+			peak:   []float32{1},
+			points: []int{0},
+			dx:     []int{10},
+			dy:     []int{20},
+		}}},
+	)
+	return tables
+}
+
+// testShortGvarTables returns testGvarTables, except that the square's glyph
+// variation data offset is within its header.
+func testShortGvarTables() map[string][]byte {
+	tables := testGvarTables()
+	b := otData(tables["gvar"])
+	copy(b[b.u32(16)+b.u32(gvarLen+4)+2:], be16(2))
+	return tables
+}
+
+func TestGvarOutline(t *testing.T) {
+	f := testVariableFont(t, testGvarTables())
+	testCases := []struct {
+		wght    float32
+		glyphID GlyphID
+		want    string
+	}{
+		{400, 1, "M 100 0, L 100 400, L 500 400, L 500 0, L 100 0"},
+		{900, 1, "M 100 0, L 100 400, L 600 400, L 600 0, L 100 0"},
+		{650, 1, "M 100 0, L 100 400, L 550 400, L 550 0, L 100 0"},
+		{400, 2, "M 300 0, Q 100 200 300 400, Q 500 200 300 0"},
+		{100, 2, "M 300 0, Q 100 250 300 500, Q 500 250 300 0"},
+		{250, 2, "M 300 0, Q 100 225 300 450, Q 500 225 300 0"},
+		{650, 2, "M 340 0, Q 140 200 340 400, Q 540 200 340 0"},
+		{775, 2, "M 320 0, Q 120 200 320 400, Q 520 200 320 0"},
+		{900, 2, "M 300 0, Q 100 200 300 400, Q 500 200 300 0"},
+		{900, 3, ""},
+		{400, 4, "M 100 0, L 100 400, L 500 400, L 500 0, L 100 0"},
+		{900, 4, "M 110 20, L 110 420, L 610 420, L 610 20, L 110 20"},
+	}
+	for _, tc := range testCases {
+		f.SetVariation(map[Tag]float32{MakeTag("wght"): tc.wght})
+		g, err := f.Glyph(tc.glyphID)
+		if err != nil {
+			t.Errorf("wght=%v, glyphID=%d: Glyph: %v", tc.wght, tc.glyphID, err)
+			continue
+		}
+		var r recorder
+		if err := f.Outline(&r, g, identity); err != nil {
+			t.Errorf("wght=%v, glyphID=%d: Outline: %v", tc.wght, tc.glyphID, err)
+			continue
+		}
+		if got := strings.Join(r, ", "); got != tc.want {
+			t.Errorf("wght=%v, glyphID=%d:\ngot  %q\nwant %q", tc.wght, tc.glyphID, got, tc.want)
+		}
+	}
+}
+
+func TestGvarBounds(t *testing.T) {
+	f := testVariableFont(t, testGvarTables())
+	f.SetVariation(map[Tag]float32{MakeTag("wght"): 900})
+	testCases := []struct {
+		glyphID GlyphID
+		want    [4]int
+	}{
+		{1, [4]int{100, 0, 600, 400}},
+		{4, [4]int{110, 20, 610, 420}},
+	}
+	for _, tc := range testCases {
+		g, err := f.Glyph(tc.glyphID)
+		if err != nil {
+			t.Errorf("glyphID=%d: Glyph: %v", tc.glyphID, err)
+			continue
+		}
+		xMin, yMin, xMax, yMax := g.bounds()
+		if got := [4]int{xMin, yMin, xMax, yMax}; got != tc.want {
+			t.Errorf("glyphID=%d: got %v, want %v", tc.glyphID, got, tc.want)
+		}
+	}
+}
+
+func TestGvarHMetrics(t *testing.T) {
+	f := testVariableFont(t, testGvarTables())
+	testCases := []struct {
+		wght    float32
+		glyphID GlyphID
+		want    HMetrics
+	}{
+		{400, 1, HMetrics{600, 100}},
+		{900, 1, HMetrics{700, 100}},
+		{650, 1, HMetrics{650, 100}},
+		{650, 2, HMetrics{700, 140}},
+		{900, 3, HMetrics{750, 0}},
+		{650, 3, HMetrics{725, 0}},
+		{900, 4, HMetrics{600, 110}},
+	}
+	for _, tc := range testCases {
+		f.SetVariation(map[Tag]float32{MakeTag("wght"): tc.wght})
+		got, err := f.HMetrics(tc.glyphID)
+		if err != nil {
+			t.Errorf("wght=%v, glyphID=%d: HMetrics: %v", tc.wght, tc.glyphID, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("wght=%v, glyphID=%d: got %v, want %v", tc.wght, tc.glyphID, got, tc.want)
+		}
+	}
+}
+
+func TestParsePackedPoints(t *testing.T) {
+	many := make([]int, 200)
+	for i := range many {
+		many[i] = 3 * i
+	}
+	testCases := []struct {
+		b    []byte
+		want []int
+	}{
+		{[]byte{0}, nil},
+		{[]byte{3, 2, 1, 2, 3}, []int{1, 3, 6}},
+		{[]byte{2, 0x81, 0x01, 0x00, 0x00, 0x02}, []int{256, 258}},
+		{[]byte{3, 0, 5, 0x81, 0x01, 0x00, 0x00, 0x01}, []int{5, 261, 262}},
+		{buildPackedPoints(many), many},
+	}
+	for _, tc := range testCases {
+		got, rest, err := parsePackedPoints(append(tc.b, 0xff))
+		if err != nil {
+			t.Errorf("%x: %v", tc.b, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) || len(rest) != 1 {
+			t.Errorf("%x: got %v, %x, want %v, ff", tc.b, got, rest, tc.want)
+		}
+	}
+
+	for _, b := range [][]byte{
+		{},
+		{0x80},
+		{3, 2, 1, 2},
+		{2, 2, 1, 2, 3},
+		{1, 0x80, 0x01},
+	} {
+		if _, _, err := parsePackedPoints(b); err == nil {
+			t.Errorf("%x: got nil error", b)
+		}
+	}
+}
+
+func TestParsePackedDeltas(t *testing.T) {
+	b := []byte{
+		0x01, 0x05, 0xfb,
+		0x82,
+		0x41, 0x01, 0x00, 0xff, 0x00,
+		0xc0, 0x00, 0x01, 0x00, 0x00,
+		0xff,
+	}
+	want := []float32{5, -5, 0, 0, 0, 256, -256, 65536}
+	got, rest, err := parsePackedDeltas(nil, b, len(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) || len(rest) != 1 {
+		t.Errorf("got %v, %x, want %v, ff", got, rest, want)
+	}
+
+	for _, n := range []int{len(want) + 1, 1} {
+		if _, _, err := parsePackedDeltas(nil, b[:len(b)-1], n); err == nil {
+			t.Errorf("n=%d: got nil error", n)
+		}
+	}
+}
+
+func TestIUP(t *testing.T) {
+	// A contour of five points, of which only the second and fourth are
+	// touched, and a contour with no touched points.
+	orig := []point{{0, 0}, {100, 0}, {200, 100}, {300, 200}, {400, 50}, {0, 0}, {10, 10}}
+	deltas := []point{{}, {10, -10}, {}, {30, 10}, {}, {}, {}}
+	touched := []bool{false, true, false, true, false, false, false}
+	interpolateUntouched(deltas, touched, orig, []int{4, 6})
+	want := []point{
+		// Outside of the touched points' range, the delta is the nearest
+		// touched point's. Within it, the delta is interpolated.
+		{10, -10},
+		{10, -10},
+		{20, 0},
+		{30, 10},
+		{30, -5},
+		{}, {},
+	}
+	if !reflect.DeepEqual(deltas, want) {
+		t.Errorf("got %v, want %v", deltas, want)
+	}
+}
+
+func TestGvarErrors(t *testing.T) {
+	f := testVariableFont(t, testShortGvarTables())
+	f.SetVariation(map[Tag]float32{MakeTag("wght"): 900})
+	if _, err := f.Glyph(1); !errors.Is(err, ErrInvalidFont) {
+		t.Errorf("short data offset: Glyph: got %v, want an ErrInvalidFont", err)
+	}
+
+	valid := buildGvar(1, nil, testGlyphVar{}, testGlyphVar{tuples: []testTuple{{
+		peak: []float32{1},
+		dx:   []int{0, 0, 100, 100, 0, 100, 0, 0},
+		dy:   []int{0, 0, 0, 0, 0, 0, 0, 0},
+	}}})
+	glyphData := gvarLen + 3*4
+
+	testCases := []struct {
+		desc string
+		b    []byte
+	}{
+		{"shared tuple index", cat(valid[:glyphData+6], be16(0), valid[glyphData+8:])},
+		{"truncated deltas", buildGvar(1, nil, testGlyphVar{}, testGlyphVar{tuples: []testTuple{{
+			peak: []float32{1},
+			dx:   []int{0, 0, 100, 100, 0, 100, 0, 0},
+			dy:   []int{0},
+		}}})},
+		{"data offset", cat(valid[:glyphData+2], be16(0xff), valid[glyphData+4:])},
+		{"short data offset", cat(valid[:glyphData+2], be16(2), valid[glyphData+4:])},
+		{"tuple count", cat(valid[:glyphData], be16(2), valid[glyphData+2:])},
+		{"tuple size", cat(valid[:glyphData+4], be16(0xff), valid[glyphData+6:])},
+		{"glyph range", cat(valid[:gvarLen+8], be32(0xff), valid[gvarLen+12:])},
+	}
+	for _, tc := range testCases {
+		tables := testTables()
+		tables["gvar"] = tc.b
+		f := testVariableFont(t, tables)
+		f.SetVariation(map[Tag]float32{MakeTag("wght"): 900})
+		if _, err := f.Glyph(1); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: Glyph: got %v, want an ErrInvalidFont", tc.desc, err)
+		}
+		if _, err := f.HMetrics(1); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: HMetrics: got %v, want an ErrInvalidFont", tc.desc, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		desc string
+		b    []byte
+	}{
+		{"short", valid[:gvarLen-1]},
+		{"version", cat(be16(2), valid[2:])},
+		{"truncated offsets", valid[:gvarLen+11]},
+		{"shared tuples", cat(valid[:8], be32(len(valid)+1), valid[12:])},
+		{"data", cat(valid[:16], be32(len(valid)+1), valid[20:])},
+	} {
+		tables := testTables()
+		tables["gvar"] = tc.b
+		if _, err := Parse(buildFont(tables)); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: Parse: got %v, want an ErrInvalidFont", tc.desc, err)
+		}
+	}
+}
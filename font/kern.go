@@ -0,0 +1,213 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"fmt"
+)
+
+// Coverage bits of kern subtables. The Microsoft version of the table has the
+// format in the high byte and the flags in the low byte, and the Apple version
+// has them the other way around.
+const (
+	kernMicrosoftHorizontal  = 0x0001
+	kernMicrosoftMinimum     = 0x0002
+	kernMicrosoftCrossStream = 0x0004
+	kernMicrosoftOverride    = 0x0008
+
+	kernAppleVertical    = 0x8000
+	kernAppleCrossStream = 0x4000
+	kernAppleVariation   = 0x2000
+)
+
+// kern holds the subtables of the kern table that adjust the horizontal
+// spacing of glyph pairs, in the order they apply.
+type kern []kernSubtable
+
+// kernSubtable is a format 0 or format 2 kern subtable.
+type kernSubtable struct {
+	format int
+	// override is whether the subtable's values replace, rather than add to,
+	// the values from previous subtables.
+	override bool
+	// data is the subtable, starting with its header. Format 2 offsets are
+	// relative to its start.
+	data []byte
+	// headerLen is the length of the header, which differs between the
+	// Microsoft and Apple versions of the table.
+	headerLen int32
+}
+
+// parseKern parses the kern table b, in either its Microsoft or Apple version.
+// Subtables for vertical or cross-stream kerning, and those in unsupported
+// formats, are ignored.
+func parseKern(b []byte) (kern, error) {
+	if len(b) < 4 {
+		return nil, ErrTableTooShort{Tag: MakeTag("kern"), Length: len(b), MinLength: 4}
+	}
+	apple := u16(b, 0) == 1
+	n, offset, headerLen := uint32(u16(b, 2)), uint32(4), int32(6)
+	if apple {
+		if len(b) < 8 {
+			return nil, ErrTableTooShort{Tag: MakeTag("kern"), Length: len(b), MinLength: 8}
+		}
+		if v := u32(b, 0); v != 0x00010000 {
+			return nil, ErrUnsupportedFormat{Tag: MakeTag("kern"), Format: v}
+		}
+		n, offset, headerLen = u32(b, 4), 8, 8
+	} else if v := u16(b, 0); v != 0 {
+		return nil, ErrUnsupportedFormat{Tag: MakeTag("kern"), Format: uint32(v)}
+	}
+
+	var k kern
+	for i := uint32(0); i < n; i++ {
+		if uint64(offset)+uint64(headerLen) > uint64(len(b)) {
+			return nil, ErrInvalidTable{Tag: MakeTag("kern"), Reason: fmt.Sprintf("subtable %d is out of bounds", i)}
+		}
+		s := kernSubtable{headerLen: headerLen}
+		length, use := uint32(0), false
+		if apple {
+			length = u32(b, int32(offset))
+			coverage := u16(b, int32(offset)+4)
+			s.format = int(coverage & 0xff)
+			use = coverage&(kernAppleVertical|kernAppleCrossStream|kernAppleVariation) == 0
+		} else {
+			length = uint32(u16(b, int32(offset)+2))
+			coverage := u16(b, int32(offset)+4)
+			s.format = int(coverage >> 8)
+			s.override = coverage&kernMicrosoftOverride != 0
+			use = coverage&(kernMicrosoftHorizontal|kernMicrosoftMinimum|kernMicrosoftCrossStream) == kernMicrosoftHorizontal
+			if s.format == 0 && i == n-1 {
+				// The 16-bit length of a large format 0 subtable overflows,
+				// so that many fonts get it wrong. Let the last subtable,
+				// typically the only one, extend to the end of the table.
+				length = uint32(len(b)) - offset
+			}
+		}
+		if length < uint32(headerLen) || uint64(offset)+uint64(length) > uint64(len(b)) {
+			return nil, ErrInvalidTable{Tag: MakeTag("kern"), Reason: fmt.Sprintf("subtable %d has an invalid length %d", i, length)}
+		}
+		s.data = b[offset : offset+length]
+		offset += length
+
+		if !use {
+			continue
+		}
+		switch s.format {
+		case 0:
+			if len(s.data) < int(headerLen)+8 {
+				return nil, ErrInvalidTable{Tag: MakeTag("kern"), Reason: fmt.Sprintf("subtable %d is truncated", i)}
+			}
+			if nPairs := int(u16(s.data, headerLen)); len(s.data) < int(headerLen)+8+6*nPairs {
+				return nil, ErrInvalidTable{Tag: MakeTag("kern"), Reason: fmt.Sprintf("subtable %d has %d pairs, more than fit", i, nPairs)}
+			}
+		case 2:
+			if len(s.data) < int(headerLen)+8 {
+				return nil, ErrInvalidTable{Tag: MakeTag("kern"), Reason: fmt.Sprintf("subtable %d is truncated", i)}
+			}
+		default:
+			continue
+		}
+		k = append(k, s)
+	}
+	return k, nil
+}
+
+// kern returns the kerning adjustment, in font units, for the glyph pair.
+func (k kern) kern(left, right GlyphID) int {
+	v := 0
+	for _, s := range k {
+		x, ok := 0, false
+		switch s.format {
+		case 0:
+			x, ok = s.kern0(left, right)
+		case 2:
+			x, ok = s.kern2(left, right)
+		}
+		if !ok {
+			continue
+		}
+		if s.override {
+			v = x
+		} else {
+			v += x
+		}
+	}
+	return v
+}
+
+// kern0 looks up the pair in a format 0 subtable's sorted list of pairs.
+// parseKern checked that the list is within the subtable.
+func (s kernSubtable) kern0(left, right GlyphID) (int, bool) {
+	pairs := s.headerLen + 8
+	key := uint32(left)<<16 | uint32(right)
+	lo, hi := int32(0), int32(u16(s.data, s.headerLen))
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		pair := pairs + 6*mid
+		switch k := u32(s.data, pair); {
+		case key < k:
+			hi = mid
+		case key > k:
+			lo = mid + 1
+		default:
+			return int(i16(s.data, pair+4)), true
+		}
+	}
+	return 0, false
+}
+
+// kern2 looks up the pair in a format 2 subtable's two dimensional array,
+// indexed by the left and right glyphs' classes. The left and right class
+// values are byte offsets, which sum to the offset of the kerning value from
+// the start of the subtable.
+func (s kernSubtable) kern2(left, right GlyphID) (int, bool) {
+	h := s.headerLen
+	l, ok := s.kern2Class(int32(u16(s.data, h+2)), left)
+	if !ok {
+		return 0, false
+	}
+	r, ok := s.kern2Class(int32(u16(s.data, h+4)), right)
+	if !ok {
+		return 0, false
+	}
+	i := l + r
+	if i < h+8 || int(i)+2 > len(s.data) {
+		return 0, false
+	}
+	return int(i16(s.data, i)), true
+}
+
+// kern2Class returns the class value of the glyph from the format 2 class
+// table at the given offset.
+func (s kernSubtable) kern2Class(offset int32, glyphID GlyphID) (int32, bool) {
+	if int(offset)+4 > len(s.data) {
+		return 0, false
+	}
+	first, n := u16(s.data, offset), int32(u16(s.data, offset+2))
+	i := int32(glyphID) - int32(first)
+	if i < 0 || n <= i || int(offset+4+2*i+2) > len(s.data) {
+		return 0, false
+	}
+	return int32(u16(s.data, offset+4+2*i)), true
+}
+
+// Kern returns the horizontal adjustment, in pixels at the given pixels per
+// em, to the advance of the left glyph when followed by the right glyph. It
+// is usually negative, to move the glyphs closer together. It uses the legacy
+// kern table, and returns zero if the font has none.
+func (f *Font) Kern(left, right GlyphID, ppem float32) float32 {
+	return f.Scale(ppem) * float32(f.kern.kern(left, right))
+}
@@ -0,0 +1,186 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"errors"
+	"testing"
+)
+
+// testKernPair is a kerning pair, for buildKern0.
+type testKernPair struct {
+	left, right GlyphID
+	value       int
+}
+
+// buildKern0 returns the body of a format 0 kern subtable, which follows the
+// subtable header. The pairs must be sorted.
+func buildKern0(pairs ...testKernPair) []byte {
+	b := cat(be16(len(pairs)), be16(0), be16(0), be16(0))
+	for _, p := range pairs {
+		b = append(b, cat(be16(int(p.left)), be16(int(p.right)), be16(p.value))...)
+	}
+	return b
+}
+
+// buildKernMicrosoft returns a Microsoft version kern table with subtables
+// with the given coverage fields and bodies.
+func buildKernMicrosoft(subtables ...interface{}) []byte {
+	b := cat(be16(0), be16(len(subtables)/2))
+	for i := 0; i < len(subtables); i += 2 {
+		coverage, body := subtables[i].(int), subtables[i+1].([]byte)
+		b = append(b, cat(be16(0), be16(6+len(body)), be16(coverage), body)...)
+	}
+	return b
+}
+
+// buildKernApple returns an Apple version kern table with subtables with the
+// given coverage fields and bodies.
+func buildKernApple(subtables ...interface{}) []byte {
+	b := cat(be32(0x00010000), be32(len(subtables)/2))
+	for i := 0; i < len(subtables); i += 2 {
+		coverage, body := subtables[i].(int), subtables[i+1].([]byte)
+		b = append(b, cat(be32(8+len(body)), be16(coverage), be16(0), body)...)
+	}
+	return b
+}
+
+// buildKern2 returns the body of an Apple format 2 kern subtable, whose
+// header is 8 bytes long, for glyphs 1 and 2 on the left and glyphs 2 and 3
+// on the right. The values are indexed by left class then right class.
+func buildKern2(values [2][2]int) []byte {
+	const (
+		headerLen  = 8
+		leftClass  = headerLen + 8
+		rightClass = leftClass + 8
+		array      = rightClass + 8
+	)
+	// Left class values are offsets of rows, from the start of the
+	// subtable, and right class values are offsets within a row.
+	return cat(
+		be16(4), be16(leftClass), be16(rightClass), be16(array),
+		be16(1), be16(2), be16(array), be16(array+4),
+		be16(2), be16(2), be16(0), be16(2),
+		be16(values[0][0]), be16(values[0][1]), be16(values[1][0]), be16(values[1][1]),
+	)
+}
+
+func TestKern(t *testing.T) {
+	testCases := []struct {
+		desc string
+		kern []byte
+		want map[[2]GlyphID]int
+	}{{
+		desc: "format 0",
+		kern: buildKernMicrosoft(
+			0x0001, buildKern0(testKernPair{1, 2, -50}, testKernPair{2, 1, -70}, testKernPair{2, 3, 20}),
+		),
+		want: map[[2]GlyphID]int{{1, 2}: -50, {2, 1}: -70, {2, 3}: 20, {1, 1}: 0, {3, 2}: 0},
+	}, {
+		desc: "format 0, accumulated and overridden",
+		kern: buildKernMicrosoft(
+			0x0001, buildKern0(testKernPair{1, 2, -50}, testKernPair{2, 1, -70}),
+			0x0001, buildKern0(testKernPair{1, 2, -5}),
+			0x0009, buildKern0(testKernPair{2, 1, -7}),
+		),
+		want: map[[2]GlyphID]int{{1, 2}: -55, {2, 1}: -7},
+	}, {
+		desc: "format 0, vertical, minimum and cross-stream ignored",
+		kern: buildKernMicrosoft(
+			0x0000, buildKern0(testKernPair{1, 2, -50}),
+			0x0003, buildKern0(testKernPair{1, 2, -60}),
+			0x0005, buildKern0(testKernPair{1, 2, -70}),
+		),
+		want: map[[2]GlyphID]int{{1, 2}: 0},
+	}, {
+		desc: "Apple format 0",
+		kern: buildKernApple(
+			0x0000, buildKern0(testKernPair{1, 2, -50}),
+			0x8000, buildKern0(testKernPair{1, 2, -60}),
+		),
+		want: map[[2]GlyphID]int{{1, 2}: -50, {2, 1}: 0},
+	}, {
+		desc: "Apple format 2",
+		kern: buildKernApple(
+			0x0002, buildKern2([2][2]int{{-10, -20}, {-30, -40}}),
+		),
+		want: map[[2]GlyphID]int{
+			{1, 2}: -10, {1, 3}: -20, {2, 2}: -30, {2, 3}: -40,
+			{0, 2}: 0, {3, 2}: 0, {1, 1}: 0, {1, 4}: 0,
+		},
+	}, {
+		desc: "unsupported format ignored",
+		kern: buildKernApple(
+			0x0001, make([]byte, 10),
+			0x0000, buildKern0(testKernPair{1, 2, -50}),
+		),
+		want: map[[2]GlyphID]int{{1, 2}: -50},
+	}}
+
+	for _, tc := range testCases {
+		m := testTables()
+		m["kern"] = tc.kern
+		f, err := Parse(buildFont(m))
+		if err != nil {
+			t.Errorf("%s: Parse: %v", tc.desc, err)
+			continue
+		}
+		for pair, want := range tc.want {
+			// The font's units per em is 1000, so that at 1000 ppem, pixels
+			// and font units are the same.
+			if got := f.Kern(pair[0], pair[1], 1000); got != float32(want) {
+				t.Errorf("%s: pair %v: got %v, want %v", tc.desc, pair, got, want)
+			}
+		}
+	}
+}
+
+func TestKernScale(t *testing.T) {
+	m := testTables()
+	m["kern"] = buildKernMicrosoft(0x0001, buildKern0(testKernPair{1, 2, -50}))
+	f, err := Parse(buildFont(m))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got, want := f.Kern(1, 2, 20), f.Scale(20)*-50; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestKernErrors(t *testing.T) {
+	testCases := []struct {
+		desc string
+		kern []byte
+	}{{
+		desc: "short table",
+		kern: be16(0),
+	}, {
+		desc: "unsupported version",
+		kern: cat(be16(2), be16(0)),
+	}, {
+		desc: "subtable out of bounds",
+		kern: cat(be16(0), be16(2), be16(0), be16(6), be16(0x0001)),
+	}, {
+		desc: "too many pairs",
+		kern: buildKernApple(0x0000, cat(be16(2), be16(0), be16(0), be16(0), be16(1), be16(2), be16(-50))),
+	}}
+	for _, tc := range testCases {
+		m := testTables()
+		m["kern"] = tc.kern
+		if _, err := Parse(buildFont(m)); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an error matching ErrInvalidFont", tc.desc, err)
+		}
+	}
+}
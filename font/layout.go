@@ -0,0 +1,578 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"fmt"
+	"sort"
+)
+
+// This file implements the parts of OpenType layout that are common to the
+// GPOS and GSUB tables: script, language system and feature selection, the
+// lookup list, coverage and class definition tables, and matching contextual
+// rules.
+//
+// Layout tables hold many nested subtables at 16 and 32 bit offsets. Rather
+// than validate them all up front, they are read through otData, whose
+// methods treat out of bounds reads as zero. A zero count or a null offset
+// means an empty table, so malformed subtables simply do not match.
+
+// LayoutOptions are optional arguments to Position, Substitute and Shape.
+type LayoutOptions struct {
+	// Script is the OpenType script tag, such as "latn" or "arab". A zero
+	// value means the font's default script.
+	Script Tag
+	// Language is the OpenType language system tag, such as "TRK ". A zero
+	// value means the script's default language system.
+	Language Tag
+	// Features turns features on (true) or off (false). Features that are not
+	// in the map are on if they are on by default, such as "kern", "mark" and
+	// "mkmk" for positioning, and "liga" and "calt" for substitution.
+	Features map[Tag]bool
+	// RightToLeft is whether the glyphs are in logical order for right to
+	// left text, such as Arabic or Hebrew.
+	RightToLeft bool
+}
+
+// Shape applies Substitute and then Position to the glyphs, and returns their
+// positions. Unlike Position on its own, it attaches marks that were between
+// the components of a ligature to the component that they follow, such as a
+// mark on the first component of a ligature of two letters. The opts may be
+// nil.
+func (f *Font) Shape(glyphs []GlyphID, opts *LayoutOptions) ([]GlyphPosition, error) {
+	r := f.substitute(glyphs, opts)
+	return f.position(r.glyphs, r.components, opts)
+}
+
+// maxContextDepth limits the nesting of contextual lookups, which can
+// otherwise recurse without bound in malformed fonts.
+const maxContextDepth = 16
+
+// Lookup flags.
+const (
+	lookupRightToLeft         = 0x0001
+	lookupIgnoreBaseGlyphs    = 0x0002
+	lookupIgnoreLigatures     = 0x0004
+	lookupIgnoreMarks         = 0x0008
+	lookupUseMarkFilteringSet = 0x0010
+	lookupMarkAttachmentType  = 0xff00
+)
+
+// otData is an OpenType layout table, or part of one. Its methods return zero
+// for out of bounds reads.
+type otData []byte
+
+func (b otData) u8(i int) uint8 {
+	if i < 0 || len(b) < i+1 {
+		return 0
+	}
+	return b[i]
+}
+
+func (b otData) u16(i int) uint16 {
+	if i < 0 || len(b) < i+2 {
+		return 0
+	}
+	return uint16(b[i])<<8 | uint16(b[i+1])
+}
+
+func (b otData) i16(i int) int16 { return int16(b.u16(i)) }
+
+func (b otData) u24(i int) uint32 {
+	if i < 0 || len(b) < i+3 {
+		return 0
+	}
+	return uint32(b[i])<<16 | uint32(b[i+1])<<8 | uint32(b[i+2])
+}
+
+func (b otData) u32(i int) uint32 {
+	if i < 0 || len(b) < i+4 {
+		return 0
+	}
+	return uint32(b[i])<<24 | uint32(b[i+1])<<16 | uint32(b[i+2])<<8 | uint32(b[i+3])
+}
+
+func (b otData) tag(i int) Tag { return Tag(b.u32(i)) }
+
+// offset16 returns the subtable at the 16-bit offset, relative to b, stored at
+// b[i:]. It returns nil for a null or out of bounds offset.
+func (b otData) offset16(i int) otData {
+	o := int(b.u16(i))
+	if o == 0 || o >= len(b) {
+		return nil
+	}
+	return b[o:]
+}
+
+// offset24 is like offset16, for a 24-bit offset.
+func (b otData) offset24(i int) otData {
+	o := int(b.u24(i))
+	if o == 0 || o >= len(b) {
+		return nil
+	}
+	return b[o:]
+}
+
+// offset32 is like offset16, for a 32-bit offset.
+func (b otData) offset32(i int) otData {
+	o := b.u32(i)
+	if o == 0 || uint64(o) >= uint64(len(b)) {
+		return nil
+	}
+	return b[o:]
+}
+
+// coverageIndex returns the index of the glyph in the Coverage table b, or -1
+// if the glyph is not covered.
+func (b otData) coverageIndex(g GlyphID) int {
+	switch b.u16(0) {
+	case 1:
+		n := int(b.u16(2))
+		i := sort.Search(n, func(i int) bool { return GlyphID(b.u16(4+2*i)) >= g })
+		if i < n && GlyphID(b.u16(4+2*i)) == g {
+			return i
+		}
+	case 2:
+		n := int(b.u16(2))
+		i := sort.Search(n, func(i int) bool { return GlyphID(b.u16(4+6*i+2)) >= g })
+		if i < n {
+			rec := 4 + 6*i
+			if start := GlyphID(b.u16(rec)); start <= g {
+				return int(b.u16(rec+4)) + int(g-start)
+			}
+		}
+	}
+	return -1
+}
+
+// class returns the class of the glyph in the ClassDef table b. Glyphs that
+// are not listed are in class 0.
+func (b otData) class(g GlyphID) int {
+	switch b.u16(0) {
+	case 1:
+		start, n := GlyphID(b.u16(2)), int(b.u16(4))
+		if i := int(g) - int(start); 0 <= i && i < n {
+			return int(b.u16(6 + 2*i))
+		}
+	case 2:
+		n := int(b.u16(2))
+		i := sort.Search(n, func(i int) bool { return GlyphID(b.u16(4+6*i+2)) >= g })
+		if i < n {
+			rec := 4 + 6*i
+			if GlyphID(b.u16(rec)) <= g {
+				return int(b.u16(rec + 4))
+			}
+		}
+	}
+	return 0
+}
+
+// layoutTable is a GSUB or GPOS table.
+type layoutTable struct {
+	scripts  otData
+	features otData
+	lookups  otData
+	// extensionType is the lookup type for extension lookups, which differs
+	// between GSUB and GPOS.
+	extensionType int
+}
+
+// parseLayoutTable parses the header of the GSUB or GPOS table b.
+func parseLayoutTable(tag string, b []byte, extensionType int) (layoutTable, error) {
+	if len(b) < 10 {
+		return layoutTable{}, ErrTableTooShort{Tag: MakeTag(tag), Length: len(b), MinLength: 10}
+	}
+	if major := u16(b, 0); major != 1 {
+		return layoutTable{}, ErrUnsupportedFormat{Tag: MakeTag(tag), Format: uint32(major)}
+	}
+	t := layoutTable{extensionType: extensionType}
+	for _, x := range []struct {
+		dst  *otData
+		i    int
+		name string
+	}{
+		{&t.scripts, 4, "script list"},
+		{&t.features, 6, "feature list"},
+		{&t.lookups, 8, "lookup list"},
+	} {
+		*x.dst = otData(b).offset16(x.i)
+		if *x.dst == nil && u16(b, int32(x.i)) != 0 {
+			return layoutTable{}, ErrInvalidTable{Tag: MakeTag(tag), Reason: fmt.Sprintf("%s offset is out of bounds", x.name)}
+		}
+	}
+	return t, nil
+}
+
+// langSys returns the LangSys table for the script and language system.
+func (t layoutTable) langSys(script, language Tag) otData {
+	var s otData
+	for _, tag := range []Tag{script, MakeTag("DFLT"), MakeTag("dflt"), MakeTag("latn")} {
+		if tag == 0 {
+			continue
+		}
+		if s = t.findRecord(t.scripts, tag); s != nil {
+			break
+		}
+	}
+	if s == nil {
+		return nil
+	}
+	if language != 0 {
+		n := int(s.u16(2))
+		for i := 0; i < n; i++ {
+			if rec := 4 + 6*i; s.tag(rec) == language {
+				return s.offset16(rec + 4)
+			}
+		}
+	}
+	return s.offset16(0)
+}
+
+// findRecord returns the table for the tag in a ScriptList or FeatureList
+// style list of tag and offset records.
+func (t layoutTable) findRecord(list otData, tag Tag) otData {
+	n := int(list.u16(0))
+	for i := 0; i < n; i++ {
+		if rec := 2 + 6*i; list.tag(rec) == tag {
+			return list.offset16(rec + 4)
+		}
+	}
+	return nil
+}
+
+// lookupIndices returns the indices, in increasing order and without
+// duplicates, of the lookups of the features that opts selects. The features
+// in defaults are on unless opts turns them off.
+func (t layoutTable) lookupIndices(opts *LayoutOptions, defaults []string) []int {
+	ls := t.langSys(opts.Script, opts.Language)
+	if ls == nil {
+		return nil
+	}
+	enabled := func(tag Tag) bool {
+		if on, ok := opts.Features[tag]; ok {
+			return on
+		}
+		for _, d := range defaults {
+			if MakeTag(d) == tag {
+				return true
+			}
+		}
+		return false
+	}
+
+	seen := map[int]bool{}
+	var indices []int
+	addFeature := func(fi int, required bool) {
+		rec := 2 + 6*fi
+		if fi >= int(t.features.u16(0)) || (!required && !enabled(t.features.tag(rec))) {
+			return
+		}
+		feature := t.features.offset16(rec + 4)
+		n := int(feature.u16(2))
+		for i := 0; i < n; i++ {
+			if li := int(feature.u16(4 + 2*i)); !seen[li] {
+				seen[li] = true
+				indices = append(indices, li)
+			}
+		}
+	}
+	if req := ls.u16(2); req != 0xffff {
+		addFeature(int(req), true)
+	}
+	n := int(ls.u16(4))
+	for i := 0; i < n; i++ {
+		addFeature(int(ls.u16(6+2*i)), false)
+	}
+	sort.Ints(indices)
+	return indices
+}
+
+// lookup is a lookup from the lookup list, with extension subtables
+// resolved.
+type lookup struct {
+	typ              int
+	flag             uint16
+	markFilteringSet int
+	subtables        []otData
+}
+
+// lookup returns the lookup at the given index in the lookup list.
+func (t layoutTable) lookup(i int) lookup {
+	if i >= int(t.lookups.u16(0)) {
+		return lookup{}
+	}
+	b := t.lookups.offset16(2 + 2*i)
+	l := lookup{
+		typ:  int(b.u16(0)),
+		flag: b.u16(2),
+	}
+	n := int(b.u16(4))
+	if l.flag&lookupUseMarkFilteringSet != 0 {
+		l.markFilteringSet = int(b.u16(6 + 2*n))
+	}
+	l.subtables = make([]otData, 0, n)
+	for j := 0; j < n; j++ {
+		s := b.offset16(6 + 2*j)
+		if l.typ == t.extensionType {
+			// An extension subtable holds the real lookup type and a 32-bit
+			// offset to the real subtable.
+			if s.u16(0) != 1 {
+				continue
+			}
+			typ := int(s.u16(2))
+			if typ == t.extensionType || (j > 0 && typ != l.typ) {
+				continue
+			}
+			l.typ, s = typ, s.offset32(4)
+		}
+		if s != nil {
+			l.subtables = append(l.subtables, s)
+		}
+	}
+	return l
+}
+
+// seqLookup is a sequence lookup record of a contextual rule: the lookup to
+// apply at an index into the rule's input sequence.
+type seqLookup struct {
+	seqIndex    int
+	lookupIndex int
+}
+
+// layoutRun is a glyph run that lookups are applied to.
+type layoutRun struct {
+	glyphs []GlyphID
+	gdef   *gdef
+}
+
+// skip returns whether the lookup ignores the glyph at index i, by the glyph's
+// class in the GDEF table, according to the lookup flag.
+func (r *layoutRun) skip(i int, l *lookup) bool {
+	g := r.glyphs[i]
+	switch r.gdef.glyphClass(g) {
+	case GlyphClassBase:
+		return l.flag&lookupIgnoreBaseGlyphs != 0
+	case GlyphClassLigature:
+		return l.flag&lookupIgnoreLigatures != 0
+	case GlyphClassMark:
+		if l.flag&lookupIgnoreMarks != 0 {
+			return true
+		}
+		if l.flag&lookupUseMarkFilteringSet != 0 {
+			return !r.gdef.inMarkGlyphSet(l.markFilteringSet, g)
+		}
+		if c := int(l.flag&lookupMarkAttachmentType) >> 8; c != 0 {
+			return r.gdef.markAttachClass(g) != c
+		}
+	}
+	return false
+}
+
+// next returns the index of the first glyph after i that the lookup does not
+// ignore, or -1 if there is none.
+func (r *layoutRun) next(i int, l *lookup) int {
+	for i++; i < len(r.glyphs); i++ {
+		if !r.skip(i, l) {
+			return i
+		}
+	}
+	return -1
+}
+
+// prev returns the index of the last glyph before i that the lookup does not
+// ignore, or -1 if there is none.
+func (r *layoutRun) prev(i int, l *lookup) int {
+	for i--; i >= 0; i-- {
+		if !r.skip(i, l) {
+			return i
+		}
+	}
+	return -1
+}
+
+// matchContext matches the rules of a context (chained is false) or chained
+// context (chained is true) subtable b at index i of the run. If a rule
+// matches, it returns the run indices of the rule's input sequence and the
+// rule's sequence lookup records.
+func (r *layoutRun) matchContext(b otData, chained bool, i int, l *lookup) (input []int, records []seqLookup, ok bool) {
+	g := r.glyphs[i]
+	switch format := b.u16(0); {
+	case format == 1 || format == 2:
+		// Rule sets are indexed by the coverage index of the first glyph, for
+		// format 1, or by its class, for format 2. Within rules, glyphs are
+		// matched by ID, or by class, respectively.
+		ci := b.offset16(2).coverageIndex(g)
+		if ci < 0 {
+			return nil, nil, false
+		}
+		setIndex, setCount, sets := ci, int(b.u16(4)), 6
+		var backtrack, inputClasses, lookahead otData
+		switch {
+		case format == 2 && !chained:
+			inputClasses = b.offset16(4)
+			setIndex, setCount, sets = inputClasses.class(g), int(b.u16(6)), 8
+		case format == 2 && chained:
+			backtrack, inputClasses, lookahead = b.offset16(4), b.offset16(6), b.offset16(8)
+			setIndex, setCount, sets = inputClasses.class(g), int(b.u16(10)), 12
+		}
+		if setIndex >= setCount {
+			return nil, nil, false
+		}
+		set := b.offset16(sets + 2*setIndex)
+		matcher := func(classes otData) func(otData, int, int) bool {
+			if format == 1 {
+				return func(seq otData, k, i int) bool { return r.glyphs[i] == GlyphID(seq.u16(2*k)) }
+			}
+			return func(seq otData, k, i int) bool { return classes.class(r.glyphs[i]) == int(seq.u16(2*k)) }
+		}
+		n := int(set.u16(0))
+		for j := 0; j < n; j++ {
+			rule := set.offset16(2 + 2*j)
+			if input, records, ok := r.matchRule(rule, chained, i, l,
+				matcher(backtrack), matcher(inputClasses), matcher(lookahead)); ok {
+				return input, records, true
+			}
+		}
+
+	case format == 3 && !chained:
+		// Format 3 has one rule, which matches each glyph by coverage.
+		nInput, nRecords := int(b.u16(2)), int(b.u16(4))
+		input, ok := r.matchSeq(i, nInput, +1, l, func(k, i int) bool {
+			return b.offset16(6+2*k).coverageIndex(r.glyphs[i]) >= 0
+		})
+		if ok && nInput != 0 {
+			return input, seqLookups(b[min(6+2*nInput, len(b)):], nRecords), true
+		}
+
+	case format == 3 && chained:
+		nBacktrack := int(b.u16(2))
+		backtrack := 4
+		nInput := int(b.u16(backtrack + 2*nBacktrack))
+		inputs := backtrack + 2*nBacktrack + 2
+		nLookahead := int(b.u16(inputs + 2*nInput))
+		lookahead := inputs + 2*nInput + 2
+		nRecords := int(b.u16(lookahead + 2*nLookahead))
+		coverage := func(base int) func(k, i int) bool {
+			return func(k, i int) bool { return b.offset16(base+2*k).coverageIndex(r.glyphs[i]) >= 0 }
+		}
+		input, ok := r.matchSeq(i, nInput, +1, l, coverage(inputs))
+		if !ok || nInput == 0 {
+			return nil, nil, false
+		}
+		if _, ok := r.matchSeq(r.prev(i, l), nBacktrack, -1, l, coverage(backtrack)); !ok {
+			return nil, nil, false
+		}
+		if _, ok := r.matchSeq(r.next(input[nInput-1], l), nLookahead, +1, l, coverage(lookahead)); !ok {
+			return nil, nil, false
+		}
+		records := lookahead + 2*nLookahead + 2
+		return input, seqLookups(b[min(records, len(b)):], nRecords), true
+	}
+	return nil, nil, false
+}
+
+// matchRule matches a format 1 or 2 context or chained context rule at index
+// i of the run, whose first glyph has already been matched.
+func (r *layoutRun) matchRule(rule otData, chained bool, i int, l *lookup,
+	backtrack, input, lookahead func(seq otData, k, i int) bool) ([]int, []seqLookup, bool) {
+
+	off := 0
+	var backtrackSeq otData
+	nBacktrack := 0
+	if chained {
+		nBacktrack = int(rule.u16(0))
+		backtrackSeq = rule[min(2, len(rule)):]
+		off = 2 + 2*nBacktrack
+	}
+	nInput := int(rule.u16(off))
+	off += 2
+	if nInput == 0 {
+		return nil, nil, false
+	}
+	nRecords := 0
+	if !chained {
+		nRecords = int(rule.u16(off))
+		off += 2
+	}
+	inputSeq := rule[min(off, len(rule)):]
+	off += 2 * (nInput - 1)
+
+	// The rule's input sequence omits the first glyph.
+	matched, ok := r.matchSeq(i, nInput, +1, l, func(k, i int) bool {
+		return k == 0 || input(inputSeq, k-1, i)
+	})
+	if !ok {
+		return nil, nil, false
+	}
+	if chained {
+		if _, ok := r.matchSeq(r.prev(i, l), nBacktrack, -1, l, func(k, i int) bool {
+			return backtrack(backtrackSeq, k, i)
+		}); !ok {
+			return nil, nil, false
+		}
+		nLookahead := int(rule.u16(off))
+		lookaheadSeq := rule[min(off+2, len(rule)):]
+		if _, ok := r.matchSeq(r.next(matched[nInput-1], l), nLookahead, +1, l, func(k, i int) bool {
+			return lookahead(lookaheadSeq, k, i)
+		}); !ok {
+			return nil, nil, false
+		}
+		off += 2 + 2*nLookahead
+		nRecords = int(rule.u16(off))
+		off += 2
+	}
+	return matched, seqLookups(rule[min(off, len(rule)):], nRecords), true
+}
+
+// matchSeq matches n glyphs, starting at index i of the run and going forwards
+// (dir is +1) or backwards (dir is -1), skipping glyphs that the lookup
+// ignores. The match function is given each glyph's index in the sequence and
+// in the run. It returns the run indices of the matched glyphs.
+func (r *layoutRun) matchSeq(i, n, dir int, l *lookup, match func(k, i int) bool) ([]int, bool) {
+	matched := make([]int, 0, n)
+	for k := 0; k < n; k++ {
+		if k > 0 {
+			if dir > 0 {
+				i = r.next(i, l)
+			} else {
+				i = r.prev(i, l)
+			}
+		}
+		if i < 0 || i >= len(r.glyphs) || !match(k, i) {
+			return nil, false
+		}
+		matched = append(matched, i)
+	}
+	return matched, true
+}
+
+// seqLookups returns the n sequence lookup records at the start of b.
+func seqLookups(b otData, n int) []seqLookup {
+	records := make([]seqLookup, 0, n)
+	for j := 0; j < n; j++ {
+		records = append(records, seqLookup{
+			seqIndex:    int(b.u16(4*j + 0)),
+			lookupIndex: int(b.u16(4*j + 2)),
+		})
+	}
+	return records
+}
+
+func min(x, y int) int {
+	if x < y {
+		return x
+	}
+	return y
+}
@@ -0,0 +1,248 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"testing"
+)
+
+// off16 is a subtable at a 16-bit offset, for buildTable. A nil off16 is a
+// null offset.
+type off16 []byte
+
+// off32 is like off16, for a 32-bit offset.
+type off32 []byte
+
+// buildTable returns a table whose header is the concatenation of the fields,
+// which are either raw []byte values or offsets to subtables. The subtables
+// follow the header, in order, and the offsets are relative to the start of
+// the table.
+func buildTable(fields ...interface{}) []byte {
+	n := 0
+	for _, f := range fields {
+		switch f := f.(type) {
+		case []byte:
+			n += len(f)
+		case off16:
+			n += 2
+		case off32:
+			n += 4
+		}
+	}
+	var head, tail []byte
+	for _, f := range fields {
+		switch f := f.(type) {
+		case []byte:
+			head = append(head, f...)
+		case off16:
+			if f == nil {
+				head = append(head, be16(0)...)
+				continue
+			}
+			head = append(head, be16(n+len(tail))...)
+			tail = append(tail, f...)
+		case off32:
+			if f == nil {
+				head = append(head, be32(0)...)
+				continue
+			}
+			head = append(head, be32(n+len(tail))...)
+			tail = append(tail, f...)
+		}
+	}
+	return cat(head, tail)
+}
+
+// buildCoverage returns a format 1 Coverage table for the glyphs, which must
+// be in increasing order.
+func buildCoverage(glyphs ...GlyphID) []byte {
+	b := cat(be16(1), be16(len(glyphs)))
+	for _, g := range glyphs {
+		b = append(b, be16(int(g))...)
+	}
+	return b
+}
+
+// buildClassDef returns a format 2 ClassDef table with one range per glyph,
+// for the glyphs and classes in the map.
+func buildClassDef(classes map[GlyphID]int) []byte {
+	b := cat(be16(2), be16(len(classes)))
+	for g := GlyphID(0); g < 256; g++ {
+		if c, ok := classes[g]; ok {
+			b = append(b, cat(be16(int(g)), be16(int(g)), be16(c))...)
+		}
+	}
+	return b
+}
+
+// testFeature is a feature and its lookup indices, for buildLayoutTable.
+type testFeature struct {
+	tag     string
+	lookups []int
+}
+
+// testScript is a script, for buildLayoutTable, with its default language
+// system's feature indices and other language systems' feature indices.
+type testScript struct {
+	tag      string
+	features []int
+	langs    map[string][]int
+}
+
+// buildLayoutTable returns a GSUB or GPOS table.
+func buildLayoutTable(scripts []testScript, features []testFeature, lookups ...[]byte) []byte {
+	langSys := func(indices []int) []byte {
+		b := cat(be16(0), be16(0xffff), be16(len(indices)))
+		for _, i := range indices {
+			b = append(b, be16(i)...)
+		}
+		return b
+	}
+
+	scriptList := []interface{}{be16(len(scripts))}
+	for _, s := range scripts {
+		script := []interface{}{off16(langSys(s.features)), be16(len(s.langs))}
+		for tag, indices := range s.langs {
+			script = append(script, []byte(tag), off16(langSys(indices)))
+		}
+		scriptList = append(scriptList, []byte(s.tag), off16(buildTable(script...)))
+	}
+
+	featureList := []interface{}{be16(len(features))}
+	for _, f := range features {
+		feature := cat(be16(0), be16(len(f.lookups)))
+		for _, i := range f.lookups {
+			feature = append(feature, be16(i)...)
+		}
+		featureList = append(featureList, []byte(f.tag), off16(feature))
+	}
+
+	lookupList := []interface{}{be16(len(lookups))}
+	for _, l := range lookups {
+		lookupList = append(lookupList, off16(l))
+	}
+
+	return buildTable(
+		be16(1), be16(0),
+		off16(buildTable(scriptList...)),
+		off16(buildTable(featureList...)),
+		off16(buildTable(lookupList...)),
+	)
+}
+
+// buildLookup returns a Lookup table with the given subtables.
+func buildLookup(typ, flag int, subtables ...[]byte) []byte {
+	fields := []interface{}{be16(typ), be16(flag), be16(len(subtables))}
+	for _, s := range subtables {
+		fields = append(fields, off16(s))
+	}
+	return buildTable(fields...)
+}
+
+// testLayoutTables returns the tables of a font with eight glyphs, with
+// advance widths of 0, 500, 600, 700, 800, 900, 0 and 0. Glyphs 6 and 7 are
+// meant to be marks.
+func testLayoutTables() map[string][]byte {
+	glyphs := make([][]byte, 8)
+	for i := range glyphs {
+		glyphs[i] = buildSimpleGlyph(testSquare)
+	}
+	return buildTables(glyphs, []int{0, 500, 600, 700, 800, 900, 0, 0}, nil)
+}
+
+func TestLookupIndices(t *testing.T) {
+	b := buildLayoutTable(
+		[]testScript{
+			{tag: "DFLT", features: []int{0}},
+			{tag: "latn", features: []int{1, 2}, langs: map[string][]int{"TRK ": {3}}},
+		},
+		[]testFeature{
+			{"kern", []int{0}},
+			{"kern", []int{2, 1}},
+			{"liga", []int{3}},
+			{"kern", []int{4}},
+		},
+	)
+	table, err := parseLayoutTable("GPOS", b, gposExtension)
+	if err != nil {
+		t.Fatalf("parseLayoutTable: %v", err)
+	}
+	testCases := []struct {
+		desc string
+		opts LayoutOptions
+		want []int
+	}{
+		{"default script", LayoutOptions{}, []int{0}},
+		{"unknown script", LayoutOptions{Script: MakeTag("grek")}, []int{0}},
+		{"latn", LayoutOptions{Script: MakeTag("latn")}, []int{1, 2}},
+		{"latn with liga", LayoutOptions{
+			Script:   MakeTag("latn"),
+			Features: map[Tag]bool{MakeTag("liga"): true},
+		}, []int{1, 2, 3}},
+		{"latn without kern", LayoutOptions{
+			Script:   MakeTag("latn"),
+			Features: map[Tag]bool{MakeTag("kern"): false, MakeTag("liga"): true},
+		}, []int{3}},
+		{"latn TRK", LayoutOptions{Script: MakeTag("latn"), Language: MakeTag("TRK ")}, []int{4}},
+		{"latn unknown language", LayoutOptions{Script: MakeTag("latn"), Language: MakeTag("DEU ")}, []int{1, 2}},
+	}
+	for _, tc := range testCases {
+		got := table.lookupIndices(&tc.opts, []string{"kern"})
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.desc, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: got %v, want %v", tc.desc, got, tc.want)
+				break
+			}
+		}
+	}
+}
+
+func TestCoverageAndClassDef(t *testing.T) {
+	coverage2 := cat(be16(2), be16(2), be16(3), be16(5), be16(0), be16(10), be16(10), be16(3))
+	testCases := []struct {
+		g        GlyphID
+		cov1     int
+		cov2     int
+		classDef int
+	}{
+		{1, -1, -1, 0},
+		{3, 0, 0, 7},
+		{4, -1, 1, 0},
+		{5, 1, 2, 0},
+		{10, 2, 3, 9},
+		{11, -1, -1, 0},
+	}
+	cov1 := otData(buildCoverage(3, 5, 10))
+	classDef := otData(buildClassDef(map[GlyphID]int{3: 7, 10: 9}))
+	classDef1 := otData(cat(be16(1), be16(3), be16(8), be16(7), make([]byte, 12), be16(9)))
+	for _, tc := range testCases {
+		if got := cov1.coverageIndex(tc.g); got != tc.cov1 {
+			t.Errorf("glyph %d: coverage format 1: got %d, want %d", tc.g, got, tc.cov1)
+		}
+		if got := otData(coverage2).coverageIndex(tc.g); got != tc.cov2 {
+			t.Errorf("glyph %d: coverage format 2: got %d, want %d", tc.g, got, tc.cov2)
+		}
+		if got := classDef.class(tc.g); got != tc.classDef {
+			t.Errorf("glyph %d: class format 2: got %d, want %d", tc.g, got, tc.classDef)
+		}
+		if got := classDef1.class(tc.g); got != tc.classDef {
+			t.Errorf("glyph %d: class format 1: got %d, want %d", tc.g, got, tc.classDef)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"golang.org/x/image/math/f32"
+)
+
+const (
+	hheaLen = 36
+	vheaLen = 36
+	// os2TypoLen is the length of the OS/2 table up to and including the
+	// sTypoLineGap field, which some old fonts' tables end before.
+	os2TypoLen = 74
+)
+
+// hhea is the horizontal header table.
+type hhea []byte
+
+func (b hhea) ascender() int         { return int(i16(b, 4)) }
+func (b hhea) descender() int        { return int(i16(b, 6)) }
+func (b hhea) lineGap() int          { return int(i16(b, 8)) }
+func (b hhea) caretSlopeRise() int   { return int(i16(b, 18)) }
+func (b hhea) caretSlopeRun() int    { return int(i16(b, 20)) }
+func (b hhea) numberOfHMetrics() int { return int(u16(b, 34)) }
+
+// vhea is the vertical header table. Its layout matches the hhea table's.
+type vhea []byte
+
+func (b vhea) numOfLongVerMetrics() int { return int(u16(b, 34)) }
+
+// os2 is the OS/2 and Windows metrics table.
+type os2 []byte
+
+// typoAscenderDescender returns the sTypoAscender and sTypoDescender fields,
+// if the table is long enough to hold them.
+func (b os2) typoAscenderDescender() (ascender, descender int, ok bool) {
+	if len(b) < os2TypoLen {
+		return 0, 0, false
+	}
+	return int(i16(b, 68)), int(i16(b, 70)), true
+}
+
+// hmtx is the horizontal metrics table. It starts with numberOfHMetrics long
+// metrics, each an advance width and a left side bearing, followed by only the
+// left side bearings of the remaining glyphs.
+type hmtx []byte
+
+// hMetrics returns the glyph's advance width and left side bearing in font
+// units. The caller must check that the table is long enough for glyphID.
+func (b hmtx) hMetrics(glyphID GlyphID, numberOfHMetrics int) HMetrics {
+	advance, bearing := longMetric(b, glyphID, numberOfHMetrics)
+	return HMetrics{AdvanceWidth: advance, LeftSideBearing: bearing}
+}
+
+// vmtx is the vertical metrics table. Its layout matches the hmtx table's,
+// with advance heights and top side bearings.
+type vmtx []byte
+
+// vMetrics returns the glyph's advance height and top side bearing in font
+// units. The caller must check that the table is long enough for glyphID.
+func (b vmtx) vMetrics(glyphID GlyphID, numOfLongVerMetrics int) VMetrics {
+	advance, bearing := longMetric(b, glyphID, numOfLongVerMetrics)
+	return VMetrics{AdvanceHeight: advance, TopSideBearing: bearing}
+}
+
+// longMetric returns the advance and side bearing for a glyph from an hmtx or
+// vmtx table b with n long metrics. Glyphs after the last long metric share
+// that last metric's advance. The caller must check that n is positive and
+// that b is long enough for glyphID.
+func longMetric(b []byte, glyphID GlyphID, n int) (advance, bearing int) {
+	i, n32 := int32(glyphID), int32(n)
+	if i < n32 {
+		return int(u16(b, 4*i+0)), int(i16(b, 4*i+2))
+	}
+	return int(u16(b, 4*n32-4)), int(i16(b, 4*n32+2*(i-n32)))
+}
+
+// HMetrics are a glyph's horizontal metrics, in font units. Multiply by the
+// Font's Scale to convert to pixels.
+type HMetrics struct {
+	// AdvanceWidth is the distance from this glyph's origin to the next
+	// glyph's origin.
+	AdvanceWidth int
+	// LeftSideBearing is the distance from the glyph's origin to the left
+	// edge of its bounding box.
+	LeftSideBearing int
+}
+
+// HMetrics returns the horizontal metrics for the given glyph ID. A compound
+// glyph with a USE_MY_METRICS component has that component's metrics.
+//
+// For variable fonts, the metrics vary with the HVAR table's deltas or,
+// failing that, with the glyph's gvar deltas.
+func (f *Font) HMetrics(glyphID GlyphID) (HMetrics, error) {
+	if int(glyphID) >= f.maxp.numGlyphs() {
+		return HMetrics{}, ErrInvalidGlyph{fmt.Sprintf("glyph ID %d is out of range", glyphID)}
+	}
+	// The component with the metrics can itself be a compound glyph. If they
+	// nest too deeply, or form a cycle, the components' metrics are ignored.
+	for id, depth := glyphID, 0; ; depth++ {
+		sub, ok := f.metricsComponent(id)
+		if !ok {
+			glyphID = id
+			break
+		}
+		if depth == maxComponentDepth {
+			break
+		}
+		id = sub
+	}
+	// validate checked that the hmtx table is long enough for every glyph ID
+	// less than numGlyphs.
+	m := f.hmtx.hMetrics(glyphID, f.hhea.numberOfHMetrics())
+	if f.coords == nil {
+		return m, nil
+	}
+	switch {
+	case f.hvar != nil:
+		m.AdvanceWidth += int(math.Round(float64(f.hvar.advanceDelta(glyphID, f.coords))))
+		if d, ok := f.hvar.lsbDelta(glyphID, f.coords); ok {
+			m.LeftSideBearing += int(math.Round(float64(d)))
+		}
+	case f.gvar != nil && f.cff == nil:
+		// The advance width is the distance between the phantom points of
+		// the glyph's origin and advance.
+		b, err := f.glyfData(glyphID)
+		if err != nil {
+			return HMetrics{}, err
+		}
+		g, phantom, err := f.varyGlyph(glyphID, b, nil, &compoundWalk{})
+		if err != nil {
+			return HMetrics{}, err
+		}
+		origin := int(math.Round(float64(phantom[0].x)))
+		xMin, _, _, _ := g.bounds()
+		m.AdvanceWidth = int(math.Round(float64(phantom[1].x))) - origin
+		m.LeftSideBearing = xMin - origin
+	}
+	return m, nil
+}
+
+// metricsComponent returns the component of a compound TrueType glyph with
+// the USE_MY_METRICS flag, if any. Malformed glyph data is left for Glyph and
+// Outline to report.
+func (f *Font) metricsComponent(glyphID GlyphID) (GlyphID, bool) {
+	if f.cff != nil {
+		return 0, false
+	}
+	b, err := f.glyfData(glyphID)
+	if err != nil {
+		return 0, false
+	}
+	for g := b.glyphIter(); g.compoundGlyph() && g.nextSubGlyph(); {
+		if g.subFlags&flagUseMyMetrics != 0 {
+			return g.subGlyphID, int(g.subGlyphID) < f.maxp.numGlyphs()
+		}
+	}
+	return 0, false
+}
+
+// LineMetrics are a font's metrics for laying out lines of horizontal text,
+// in pixels.
+type LineMetrics struct {
+	// Ascent is the distance from the baseline to the top of a line.
+	Ascent float32
+	// Descent is the distance from the baseline to the bottom of a line. It
+	// is positive for a bottom below the baseline, unlike the hhea table's
+	// descender.
+	Descent float32
+	// LineGap is the extra space between the bottom of one line and the top
+	// of the next.
+	LineGap float32
+}
+
+// LineMetrics returns the font's line metrics at the given pixels per em.
+func (f *Font) LineMetrics(ppem float32) LineMetrics {
+	scale := f.Scale(ppem)
+	return LineMetrics{
+		Ascent:  scale * float32(+f.hhea.ascender()),
+		Descent: scale * float32(-f.hhea.descender()),
+		LineGap: scale * float32(f.hhea.lineGap()),
+	}
+}
+
+// VMetrics are a glyph's vertical metrics, in font units. Multiply by the
+// Font's Scale to convert to pixels.
+type VMetrics struct {
+	// AdvanceHeight is the distance from this glyph's vertical origin to the
+	// next glyph's vertical origin, downwards.
+	AdvanceHeight int
+	// TopSideBearing is the distance from the glyph's vertical origin down
+	// to the top edge of its bounding box.
+	TopSideBearing int
+}
+
+// VMetrics returns the vertical metrics for the given glyph ID, for laying out
+// vertical text.
+//
+// If the font has no vhea and vmtx tables, the metrics are synthesized from
+// the OS/2 table's typographic ascender and descender, or failing that, from
+// the hhea table's: every glyph's advance height is the ascender minus the
+// descender, and its vertical origin is at the ascender.
+func (f *Font) VMetrics(glyphID GlyphID) (VMetrics, error) {
+	if f.vhea != nil {
+		if int(glyphID) >= f.maxp.numGlyphs() {
+			return VMetrics{}, ErrInvalidGlyph{fmt.Sprintf("glyph ID %d is out of range", glyphID)}
+		}
+		// validate checked that the vmtx table is long enough for every
+		// glyph ID less than numGlyphs.
+		return f.vmtx.vMetrics(glyphID, f.vhea.numOfLongVerMetrics()), nil
+	}
+
+	g, err := f.Glyph(glyphID)
+	if err != nil {
+		return VMetrics{}, err
+	}
+	ascender, descender, ok := f.os2.typoAscenderDescender()
+	if !ok {
+		ascender, descender = f.hhea.ascender(), f.hhea.descender()
+	}
+	m := VMetrics{AdvanceHeight: ascender - descender}
+	if g != nil {
+		_, _, _, yMax := g.bounds()
+		m.TopSideBearing = ascender - yMax
+	}
+	return m, nil
+}
+
+// VerticalSizeAndTransform is like Glyph.SizeAndTransform, for vertical text.
+// It also returns the pixel coordinates that the glyph's vertical origin maps
+// to, so that the rasterized glyph should be drawn with that point at the pen
+// position.
+//
+// The vertical origin is horizontally centered on the glyph's advance width,
+// and is TopSideBearing above the top of the glyph's bounding box.
+func (f *Font) VerticalSizeAndTransform(glyphID GlyphID, scale float32) (width, height int, origin image.Point, t f32.Aff3, err error) {
+	g, err := f.Glyph(glyphID)
+	if err != nil {
+		return 0, 0, image.Point{}, f32.Aff3{}, err
+	}
+	if g == nil {
+		return 0, 0, image.Point{}, f32.Aff3{}, nil
+	}
+	hm, err := f.HMetrics(glyphID)
+	if err != nil {
+		return 0, 0, image.Point{}, f32.Aff3{}, err
+	}
+	vm, err := f.VMetrics(glyphID)
+	if err != nil {
+		return 0, 0, image.Point{}, f32.Aff3{}, err
+	}
+
+	xMin, yMin, xMax, yMax := g.bounds()
+	s := float64(scale)
+	ox := float64(hm.AdvanceWidth) / 2
+	oy := float64(yMax + vm.TopSideBearing)
+	bbox := image.Rectangle{
+		Min: image.Point{
+			X: int(math.Floor(+s * (float64(xMin) - ox))),
+			Y: int(math.Floor(-s * (float64(yMax) - oy))),
+		},
+		Max: image.Point{
+			X: int(math.Ceil(+s * (float64(xMax) - ox))),
+			Y: int(math.Ceil(-s * (float64(yMin) - oy))),
+		},
+	}
+	return bbox.Dx(), bbox.Dy(), image.Point{-bbox.Min.X, -bbox.Min.Y}, f32.Aff3{
+		+scale, 0, float32(-s*ox) - float32(bbox.Min.X),
+		0, -scale, float32(+s*oy) - float32(bbox.Min.Y),
+	}, nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"errors"
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestHMetrics(t *testing.T) {
+	f := testFont(t)
+	// There are only three long metrics, so the fourth glyph re-uses the last
+	// advance width, and its left side bearing comes from the short array.
+	want := []HMetrics{
+		{AdvanceWidth: 500, LeftSideBearing: 0},
+		{AdvanceWidth: 600, LeftSideBearing: 100},
+		{AdvanceWidth: 700, LeftSideBearing: 100},
+		{AdvanceWidth: 700, LeftSideBearing: 0},
+	}
+	for i, w := range want {
+		got, err := f.HMetrics(GlyphID(i))
+		if err != nil {
+			t.Errorf("glyphID=%d: %v", i, err)
+			continue
+		}
+		if got != w {
+			t.Errorf("glyphID=%d: got %+v, want %+v", i, got, w)
+		}
+	}
+
+	if _, err := f.HMetrics(GlyphID(len(want))); !errors.Is(err, ErrInvalidFont) {
+		t.Errorf("out of range glyph ID: got %v, want an error matching ErrInvalidFont", err)
+	}
+}
+
+func TestHMetricsShortArray(t *testing.T) {
+	m := testTables()
+	// Use a single long metric, so that only glyph 0's metrics are long.
+	m["hhea"][35] = 1
+	m["hmtx"] = cat(be16(900), be16(-5), be16(11), be16(-22), be16(33))
+	f, err := Parse(buildFont(m))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	for i, lsb := range []int{-5, 11, -22, 33} {
+		got, err := f.HMetrics(GlyphID(i))
+		if err != nil {
+			t.Errorf("glyphID=%d: %v", i, err)
+			continue
+		}
+		if want := (HMetrics{AdvanceWidth: 900, LeftSideBearing: lsb}); got != want {
+			t.Errorf("glyphID=%d: got %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+func TestLineMetrics(t *testing.T) {
+	m := testTables()
+	copy(m["hhea"][8:], be16(90))
+	f, err := Parse(buildFont(m))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	// The font's units per em is 1000, with an ascender of 800, a descender
+	// of -200 and a line gap of 90.
+	got := f.LineMetrics(50)
+	want := LineMetrics{Ascent: 40, Descent: 10, LineGap: 4.5}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if s := f.Scale(50); got.Ascent != s*800 {
+		t.Errorf("Ascent: got %v, want %v, consistent with Scale", got.Ascent, s*800)
+	}
+}
+
+func TestVMetrics(t *testing.T) {
+	// The square and diamond glyphs both have a yMax of 400.
+	testCases := []struct {
+		desc   string
+		modify func(m map[string][]byte)
+		want   []VMetrics
+	}{{
+		desc: "vhea and vmtx",
+		modify: func(m map[string][]byte) {
+			m["vhea"] = cat(be32(0x00011000), be16(500), be16(-500), make([]byte, 26), be16(2))
+			m["vmtx"] = cat(be16(1000), be16(0), be16(1100), be16(50), be16(60), be16(70))
+		},
+		want: []VMetrics{{1000, 0}, {1100, 50}, {1100, 60}, {1100, 70}},
+	}, {
+		desc: "OS/2 fallback",
+		modify: func(m map[string][]byte) {
+			m["OS/2"] = cat(make([]byte, 68), be16(880), be16(-120), make([]byte, 4))
+		},
+		want: []VMetrics{{1000, 0}, {1000, 480}, {1000, 480}, {1000, 0}},
+	}, {
+		desc:   "hhea fallback",
+		modify: func(m map[string][]byte) {},
+		want:   []VMetrics{{1000, 0}, {1000, 400}, {1000, 400}, {1000, 0}},
+	}}
+
+	for _, tc := range testCases {
+		m := testTables()
+		tc.modify(m)
+		f, err := Parse(buildFont(m))
+		if err != nil {
+			t.Errorf("%s: Parse: %v", tc.desc, err)
+			continue
+		}
+		for i, want := range tc.want {
+			got, err := f.VMetrics(GlyphID(i))
+			if err != nil {
+				t.Errorf("%s: glyphID=%d: %v", tc.desc, i, err)
+				continue
+			}
+			if got != want {
+				t.Errorf("%s: glyphID=%d: got %+v, want %+v", tc.desc, i, got, want)
+			}
+		}
+	}
+}
+
+func TestParseVheaErrors(t *testing.T) {
+	m := testTables()
+	m["vhea"] = cat(be32(0x00011000), make([]byte, 30), be16(1))
+	if _, err := Parse(buildFont(m)); err != (ErrMissingTable{Tag: MakeTag("vmtx")}) {
+		t.Errorf("missing vmtx: got %v", err)
+	}
+	m["vmtx"] = cat(be16(1000), be16(0), be16(0))
+	want := ErrTableTooShort{Tag: MakeTag("vmtx"), Length: 6, MinLength: 10}
+	if _, err := Parse(buildFont(m)); err != want {
+		t.Errorf("short vmtx: got %v, want %v", err, want)
+	}
+}
+
+func TestVerticalSizeAndTransform(t *testing.T) {
+	f := testFont(t)
+	// The square, glyph 1, spans x in [100, 500] and y in [0, 400], and has an
+	// advance width of 600. Its vertical origin, from the hhea fallback, is at
+	// (300, 800) in font units. At a scale of 1/4, the square is 100 pixels
+	// wide and tall, with its top-left corner 50 pixels left of and 100
+	// pixels below the origin.
+	w, h, origin, transform, err := f.VerticalSizeAndTransform(1, 0.25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w != 100 || h != 100 {
+		t.Errorf("size: got %dx%d, want 100x100", w, h)
+	}
+	if want := image.Pt(50, -100); origin != want {
+		t.Errorf("origin: got %v, want %v", origin, want)
+	}
+	var r recorder
+	g, _ := f.Glyph(1)
+	if err := f.Outline(&r, g, transform); err != nil {
+		t.Fatal(err)
+	}
+	want := "M 0 100, L 0 0, L 100 0, L 100 100, L 0 100"
+	if got := strings.Join(r, ", "); got != want {
+		t.Errorf("outline: got %q, want %q", got, want)
+	}
+}
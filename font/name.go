@@ -0,0 +1,279 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// NameID identifies a string in the name table, such as the family name.
+type NameID uint16
+
+// Name IDs defined by the OpenType specification.
+const (
+	NameCopyright                  NameID = 0
+	NameFamily                     NameID = 1
+	NameSubfamily                  NameID = 2
+	NameUniqueID                   NameID = 3
+	NameFull                       NameID = 4
+	NameVersion                    NameID = 5
+	NamePostScript                 NameID = 6
+	NameTrademark                  NameID = 7
+	NameManufacturer               NameID = 8
+	NameDesigner                   NameID = 9
+	NameDescription                NameID = 10
+	NameVendorURL                  NameID = 11
+	NameDesignerURL                NameID = 12
+	NameLicense                    NameID = 13
+	NameLicenseURL                 NameID = 14
+	NameTypographicFamily          NameID = 16
+	NameTypographicSubfamily       NameID = 17
+	NameCompatibleFull             NameID = 18
+	NameSampleText                 NameID = 19
+	NamePostScriptCID              NameID = 20
+	NameWWSFamily                  NameID = 21
+	NameWWSSubfamily               NameID = 22
+	NameLightBackgroundPalette     NameID = 23
+	NameDarkBackgroundPalette      NameID = 24
+	NameVariationsPostScriptPrefix NameID = 25
+)
+
+// name is the naming table.
+type name []byte
+
+// parseName parses the header of the name table b.
+func parseName(b []byte) (name, error) {
+	if len(b) < 6 {
+		return nil, ErrTableTooShort{Tag: MakeTag("name"), Length: len(b), MinLength: 6}
+	}
+	format := u16(b, 0)
+	if format > 1 {
+		return nil, ErrUnsupportedFormat{Tag: MakeTag("name"), Format: uint32(format)}
+	}
+	n := name(b)
+	if want := n.langTagRecords(); len(b) < want {
+		return nil, ErrTableTooShort{Tag: MakeTag("name"), Length: len(b), MinLength: want}
+	}
+	if format == 1 {
+		if want := n.langTagRecords() + 2 + 4*n.langTagCount(); len(b) < want {
+			return nil, ErrTableTooShort{Tag: MakeTag("name"), Length: len(b), MinLength: want}
+		}
+	}
+	if int(u16(b, 4)) > len(b) {
+		return nil, ErrInvalidTable{Tag: MakeTag("name"), Reason: fmt.Sprintf("storage offset %d is out of bounds", u16(b, 4))}
+	}
+	return n, nil
+}
+
+func (b name) count() int { return int(u16(b, 2)) }
+
+// langTagRecords returns the offset of the langTagCount field of a format 1
+// table, which follows the name records.
+func (b name) langTagRecords() int { return 6 + 12*b.count() }
+
+func (b name) langTagCount() int {
+	if u16(b, 0) != 1 {
+		return 0
+	}
+	return int(u16(b, int32(b.langTagRecords())))
+}
+
+// str returns the string data at the offset, relative to the storage area,
+// and length, or nil if it is out of bounds.
+func (b name) str(offset, length int) []byte {
+	start := int(u16(b, 4)) + offset
+	if start+length > len(b) {
+		return nil
+	}
+	return b[start : start+length]
+}
+
+// language returns the BCP 47 language tag of a name record's platform and
+// language IDs, or "" if it is unknown.
+func (b name) language(platformID, languageID uint16) string {
+	if languageID >= 0x8000 {
+		// Format 1 tables have language tags for language IDs from 0x8000.
+		i := int(languageID) - 0x8000
+		if i >= b.langTagCount() {
+			return ""
+		}
+		rec := int32(b.langTagRecords() + 2 + 4*i)
+		s, ok := decodeUTF16(b.str(int(u16(b, rec+2)), int(u16(b, rec))))
+		if !ok {
+			return ""
+		}
+		return s
+	}
+	switch platformID {
+	case platformMacintosh:
+		if int(languageID) < len(macLanguages) {
+			return macLanguages[languageID]
+		}
+	case platformMicrosoft:
+		if s, ok := windowsLanguages[languageID]; ok {
+			return s
+		}
+		return windowsLanguages[languageID&0x3ff]
+	}
+	return ""
+}
+
+// Name returns the string with the given name ID, such as NameFamily, in the
+// language given by the BCP 47 tag lang, such as "en" or "de-CH". If there is
+// no string in that language, it returns the string in the same language but
+// a different region, or failing that in English, or failing that the first
+// string with the name ID. It returns false if the font has no such string.
+//
+// Strings are decoded from UTF-16 for the Unicode and Windows platforms, and
+// from Mac Roman for the Macintosh platform. Other encodings are not
+// supported.
+func (f *Font) Name(id NameID, lang string) (string, bool) {
+	b := f.name
+	if b == nil {
+		return "", false
+	}
+	lang = strings.ToLower(lang)
+	primary := lang
+	if i := strings.IndexByte(lang, '-'); i >= 0 {
+		primary = lang[:i]
+	}
+
+	// Of the strings with the name ID, pick the best match for the language,
+	// then for the platform.
+	const (
+		matchAny = iota
+		matchEnglish
+		matchPrimary
+		matchExact
+	)
+	var best []byte
+	bestMatch, bestPlatform, bestMac := -1, -1, false
+	for i, n := 0, b.count(); i < n; i++ {
+		rec := int32(6 + 12*i)
+		if NameID(u16(b, rec+6)) != id {
+			continue
+		}
+		platformID, encodingID := u16(b, rec), u16(b, rec+2)
+		var platform int
+		switch {
+		case platformID == platformMicrosoft && (encodingID == encodingMicrosoftSymbol || encodingID == encodingMicrosoftBMP || encodingID == encodingMicrosoftUCS4):
+			platform = 2
+		case platformID == platformUnicode:
+			platform = 1
+		case platformID == platformMacintosh && encodingID == encodingMacintoshRoman:
+			platform = 0
+		default:
+			continue
+		}
+		s := b.str(int(u16(b, rec+10)), int(u16(b, rec+8)))
+		if s == nil {
+			continue
+		}
+
+		match := matchAny
+		switch l := strings.ToLower(b.language(platformID, u16(b, rec+4))); {
+		case l == "":
+		case l == lang:
+			match = matchExact
+		case strings.HasPrefix(l, primary) && (len(l) == len(primary) || l[len(primary)] == '-'):
+			match = matchPrimary
+		case l == "en" || strings.HasPrefix(l, "en-"):
+			match = matchEnglish
+		}
+		if match > bestMatch || (match == bestMatch && platform > bestPlatform) {
+			best, bestMatch, bestPlatform, bestMac = s, match, platform, platformID == platformMacintosh
+		}
+	}
+	if best == nil {
+		return "", false
+	}
+	if bestMac {
+		return decodeMacRoman(best), true
+	}
+	return decodeUTF16(best)
+}
+
+// decodeUTF16 decodes UTF-16BE data. It returns false for data of an odd
+// length.
+func decodeUTF16(b []byte) (string, bool) {
+	if len(b)%2 != 0 {
+		return "", false
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(u)), true
+}
+
+// decodeMacRoman decodes Mac Roman data.
+func decodeMacRoman(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		if c < 0x80 {
+			r[i] = rune(c)
+		} else {
+			r[i] = macRoman[c-0x80]
+		}
+	}
+	return string(r)
+}
+
+// macRoman is the upper half of the Mac Roman character set. 0xca is a
+// no-break space and 0xf0 is the Apple logo, in the Unicode private use area.
+var macRoman = []rune("" +
+	"ÄÅÇÉÑÖÜáàâäãåçéè" +
+	"êëíìîïñóòôöõúùûü" +
+	"†°¢£§•¶ß®©™´¨≠ÆØ" +
+	"∞±≤≥¥µ∂∑∏π∫ªºΩæø" +
+	"¿¡¬√ƒ≈∆«»…\u00a0ÀÃÕŒœ" +
+	"–—“”‘’÷◊ÿŸ⁄€‹›ﬁﬂ" +
+	"‡·‚„‰ÂÊÁËÈÍÎÏÌÓÔ" +
+	"\uf8ffÒÚÛÙıˆ˜¯˘˙˚¸˝˛ˇ")
+
+// macLanguages are the BCP 47 language tags of the Macintosh platform's
+// language IDs.
+var macLanguages = []string{
+	"en", "fr", "de", "it", "nl", "sv", "es", "da", "pt", "no",
+	"he", "ja", "ar", "fi", "el", "is", "mt", "tr", "hr", "zh-Hant",
+	"ur", "hi", "th", "ko", "lt", "pl", "hu", "et", "lv", "se",
+	"fo", "fa", "ru", "zh-Hans", "nl-BE", "ga", "sq", "ro", "cs", "sk",
+	"sl", "yi", "sr", "mk", "bg", "uk", "be", "uz", "kk", "az-Cyrl",
+}
+
+// windowsLanguages are the BCP 47 language tags of the Windows platform's
+// language IDs. The tags of whole IDs, with a sub-language, take precedence
+// over those of the low 10 bits, the primary language.
+var windowsLanguages = map[uint16]string{
+	0x01: "ar", 0x02: "bg", 0x03: "ca", 0x04: "zh", 0x05: "cs",
+	0x06: "da", 0x07: "de", 0x08: "el", 0x09: "en", 0x0a: "es",
+	0x0b: "fi", 0x0c: "fr", 0x0d: "he", 0x0e: "hu", 0x0f: "is",
+	0x10: "it", 0x11: "ja", 0x12: "ko", 0x13: "nl", 0x14: "no",
+	0x15: "pl", 0x16: "pt", 0x18: "ro", 0x19: "ru", 0x1a: "hr",
+	0x1b: "sk", 0x1c: "sq", 0x1d: "sv", 0x1e: "th", 0x1f: "tr",
+	0x20: "ur", 0x21: "id", 0x22: "uk", 0x23: "be", 0x24: "sl",
+	0x25: "et", 0x26: "lv", 0x27: "lt", 0x29: "fa", 0x2a: "vi",
+	0x2b: "hy", 0x2d: "eu", 0x2f: "mk", 0x36: "af", 0x37: "ka",
+	0x39: "hi", 0x3e: "ms", 0x41: "sw", 0x45: "bn", 0x49: "ta",
+
+	0x0404: "zh-TW", 0x0804: "zh-CN", 0x0c04: "zh-HK", 0x1004: "zh-SG",
+	0x0409: "en-US", 0x0809: "en-GB", 0x0c09: "en-AU", 0x1009: "en-CA",
+	0x0407: "de-DE", 0x0807: "de-CH", 0x0c07: "de-AT",
+	0x040c: "fr-FR", 0x080c: "fr-BE", 0x0c0c: "fr-CA", 0x100c: "fr-CH",
+	0x0416: "pt-BR", 0x0816: "pt-PT",
+	0x040a: "es-ES", 0x080a: "es-MX", 0x0c0a: "es-ES",
+}
@@ -0,0 +1,156 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"errors"
+	"testing"
+	"unicode/utf16"
+)
+
+func utf16BE(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, be16(int(u))...)
+	}
+	return b
+}
+
+type testNameRecord struct {
+	platform, encoding, language int
+	id                           NameID
+	data                         []byte
+}
+
+// buildName returns a name table with the records, which must be sorted. It
+// is a format 1 table if there are language tags.
+func buildName(records []testNameRecord, langTags ...string) []byte {
+	format := 0
+	if len(langTags) > 0 {
+		format = 1
+	}
+	headerLen := 6 + 12*len(records)
+	if format == 1 {
+		headerLen += 2 + 4*len(langTags)
+	}
+	header := cat(be16(format), be16(len(records)), be16(headerLen))
+	var storage []byte
+	for _, r := range records {
+		header = append(header, cat(be16(r.platform), be16(r.encoding), be16(r.language), be16(int(r.id)),
+			be16(len(r.data)), be16(len(storage)))...)
+		storage = append(storage, r.data...)
+	}
+	if format == 1 {
+		header = append(header, be16(len(langTags))...)
+		for _, tag := range langTags {
+			data := utf16BE(tag)
+			header = append(header, cat(be16(len(data)), be16(len(storage)))...)
+			storage = append(storage, data...)
+		}
+	}
+	return cat(header, storage)
+}
+
+func TestName(t *testing.T) {
+	m := testTables()
+	m["name"] = buildName([]testNameRecord{
+		{platformMacintosh, encodingMacintoshRoman, 0, NameFamily, []byte("Caf\x8e Mac")},
+		{platformMacintosh, encodingMacintoshRoman, 2, NameFamily, []byte("Mac Deutsch")},
+		{platformMacintosh, 1, 0, NameSubfamily, []byte("Japanese")},
+		{platformMacintosh, encodingMacintoshRoman, 0, NameFull, []byte("Mac Full")},
+		{platformMicrosoft, encodingMicrosoftBMP, 0x0407, NameFamily, utf16BE("Schrift")},
+		{platformMicrosoft, encodingMicrosoftBMP, 0x0409, NameFamily, utf16BE("Café 𝔉ont")},
+		{platformMicrosoft, encodingMicrosoftBMP, 0x0411, NameFamily, utf16BE("フォント")},
+		{platformMicrosoft, encodingMicrosoftBMP, 0x0809, NameFamily, utf16BE("Font GB")},
+		{platformMicrosoft, encodingMicrosoftBMP, 0x8000, NameFamily, utf16BE("Font Tagged")},
+		{platformMicrosoft, encodingMicrosoftBMP, 0x0409, NameVersion, []byte("odd")},
+		{platformMicrosoft, encodingMicrosoftBMP, 0x0409, NameLicense, []byte{}},
+	}, "x-tagged")
+	f, err := Parse(buildFont(m))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	testCases := []struct {
+		id     NameID
+		lang   string
+		want   string
+		wantOK bool
+	}{
+		{NameFamily, "", "Café 𝔉ont", true},
+		{NameFamily, "en-US", "Café 𝔉ont", true},
+		{NameFamily, "EN-gb", "Font GB", true},
+		{NameFamily, "en-AU", "Café 𝔉ont", true},
+		// The Macintosh string's language is exactly "de", but the Windows
+		// string's is "de-DE". For other regions, Windows strings win.
+		{NameFamily, "de", "Mac Deutsch", true},
+		{NameFamily, "de-DE", "Schrift", true},
+		{NameFamily, "de-CH", "Schrift", true},
+		{NameFamily, "ja", "フォント", true},
+		{NameFamily, "fr", "Café 𝔉ont", true},
+		{NameFamily, "x-tagged", "Font Tagged", true},
+		// Only the Macintosh platform has the full name, in Mac Roman.
+		{NameFull, "de", "Mac Full", true},
+		// Mac Roman is the only supported Macintosh encoding.
+		{NameSubfamily, "", "", false},
+		// UTF-16 data must have an even length.
+		{NameVersion, "", "", false},
+		{NameLicense, "", "", true},
+		{NameDesigner, "", "", false},
+	}
+	for _, tc := range testCases {
+		got, ok := f.Name(tc.id, tc.lang)
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("Name(%d, %q): got %q, %t, want %q, %t", tc.id, tc.lang, got, ok, tc.want, tc.wantOK)
+		}
+	}
+
+	m["name"] = buildName([]testNameRecord{
+		{platformMacintosh, encodingMacintoshRoman, 0, NameFamily, []byte("Caf\x8e \xf0\xca")},
+	})
+	if f, err = Parse(buildFont(m)); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got, want := decodeMacRoman([]byte("Caf\x8e \xf0\xca")), "Café \uf8ff\u00a0"; got != want {
+		t.Errorf("decodeMacRoman: got %q, want %q", got, want)
+	}
+	if got, _ := f.Name(NameFamily, "en"); got != "Café \uf8ff\u00a0" {
+		t.Errorf("Mac Roman: got %q, want %q", got, "Café \uf8ff\u00a0")
+	}
+
+	if _, ok := testFont(t).Name(NameFamily, ""); ok {
+		t.Errorf("no name table: got ok, want !ok")
+	}
+}
+
+func TestParseNameErrors(t *testing.T) {
+	testCases := []struct {
+		desc string
+		name []byte
+	}{
+		{"too short", be16(0)},
+		{"unsupported format", cat(be16(2), be16(0), be16(6))},
+		{"truncated records", cat(be16(0), be16(2), be16(30), make([]byte, 12))},
+		{"truncated language tags", cat(be16(1), be16(0), be16(10), be16(2))},
+		{"storage offset out of bounds", cat(be16(0), be16(0), be16(100))},
+	}
+	for _, tc := range testCases {
+		m := testTables()
+		m["name"] = tc.name
+		if _, err := Parse(buildFont(m)); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an error matching ErrInvalidFont", tc.desc, err)
+		}
+	}
+}
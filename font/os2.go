@@ -0,0 +1,171 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+// Embedding permission bits of OS2.FSType. A zero FSType is installable
+// embedding, the least restrictive.
+const (
+	FSTypeRestrictedLicense = 0x0002
+	FSTypePreviewAndPrint   = 0x0004
+	FSTypeEditable          = 0x0008
+	FSTypeNoSubsetting      = 0x0100
+	FSTypeBitmapOnly        = 0x0200
+)
+
+// Bits of OS2.FSSelection.
+const (
+	FSSelectionItalic         = 0x0001
+	FSSelectionUnderscore     = 0x0002
+	FSSelectionNegative       = 0x0004
+	FSSelectionOutlined       = 0x0008
+	FSSelectionStrikeout      = 0x0010
+	FSSelectionBold           = 0x0020
+	FSSelectionRegular        = 0x0040
+	FSSelectionUseTypoMetrics = 0x0080
+	FSSelectionWWS            = 0x0100
+	FSSelectionOblique        = 0x0200
+)
+
+// OS2 is the OS/2 and Windows metrics table. Metrics are in font units.
+// Fields that the table's version does not have are zero.
+type OS2 struct {
+	Version       int
+	XAvgCharWidth int
+	// WeightClass is the visual weight, from 1 to 1000, such as 400 for
+	// regular and 700 for bold.
+	WeightClass int
+	// WidthClass is the relative width, from 1 (ultra-condensed) to 9
+	// (ultra-expanded), with 5 for normal.
+	WidthClass int
+	// FSType is the font's embedding permissions, a combination of the
+	// FSType bits.
+	FSType uint16
+
+	SubscriptXSize     int
+	SubscriptYSize     int
+	SubscriptXOffset   int
+	SubscriptYOffset   int
+	SuperscriptXSize   int
+	SuperscriptYSize   int
+	SuperscriptXOffset int
+	SuperscriptYOffset int
+	StrikeoutSize      int
+	StrikeoutPosition  int
+
+	FamilyClass  int
+	Panose       [10]byte
+	UnicodeRange [4]uint32
+	VendorID     Tag
+	// FSSelection is a combination of the FSSelection bits.
+	FSSelection    uint16
+	FirstCharIndex rune
+	LastCharIndex  rune
+
+	TypoAscender  int
+	TypoDescender int
+	TypoLineGap   int
+	WinAscent     int
+	WinDescent    int
+
+	// CodePageRange is in version 1 and later.
+	CodePageRange [2]uint32
+
+	// XHeight, CapHeight, DefaultChar, BreakChar and MaxContext are in
+	// version 2 and later.
+	XHeight     int
+	CapHeight   int
+	DefaultChar rune
+	BreakChar   rune
+	MaxContext  int
+
+	// LowerOpticalPointSize and UpperOpticalPointSize, in twentieths of a
+	// point, are in version 5 and later.
+	LowerOpticalPointSize int
+	UpperOpticalPointSize int
+}
+
+// os2Len returns the length of the OS/2 table for the version.
+func os2Len(version int) int {
+	switch {
+	case version >= 5:
+		return 100
+	case version >= 2:
+		return 96
+	case version == 1:
+		return 86
+	}
+	return 78
+}
+
+// OS2 returns the font's OS/2 table. It returns false if the font has no OS/2
+// table. For tables that are shorter than their version requires, the missing
+// fields are zero.
+func (f *Font) OS2() (OS2, bool) {
+	if f.os2 == nil {
+		return OS2{}, false
+	}
+	version := int(u16(f.os2, 0))
+	// Copy the table, to the length of its version, so that fields past its
+	// end read as zero.
+	b := make([]byte, os2Len(version))
+	copy(b, f.os2)
+
+	o := OS2{
+		Version:            version,
+		XAvgCharWidth:      int(i16(b, 2)),
+		WeightClass:        int(u16(b, 4)),
+		WidthClass:         int(u16(b, 6)),
+		FSType:             u16(b, 8),
+		SubscriptXSize:     int(i16(b, 10)),
+		SubscriptYSize:     int(i16(b, 12)),
+		SubscriptXOffset:   int(i16(b, 14)),
+		SubscriptYOffset:   int(i16(b, 16)),
+		SuperscriptXSize:   int(i16(b, 18)),
+		SuperscriptYSize:   int(i16(b, 20)),
+		SuperscriptXOffset: int(i16(b, 22)),
+		SuperscriptYOffset: int(i16(b, 24)),
+		StrikeoutSize:      int(i16(b, 26)),
+		StrikeoutPosition:  int(i16(b, 28)),
+		FamilyClass:        int(i16(b, 30)),
+		VendorID:           Tag(u32(b, 58)),
+		FSSelection:        u16(b, 62),
+		FirstCharIndex:     rune(u16(b, 64)),
+		LastCharIndex:      rune(u16(b, 66)),
+		TypoAscender:       int(i16(b, 68)),
+		TypoDescender:      int(i16(b, 70)),
+		TypoLineGap:        int(i16(b, 72)),
+		WinAscent:          int(u16(b, 74)),
+		WinDescent:         int(u16(b, 76)),
+	}
+	copy(o.Panose[:], b[32:42])
+	for i := range o.UnicodeRange {
+		o.UnicodeRange[i] = u32(b, int32(42+4*i))
+	}
+	if version >= 1 {
+		o.CodePageRange = [2]uint32{u32(b, 78), u32(b, 82)}
+	}
+	if version >= 2 {
+		o.XHeight = int(i16(b, 86))
+		o.CapHeight = int(i16(b, 88))
+		o.DefaultChar = rune(u16(b, 90))
+		o.BreakChar = rune(u16(b, 92))
+		o.MaxContext = int(u16(b, 94))
+	}
+	if version >= 5 {
+		o.LowerOpticalPointSize = int(u16(b, 96))
+		o.UpperOpticalPointSize = int(u16(b, 98))
+	}
+	return o, true
+}
@@ -0,0 +1,108 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"reflect"
+	"testing"
+)
+
+// buildOS2 returns a version 5 OS/2 table, truncated to length n.
+func buildOS2(n int) []byte {
+	b := cat(
+		be16(5), be16(550), be16(700), be16(3), be16(FSTypeEditable|FSTypeNoSubsetting),
+		be16(650), be16(600), be16(0), be16(75), be16(650), be16(600), be16(0), be16(350),
+		be16(50), be16(250), be16(0x0801),
+		[]byte{2, 11, 6, 3, 5, 4, 2, 2, 2, 4},
+		be32(1), be32(2), be32(3), be32(4),
+		[]byte("GOOG"), be16(FSSelectionBold|FSSelectionUseTypoMetrics), be16(0x20), be16(0xfffd),
+		be16(800), be16(-200), be16(100), be16(900), be16(300),
+		be32(0x1), []byte{0x80, 0, 0, 0},
+		be16(500), be16(700), be16(0), be16(0x20), be16(3),
+		be16(160), be16(1440),
+	)
+	return b[:n]
+}
+
+func TestOS2(t *testing.T) {
+	v0 := OS2{
+		Version:            5,
+		XAvgCharWidth:      550,
+		WeightClass:        700,
+		WidthClass:         3,
+		FSType:             FSTypeEditable | FSTypeNoSubsetting,
+		SubscriptXSize:     650,
+		SubscriptYSize:     600,
+		SubscriptYOffset:   75,
+		SuperscriptXSize:   650,
+		SuperscriptYSize:   600,
+		SuperscriptYOffset: 350,
+		StrikeoutSize:      50,
+		StrikeoutPosition:  250,
+		FamilyClass:        0x0801,
+		Panose:             [10]byte{2, 11, 6, 3, 5, 4, 2, 2, 2, 4},
+		UnicodeRange:       [4]uint32{1, 2, 3, 4},
+		VendorID:           MakeTag("GOOG"),
+		FSSelection:        FSSelectionBold | FSSelectionUseTypoMetrics,
+		FirstCharIndex:     0x20,
+		LastCharIndex:      0xfffd,
+		TypoAscender:       800,
+		TypoDescender:      -200,
+		TypoLineGap:        100,
+		WinAscent:          900,
+		WinDescent:         300,
+	}
+	v1 := v0
+	v1.CodePageRange = [2]uint32{0x1, 0x80000000}
+	v2 := v1
+	v2.XHeight, v2.CapHeight, v2.BreakChar, v2.MaxContext = 500, 700, 0x20, 3
+	v5 := v2
+	v5.LowerOpticalPointSize, v5.UpperOpticalPointSize = 160, 1440
+
+	testCases := []struct {
+		desc    string
+		version int
+		n       int
+		want    OS2
+	}{
+		{"version 5", 5, 100, v5},
+		{"version 4", 4, 96, v2},
+		{"version 1", 1, 86, v1},
+		{"version 0", 0, 78, v0},
+		{"truncated version 0", 0, 74, v0},
+		{"version 5 truncated to version 2", 5, 96, v2},
+	}
+	for _, tc := range testCases {
+		m := testTables()
+		m["OS/2"] = cat(be16(tc.version), buildOS2(tc.n)[2:])
+		f, err := Parse(buildFont(m))
+		if err != nil {
+			t.Fatalf("%s: Parse: %v", tc.desc, err)
+		}
+		want := tc.want
+		want.Version = tc.version
+		if tc.n < 78 {
+			want.WinAscent, want.WinDescent = 0, 0
+		}
+		got, ok := f.OS2()
+		if !ok || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s:\ngot  %+v, %t\nwant %+v", tc.desc, got, ok, want)
+		}
+	}
+
+	if _, ok := testFont(t).OS2(); ok {
+		t.Errorf("no OS/2 table: got ok, want !ok")
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"fmt"
+	"math"
+
+	"golang.org/x/image/math/f32"
+)
+
+// Pather is a sink for the segments of a glyph's outline, such as a
+// rasterizer. Every contour starts with a MoveTo, and ends with a LineTo,
+// QuadTo or CubeTo back to that contour's first point.
+//
+// TrueType outlines have only quadratic curves, and CFF outlines have only
+// cubic curves.
+type Pather interface {
+	// MoveTo starts a new contour at p.
+	MoveTo(p f32.Vec2)
+	// LineTo adds a straight line to p.
+	LineTo(p f32.Vec2)
+	// QuadTo adds a quadratic Bézier curve, with control point p, to q.
+	QuadTo(p, q f32.Vec2)
+	// CubeTo adds a cubic Bézier curve, with control points p and q, to r.
+	CubeTo(p, q, r f32.Vec2)
+}
+
+// Outline sends the glyph's outline, after applying the transform, to dst.
+// SizeAndTransform gives a suitable transform for rasterization.
+//
+// If the glyph data is malformed, Outline returns an error, and dst may have
+// received some but not all of the outline's segments.
+func (f *Font) Outline(dst Pather, b Glyph, transform f32.Aff3) error {
+	if f.cff != nil {
+		return f.cff.outline(dst, b, &transform, f.coords)
+	}
+	return f.outline(dst, b, transform, []GlyphID{unknownGlyphID}, &compoundWalk{})
+}
+
+const (
+	// maxComponentDepth is the maximum nesting depth of compound glyphs,
+	// counting the outermost one. The maxp table's maxComponentDepth is not
+	// used, as fonts do not always set it correctly.
+	maxComponentDepth = 16
+	// maxComponents and maxComponentPoints aren't part of the spec. They are
+	// sanity checks on the number of sub-glyphs, and of their points, that
+	// one call to Outline or Glyph visits. Compound glyphs can share
+	// sub-glyphs without forming a cycle, so that the number of sub-glyphs
+	// grows exponentially with the depth, and point matching and varied
+	// compound glyphs visit some sub-glyphs more than once.
+	maxComponents      = 1 << 12
+	maxComponentPoints = 1 << 20
+)
+
+// unknownGlyphID stands for the glyph passed to Outline, whose glyph ID is not
+// known, at the start of a compound glyph path. It is not a valid glyph ID, as
+// a font has at most 0xffff glyphs.
+const unknownGlyphID GlyphID = 0xffff
+
+// compoundWalk counts the sub-glyphs, and their points, visited by one call to
+// Outline or Glyph.
+type compoundWalk struct {
+	components int
+	points     int
+}
+
+// componentPath returns path, the glyph IDs of a compound glyph and the
+// compound glyphs that it is a sub-glyph of, followed by its sub-glyph's ID.
+// It returns an error if the compound glyphs nest too deeply, if the sub-glyph
+// is one of them, or if the walk has visited too many sub-glyphs.
+func (w *compoundWalk) componentPath(path []GlyphID, subGlyphID GlyphID) ([]GlyphID, error) {
+	if len(path) >= maxComponentDepth {
+		return nil, ErrInvalidGlyph{fmt.Sprintf("compound glyphs are nested more than %d deep", maxComponentDepth)}
+	}
+	for _, id := range path {
+		if id == subGlyphID {
+			return nil, ErrInvalidGlyph{fmt.Sprintf("glyph ID %d is a sub-glyph of itself", subGlyphID)}
+		}
+	}
+	if w.components++; w.components > maxComponents {
+		return nil, ErrInvalidGlyph{fmt.Sprintf("compound glyph has more than %d sub-glyphs", maxComponents)}
+	}
+	return append(path[:len(path):len(path)], subGlyphID), nil
+}
+
+// addPoints counts the points of the simple glyph b, before they are visited.
+// It returns an error if the walk has visited too many points.
+func (w *compoundWalk) addPoints(b Glyph) error {
+	if len(b) < minGlyphDataLen {
+		return nil
+	}
+	nContours := int32(i16(b, 0))
+	if nContours <= 0 || len(b) < initialIndex+2*int(nContours) {
+		// glyphIter reports any error.
+		return nil
+	}
+	w.points += 1 + int(u16(b, initialIndex+2*nContours-2))
+	if w.points > maxComponentPoints {
+		return ErrInvalidGlyph{fmt.Sprintf("compound glyph has more than %d points", maxComponentPoints)}
+	}
+	return nil
+}
+
+// outline is like Outline, for a TrueType glyph. The glyph IDs of b and the
+// compound glyphs that it is a sub-glyph of are path, and w counts the
+// sub-glyphs visited so far.
+func (f *Font) outline(dst Pather, b Glyph, transform f32.Aff3, path []GlyphID, w *compoundWalk) error {
+	g := b.glyphIter()
+	if g.compoundGlyph() {
+		// Point matching sub-glyphs are positioned relative to the points of
+		// the previous sub-glyphs.
+		var pts []point
+		matching := g.pointMatching()
+		for g.nextSubGlyph() {
+			subPath, err := w.componentPath(path, g.subGlyphID)
+			if err != nil {
+				return err
+			}
+			sub, err := f.glyph(g.subGlyphID, path, w)
+			if err != nil {
+				return err
+			}
+			m, err := f.subTransform(&g, sub, pts, subPath, w)
+			if err != nil {
+				return err
+			}
+			if matching {
+				if pts, err = f.glyphPoints(pts, sub, &m, subPath, w); err != nil {
+					return err
+				}
+			}
+			subTransform := concat(&transform, &m)
+			if g.subFlags&(flagArgsAreXYValues|flagRoundXYToGrid) == flagArgsAreXYValues|flagRoundXYToGrid {
+				// Round the offset, after transformation, to whole pixels.
+				dx := transform[0]*m[2] + transform[1]*m[5]
+				dy := transform[3]*m[2] + transform[4]*m[5]
+				subTransform[2] += float32(math.Round(float64(dx))) - dx
+				subTransform[5] += float32(math.Round(float64(dy))) - dy
+			}
+			if err := f.outline(dst, sub, subTransform, subPath, w); err != nil {
+				return err
+			}
+		}
+		return g.err
+	}
+
+	if err := w.addPoints(b); err != nil {
+		return err
+	}
+	for g.nextContour() {
+		for g.nextSegment() {
+			switch g.seg.op {
+			case moveTo:
+				dst.MoveTo(mul(&transform, g.seg.p))
+			case lineTo:
+				dst.LineTo(mul(&transform, g.seg.p))
+			case quadTo:
+				dst.QuadTo(mul(&transform, g.seg.p), mul(&transform, g.seg.q))
+			}
+		}
+	}
+	return g.err
+}
+
+// subTransform returns the transform of the compound glyph iterator's current
+// sub-glyph, sub. A point matching sub-glyph is offset so that its point
+// coincides with the compound glyph's point, of pts, the points of the
+// previous sub-glyphs. The glyph IDs of sub and the compound glyphs that it is
+// a sub-glyph of are subPath, and w counts the sub-glyphs visited so far.
+func (f *Font) subTransform(g *glyphIter, sub Glyph, pts []point, subPath []GlyphID, w *compoundWalk) (f32.Aff3, error) {
+	m := g.subTransform
+	if g.subFlags&flagArgsAreXYValues != 0 {
+		return m, nil
+	}
+	subPts, err := f.glyphPoints(nil, sub, &m, subPath, w)
+	if err != nil {
+		return f32.Aff3{}, err
+	}
+	i, j := g.subArgs[0], g.subArgs[1]
+	if i >= len(pts) || j >= len(subPts) {
+		return f32.Aff3{}, ErrInvalidGlyph{fmt.Sprintf("matched points %d and %d are out of range", i, j)}
+	}
+	m[2] = pts[i].x - subPts[j].x
+	m[5] = pts[i].y - subPts[j].y
+	return m, nil
+}
+
+// glyphPoints appends the points of the TrueType glyph b, after applying the
+// transform, to dst. A compound glyph's points are those of its sub-glyphs, in
+// order. The glyph IDs of b and the compound glyphs that it is a sub-glyph of
+// are path, and w counts the sub-glyphs visited so far.
+func (f *Font) glyphPoints(dst []point, b Glyph, transform *f32.Aff3, path []GlyphID, w *compoundWalk) ([]point, error) {
+	g := b.glyphIter()
+	if g.compoundGlyph() {
+		var pts []point
+		for g.nextSubGlyph() {
+			subPath, err := w.componentPath(path, g.subGlyphID)
+			if err != nil {
+				return nil, err
+			}
+			sub, err := f.glyph(g.subGlyphID, path, w)
+			if err != nil {
+				return nil, err
+			}
+			m, err := f.subTransform(&g, sub, pts, subPath, w)
+			if err != nil {
+				return nil, err
+			}
+			if pts, err = f.glyphPoints(pts, sub, &m, subPath, w); err != nil {
+				return nil, err
+			}
+		}
+		for _, p := range pts {
+			v := mul(transform, p)
+			dst = append(dst, point{v[0], v[1]})
+		}
+		return dst, g.err
+	}
+
+	if err := w.addPoints(b); err != nil {
+		return nil, err
+	}
+	for g.nextContour() {
+		for g.nextPoint() {
+			v := mul(transform, point{float32(g.x), float32(g.y)})
+			dst = append(dst, point{v[0], v[1]})
+		}
+	}
+	return dst, g.err
+}
+
+func concat(a, b *f32.Aff3) f32.Aff3 {
+	return f32.Aff3{
+		a[0]*b[0] + a[1]*b[3],
+		a[0]*b[1] + a[1]*b[4],
+		a[0]*b[2] + a[1]*b[5] + a[2],
+		a[3]*b[0] + a[4]*b[3],
+		a[3]*b[1] + a[4]*b[4],
+		a[3]*b[2] + a[4]*b[5] + a[5],
+	}
+}
+
+type op uint8
+
+const (
+	moveTo op = 0
+	lineTo op = 1
+	quadTo op = 2
+	cubeTo op = 3
+)
+
+type point struct {
+	x, y float32
+}
+
+func midPoint(p, q point) point {
+	return point{
+		x: (p.x + q.x) * 0.5,
+		y: (p.y + q.y) * 0.5,
+	}
+}
+
+func mul(m *f32.Aff3, p point) f32.Vec2 {
+	return f32.Vec2{
+		m[0]*p.x + m[1]*p.y + m[2],
+		m[3]*p.x + m[4]*p.y + m[5],
+	}
+}
+
+// segment is a path segment. Its op determines how many of its points are
+// used: one for moveTo and lineTo, two for quadTo and three for cubeTo.
+type segment struct {
+	op      op
+	p, q, r point
+}
@@ -0,0 +1,150 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"fmt"
+	"strings"
+)
+
+const postLen = 32
+
+// post is the PostScript table, with the offsets of the glyph name strings of
+// a format 2 table.
+type post struct {
+	data []byte
+	// names are the offsets, in data, of the Pascal strings of the glyph names
+	// that are not standard Macintosh glyph names.
+	names []int32
+}
+
+// parsePost parses the post table b. A format 2 table's names are checked to
+// be within the table, but glyph name indices that refer to missing names
+// are not errors, as such names are simply not available.
+func parsePost(b []byte) (post, error) {
+	if len(b) < postLen {
+		return post{}, ErrTableTooShort{Tag: MakeTag("post"), Length: len(b), MinLength: postLen}
+	}
+	p := post{data: b}
+	if u32(b, 0) != 0x00020000 {
+		return p, nil
+	}
+	if len(b) < postLen+2 {
+		return post{}, ErrTableTooShort{Tag: MakeTag("post"), Length: len(b), MinLength: postLen + 2}
+	}
+	n := int(u16(b, postLen))
+	offset := postLen + 2 + 2*n
+	if len(b) < offset {
+		return post{}, ErrTableTooShort{Tag: MakeTag("post"), Length: len(b), MinLength: offset}
+	}
+	for offset < len(b) {
+		length := int(b[offset])
+		if offset+1+length > len(b) {
+			return post{}, ErrInvalidTable{Tag: MakeTag("post"), Reason: fmt.Sprintf("glyph name %d is out of bounds", len(p.names))}
+		}
+		p.names = append(p.names, int32(offset))
+		offset += 1 + length
+	}
+	return p, nil
+}
+
+// Post is the font's PostScript information, from the post table. Metrics are
+// in font units.
+type Post struct {
+	// ItalicAngle is the angle, in degrees counterclockwise from vertical, of
+	// upright strokes. It is negative for fonts that slant to the right.
+	ItalicAngle float32
+	// UnderlinePosition is the distance from the baseline to the top of the
+	// underline. It is negative for underlines below the baseline.
+	UnderlinePosition  int
+	UnderlineThickness int
+	IsFixedPitch       bool
+}
+
+// Post returns the font's PostScript information. It returns false if the
+// font has no post table.
+func (f *Font) Post() (Post, bool) {
+	b := f.post.data
+	if b == nil {
+		return Post{}, false
+	}
+	return Post{
+		ItalicAngle:        float32(int32(u32(b, 4))) / (1 << 16),
+		UnderlinePosition:  int(i16(b, 8)),
+		UnderlineThickness: int(i16(b, 10)),
+		IsFixedPitch:       u32(b, 12) != 0,
+	}, true
+}
+
+// GlyphName returns the PostScript name of the glyph, such as "Aacute" or
+// "uni0301", from a format 1 or format 2 post table. It returns false if the
+// font has no name for the glyph.
+func (f *Font) GlyphName(glyphID GlyphID) (string, bool) {
+	b := f.post.data
+	if b == nil {
+		return "", false
+	}
+	switch u32(b, 0) {
+	case 0x00010000:
+		if int(glyphID) < len(macGlyphNames) {
+			return macGlyphNames[glyphID], true
+		}
+	case 0x00020000:
+		if int(glyphID) >= int(u16(b, postLen)) {
+			return "", false
+		}
+		i := int(u16(b, postLen+2+2*int32(glyphID)))
+		if i < len(macGlyphNames) {
+			return macGlyphNames[i], true
+		}
+		if i -= len(macGlyphNames); i < len(f.post.names) {
+			offset := f.post.names[i]
+			return string(b[offset+1 : offset+1+int32(b[offset])]), true
+		}
+	}
+	return "", false
+}
+
+// macGlyphNames are the names of the 258 glyphs of the standard Macintosh
+// character set, which format 1 and format 2 post tables refer to by index.
+var macGlyphNames = strings.Fields(`
+	.notdef .null nonmarkingreturn space exclam quotedbl numbersign dollar
+	percent ampersand quotesingle parenleft parenright asterisk plus comma
+	hyphen period slash zero one two three four five six seven eight nine
+	colon semicolon less equal greater question at
+	A B C D E F G H I J K L M N O P Q R S T U V W X Y Z
+	bracketleft backslash bracketright asciicircum underscore grave
+	a b c d e f g h i j k l m n o p q r s t u v w x y z
+	braceleft bar braceright asciitilde Adieresis Aring Ccedilla Eacute Ntilde
+	Odieresis Udieresis aacute agrave acircumflex adieresis atilde aring
+	ccedilla eacute egrave ecircumflex edieresis iacute igrave icircumflex
+	idieresis ntilde oacute ograve ocircumflex odieresis otilde uacute ugrave
+	ucircumflex udieresis dagger degree cent sterling section bullet paragraph
+	germandbls registered copyright trademark acute dieresis notequal AE Oslash
+	infinity plusminus lessequal greaterequal yen mu partialdiff summation
+	product pi integral ordfeminine ordmasculine Omega ae oslash questiondown
+	exclamdown logicalnot radical florin approxequal Delta guillemotleft
+	guillemotright ellipsis nonbreakingspace Agrave Atilde Otilde OE oe endash
+	emdash quotedblleft quotedblright quoteleft quoteright divide lozenge
+	ydieresis Ydieresis fraction currency guilsinglleft guilsinglright fi fl
+	daggerdbl periodcentered quotesinglbase quotedblbase perthousand
+	Acircumflex Ecircumflex Aacute Edieresis Egrave Iacute Icircumflex
+	Idieresis Igrave Oacute Ocircumflex apple Ograve Uacute Ucircumflex Ugrave
+	dotlessi circumflex tilde macron breve dotaccent ring cedilla hungarumlaut
+	ogonek caron Lslash lslash Scaron scaron Zcaron zcaron brokenbar Eth eth
+	Yacute yacute Thorn thorn minus multiply onesuperior twosuperior
+	threesuperior onehalf onequarter threequarters franc Gbreve gbreve
+	Idotaccent Scedilla scedilla Cacute cacute Ccaron ccaron dcroat
+`)
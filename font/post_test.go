@@ -0,0 +1,115 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"errors"
+	"testing"
+)
+
+// buildPost returns a post table of the given version, whose italic angle is
+// -12.5 degrees and whose underline is 100 units below the baseline and 50
+// units thick. A version 2 table has the glyph name indices and names.
+func buildPost(version int, indices []int, names ...string) []byte {
+	b := cat(be32(version), be32(-12<<16-1<<15), be16(-100), be16(50), be32(1), make([]byte, 16))
+	if version != 0x00020000 {
+		return b
+	}
+	b = append(b, be16(len(indices))...)
+	for _, i := range indices {
+		b = append(b, be16(i)...)
+	}
+	for _, n := range names {
+		b = append(b, byte(len(n)))
+		b = append(b, n...)
+	}
+	return b
+}
+
+func TestPost(t *testing.T) {
+	m := testTables()
+	m["post"] = buildPost(0x00030000, nil)
+	f, err := Parse(buildFont(m))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	got, ok := f.Post()
+	if want := (Post{ItalicAngle: -12.5, UnderlinePosition: -100, UnderlineThickness: 50, IsFixedPitch: true}); !ok || got != want {
+		t.Errorf("got %+v, %t, want %+v", got, ok, want)
+	}
+	if _, ok := testFont(t).Post(); ok {
+		t.Errorf("no post table: got ok, want !ok")
+	}
+}
+
+func TestGlyphName(t *testing.T) {
+	testCases := []struct {
+		desc string
+		post []byte
+		want []string
+	}{{
+		desc: "format 1",
+		post: buildPost(0x00010000, nil),
+		want: []string{".notdef", ".null", "nonmarkingreturn", "space"},
+	}, {
+		desc: "format 2",
+		post: buildPost(0x00020000, []int{0, 258, 257, 260}, "uni0301", "a.alt"),
+		want: []string{".notdef", "uni0301", "dcroat", ""},
+	}, {
+		desc: "format 2 with fewer glyphs",
+		post: buildPost(0x00020000, []int{3, 68}),
+		want: []string{"space", "a", "", ""},
+	}, {
+		desc: "format 3",
+		post: buildPost(0x00030000, nil),
+		want: []string{"", "", "", ""},
+	}}
+	for _, tc := range testCases {
+		m := testTables()
+		m["post"] = tc.post
+		f, err := Parse(buildFont(m))
+		if err != nil {
+			t.Fatalf("%s: Parse: %v", tc.desc, err)
+		}
+		for i, want := range tc.want {
+			if got, ok := f.GlyphName(GlyphID(i)); got != want || ok != (want != "") {
+				t.Errorf("%s: glyph %d: got %q, %t, want %q", tc.desc, i, got, ok, want)
+			}
+		}
+	}
+
+	if _, ok := testFont(t).GlyphName(0); ok {
+		t.Errorf("no post table: got ok, want !ok")
+	}
+}
+
+func TestParsePostErrors(t *testing.T) {
+	testCases := []struct {
+		desc string
+		post []byte
+	}{
+		{"too short", make([]byte, 31)},
+		{"format 2 without glyph count", buildPost(0x00020000, nil)[:32]},
+		{"format 2 truncated indices", buildPost(0x00020000, []int{0, 1, 2})[:38]},
+		{"format 2 truncated name", buildPost(0x00020000, []int{258}, "uni0301")[:40]},
+	}
+	for _, tc := range testCases {
+		m := testTables()
+		m["post"] = tc.post
+		if _, err := Parse(buildFont(m)); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an error matching ErrInvalidFont", tc.desc, err)
+		}
+	}
+}
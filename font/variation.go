@@ -0,0 +1,238 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import "fmt"
+
+// f2dot14 converts a 2.14 fixed point number to a float32.
+func f2dot14(x int16) float32 { return float32(x) / (1 << 14) }
+
+// itemVariationStore is an ItemVariationStore, which holds the deltas of
+// values that vary with the font's variation coordinates, such as GDEF caret
+// positions. Deltas are addressed by an outer index, selecting an
+// ItemVariationData subtable, and an inner index, selecting a row within it.
+type itemVariationStore otData
+
+// delta returns the sum of the deltas of the (outer, inner) row, each scaled
+// by how much its region applies at the normalized coordinates.
+func (s itemVariationStore) delta(outer, inner int, coords []float32) float32 {
+	b := otData(s)
+	if len(coords) == 0 || b.u16(0) != 1 || outer >= int(b.u16(6)) {
+		return 0
+	}
+	regions, data := b.offset32(2), b.offset32(8+4*outer)
+	nItems, wordCount, nRegions := int(data.u16(0)), int(data.u16(2)), int(data.u16(4))
+	if inner >= nItems {
+		return 0
+	}
+	// With the long words flag, the word deltas are 32-bit and the others
+	// 16-bit, and otherwise they are 16-bit and 8-bit.
+	longWords := wordCount&0x8000 != 0
+	wordCount &= 0x7fff
+	wordSize := 2
+	if longWords {
+		wordSize = 4
+	}
+	rowLen := wordCount*wordSize + (nRegions-wordCount)*wordSize/2
+	row := 6 + 2*nRegions + inner*rowLen
+	if row+rowLen > len(data) {
+		return 0
+	}
+
+	var sum float32
+	for k, off := 0, row; k < nRegions; k++ {
+		size := wordSize
+		if k >= wordCount {
+			size /= 2
+		}
+		var d int32
+		switch size {
+		case 1:
+			d = int32(int8(data[off]))
+		case 2:
+			d = int32(data.i16(off))
+		case 4:
+			d = int32(data.u32(off))
+		}
+		off += size
+		if d == 0 {
+			continue
+		}
+		sum += float32(d) * regionScalar(regions, int(data.u16(6+2*k)), coords)
+	}
+	return sum
+}
+
+// regionScalar returns how much the region with index i, of the
+// VariationRegionList b, applies at the normalized coordinates: the product
+// of the region's tent functions along each axis.
+func regionScalar(b otData, i int, coords []float32) float32 {
+	nAxes, nRegions := int(b.u16(0)), int(b.u16(2))
+	if i >= nRegions {
+		return 0
+	}
+	scalar := float32(1)
+	for a := 0; a < nAxes; a++ {
+		rec := 4 + 6*(nAxes*i+a)
+		var c float32
+		if a < len(coords) {
+			c = coords[a]
+		}
+		scalar *= axisScalar(c, f2dot14(b.i16(rec)), f2dot14(b.i16(rec+2)), f2dot14(b.i16(rec+4)))
+		if scalar == 0 {
+			return 0
+		}
+	}
+	return scalar
+}
+
+// axisScalar returns how much a tent function, rising from start to its peak
+// and falling to end, applies at the normalized coordinate c. Tents with a
+// zero peak, or an invalid range, apply everywhere.
+func axisScalar(c, start, peak, end float32) float32 {
+	switch {
+	case peak == 0 || start > peak || peak > end || (start < 0 && end > 0):
+		return 1
+	case c < start || c > end:
+		return 0
+	case c == peak:
+		return 1
+	case c < peak:
+		return (c - start) / (peak - start)
+	}
+	return (end - c) / (end - peak)
+}
+
+// regionScalars appends to dst how much each region of the outer'th
+// ItemVariationData subtable applies at the normalized coordinates, as
+// regionScalar does. It returns false if there is no such subtable.
+func (s itemVariationStore) regionScalars(dst []float32, outer int, coords []float32) ([]float32, bool) {
+	b := otData(s)
+	if b.u16(0) != 1 || outer < 0 || outer >= int(b.u16(6)) {
+		return dst, false
+	}
+	regions, data := b.offset32(2), b.offset32(8+4*outer)
+	nRegions := int(data.u16(4))
+	if 6+2*nRegions > len(data) {
+		return dst, false
+	}
+	for k := 0; k < nRegions; k++ {
+		dst = append(dst, regionScalar(regions, int(data.u16(6+2*k)), coords))
+	}
+	return dst, true
+}
+
+// noVariationIndex is the outer and inner index that a DeltaSetIndexMap maps
+// values that do not vary to.
+const noVariationIndex = 0xffff
+
+// deltaSetIndexMap is a DeltaSetIndexMap, which maps glyph IDs to the outer
+// and inner indexes of their rows in an ItemVariationStore.
+type deltaSetIndexMap otData
+
+// get returns the outer and inner index of the i'th value. Without a map,
+// the outer index is zero and the inner index is i. Indexes past the end of
+// the map use its last entry.
+func (m deltaSetIndexMap) get(i int) (outer, inner int) {
+	b := otData(m)
+	if b == nil {
+		return 0, i
+	}
+	format, entryFormat := b.u16(0)>>8, int(b.u16(0)&0xff)
+	n, start := int(b.u16(2)), 4
+	if format == 1 {
+		n, start = int(b.u32(2)), 6
+	}
+	if n == 0 {
+		return noVariationIndex, noVariationIndex
+	}
+	if i >= n {
+		i = n - 1
+	}
+	// The entries are 1 to 4 bytes, with the inner index in their low 1 to
+	// 16 bits.
+	size, innerBits := 1+entryFormat>>4&3, 1+entryFormat&0xf
+	entry := 0
+	for j := start + i*size; j < start+(i+1)*size; j++ {
+		if j >= len(b) {
+			return noVariationIndex, noVariationIndex
+		}
+		entry = entry<<8 | int(b[j])
+	}
+	return entry >> innerBits, entry & (1<<innerBits - 1)
+}
+
+// hvar is the horizontal metrics variations table.
+type hvar struct {
+	varStore itemVariationStore
+	// advances and lsbs map glyph IDs to the rows of their advance width
+	// and left side bearing deltas. A nil advances maps glyph IDs directly,
+	// and a nil lsbs means that left side bearings do not vary.
+	advances deltaSetIndexMap
+	lsbs     deltaSetIndexMap
+}
+
+// parseHVAR parses the HVAR table b.
+func parseHVAR(b []byte) (*hvar, error) {
+	const hvarLen = 20
+	if len(b) < hvarLen {
+		return nil, ErrTableTooShort{Tag: MakeTag("HVAR"), Length: len(b), MinLength: hvarLen}
+	}
+	if major := u16(b, 0); major != 1 {
+		return nil, ErrUnsupportedFormat{Tag: MakeTag("HVAR"), Format: uint32(major)}
+	}
+	var varStore, advances, lsbs otData
+	for _, x := range []struct {
+		dst  *otData
+		i    int
+		name string
+	}{
+		{&varStore, 4, "item variation store"},
+		{&advances, 8, "advance width mapping"},
+		{&lsbs, 12, "left side bearing mapping"},
+	} {
+		*x.dst = otData(b).offset32(x.i)
+		if *x.dst == nil && u32(b, int32(x.i)) != 0 {
+			return nil, ErrInvalidTable{Tag: MakeTag("HVAR"), Reason: fmt.Sprintf("%s offset is out of bounds", x.name)}
+		}
+	}
+	if varStore == nil {
+		return nil, ErrInvalidTable{Tag: MakeTag("HVAR"), Reason: "no item variation store"}
+	}
+	h := &hvar{
+		varStore: itemVariationStore(varStore),
+		advances: deltaSetIndexMap(advances),
+		lsbs:     deltaSetIndexMap(lsbs),
+	}
+	return h, nil
+}
+
+// advanceDelta returns the delta of the glyph's advance width at the
+// normalized coordinates.
+func (h *hvar) advanceDelta(glyphID GlyphID, coords []float32) float32 {
+	outer, inner := h.advances.get(int(glyphID))
+	return h.varStore.delta(outer, inner, coords)
+}
+
+// lsbDelta returns the delta of the glyph's left side bearing at the
+// normalized coordinates, and whether the table has left side bearing
+// deltas.
+func (h *hvar) lsbDelta(glyphID GlyphID, coords []float32) (float32, bool) {
+	if h.lsbs == nil {
+		return 0, false
+	}
+	outer, inner := h.lsbs.get(int(glyphID))
+	return h.varStore.delta(outer, inner, coords), true
+}
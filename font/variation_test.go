@@ -0,0 +1,216 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func beF2Dot14(x float32) []byte { return be16(int(math.Round(float64(x) * (1 << 14)))) }
+
+// testRegion is a variation region: the start, peak and end coordinates for
+// each axis.
+type testRegion [][3]float32
+
+// testVarData is an ItemVariationData subtable. The first wordCount deltas of
+// each row are 16-bit, or 32-bit if long is true, and the others are 8-bit, or
+// 16-bit if long is true.
+type testVarData struct {
+	regions   []int
+	wordCount int
+	long      bool
+	rows      [][]int
+}
+
+// buildItemVariationStore returns an ItemVariationStore table.
+func buildItemVariationStore(regions []testRegion, data ...testVarData) []byte {
+	nAxes := 0
+	if len(regions) > 0 {
+		nAxes = len(regions[0])
+	}
+	regionList := cat(be16(nAxes), be16(len(regions)))
+	for _, r := range regions {
+		for _, axis := range r {
+			regionList = append(regionList, cat(beF2Dot14(axis[0]), beF2Dot14(axis[1]), beF2Dot14(axis[2]))...)
+		}
+	}
+
+	fields := []interface{}{be16(1), off32(regionList), be16(len(data))}
+	for _, d := range data {
+		wordCount := d.wordCount
+		if d.long {
+			wordCount |= 0x8000
+		}
+		b := cat(be16(len(d.rows)), be16(wordCount), be16(len(d.regions)))
+		for _, r := range d.regions {
+			b = append(b, be16(r)...)
+		}
+		for _, row := range d.rows {
+			for k, x := range row {
+				switch {
+				case k < d.wordCount && d.long:
+					b = append(b, be32(x)...)
+				case k < d.wordCount || d.long:
+					b = append(b, be16(x)...)
+				default:
+					b = append(b, byte(int8(x)))
+				}
+			}
+		}
+		fields = append(fields, off32(b))
+	}
+	return buildTable(fields...)
+}
+
+func TestItemVariationStore(t *testing.T) {
+	s := itemVariationStore(buildItemVariationStore(
+		[]testRegion{
+			{{0, 1, 1}, {0, 0, 0}},
+			{{0, 0, 0}, {-1, -1, 0}},
+			{{0, 0.5, 1}, {0, 1, 1}},
+		},
+		testVarData{regions: []int{0, 1, 2}, wordCount: 1, rows: [][]int{{1000, -20, 100}, {0, 10, 0}}},
+		testVarData{regions: []int{2, 0}, wordCount: 1, long: true, rows: [][]int{{100000, -300}}},
+	))
+	testCases := []struct {
+		outer, inner int
+		coords       []float32
+		want         float32
+	}{
+		{0, 0, nil, 0},
+		{0, 0, []float32{1, 0}, 1000},
+		{0, 0, []float32{0.5, 0}, 500},
+		{0, 0, []float32{-0.5, 0}, 0},
+		{0, 0, []float32{0, -0.25}, -5},
+		// The third region peaks at (0.5, 1), and ends at 1 on the first
+		// axis.
+		{0, 0, []float32{0.5, 1}, 500 + 100},
+		{0, 0, []float32{0.75, 1}, 750 + 50},
+		{0, 0, []float32{0.75, 0.5}, 750 + 25},
+		{0, 1, []float32{0, -1}, 10},
+		{0, 2, []float32{1, 0}, 0},
+		// Missing coordinates are zero.
+		{0, 0, []float32{1}, 1000},
+		{1, 0, []float32{0.5, 1}, 100000 - 150},
+		{2, 0, []float32{1, 1}, 0},
+	}
+	for _, tc := range testCases {
+		if got := s.delta(tc.outer, tc.inner, tc.coords); got != tc.want {
+			t.Errorf("delta(%d, %d, %v): got %v, want %v", tc.outer, tc.inner, tc.coords, got, tc.want)
+		}
+	}
+}
+
+func TestDeltaSetIndexMap(t *testing.T) {
+	testCases := []struct {
+		desc string
+		m    deltaSetIndexMap
+		want [][2]int
+	}{
+		{"nil", nil, [][2]int{{0, 0}, {0, 1}, {0, 2}}},
+		// Each entry is 2 bytes, with a 4-bit inner index.
+		{"format 0", deltaSetIndexMap(cat([]byte{0, 0x13}, be16(2), be16(0x0025), be16(0x0100))),
+			[][2]int{{2, 5}, {16, 0}, {16, 0}}},
+		// Each entry is 1 byte, with a 1-bit inner index.
+		{"format 1", deltaSetIndexMap(cat([]byte{1, 0x00}, be32(2), []byte{0x03, 0x02})),
+			[][2]int{{1, 1}, {1, 0}, {1, 0}}},
+		{"empty", deltaSetIndexMap(cat([]byte{0, 0x00}, be16(0))),
+			[][2]int{{noVariationIndex, noVariationIndex}, {noVariationIndex, noVariationIndex}}},
+		{"truncated", deltaSetIndexMap(cat([]byte{0, 0x10}, be16(2), be16(0x0003), []byte{0})),
+			[][2]int{{1, 1}, {noVariationIndex, noVariationIndex}}},
+	}
+	for _, tc := range testCases {
+		for i, want := range tc.want {
+			if outer, inner := tc.m.get(i); outer != want[0] || inner != want[1] {
+				t.Errorf("%s: get(%d): got (%d, %d), want (%d, %d)", tc.desc, i, outer, inner, want[0], want[1])
+			}
+		}
+	}
+}
+
+// buildHVAR returns an HVAR table whose advance widths and left side
+// bearings vary on a single axis, with a peak at 1:
+//
+//   - Glyph 0's advance width does not vary.
+//   - Glyph 1's advance width is 20 more, and its left side bearing is 30
+//     less.
+//   - Glyph 2 and later glyphs' advance widths are 100 more, and their left
+//     side bearings are also 30 less.
+//
+// It has left side bearing deltas if withLSB is true.
+func buildHVAR(withLSB bool) []byte {
+	store := buildItemVariationStore(
+		[]testRegion{{{0, 1, 1}}},
+		testVarData{regions: []int{0}, rows: [][]int{{0}, {20}, {-30}}},
+		testVarData{regions: []int{0}, rows: [][]int{{100}}},
+	)
+	advances := cat([]byte{0, 0x10}, be16(3), be16(0x0000), be16(0x0001), be16(0x0002))
+	var lsbs off32
+	if withLSB {
+		lsbs = cat([]byte{1, 0x01}, be32(2), []byte{0x00, 0x02})
+	}
+	return buildTable(be16(1), be16(0), off32(store), off32(advances), lsbs, off32(nil))
+}
+
+func TestHVAR(t *testing.T) {
+	testCases := []struct {
+		withLSB bool
+		wght    float32
+		want    []HMetrics
+	}{
+		{true, 400, []HMetrics{{500, 0}, {600, 100}, {700, 100}, {700, 0}}},
+		{true, 900, []HMetrics{{500, 0}, {620, 70}, {800, 70}, {800, -30}}},
+		{true, 650, []HMetrics{{500, 0}, {610, 85}, {750, 85}, {750, -15}}},
+		{false, 900, []HMetrics{{500, 0}, {620, 100}, {800, 100}, {800, 0}}},
+	}
+	for _, tc := range testCases {
+		tables := testTables()
+		tables["HVAR"] = buildHVAR(tc.withLSB)
+		f := testVariableFont(t, tables)
+		f.SetVariation(map[Tag]float32{MakeTag("wght"): tc.wght})
+		for i, want := range tc.want {
+			got, err := f.HMetrics(GlyphID(i))
+			if err != nil {
+				t.Errorf("withLSB=%t, wght=%v, glyphID=%d: %v", tc.withLSB, tc.wght, i, err)
+				continue
+			}
+			if got != want {
+				t.Errorf("withLSB=%t, wght=%v, glyphID=%d: got %v, want %v", tc.withLSB, tc.wght, i, got, want)
+			}
+		}
+	}
+}
+
+func TestParseHVARErrors(t *testing.T) {
+	valid := buildHVAR(true)
+	testCases := []struct {
+		desc string
+		b    []byte
+	}{
+		{"short", valid[:19]},
+		{"version", cat(be16(2), valid[2:])},
+		{"no item variation store", cat(valid[:4], be32(0), valid[8:])},
+		{"out of bounds", cat(valid[:8], be32(len(valid)+1), valid[12:])},
+	}
+	for _, tc := range testCases {
+		tables := testTables()
+		tables["HVAR"] = tc.b
+		if _, err := Parse(buildFont(tables)); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an ErrInvalidFont", tc.desc, err)
+		}
+	}
+}
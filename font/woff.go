@@ -0,0 +1,224 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Signatures, the first four bytes, of WOFF and WOFF2 web font files.
+const (
+	woffSignature  = 0x774f4646 // "wOFF".
+	woff2Signature = 0x774f4632 // "wOF2".
+)
+
+const (
+	woffHeaderLen   = 44
+	woffDirEntryLen = 20
+
+	// maxWebFontLen isn't part of the spec. It is a sanity check on the total
+	// length of the decoded tables, as compressed data can otherwise expand
+	// without limit.
+	maxWebFontLen = 128 * 1024 * 1024
+)
+
+// decodeWebFont returns the sfnt data of a WOFF or WOFF2 web font. It returns
+// b unchanged if it is not a web font.
+func decodeWebFont(b []byte) ([]byte, error) {
+	if len(b) < 4 {
+		return b, nil
+	}
+	switch u32(b, 0) {
+	case woffSignature:
+		return decodeWOFF(b)
+	case woff2Signature:
+		return decodeWOFF2(b)
+	}
+	return b, nil
+}
+
+// decodeWOFF decodes a WOFF font, whose tables are each stored either as is
+// or compressed with zlib.
+func decodeWOFF(b []byte) ([]byte, error) {
+	if len(b) < woffHeaderLen {
+		return nil, fmt.Errorf("%w: %d bytes is too short for a WOFF header", ErrInvalidFont, len(b))
+	}
+	flavor := u32(b, 4)
+	if flavor == collectionTag {
+		return nil, ErrUnsupportedFormat{Format: flavor}
+	}
+	n := int(u16(b, 12))
+	if len(b) < woffHeaderLen+n*woffDirEntryLen {
+		return nil, fmt.Errorf("%w: WOFF table directory with %d entries is truncated", ErrInvalidFont, n)
+	}
+
+	tables := make([]sfntTable, n)
+	// total is a uint64 so that it cannot wrap around on 32-bit targets.
+	total := uint64(0)
+	for i := range tables {
+		entry := b[woffHeaderLen+woffDirEntryLen*(i+0) : woffHeaderLen+woffDirEntryLen*(i+1)]
+		tag := Tag(u32(entry, 0))
+		offset, compLength, origLength := u32(entry, 4), u32(entry, 8), u32(entry, 12)
+		if uint64(offset)+uint64(compLength) > uint64(len(b)) {
+			return nil, ErrTableOutOfBounds{Tag: tag, Offset: offset, Length: compLength}
+		}
+		if compLength > origLength {
+			return nil, ErrInvalidTable{Tag: tag, Reason: fmt.Sprintf("WOFF compressed length %d exceeds the original length %d", compLength, origLength)}
+		}
+		if total += uint64(origLength); total > maxWebFontLen {
+			return nil, fmt.Errorf("%w: WOFF tables are too large", ErrInvalidFont)
+		}
+		data := b[offset : offset+compLength]
+		if compLength < origLength {
+			r, err := zlib.NewReader(bytes.NewReader(data))
+			if err == nil {
+				data, err = decompress(r, int(origLength))
+			}
+			if err != nil {
+				return nil, ErrInvalidTable{Tag: tag, Reason: "WOFF table data: " + err.Error()}
+			}
+		}
+		tables[i] = sfntTable{tag: tag, data: data}
+	}
+
+	font := sfntFont{flavor: flavor, tables: make([]int, n)}
+	for i := range font.tables {
+		font.tables[i] = i
+	}
+	return writeSFNT(tables, []sfntFont{font}, false), nil
+}
+
+// decompress returns the n bytes of decompressed data that r produces. It is
+// an error for r to produce more or less than n bytes.
+func decompress(r io.Reader, n int) ([]byte, error) {
+	// Read at most one byte more than expected, so that a compressed stream
+	// that expands too far is detected without decompressing all of it.
+	b, err := io.ReadAll(io.LimitReader(r, int64(n)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != n {
+		return nil, fmt.Errorf("decompressed length is %d, want %d", len(b), n)
+	}
+	return b, nil
+}
+
+// sfntTable is a table of a decoded web font.
+type sfntTable struct {
+	tag  Tag
+	data []byte
+}
+
+// sfntFont is a font of a decoded web font: its sfnt version and the indices
+// of its tables.
+type sfntFont struct {
+	flavor uint32
+	tables []int
+}
+
+// writeSFNT returns the sfnt data of the fonts, whose tables are indices into
+// tables. If collection is true, the data is a font collection, and the fonts
+// share the tables that they have in common. Otherwise, there must be exactly
+// one font.
+func writeSFNT(tables []sfntTable, fonts []sfntFont, collection bool) []byte {
+	headerLen := 0
+	if collection {
+		headerLen = 12 + 4*len(fonts)
+	}
+	dirsLen := 0
+	for _, font := range fonts {
+		dirsLen += 12 + dirEntryLen*len(font.tables)
+	}
+	offsets := make([]int, len(tables))
+	n := headerLen + dirsLen
+	for i, t := range tables {
+		offsets[i] = n
+		n += (len(t.data) + 3) &^ 3
+	}
+
+	b := make([]byte, headerLen, n)
+	if collection {
+		putU32(b[0:], collectionTag)
+		putU32(b[4:], 0x00010000)
+		putU32(b[8:], uint32(len(fonts)))
+	}
+	for i, font := range fonts {
+		if collection {
+			putU32(b[12+4*i:], uint32(len(b)))
+		}
+		indices := append([]int(nil), font.tables...)
+		sort.Slice(indices, func(i, j int) bool { return tables[indices[i]].tag < tables[indices[j]].tag })
+
+		numTables := len(indices)
+		entrySelector := 0
+		for 2<<entrySelector <= numTables {
+			entrySelector++
+		}
+		searchRange := dirEntryLen << entrySelector
+		dir := make([]byte, 12, 12+dirEntryLen*numTables)
+		putU32(dir[0:], font.flavor)
+		putU16(dir[4:], uint16(numTables))
+		putU16(dir[6:], uint16(searchRange))
+		putU16(dir[8:], uint16(entrySelector))
+		putU16(dir[10:], uint16(dirEntryLen*numTables-searchRange))
+		for _, j := range indices {
+			var entry [dirEntryLen]byte
+			putU32(entry[0:], uint32(tables[j].tag))
+			putU32(entry[4:], checksum(tables[j].data))
+			putU32(entry[8:], uint32(offsets[j]))
+			putU32(entry[12:], uint32(len(tables[j].data)))
+			dir = append(dir, entry[:]...)
+		}
+		b = append(b, dir...)
+	}
+	for _, t := range tables {
+		b = append(b, t.data...)
+		for len(b)%4 != 0 {
+			b = append(b, 0)
+		}
+	}
+	return b
+}
+
+// checksum returns the sfnt checksum of a table, the sum of its big-endian
+// uint32 words, with the data padded with zeros to a multiple of four bytes.
+func checksum(b []byte) uint32 {
+	sum := uint32(0)
+	for ; len(b) >= 4; b = b[4:] {
+		sum += u32(b, 0)
+	}
+	if len(b) > 0 {
+		var pad [4]byte
+		copy(pad[:], b)
+		sum += u32(pad[:], 0)
+	}
+	return sum
+}
+
+func putU16(b []byte, v uint16) {
+	b[0] = byte(v >> 8)
+	b[1] = byte(v >> 0)
+}
+
+func putU32(b []byte, v uint32) {
+	b[0] = byte(v >> 24)
+	b[1] = byte(v >> 16)
+	b[2] = byte(v >> 8)
+	b[3] = byte(v >> 0)
+}
@@ -0,0 +1,697 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	woff2HeaderLen = 48
+
+	// woff2GlyfHeaderLen is the length of a transformed glyf table's header,
+	// which is followed by its seven streams.
+	woff2GlyfHeaderLen = 36
+
+	// woff2ArbitraryTag is the known tag index of a table directory entry
+	// whose tag follows its flags.
+	woff2ArbitraryTag = 63
+)
+
+// woff2KnownTags are the tags of the WOFF2 table directory's known tag
+// indices.
+var woff2KnownTags = [woff2ArbitraryTag]string{
+	"cmap", "head", "hhea", "hmtx", "maxp", "name", "OS/2", "post",
+	"cvt ", "fpgm", "glyf", "loca", "prep", "CFF ", "VORG", "EBDT",
+	"EBLC", "gasp", "hdmx", "kern", "LTSH", "PCLT", "VDMX", "vhea",
+	"vmtx", "BASE", "GDEF", "GPOS", "GSUB", "EBSC", "JSTF", "MATH",
+	"CBDT", "CBLC", "COLR", "CPAL", "SVG ", "sbix", "acnt", "avar",
+	"bdat", "bloc", "bsln", "cvar", "fdsc", "feat", "fmtx", "fvar",
+	"gvar", "hsty", "just", "lcar", "mort", "morx", "opbd", "prop",
+	"trak", "Zapf", "Silf", "Glat", "Gloc", "Feat", "Sill",
+}
+
+// woff2Table is an entry of the WOFF2 table directory.
+type woff2Table struct {
+	tag Tag
+	// transform is the table's transformation version. For the glyf and loca
+	// tables, version 0 is the glyf transform and version 3 is the null
+	// transform. For the hmtx table, version 1 is the hmtx transform. For
+	// other tables, version 0 is the null transform.
+	transform  int
+	origLength uint32
+	// length is the length of the table's data in the compressed stream.
+	length uint32
+	// data is the table's data, as stored in the compressed stream, and then
+	// as reconstructed.
+	data []byte
+	// xMins are the glyphs' xMin values of a reconstructed glyf table.
+	xMins []int16
+}
+
+func (t *woff2Table) transformed() bool {
+	switch t.tag {
+	case MakeTag("glyf"), MakeTag("loca"):
+		return t.transform != 3
+	}
+	return t.transform != 0
+}
+
+// decodeWOFF2 decodes a WOFF2 font or font collection, whose tables are
+// compressed together with Brotli, after transforming the glyf, loca and,
+// optionally, hmtx tables to make them more compressible.
+func decodeWOFF2(b []byte) ([]byte, error) {
+	if len(b) < woff2HeaderLen {
+		return nil, fmt.Errorf("%w: %d bytes is too short for a WOFF2 header", ErrInvalidFont, len(b))
+	}
+	flavor := u32(b, 4)
+	numTables := int(u16(b, 12))
+	compressedLen := u32(b, 20)
+
+	s := woff2Stream{b: b[woff2HeaderLen:]}
+	tables := make([]woff2Table, numTables)
+	// total is a uint64 so that it cannot wrap around on 32-bit targets.
+	total := uint64(0)
+	for i := range tables {
+		t := &tables[i]
+		flags := s.u8()
+		if flags&0x3f == woff2ArbitraryTag {
+			t.tag = Tag(s.u32())
+		} else {
+			t.tag = MakeTag(woff2KnownTags[flags&0x3f])
+		}
+		t.transform = int(flags >> 6)
+		var ok bool
+		if t.origLength, ok = s.base128(); !ok {
+			return nil, fmt.Errorf("%w: WOFF2 table directory entry %d is invalid", ErrInvalidFont, i)
+		}
+		t.length = t.origLength
+		if t.transformed() {
+			switch {
+			case t.tag == MakeTag("glyf") && t.transform == 0,
+				t.tag == MakeTag("loca") && t.transform == 0,
+				t.tag == MakeTag("hmtx") && t.transform == 1:
+			default:
+				return nil, ErrUnsupportedFormat{Tag: t.tag, Format: uint32(t.transform)}
+			}
+			if t.length, ok = s.base128(); !ok {
+				return nil, fmt.Errorf("%w: WOFF2 table directory entry %d is invalid", ErrInvalidFont, i)
+			}
+			if t.tag == MakeTag("loca") && t.length != 0 {
+				return nil, ErrInvalidTable{Tag: t.tag, Reason: "transformed WOFF2 loca table has data"}
+			}
+		}
+		if t.length > t.origLength {
+			total += uint64(t.length)
+		} else {
+			total += uint64(t.origLength)
+		}
+		if total > maxWebFontLen {
+			return nil, fmt.Errorf("%w: WOFF2 tables are too large", ErrInvalidFont)
+		}
+	}
+	if s.short {
+		return nil, fmt.Errorf("%w: WOFF2 table directory with %d entries is truncated", ErrInvalidFont, numTables)
+	}
+
+	var fonts []sfntFont
+	if flavor == collectionTag {
+		switch version := s.u32(); version {
+		case 0x00010000, 0x00020000:
+		default:
+			return nil, ErrUnsupportedFormat{Tag: collectionTag, Format: version}
+		}
+		fonts = make([]sfntFont, s.u255())
+		for i := range fonts {
+			n := int(s.u255())
+			if s.short || n > numTables {
+				return nil, fmt.Errorf("%w: WOFF2 collection directory is invalid", ErrInvalidFont)
+			}
+			fonts[i] = sfntFont{flavor: s.u32(), tables: make([]int, n)}
+			for j := range fonts[i].tables {
+				k := int(s.u255())
+				if k >= numTables {
+					return nil, fmt.Errorf("%w: WOFF2 collection font %d has an invalid table index %d", ErrInvalidFont, i, k)
+				}
+				fonts[i].tables[j] = k
+			}
+		}
+		if s.short || len(fonts) == 0 {
+			return nil, fmt.Errorf("%w: WOFF2 collection directory is invalid", ErrInvalidFont)
+		}
+	} else {
+		fonts = []sfntFont{{flavor: flavor, tables: make([]int, numTables)}}
+		for i := range fonts[0].tables {
+			fonts[0].tables[i] = i
+		}
+	}
+
+	compressed := s.bytes32(compressedLen)
+	if s.short {
+		return nil, fmt.Errorf("%w: WOFF2 compressed data is truncated", ErrInvalidFont)
+	}
+	n := 0
+	for _, t := range tables {
+		n += int(t.length)
+	}
+	data, err := decompress(brotli.NewReader(bytes.NewReader(compressed)), n)
+	if err != nil {
+		return nil, fmt.Errorf("%w: WOFF2 compressed data: %v", ErrInvalidFont, err)
+	}
+	for i := range tables {
+		t := &tables[i]
+		t.data, data = data[:t.length:t.length], data[t.length:]
+	}
+
+	for _, font := range fonts {
+		if err := reconstructWOFF2(tables, font); err != nil {
+			return nil, err
+		}
+	}
+
+	sfntTables := make([]sfntTable, len(tables))
+	for i, t := range tables {
+		sfntTables[i] = sfntTable{tag: t.tag, data: t.data}
+	}
+	return writeSFNT(sfntTables, fonts, flavor == collectionTag), nil
+}
+
+// reconstructWOFF2 reconstructs the transformed tables of the font. Fonts of
+// a collection may share tables, which are only reconstructed once.
+func reconstructWOFF2(tables []woff2Table, font sfntFont) error {
+	var glyf, loca, head, hhea, hmtx, maxp *woff2Table
+	for _, i := range font.tables {
+		t := &tables[i]
+		switch t.tag {
+		case MakeTag("glyf"):
+			glyf = t
+		case MakeTag("loca"):
+			loca = t
+		case MakeTag("head"):
+			head = t
+		case MakeTag("hhea"):
+			hhea = t
+		case MakeTag("hmtx"):
+			hmtx = t
+		case MakeTag("maxp"):
+			maxp = t
+		}
+	}
+
+	if glyf != nil && glyf.transformed() {
+		if loca == nil || !loca.transformed() {
+			return ErrInvalidTable{Tag: MakeTag("glyf"), Reason: "transformed WOFF2 glyf table has no transformed loca table"}
+		}
+		if head == nil {
+			return ErrMissingTable{Tag: MakeTag("head")}
+		}
+		if len(head.data) < headLen {
+			return ErrTableTooShort{Tag: MakeTag("head"), Length: len(head.data), MinLength: headLen}
+		}
+		glyfData, locaData, xMins, err := reconstructGlyf(glyf.data, head.indexToLocFormat())
+		if err != nil {
+			return err
+		}
+		glyf.data, glyf.transform, glyf.xMins = glyfData, 3, xMins
+		loca.data, loca.transform = locaData, 3
+		if uint32(len(locaData)) != loca.origLength {
+			return ErrInvalidTable{Tag: MakeTag("loca"), Reason: fmt.Sprintf("reconstructed WOFF2 loca table has length %d, want %d", len(locaData), loca.origLength)}
+		}
+	} else if loca != nil && loca.transformed() {
+		return ErrInvalidTable{Tag: MakeTag("loca"), Reason: "transformed WOFF2 loca table has no transformed glyf table"}
+	}
+
+	if hmtx != nil && hmtx.transformed() {
+		if glyf == nil || glyf.xMins == nil {
+			return ErrInvalidTable{Tag: MakeTag("hmtx"), Reason: "transformed WOFF2 hmtx table has no transformed glyf table"}
+		}
+		if hhea == nil {
+			return ErrMissingTable{Tag: MakeTag("hhea")}
+		}
+		if len(hhea.data) < hheaLen {
+			return ErrTableTooShort{Tag: MakeTag("hhea"), Length: len(hhea.data), MinLength: hheaLen}
+		}
+		if maxp == nil {
+			return ErrMissingTable{Tag: MakeTag("maxp")}
+		}
+		if len(maxp.data) < maxpLen05 {
+			return ErrTableTooShort{Tag: MakeTag("maxp"), Length: len(maxp.data), MinLength: maxpLen05}
+		}
+		data, err := reconstructHmtx(hmtx.data, maxp.numGlyphs(), hhea.numberOfHMetrics(), glyf.xMins)
+		if err != nil {
+			return err
+		}
+		hmtx.data, hmtx.transform = data, 0
+	}
+	return nil
+}
+
+func (t *woff2Table) indexToLocFormat() int { return head(t.data).indexToLocFormat() }
+func (t *woff2Table) numberOfHMetrics() int { return hhea(t.data).numberOfHMetrics() }
+func (t *woff2Table) numGlyphs() int        { return maxp(t.data).numGlyphs() }
+
+// reconstructGlyf reconstructs the glyf and loca tables from a transformed
+// glyf table. It also returns the glyphs' xMin values, for reconstructing a
+// transformed hmtx table.
+func reconstructGlyf(b []byte, indexToLocFormat int) (glyfData, locaData []byte, xMins []int16, err error) {
+	if len(b) < woff2GlyfHeaderLen {
+		return nil, nil, nil, ErrTableTooShort{Tag: MakeTag("glyf"), Length: len(b), MinLength: woff2GlyfHeaderLen}
+	}
+	optionFlags := u16(b, 2)
+	numGlyphs := int(u16(b, 4))
+	if indexFormat := int(u16(b, 6)); indexFormat != indexToLocFormat {
+		return nil, nil, nil, ErrInvalidTable{Tag: MakeTag("glyf"), Reason: fmt.Sprintf("WOFF2 index format %d does not match the head table's %d", indexFormat, indexToLocFormat)}
+	}
+
+	// The header is followed by the seven streams, and then by the optional
+	// overlap bitmap.
+	s := woff2Stream{b: b[woff2GlyfHeaderLen:]}
+	var streams [7]woff2Stream
+	for i := range streams {
+		streams[i].b = s.bytes32(u32(b, int32(8+4*i)))
+	}
+	bitmapLen := 4 * ((numGlyphs + 31) / 32)
+	bboxBitmap := streams[5].bytes(bitmapLen)
+	var overlapBitmap []byte
+	if optionFlags&1 != 0 {
+		overlapBitmap = s.bytes((numGlyphs + 7) / 8)
+	}
+	if s.short || streams[5].short {
+		return nil, nil, nil, ErrTableTooShort{Tag: MakeTag("glyf"), Length: len(b), MinLength: len(b) + 1}
+	}
+	nContours, nPoints, flags, glyphs, composites, bboxes, instructions :=
+		&streams[0], &streams[1], &streams[2], &streams[3], &streams[4], &streams[5], &streams[6]
+
+	locaData = make([]byte, 0, (numGlyphs+1)*(2<<uint(indexToLocFormat)))
+	xMins = make([]int16, numGlyphs)
+	var endPts []int
+	var points []woff2Point
+	for i := 0; i < numGlyphs; i++ {
+		locaData = appendLoca(locaData, len(glyfData), indexToLocFormat)
+		hasBBox := bboxBitmap[i/8]&(0x80>>uint(i%8)) != 0
+		var bbox [4]int16
+		if hasBBox {
+			b := bboxes.bytes(8)
+			if b == nil {
+				return nil, nil, nil, ErrInvalidTable{Tag: MakeTag("glyf"), Reason: fmt.Sprintf("WOFF2 glyph %d is truncated", i)}
+			}
+			bbox = [4]int16{i16(b, 0), i16(b, 2), i16(b, 4), i16(b, 6)}
+		}
+
+		switch n := int(int16(nContours.u16())); {
+		case n == 0:
+			if hasBBox {
+				return nil, nil, nil, ErrInvalidTable{Tag: MakeTag("glyf"), Reason: fmt.Sprintf("empty WOFF2 glyph %d has a bounding box", i)}
+			}
+
+		case n < 0:
+			if !hasBBox {
+				return nil, nil, nil, ErrInvalidTable{Tag: MakeTag("glyf"), Reason: fmt.Sprintf("compound WOFF2 glyph %d has no bounding box", i)}
+			}
+			components, haveInstructions := composites.components()
+			glyfData = appendGlyphHeader(glyfData, -1, bbox)
+			glyfData = append(glyfData, components...)
+			if haveInstructions {
+				ins := instructions.bytes(int(glyphs.u255()))
+				glyfData = append(glyfData, byte(len(ins)>>8), byte(len(ins)))
+				glyfData = append(glyfData, ins...)
+			}
+
+		default:
+			endPts, points = endPts[:0], points[:0]
+			x, y := 0, 0
+			for c := 0; c < n; c++ {
+				for j, numPoints := 0, int(nPoints.u255()); j < numPoints && !glyphs.short; j++ {
+					flag := flags.u8()
+					dx, dy, onCurve := decodeTriplet(flag, glyphs.bytes(tripletLen(flag)))
+					x, y = x+dx, y+dy
+					points = append(points, woff2Point{x, y, dx, dy, onCurve})
+				}
+				endPts = append(endPts, len(points)-1)
+			}
+			if len(points) > 0xffff {
+				return nil, nil, nil, ErrInvalidTable{Tag: MakeTag("glyf"), Reason: fmt.Sprintf("WOFF2 glyph %d has too many points", i)}
+			}
+			ins := instructions.bytes(int(glyphs.u255()))
+			if !hasBBox {
+				bbox = pointsBBox(points)
+			}
+			overlap := overlapBitmap != nil && overlapBitmap[i/8]&(0x80>>uint(i%8)) != 0
+			glyfData = appendGlyphHeader(glyfData, n, bbox)
+			glyfData = appendSimpleGlyph(glyfData, endPts, points, ins, overlap)
+		}
+		for _, s := range streams {
+			if s.short {
+				return nil, nil, nil, ErrInvalidTable{Tag: MakeTag("glyf"), Reason: fmt.Sprintf("WOFF2 glyph %d is truncated", i)}
+			}
+		}
+		if len(glyfData) > maxWebFontLen {
+			return nil, nil, nil, fmt.Errorf("%w: WOFF2 glyf table is too large", ErrInvalidFont)
+		}
+		// Glyphs are padded to four bytes, as is conventional, and as
+		// required for short offsets to be even.
+		for len(glyfData)%4 != 0 {
+			glyfData = append(glyfData, 0)
+		}
+		xMins[i] = bbox[0]
+	}
+	if indexToLocFormat == 0 && len(glyfData) > 2*0xffff {
+		return nil, nil, nil, ErrInvalidTable{Tag: MakeTag("glyf"), Reason: "WOFF2 glyf table is too large for a short loca table"}
+	}
+	return glyfData, appendLoca(locaData, len(glyfData), indexToLocFormat), xMins, nil
+}
+
+// woff2Point is a point of a simple glyph, with its coordinates and its
+// offset from the previous point.
+type woff2Point struct {
+	x, y    int
+	dx, dy  int
+	onCurve bool
+}
+
+func pointsBBox(points []woff2Point) [4]int16 {
+	if len(points) == 0 {
+		return [4]int16{}
+	}
+	xMin, yMin, xMax, yMax := points[0].x, points[0].y, points[0].x, points[0].y
+	for _, p := range points[1:] {
+		if p.x < xMin {
+			xMin = p.x
+		}
+		if p.y < yMin {
+			yMin = p.y
+		}
+		if p.x > xMax {
+			xMax = p.x
+		}
+		if p.y > yMax {
+			yMax = p.y
+		}
+	}
+	return [4]int16{int16(xMin), int16(yMin), int16(xMax), int16(yMax)}
+}
+
+func appendLoca(b []byte, offset, indexToLocFormat int) []byte {
+	if indexToLocFormat == 0 {
+		return append(b, byte(offset>>9), byte(offset>>1))
+	}
+	return append(b, byte(offset>>24), byte(offset>>16), byte(offset>>8), byte(offset))
+}
+
+func appendGlyphHeader(b []byte, numberOfContours int, bbox [4]int16) []byte {
+	b = append(b, byte(numberOfContours>>8), byte(numberOfContours))
+	for _, v := range bbox {
+		b = append(b, byte(v>>8), byte(v))
+	}
+	return b
+}
+
+// appendSimpleGlyph appends the glyf data of a simple glyph, after its header,
+// using the shortest encoding for each coordinate and repeating identical
+// flags.
+func appendSimpleGlyph(b []byte, endPts []int, points []woff2Point, instructions []byte, overlap bool) []byte {
+	for _, e := range endPts {
+		b = append(b, byte(e>>8), byte(e))
+	}
+	b = append(b, byte(len(instructions)>>8), byte(len(instructions)))
+	b = append(b, instructions...)
+
+	var xs, ys []byte
+	var prevFlag byte
+	repeat := -1
+	for i, p := range points {
+		flag := byte(0)
+		if p.onCurve {
+			flag |= flagOnCurve
+		}
+		if i == 0 && overlap {
+			flag |= flagOverlapSimple
+		}
+		switch dx := p.dx; {
+		case dx == 0:
+			flag |= flagThisXIsSame
+		case -0xff <= dx && dx <= +0xff:
+			flag |= flagXShortVector
+			if dx > 0 {
+				flag |= flagPositiveXShortVector
+			} else {
+				dx = -dx
+			}
+			xs = append(xs, byte(dx))
+		default:
+			xs = append(xs, byte(dx>>8), byte(dx))
+		}
+		switch dy := p.dy; {
+		case dy == 0:
+			flag |= flagThisYIsSame
+		case -0xff <= dy && dy <= +0xff:
+			flag |= flagYShortVector
+			if dy > 0 {
+				flag |= flagPositiveYShortVector
+			} else {
+				dy = -dy
+			}
+			ys = append(ys, byte(dy))
+		default:
+			ys = append(ys, byte(dy>>8), byte(dy))
+		}
+
+		// repeat is the index, in b, of the repeat count of the previous
+		// flag, if it has one.
+		switch {
+		case i > 0 && flag == prevFlag && repeat >= 0 && b[repeat] < 0xff:
+			b[repeat]++
+		case i > 0 && flag == prevFlag && repeat < 0:
+			b[len(b)-1] |= flagRepeat
+			b = append(b, 1)
+			repeat = len(b) - 1
+		default:
+			b = append(b, flag)
+			prevFlag, repeat = flag, -1
+		}
+	}
+	b = append(b, xs...)
+	return append(b, ys...)
+}
+
+// reconstructHmtx reconstructs the hmtx table from a transformed hmtx table,
+// whose left side bearings may be omitted, as they equal the glyphs' xMin
+// values.
+func reconstructHmtx(b []byte, numGlyphs, numberOfHMetrics int, xMins []int16) ([]byte, error) {
+	s := woff2Stream{b: b}
+	flags := s.u8()
+	if flags&^3 != 0 {
+		return nil, ErrInvalidTable{Tag: MakeTag("hmtx"), Reason: fmt.Sprintf("WOFF2 hmtx transform flags %#02x are invalid", flags)}
+	}
+	if numberOfHMetrics > numGlyphs || numberOfHMetrics == 0 {
+		return nil, ErrInvalidTable{Tag: MakeTag("hhea"), Reason: fmt.Sprintf("numberOfHMetrics %d is out of range", numberOfHMetrics)}
+	}
+	advances := s.bytes(2 * numberOfHMetrics)
+	lsb := func(i int, omitted bool) int16 {
+		if omitted {
+			if i < len(xMins) {
+				return xMins[i]
+			}
+			return 0
+		}
+		return int16(s.u16())
+	}
+	out := make([]byte, 0, 4*numberOfHMetrics+2*(numGlyphs-numberOfHMetrics))
+	for i := 0; i < numberOfHMetrics; i++ {
+		out = append(out, 0, 0, 0, 0)
+		if advances != nil {
+			copy(out[4*i:], advances[2*i:2*i+2])
+		}
+	}
+	for i := 0; i < numGlyphs; i++ {
+		var v int16
+		if i < numberOfHMetrics {
+			v = lsb(i, flags&1 != 0)
+			putU16(out[4*i+2:], uint16(v))
+		} else {
+			v = lsb(i, flags&2 != 0)
+			out = append(out, byte(v>>8), byte(v))
+		}
+	}
+	if s.short {
+		return nil, ErrTableTooShort{Tag: MakeTag("hmtx"), Length: len(b), MinLength: len(b) + 1}
+	}
+	return out, nil
+}
+
+// tripletLen returns the number of data bytes of a WOFF2 point triplet with
+// the flag.
+func tripletLen(flag byte) int {
+	switch flag &= 0x7f; {
+	case flag < 84:
+		return 1
+	case flag < 120:
+		return 2
+	case flag < 124:
+		return 3
+	}
+	return 4
+}
+
+// decodeTriplet decodes a WOFF2 point triplet, the flag and its data bytes,
+// into a point's offset from the previous point. A nil data decodes as zeros.
+func decodeTriplet(flag byte, data []byte) (dx, dy int, onCurve bool) {
+	onCurve = flag&0x80 == 0
+	flag &= 0x7f
+	var in [4]int
+	for i := range data {
+		in[i] = int(data[i])
+	}
+	withSign := func(flag byte, v int) int {
+		if flag&1 != 0 {
+			return v
+		}
+		return -v
+	}
+	switch {
+	case flag < 10:
+		dy = withSign(flag, int(flag&0x0e)<<7+in[0])
+	case flag < 20:
+		dx = withSign(flag, int((flag-10)&0x0e)<<7+in[0])
+	case flag < 84:
+		b0 := int(flag - 20)
+		dx = withSign(flag, 1+b0&0x30+in[0]>>4)
+		dy = withSign(flag>>1, 1+(b0&0x0c)<<2+in[0]&0x0f)
+	case flag < 120:
+		b0 := int(flag - 84)
+		dx = withSign(flag, 1+(b0/12)<<8+in[0])
+		dy = withSign(flag>>1, 1+((b0%12)>>2)<<8+in[1])
+	case flag < 124:
+		dx = withSign(flag, in[0]<<4+in[1]>>4)
+		dy = withSign(flag>>1, (in[1]&0x0f)<<8+in[2])
+	default:
+		dx = withSign(flag, in[0]<<8+in[1])
+		dy = withSign(flag>>1, in[2]<<8+in[3])
+	}
+	return dx, dy, onCurve
+}
+
+// woff2Stream is a sequence of WOFF2 data. Reading past its end returns
+// zeros, or nil, and sets short, which callers check after a group of reads.
+type woff2Stream struct {
+	b     []byte
+	short bool
+}
+
+func (s *woff2Stream) bytes(n int) []byte {
+	if n < 0 || n > len(s.b) {
+		s.b, s.short = nil, true
+		return nil
+	}
+	b := s.b[:n:n]
+	s.b = s.b[n:]
+	return b
+}
+
+// bytes32 is like bytes, for a uint32 length read from the font, which
+// might not fit in an int on 32-bit targets.
+func (s *woff2Stream) bytes32(n uint32) []byte {
+	if uint64(n) > uint64(len(s.b)) {
+		s.b, s.short = nil, true
+		return nil
+	}
+	return s.bytes(int(n))
+}
+
+func (s *woff2Stream) u8() byte {
+	if b := s.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (s *woff2Stream) u16() uint16 {
+	if b := s.bytes(2); b != nil {
+		return u16(b, 0)
+	}
+	return 0
+}
+
+func (s *woff2Stream) u32() uint32 {
+	if b := s.bytes(4); b != nil {
+		return u32(b, 0)
+	}
+	return 0
+}
+
+// u255 reads a 255UInt16, a variable length encoding of a uint16.
+func (s *woff2Stream) u255() uint16 {
+	switch code := s.u8(); code {
+	case 253:
+		return s.u16()
+	case 254:
+		return 2*253 + uint16(s.u8())
+	case 255:
+		return 253 + uint16(s.u8())
+	default:
+		return uint16(code)
+	}
+}
+
+// base128 reads a UIntBase128, a variable length encoding of a uint32. It
+// returns false for invalid encodings, which have leading zeros, overflow or
+// are too long.
+func (s *woff2Stream) base128() (uint32, bool) {
+	v := uint32(0)
+	for i := 0; i < 5; i++ {
+		b := s.u8()
+		if s.short || (i == 0 && b == 0x80) || v&0xfe000000 != 0 {
+			return 0, false
+		}
+		v = v<<7 | uint32(b&0x7f)
+		if b&0x80 == 0 {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// components reads the component records of a compound glyph, returning
+// their data and whether any of them has instructions.
+func (s *woff2Stream) components() (data []byte, haveInstructions bool) {
+	start := s.b
+	for {
+		flags := s.u16()
+		s.bytes(2)
+		if flags&flagArg1And2AreWords != 0 {
+			s.bytes(4)
+		} else {
+			s.bytes(2)
+		}
+		switch {
+		case flags&flagWeHaveAScale != 0:
+			s.bytes(2)
+		case flags&flagWeHaveAnXAndYScale != 0:
+			s.bytes(4)
+		case flags&flagWeHaveATwoByTwo != 0:
+			s.bytes(8)
+		}
+		if s.short {
+			return nil, false
+		}
+		haveInstructions = haveInstructions || flags&flagWeHaveInstructions != 0
+		if flags&flagMoreComponents == 0 {
+			return start[:len(start)-len(s.b)], haveInstructions
+		}
+	}
+}
@@ -0,0 +1,435 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func base128(v int) []byte {
+	b := []byte{byte(v & 0x7f)}
+	for v >>= 7; v > 0; v >>= 7 {
+		b = append([]byte{byte(v&0x7f) | 0x80}, b...)
+	}
+	return b
+}
+
+func u255(v int) []byte {
+	if v < 253 {
+		return []byte{byte(v)}
+	}
+	return cat([]byte{253}, be16(v))
+}
+
+// testWOFF2Table is a table of a WOFF2 font. Its data is transformed if its
+// transform is not the table's null transform.
+type testWOFF2Table struct {
+	tag        string
+	transform  int
+	origLength int
+	data       []byte
+}
+
+// woff2Tables returns the WOFF2 tables of a font's tables, sorted by tag. The
+// tables with the given transformed data are transformed.
+func woff2Tables(tables, transformed map[string][]byte) []testWOFF2Table {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	var ret []testWOFF2Table
+	for _, tag := range tags {
+		t := testWOFF2Table{tag: tag, origLength: len(tables[tag]), data: tables[tag]}
+		if tag == "glyf" || tag == "loca" {
+			t.transform = 3
+		}
+		if data, ok := transformed[tag]; ok {
+			t.transform, t.data = 0, data
+			if tag == "hmtx" {
+				t.transform = 1
+			}
+		}
+		ret = append(ret, t)
+	}
+	return ret
+}
+
+// buildWOFF2 returns a WOFF2 font file containing the tables, and the
+// collection directory if the flavor is "ttcf".
+func buildWOFF2(flavor int, tables []testWOFF2Table, collection []byte) []byte {
+	var dir, data []byte
+	for _, t := range tables {
+		known := -1
+		for i, k := range woff2KnownTags {
+			if k == t.tag {
+				known = i
+			}
+		}
+		if known >= 0 {
+			dir = append(dir, byte(t.transform<<6|known))
+		} else {
+			dir = append(dir, byte(t.transform<<6|woff2ArbitraryTag))
+			dir = append(dir, t.tag...)
+		}
+		dir = append(dir, base128(t.origLength)...)
+		// The glyf and loca tables' null transform is version 3.
+		if (t.tag == "glyf" || t.tag == "loca") != (t.transform != 0) {
+			dir = append(dir, base128(len(t.data))...)
+		}
+		data = append(data, t.data...)
+	}
+
+	var buf bytes.Buffer
+	w := brotli.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	n := woff2HeaderLen + len(dir) + len(collection) + buf.Len()
+	header := cat([]byte("wOF2"), be32(flavor), be32(n), be16(len(tables)), be16(0),
+		be32(0), be32(buf.Len()), be16(1), be16(0), make([]byte, 20))
+	return cat(header, dir, collection, buf.Bytes())
+}
+
+// testWOFF2Glyph is a glyph of a transformed glyf table, either a simple
+// glyph with contours or a compound glyph with the given glyf data.
+type testWOFF2Glyph struct {
+	contours [][]testPoint
+	compound []byte
+	// explicitBBox is whether a simple glyph's bounding box is stored,
+	// rather than computed from its points.
+	explicitBBox bool
+	overlap      bool
+	instructions []byte
+}
+
+// buildWOFF2Glyf returns a transformed glyf table of the glyphs, and their
+// glyf data. Point coordinates use the longest triplet encoding.
+func buildWOFF2Glyf(glyphs []testWOFF2Glyph, indexFormat int) (transformed []byte, glyfData [][]byte) {
+	var nContours, nPoints, flags, glyphStream, composites, bboxes, instructions []byte
+	bboxBitmap := make([]byte, 4*((len(glyphs)+31)/32))
+	overlapBitmap := make([]byte, (len(glyphs)+7)/8)
+	haveOverlap := false
+	for i, g := range glyphs {
+		switch {
+		case g.compound != nil:
+			nContours = append(nContours, be16(-1)...)
+			bboxBitmap[i/8] |= 0x80 >> uint(i%8)
+			bboxes = append(bboxes, g.compound[2:10]...)
+			composites = append(composites, g.compound[10:]...)
+			glyfData = append(glyfData, g.compound)
+
+		case g.contours != nil:
+			nContours = append(nContours, be16(len(g.contours))...)
+			x, y := 0, 0
+			for _, c := range g.contours {
+				nPoints = append(nPoints, u255(len(c))...)
+				for _, p := range c {
+					dx, dy := p.x-x, p.y-y
+					x, y = p.x, p.y
+					flag := byte(124)
+					if !p.on {
+						flag |= 0x80
+					}
+					if dx >= 0 {
+						flag |= 1
+					} else {
+						dx = -dx
+					}
+					if dy >= 0 {
+						flag |= 2
+					} else {
+						dy = -dy
+					}
+					flags = append(flags, flag)
+					glyphStream = append(glyphStream, cat(be16(dx), be16(dy))...)
+				}
+			}
+			glyphStream = append(glyphStream, u255(len(g.instructions))...)
+			instructions = append(instructions, g.instructions...)
+			data := buildSimpleGlyph(g.contours...)
+			if len(g.instructions) > 0 {
+				// Insert the instructions after the endPtsOfContours.
+				j := 10 + 2*len(g.contours)
+				data = cat(data[:j], be16(len(g.instructions)), g.instructions, data[j+2:])
+			}
+			if g.explicitBBox {
+				bboxBitmap[i/8] |= 0x80 >> uint(i%8)
+				bboxes = append(bboxes, data[2:10]...)
+			}
+			if g.overlap {
+				haveOverlap = true
+				overlapBitmap[i/8] |= 0x80 >> uint(i%8)
+				data = append([]byte(nil), data...)
+				data[10+2*len(g.contours)+2+len(g.instructions)] |= flagOverlapSimple
+			}
+			glyfData = append(glyfData, data)
+
+		default:
+			nContours = append(nContours, be16(0)...)
+			glyfData = append(glyfData, nil)
+		}
+	}
+
+	optionFlags := 0
+	if haveOverlap {
+		optionFlags = 1
+	}
+	bboxes = cat(bboxBitmap, bboxes)
+	transformed = cat(be16(0), be16(optionFlags), be16(len(glyphs)), be16(indexFormat))
+	streams := [][]byte{nContours, nPoints, flags, glyphStream, composites, bboxes, instructions}
+	for _, s := range streams {
+		transformed = append(transformed, be32(len(s))...)
+	}
+	transformed = cat(transformed, cat(streams...))
+	if haveOverlap {
+		transformed = cat(transformed, overlapBitmap)
+	}
+	return transformed, glyfData
+}
+
+var testWOFF2Glyphs = []testWOFF2Glyph{
+	{},
+	{contours: [][]testPoint{testSquare}, overlap: true},
+	{contours: [][]testPoint{testDiamond}, explicitBBox: true, instructions: []byte{0xb0, 0x01}},
+	{compound: buildCompoundGlyph(0, 0, 1000, 400, testComponent{1, 0, 0}, testComponent{2, 500, 0})},
+	{contours: [][]testPoint{testSquare, {{-1000, -2000, true}, {600, 0, false}, {600, 0, true}}}},
+	{},
+}
+
+// testWOFF2Font returns the tables of a font with the testWOFF2Glyphs, and the
+// font's transformed glyf table.
+func testWOFF2Font(indexFormat int) (tables map[string][]byte, transformedGlyf []byte) {
+	transformedGlyf, glyfData := buildWOFF2Glyf(testWOFF2Glyphs, indexFormat)
+	tables = buildTables(glyfData, []int{500, 600, 700, 1000}, map[rune]GlyphID{'a': 1, 'b': 2, 'c': 3})
+	if indexFormat == 0 {
+		var loca []byte
+		for i := 0; i < len(tables["loca"]); i += 4 {
+			loca = append(loca, be16(int(u32(tables["loca"], int32(i))/2))...)
+		}
+		tables["loca"] = loca
+		copy(tables["head"][50:], be16(0))
+	}
+	return tables, transformedGlyf
+}
+
+func TestParseWOFF2(t *testing.T) {
+	for _, indexFormat := range []int{0, 1} {
+		m, glyf := testWOFF2Font(indexFormat)
+		f, err := Parse(buildWOFF2(0x00010000, woff2Tables(m, map[string][]byte{"glyf": glyf, "loca": nil}), nil))
+		if err != nil {
+			t.Fatalf("indexFormat=%d: Parse: %v", indexFormat, err)
+		}
+		checkSameFont(t, "transformed glyf", f, m)
+
+		// The left side bearings of the transformed hmtx table are the
+		// glyphs' xMin values.
+		hmtx := cat([]byte{3}, be16(500), be16(600), be16(700), be16(1000))
+		f, err = Parse(buildWOFF2(0x00010000, woff2Tables(m, map[string][]byte{"glyf": glyf, "loca": nil, "hmtx": hmtx}), nil))
+		if err != nil {
+			t.Fatalf("indexFormat=%d: Parse: hmtx transform: %v", indexFormat, err)
+		}
+		checkSameFont(t, "transformed hmtx", f, m)
+	}
+
+	// A font without transformed tables.
+	m := testTables()
+	f, err := Parse(buildWOFF2(0x00010000, woff2Tables(m, nil), nil))
+	if err != nil {
+		t.Fatalf("null transforms: Parse: %v", err)
+	}
+	checkSameFont(t, "null transforms", f, m)
+}
+
+func TestParseWOFF2Collection(t *testing.T) {
+	m, glyf := testWOFF2Font(1)
+	tables := woff2Tables(m, map[string][]byte{"glyf": glyf, "loca": nil})
+	// The second font has its own cmap table, which is stored last.
+	tables = append(tables, testWOFF2Table{tag: "cmap", data: buildCmap4(map[rune]GlyphID{'a': 2})})
+	tables[len(tables)-1].origLength = len(tables[len(tables)-1].data)
+	var first, second []byte
+	for i := range tables[:len(tables)-1] {
+		first = append(first, u255(i)...)
+		if tables[i].tag != "cmap" {
+			second = append(second, u255(i)...)
+		}
+	}
+	second = append(second, u255(len(tables)-1)...)
+	collection := cat(be32(0x00010000), u255(2),
+		u255(len(tables)-1), be32(0x00010000), first,
+		u255(len(tables)-1), be32(0x00010000), second)
+
+	c, err := ParseCollection(buildWOFF2(collectionTag, tables, collection))
+	if err != nil {
+		t.Fatalf("ParseCollection: %v", err)
+	}
+	if got, want := c.NumFonts(), 2; got != want {
+		t.Fatalf("NumFonts: got %d, want %d", got, want)
+	}
+	var fonts []*Font
+	for i, want := range []GlyphID{1, 2} {
+		f, err := c.Font(i)
+		if err != nil {
+			t.Fatalf("Font(%d): %v", i, err)
+		}
+		checkSameFont(t, "collection", f, m)
+		if got := f.GlyphIndex('a'); got != want {
+			t.Errorf("Font(%d): GlyphIndex('a'): got %d, want %d", i, got, want)
+		}
+		fonts = append(fonts, f)
+	}
+	if &fonts[0].glyf[0] != &fonts[1].glyf[0] {
+		t.Errorf("the fonts' glyf tables are not shared")
+	}
+}
+
+func TestParseWOFF2Errors(t *testing.T) {
+	m, glyf := testWOFF2Font(1)
+	valid := buildWOFF2(0x00010000, woff2Tables(m, map[string][]byte{"glyf": glyf, "loca": nil}), nil)
+	// withGlyf returns a WOFF2 font whose transformed glyf table is modified
+	// by f.
+	withGlyf := func(f func(glyf []byte) []byte) []byte {
+		g := f(append([]byte(nil), glyf...))
+		return buildWOFF2(0x00010000, woff2Tables(m, map[string][]byte{"glyf": g, "loca": nil}), nil)
+	}
+	// stream returns the offset of the i'th stream of the transformed glyf
+	// table.
+	stream := func(i int) int {
+		offset := woff2GlyfHeaderLen
+		for j := 0; j < i; j++ {
+			offset += int(u32(glyf, int32(8+4*j)))
+		}
+		return offset
+	}
+	glyfTables := func(glyf, loca, hmtx []byte) []testWOFF2Table {
+		transformed := map[string][]byte{"glyf": glyf, "loca": loca}
+		if hmtx != nil {
+			transformed["hmtx"] = hmtx
+		}
+		return woff2Tables(m, transformed)
+	}
+
+	testCases := []struct {
+		desc string
+		data []byte
+	}{
+		{"truncated header", valid[:woff2HeaderLen-1]},
+		{"truncated table directory", valid[:woff2HeaderLen+2]},
+		{"truncated compressed data", valid[:len(valid)-1]},
+		{"corrupt compressed data", cat(valid[:len(valid)-4], []byte{0xff, 0xff, 0xff, 0xff})},
+		{"leading zeros", cat(valid[:woff2HeaderLen+1], []byte{0x80, 0x80, 0x01}, valid[woff2HeaderLen+1:])},
+		{"unsupported transform", buildWOFF2(0x00010000, []testWOFF2Table{{tag: "cmap", transform: 1}}, nil)},
+		{"loca with data", buildWOFF2(0x00010000, glyfTables(glyf, []byte{0}, nil), nil)},
+		{"glyf without loca", buildWOFF2(0x00010000, []testWOFF2Table{{tag: "glyf", data: glyf}, {tag: "head", origLength: headLen, data: m["head"]}}, nil)},
+		{"glyf without head", buildWOFF2(0x00010000, []testWOFF2Table{{tag: "glyf", data: glyf}, {tag: "loca"}}, nil)},
+		{"glyf too short", withGlyf(func(g []byte) []byte { return g[:woff2GlyfHeaderLen-1] })},
+		{"index format mismatch", withGlyf(func(g []byte) []byte { g[7] = 0; return g })},
+		{"truncated streams", withGlyf(func(g []byte) []byte { return g[:len(g)-1] })},
+		{"truncated flags", withGlyf(func(g []byte) []byte { copy(g[16:], be32(0)); return g })},
+		{"empty glyph with bbox", withGlyf(func(g []byte) []byte { g[stream(5)] |= 0x80; return g })},
+		{"compound glyph without bbox", withGlyf(func(g []byte) []byte { g[stream(5)] &^= 0x10; return g })},
+		{"truncated components", withGlyf(func(g []byte) []byte { g[stream(4)+9] |= flagWeHaveATwoByTwo; return g })},
+		{"hmtx without transformed glyf", buildWOFF2(0x00010000, woff2Tables(m, map[string][]byte{"hmtx": {3}}), nil)},
+		{"hmtx flags", buildWOFF2(0x00010000, glyfTables(glyf, nil, cat([]byte{4}, make([]byte, 8))), nil)},
+		{"truncated hmtx", buildWOFF2(0x00010000, glyfTables(glyf, nil, []byte{3, 0}), nil)},
+		{"collection version", buildWOFF2(collectionTag, woff2Tables(m, nil), cat(be32(3), u255(0)))},
+		{"collection without fonts", buildWOFF2(collectionTag, woff2Tables(m, nil), cat(be32(0x00010000), u255(0)))},
+		{"collection table index", buildWOFF2(collectionTag, woff2Tables(m, nil), cat(be32(0x00010000), u255(1), u255(1), be32(0x00010000), u255(100)))},
+		// Lengths of 2^31 or more do not fit in an int on 32-bit targets,
+		// such as GOARCH=386, and are written out byte by byte for them.
+		{"huge compressed length", cat(valid[:20], []byte{0x80, 0, 0, 0}, valid[24:])},
+		{"huge stream length", withGlyf(func(g []byte) []byte { copy(g[8:], []byte{0x80, 0, 0, 0}); return g })},
+		{"huge table lengths", cat(valid[:12], be16(2), valid[14:woff2HeaderLen],
+			[]byte{0}, []byte{0x88, 0x80, 0x80, 0x80, 0x00}, []byte{1}, []byte{0x88, 0x80, 0x80, 0x80, 0x00})},
+	}
+	for _, tc := range testCases {
+		if _, err := ParseCollection(tc.data); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an error matching ErrInvalidFont", tc.desc, err)
+		}
+	}
+}
+
+func TestWOFF2Stream(t *testing.T) {
+	testCases := []struct {
+		data   []byte
+		want   uint32
+		wantOK bool
+	}{
+		{[]byte{0x00}, 0, true},
+		{[]byte{0x7f}, 127, true},
+		{[]byte{0x81, 0x00}, 128, true},
+		{[]byte{0x8f, 0xff, 0xff, 0xff, 0x7f}, 0xffffffff, true},
+		{[]byte{0x90, 0x80, 0x80, 0x80, 0x00}, 0, false},
+		{[]byte{0x80, 0x01}, 0, false},
+		{[]byte{0x81, 0x80, 0x80, 0x80, 0x80, 0x00}, 0, false},
+		{[]byte{0x81}, 0, false},
+	}
+	for _, tc := range testCases {
+		s := woff2Stream{b: tc.data}
+		if got, ok := s.base128(); got != tc.want || ok != tc.wantOK {
+			t.Errorf("base128(% x): got %d, %t, want %d, %t", tc.data, got, ok, tc.want, tc.wantOK)
+		}
+	}
+
+	s := woff2Stream{b: []byte{0, 252, 253, 0x12, 0x34, 254, 0, 255, 5, 254}}
+	for _, want := range []uint16{0, 252, 0x1234, 506, 258} {
+		if got := s.u255(); got != want {
+			t.Errorf("u255: got %d, want %d", got, want)
+		}
+	}
+	if s.u255(); !s.short {
+		t.Errorf("u255: got !short, want short")
+	}
+}
+
+func TestDecodeTriplet(t *testing.T) {
+	testCases := []struct {
+		flag           byte
+		data           []byte
+		dx, dy         int
+		wantOnCurve    bool
+		wantDataLength int
+	}{
+		{0x00, []byte{5}, 0, -5, true, 1},
+		{0x03, []byte{5}, 0, +261, true, 1},
+		{0x89, []byte{5}, 0, +1029, false, 1},
+		{0x0a, []byte{5}, -5, 0, true, 1},
+		{0x13, []byte{5}, +1029, 0, true, 1},
+		{0x14, []byte{0x12}, -2, -3, true, 1},
+		{0x17, []byte{0x12}, +2, +3, true, 1},
+		{0x53, []byte{0x12}, +50, +51, true, 1},
+		{0x54, []byte{1, 2}, -2, -3, true, 2},
+		{0x77, []byte{1, 2}, +514, +515, true, 2},
+		{0x78, []byte{0x12, 0x34, 0x56}, -0x123, -0x456, true, 3},
+		{0x7b, []byte{0x12, 0x34, 0x56}, +0x123, +0x456, true, 3},
+		{0x7c, []byte{0x12, 0x34, 0x56, 0x78}, -0x1234, -0x5678, true, 4},
+		{0xfd, []byte{0x12, 0x34, 0x56, 0x78}, +0x1234, -0x5678, false, 4},
+	}
+	for _, tc := range testCases {
+		if got := tripletLen(tc.flag); got != tc.wantDataLength {
+			t.Errorf("tripletLen(%#02x): got %d, want %d", tc.flag, got, tc.wantDataLength)
+		}
+		dx, dy, onCurve := decodeTriplet(tc.flag, tc.data)
+		if dx != tc.dx || dy != tc.dy || onCurve != tc.wantOnCurve {
+			t.Errorf("decodeTriplet(%#02x, % x): got %d, %d, %t, want %d, %d, %t",
+				tc.flag, tc.data, dx, dy, onCurve, tc.dx, tc.dy, tc.wantOnCurve)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package font
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"sort"
+	"testing"
+)
+
+// buildWOFF returns a WOFF font file containing the given tables. Tables are
+// compressed with zlib when that makes them shorter.
+func buildWOFF(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	offset := woffHeaderLen + woffDirEntryLen*len(tags)
+	var records, data []byte
+	for _, tag := range tags {
+		t := tables[tag]
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write(t)
+		w.Close()
+		stored := t
+		if buf.Len() < len(t) {
+			stored = buf.Bytes()
+		}
+		records = append(records, tag...)
+		records = append(records, cat(be32(offset+len(data)), be32(len(stored)), be32(len(t)), be32(0))...)
+		data = append(data, stored...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	header := cat([]byte("wOFF"), be32(0x00010000), be32(offset+len(data)), be16(len(tags)), be16(0),
+		be32(0), be16(1), be16(0), make([]byte, 20))
+	return cat(header, records, data)
+}
+
+// checkSameFont checks that got has the same glyph and metrics tables as
+// want, which are the tables of a plain sfnt font.
+func checkSameFont(t *testing.T, desc string, got *Font, want map[string][]byte) {
+	t.Helper()
+	for tag, g := range map[string][]byte{
+		"glyf": got.glyf, "head": got.head, "hhea": got.hhea, "hmtx": got.hmtx,
+		"loca": got.loca, "maxp": got.maxp,
+	} {
+		if !bytes.Equal(g, want[tag]) {
+			t.Errorf("%s: %q table:\ngot  % x\nwant % x", desc, tag, g, want[tag])
+		}
+	}
+}
+
+func TestParseWOFF(t *testing.T) {
+	m := testTables()
+	f, err := Parse(buildWOFF(m))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	checkSameFont(t, "Parse", f, m)
+	if got := f.GlyphIndex('b'); got != 2 {
+		t.Errorf("GlyphIndex('b'): got %d, want 2", got)
+	}
+
+	c, err := ParseCollection(buildWOFF(m))
+	if err != nil {
+		t.Fatalf("ParseCollection: %v", err)
+	}
+	if f, err = c.Font(0); err != nil {
+		t.Fatalf("ParseCollection: Font(0): %v", err)
+	}
+	checkSameFont(t, "ParseCollection", f, m)
+}
+
+func TestParseWOFFErrors(t *testing.T) {
+	m := testTables()
+	m["DSIG"] = make([]byte, 100)
+	valid := buildWOFF(m)
+	// The first table is the DSIG table, which is compressed.
+	const entry = woffHeaderLen
+	if u32(valid, entry+8) >= u32(valid, entry+12) {
+		t.Fatalf("DSIG table is not compressed")
+	}
+	modify := func(offset int, v []byte) []byte {
+		b := append([]byte(nil), valid...)
+		copy(b[offset:], v)
+		return b
+	}
+	testCases := []struct {
+		desc string
+		data []byte
+	}{
+		{"truncated header", valid[:woffHeaderLen-1]},
+		{"truncated table directory", valid[:woffHeaderLen+woffDirEntryLen]},
+		{"collection flavor", modify(4, []byte("ttcf"))},
+		{"table out of bounds", modify(entry+4, be32(len(valid)))},
+		{"compressed length exceeds original length", modify(entry+12, be32(1))},
+		{"original length too long", modify(entry+12, be32(1000))},
+		{"corrupt zlib data", modify(int(u32(valid, entry+4)), []byte{0xff, 0xff})},
+		{"too large", modify(entry+12, be32(maxWebFontLen+1))},
+		{"too large on 32-bit targets", modify(entry+12, []byte{0xff, 0xff, 0xff, 0xff})},
+	}
+	for _, tc := range testCases {
+		if _, err := Parse(tc.data); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want an error matching ErrInvalidFont", tc.desc, err)
+		}
+	}
+}
+
+func TestWriteSFNT(t *testing.T) {
+	tables := []sfntTable{
+		{MakeTag("loca"), []byte{1, 2, 3, 4}},
+		{MakeTag("cmap"), []byte{5, 6, 7}},
+		{MakeTag("glyf"), []byte{8}},
+	}
+	got := writeSFNT(tables, []sfntFont{{flavor: 0x00010000, tables: []int{0, 1, 2}}}, false)
+	want := cat(
+		be32(0x00010000), be16(3), be16(32), be16(1), be16(16),
+		[]byte("cmap"), be32(0x05060700), be32(64), be32(3),
+		[]byte("glyf"), be32(0x08000000), be32(68), be32(1),
+		[]byte("loca"), be32(0x01020304), be32(60), be32(4),
+		[]byte{1, 2, 3, 4}, []byte{5, 6, 7, 0}, []byte{8, 0, 0, 0},
+	)
+	if !bytes.Equal(got, want) {
+		t.Errorf("single font:\ngot  % x\nwant % x", got, want)
+	}
+
+	got = writeSFNT(tables, []sfntFont{
+		{flavor: 0x00010000, tables: []int{2}},
+		{flavor: 0x00010000, tables: []int{2, 0}},
+	}, true)
+	want = cat(
+		[]byte("ttcf"), be16(1), be16(0), be32(2), be32(20), be32(48),
+		be32(0x00010000), be16(1), be16(16), be16(0), be16(0),
+		[]byte("glyf"), be32(0x08000000), be32(100), be32(1),
+		be32(0x00010000), be16(2), be16(32), be16(1), be16(0),
+		[]byte("glyf"), be32(0x08000000), be32(100), be32(1),
+		[]byte("loca"), be32(0x01020304), be32(92), be32(4),
+		[]byte{1, 2, 3, 4}, []byte{5, 6, 7, 0}, []byte{8, 0, 0, 0},
+	)
+	if !bytes.Equal(got, want) {
+		t.Errorf("collection:\ngot  % x\nwant % x", got, want)
+	}
+}
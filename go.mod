@@ -2,4 +2,7 @@ module github.com/google/font-go
 
 go 1.19
 
-require golang.org/x/image v0.0.0-20220413100746-70e8d0d3baa9
+require (
+	github.com/andybalholm/brotli v1.1.0
+	golang.org/x/image v0.0.0-20220413100746-70e8d0d3baa9
+)
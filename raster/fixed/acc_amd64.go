@@ -16,7 +16,7 @@
 // +build gc
 // +build !noasm
 
-package main
+package fixed
 
 var haveAccumulateSIMD = haveSSE4_1()
 
@@ -14,7 +14,7 @@
 
 // +build !amd64 appengine !gc noasm
 
-package main
+package fixed
 
 const haveAccumulateSIMD = false
 
@@ -12,13 +12,12 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package fixed
 
 import (
 	"fmt"
 	"image"
 	"image/png"
-	"io/ioutil"
 	"math"
 	"os"
 	"path"
@@ -142,25 +141,25 @@ func TestRasterizeOutOfBounds(t *testing.T) {
 	// rasterization.
 	//
 	// If empty, this test simply checks that calling lineTo with points out of
-	// bounds of the rasterizer's (0, 0) to (width, height) rectangle doesn't
+	// bounds of the Rasterizer's (0, 0) to (width, height) rectangle doesn't
 	// panic.
 	const tmpDirForManualInspection = ""
 
 	const center, radius, n = 16, 20, 16
-	z := newRasterizer(2*center, 2*center)
+	z := NewRasterizer(2*center, 2*center)
 	for i := 0; i < n; i++ {
 		for j := 1; j < n/2; j++ {
-			z.reset()
+			z.Reset()
 			z.moveTo(point{1 * center, 1 * center})
 			z.lineTo(pointOnCircle(center, radius, i+0, n))
 			z.lineTo(pointOnCircle(center, radius, i+j, n))
-			z.closePath()
+			z.ClosePath()
 
 			z.moveTo(point{0 * center, 0 * center})
 			z.lineTo(point{0 * center, 2 * center})
 			z.lineTo(point{2 * center, 2 * center})
 			z.lineTo(point{2 * center, 0 * center})
-			z.closePath()
+			z.ClosePath()
 
 			dst := image.NewAlpha(z.Bounds())
 			if haveAccumulateSIMD {
@@ -184,9 +183,9 @@ func TestRasterizeOutOfBounds(t *testing.T) {
 
 func TestRasterizePolygon(t *testing.T) {
 	for radius := 4; radius <= 1024; radius *= 2 {
-		z := newRasterizer(2*radius, 2*radius)
+		z := NewRasterizer(2*radius, 2*radius)
 		for n := 3; n <= 17; n++ {
-			z.reset()
+			z.Reset()
 			z.moveTo(point{
 				x: float32(2 * radius),
 				y: float32(1 * radius),
@@ -194,7 +193,7 @@ func TestRasterizePolygon(t *testing.T) {
 			for i := 1; i < n; i++ {
 				z.lineTo(pointOnCircle(radius, radius, i, n))
 			}
-			z.closePath()
+			z.ClosePath()
 
 			dst := image.NewAlpha(z.Bounds())
 			if haveAccumulateSIMD {
@@ -230,13 +229,13 @@ func checkCornersCenter(m *image.Alpha) error {
 }
 
 func TestRasterizeAlmostAxisAligned(t *testing.T) {
-	z := newRasterizer(8, 8)
+	z := NewRasterizer(8, 8)
 
 	z.moveTo(point{2, 2})
 	z.lineTo(point{6, math.Nextafter32(2, 0)})
 	z.lineTo(point{6, 6})
 	z.lineTo(point{math.Nextafter32(2, 0), 6})
-	z.closePath()
+	z.ClosePath()
 
 	dst := image.NewAlpha(z.Bounds())
 	if haveAccumulateSIMD {
@@ -250,41 +249,6 @@ func TestRasterizeAlmostAxisAligned(t *testing.T) {
 	}
 }
 
-func BenchmarkRasterize16(b *testing.B)  { benchRasterize(b, 16) }
-func BenchmarkRasterize32(b *testing.B)  { benchRasterize(b, 32) }
-func BenchmarkRasterize64(b *testing.B)  { benchRasterize(b, 64) }
-func BenchmarkRasterize100(b *testing.B) { benchRasterize(b, 100) }
-func BenchmarkRasterize150(b *testing.B) { benchRasterize(b, 150) }
-func BenchmarkRasterize200(b *testing.B) { benchRasterize(b, 200) }
-
-func benchRasterize(b *testing.B, ppem float32) {
-	fontData, err := ioutil.ReadFile(*fontFlag)
-	if err != nil {
-		b.Fatal(err)
-	}
-	f, err := parse(fontData)
-	if err != nil {
-		b.Fatal(err)
-	}
-
-	data := f.glyphData(uint16(*glyphIDFlag))
-	dx, dy, transform := data.glyphSizeAndTransform(f.scale(ppem))
-	z := newRasterizer(dx, dy)
-	dst := image.NewAlpha(z.Bounds())
-
-	acc := accumulate
-	if haveAccumulateSIMD {
-		acc = accumulateSIMD
-	}
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		z.reset()
-		z.rasterize(f, data, transform)
-		acc(dst.Pix, z.a)
-	}
-}
-
 // sequenceAcc is the accumulation of sequence.
 var sequenceAcc = []uint8{
 	0x20,
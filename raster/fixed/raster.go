@@ -12,7 +12,9 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+// Package fixed implements a glyph rasterizer that uses mostly int32 fixed
+// point math.
+package fixed
 
 import (
 	"image"
@@ -71,34 +73,23 @@ func clamp(i, width int32) uint {
 	return uint(width)
 }
 
-func concat(a, b *f32.Aff3) f32.Aff3 {
-	return f32.Aff3{
-		a[0]*b[0] + a[1]*b[3],
-		a[0]*b[1] + a[1]*b[4],
-		a[0]*b[2] + a[1]*b[5] + a[2],
-		a[3]*b[0] + a[4]*b[3],
-		a[3]*b[1] + a[4]*b[4],
-		a[3]*b[2] + a[4]*b[5] + a[5],
-	}
-}
-
-type op uint8
-
-const (
-	moveTo op = 0
-	lineTo op = 1
-	quadTo op = 2
-)
-
 type point struct {
 	x, y float32
 }
 
-func midPoint(p, q point) point {
-	return point{
-		x: (p.x + q.x) * 0.5,
-		y: (p.y + q.y) * 0.5,
+func finite(p point) bool {
+	// x-x is NaN, not zero, for NaN and infinite x.
+	return p.x-p.x == 0 && p.y-p.y == 0
+}
+
+func clampf(x, lo, hi float64) float64 {
+	if x < lo {
+		return lo
 	}
+	if x > hi {
+		return hi
+	}
+	return x
 }
 
 func lerp(t float32, p, q point) point {
@@ -108,19 +99,9 @@ func lerp(t float32, p, q point) point {
 	}
 }
 
-func mul(m *f32.Aff3, p point) point {
-	return point{
-		x: m[0]*p.x + m[1]*p.y + m[2],
-		y: m[3]*p.x + m[4]*p.y + m[5],
-	}
-}
-
-type segment struct {
-	op   op
-	p, q point
-}
-
-type rasterizer struct {
+// Rasterizer converts paths, such as glyph outlines, to an anti-aliased
+// coverage mask, using fixed point math.
+type Rasterizer struct {
 	a     []int2ϕ
 	first point
 	last  point
@@ -128,19 +109,22 @@ type rasterizer struct {
 	h     int
 }
 
-func newRasterizer(w, h int) *rasterizer {
-	return &rasterizer{
+// NewRasterizer returns a Rasterizer for a w×h pixel mask.
+func NewRasterizer(w, h int) *Rasterizer {
+	return &Rasterizer{
 		a: make([]int2ϕ, w*h),
 		w: w,
 		h: h,
 	}
 }
 
-func (z *rasterizer) Bounds() image.Rectangle {
+// Bounds returns the rectangle of the mask, with its top-left at the origin.
+func (z *Rasterizer) Bounds() image.Rectangle {
 	return image.Rectangle{Max: image.Point{z.w, z.h}}
 }
 
-func (z *rasterizer) reset() {
+// Reset clears the accumulated coverage, so that z can be re-used.
+func (z *Rasterizer) Reset() {
 	for i := range z.a {
 		z.a[i] = 0
 	}
@@ -148,30 +132,13 @@ func (z *rasterizer) reset() {
 	z.last = point{}
 }
 
-func (z *rasterizer) rasterize(f *Font, a glyphData, transform f32.Aff3) {
-	g := a.glyphIter()
-	if g.compoundGlyph() {
-		for g.nextSubGlyph() {
-			z.rasterize(f, f.glyphData(g.subGlyphID), concat(&transform, &g.subTransform))
-		}
-		return
-	}
-
-	for g.nextContour() {
-		for g.nextSegment() {
-			switch g.seg.op {
-			case moveTo:
-				p := mul(&transform, g.seg.p)
-				z.moveTo(p)
-			case lineTo:
-				p := mul(&transform, g.seg.p)
-				z.lineTo(p)
-			case quadTo:
-				p := mul(&transform, g.seg.p)
-				q := mul(&transform, g.seg.q)
-				z.quadTo(p, q)
-			}
-		}
+// Accumulate converts the accumulated coverage to alpha values in dst, which
+// should have the same bounds as z.
+func (z *Rasterizer) Accumulate(dst *image.Alpha) {
+	if haveAccumulateSIMD {
+		accumulateSIMD(dst.Pix, z.a)
+	} else {
+		accumulate(dst.Pix, z.a)
 	}
 }
 
@@ -192,18 +159,104 @@ func accumulate(dst []uint8, src []int2ϕ) {
 	}
 }
 
-func (z *rasterizer) closePath() {
+// MoveTo starts a new contour at p.
+func (z *Rasterizer) MoveTo(p f32.Vec2) { z.moveTo(point{p[0], p[1]}) }
+
+// LineTo adds a straight line to p.
+func (z *Rasterizer) LineTo(p f32.Vec2) { z.lineTo(point{p[0], p[1]}) }
+
+// QuadTo adds a quadratic Bézier curve, with control point p, to q.
+func (z *Rasterizer) QuadTo(p, q f32.Vec2) { z.quadTo(point{p[0], p[1]}, point{q[0], q[1]}) }
+
+// CubeTo adds a cubic Bézier curve, with control points p and q, to r.
+func (z *Rasterizer) CubeTo(p, q, r f32.Vec2) {
+	z.cubeTo(point{p[0], p[1]}, point{q[0], q[1]}, point{r[0], r[1]})
+}
+
+// ClosePath adds a straight line back to the current contour's first point.
+func (z *Rasterizer) ClosePath() {
 	z.lineTo(z.first)
 }
 
-func (z *rasterizer) moveTo(p point) {
+func (z *Rasterizer) moveTo(p point) {
 	z.first = p
 	z.last = p
 }
 
-func (z *rasterizer) lineTo(q point) {
+func (z *Rasterizer) lineTo(q point) {
 	p := z.last
 	z.last = q
+	z.clipLine(p, q)
+}
+
+// clipLine draws the line from p to q, after clipping it to the mask's rows
+// and splitting it at the mask's left and right edges.
+//
+// Rows above or below the mask are unaffected by drawing, so those parts of
+// the line are dropped. Columns to the left or right of the mask still affect
+// the accumulated coverage, but line attributes all of their coverage to the
+// first column or to one past the last column, so those parts of the line are
+// moved onto the mask's edge without changing the result. This bounds the
+// work done by line, even for huge coordinates, and avoids overflow in the
+// conversion to the pixel grid. Lines with NaN or infinite coordinates are
+// dropped altogether.
+func (z *Rasterizer) clipLine(p, q point) {
+	if !finite(p) || !finite(q) {
+		return
+	}
+	w, h := float64(z.w), float64(z.h)
+	x0, y0 := float64(p.x), float64(p.y)
+	x1, y1 := float64(q.x), float64(q.y)
+	if (y0 <= 0 && y1 <= 0) || (y0 >= h && y1 >= h) {
+		return
+	}
+	if y0 < 0 || y0 > h || y1 < 0 || y1 > h {
+		// The line crosses y=0 or y=h, so y0 != y1.
+		dxdy := (x1 - x0) / (y1 - y0)
+		xAt := func(y float64) float64 { return x0 + (y-y0)*dxdy }
+		if y0 < 0 {
+			x0, y0 = xAt(0), 0
+		} else if y0 > h {
+			x0, y0 = xAt(h), h
+		}
+		if y1 < 0 {
+			x1, y1 = xAt(0), 0
+		} else if y1 > h {
+			x1, y1 = xAt(h), h
+		}
+	}
+
+	// Split the line where it crosses x=0 or x=w, so that every piece is
+	// either inside or outside the mask's columns.
+	ts, n := [2]float64{}, 0
+	for _, edge := range [2]float64{0, w} {
+		if (x0 < edge) != (x1 < edge) {
+			if t := (edge - x0) / (x1 - x0); 0 < t && t < 1 {
+				ts[n] = t
+				n++
+			}
+		}
+	}
+	if n == 2 && ts[0] > ts[1] {
+		ts[0], ts[1] = ts[1], ts[0]
+	}
+	ax, ay := x0, y0
+	for i := 0; i <= n; i++ {
+		bx, by := x1, y1
+		if i < n {
+			bx, by = x0+ts[i]*(x1-x0), y0+ts[i]*(y1-y0)
+		}
+		z.line(
+			point{float32(clampf(ax, 0, w)), float32(ay)},
+			point{float32(clampf(bx, 0, w)), float32(by)},
+		)
+		ax, ay = bx, by
+	}
+}
+
+// line draws the line from p to q. Unlike clipLine, it assumes that the line
+// is within the mask's bounds, give or take rounding error.
+func (z *Rasterizer) line(p, q point) {
 	dir := int1ϕ(1)
 	if p.y > q.y {
 		dir, p, q = -1, q, p
@@ -341,7 +394,7 @@ func (z *rasterizer) lineTo(q point) {
 	}
 }
 
-func (z *rasterizer) quadTo(q, r point) {
+func (z *Rasterizer) quadTo(q, r point) {
 	// We make a linear approximation to the curve.
 	// http://lists.nongnu.org/archive/html/freetype-devel/2016-08/msg00080.html
 	// gives the rationale for this evenly spaced heuristic instead of a
@@ -360,7 +413,14 @@ func (z *rasterizer) quadTo(q, r point) {
 	devsq := devx*devx + devy*devy
 	if devsq >= 0.333 {
 		const tol = 3
-		n := 1 + int(math.Sqrt(math.Sqrt(tol*float64(devsq))))
+		// maxN caps the subdivision of huge or degenerate curves, such as
+		// those with infinite coordinates. It is far more than any curve
+		// within a reasonably sized mask needs.
+		const maxN = 1 << 12
+		n := maxN
+		if f := 1 + math.Sqrt(math.Sqrt(tol*float64(devsq))); f < maxN {
+			n = int(f)
+		}
 		t, nInv := float32(0), 1/float32(n)
 		for i := 0; i < n-1; i++ {
 			t += nInv
@@ -370,3 +430,39 @@ func (z *rasterizer) quadTo(q, r point) {
 	}
 	z.lineTo(r)
 }
+
+func (z *Rasterizer) cubeTo(q, r, s point) {
+	// We make a linear approximation to the curve, with evenly spaced
+	// subdivisions, as for quadTo. The distance between a curve and its
+	// approximation by n lines is at most 1/8 of the curve's maximum second
+	// derivative, divided by n². A cubic curve's second derivative is at most
+	// 6 times the larger of its two control point deviations, where a
+	// quadratic curve's is 2 times its one, so the tolerance is 3² times
+	// quadTo's.
+	p := z.last
+	dev0x := p.x - 2*q.x + r.x
+	dev0y := p.y - 2*q.y + r.y
+	dev1x := q.x - 2*r.x + s.x
+	dev1y := q.y - 2*r.y + s.y
+	devsq := dev0x*dev0x + dev0y*dev0y
+	if d := dev1x*dev1x + dev1y*dev1y; d > devsq {
+		devsq = d
+	}
+	if devsq >= 0.333 {
+		const tol = 3 * 3 * 3
+		// maxN caps the subdivision of huge or degenerate curves, as for
+		// quadTo.
+		const maxN = 1 << 12
+		n := maxN
+		if f := 1 + math.Sqrt(math.Sqrt(tol*float64(devsq))); f < maxN {
+			n = int(f)
+		}
+		t, nInv := float32(0), 1/float32(n)
+		for i := 0; i < n-1; i++ {
+			t += nInv
+			pq, qr, rs := lerp(t, p, q), lerp(t, q, r), lerp(t, r, s)
+			z.lineTo(lerp(t, lerp(t, pq, qr), lerp(t, qr, rs)))
+		}
+	}
+	z.lineTo(s)
+}
@@ -16,7 +16,7 @@
 // +build gc
 // +build !noasm
 
-package main
+package floating
 
 const haveAccumulateSIMD = true
 
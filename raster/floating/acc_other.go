@@ -14,7 +14,7 @@
 
 // +build !amd64 appengine !gc noasm
 
-package main
+package floating
 
 const haveAccumulateSIMD = false
 
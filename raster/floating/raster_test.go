@@ -0,0 +1,65 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package floating_test
+
+import (
+	"flag"
+	"image"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/google/font-go/font"
+	"github.com/google/font-go/raster/floating"
+)
+
+var (
+	fontFlag    = flag.String("font", path.Join(os.Getenv("HOME"), "fonts/Roboto-Regular.ttf"), "font filename")
+	glyphIDFlag = flag.Int("glyphid", 76, "glyph ID; for example 76 is 'g' from Roboto-Regular")
+)
+
+func BenchmarkRasterize16(b *testing.B)  { benchRasterize(b, 16) }
+func BenchmarkRasterize32(b *testing.B)  { benchRasterize(b, 32) }
+func BenchmarkRasterize64(b *testing.B)  { benchRasterize(b, 64) }
+func BenchmarkRasterize100(b *testing.B) { benchRasterize(b, 100) }
+func BenchmarkRasterize150(b *testing.B) { benchRasterize(b, 150) }
+func BenchmarkRasterize200(b *testing.B) { benchRasterize(b, 200) }
+
+func benchRasterize(b *testing.B, ppem float32) {
+	fontData, err := ioutil.ReadFile(*fontFlag)
+	if err != nil {
+		b.Fatal(err)
+	}
+	f, err := font.Parse(fontData)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	data, err := f.Glyph(font.GlyphID(*glyphIDFlag))
+	if err != nil {
+		b.Fatal(err)
+	}
+	dx, dy, transform := data.SizeAndTransform(f.Scale(ppem))
+	z := floating.NewRasterizer(dx, dy)
+	dst := image.NewAlpha(z.Bounds())
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		z.Reset()
+		f.Outline(z, data, transform)
+		z.Accumulate(dst)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raster
+
+import (
+	"encoding/binary"
+	"image"
+	"math"
+	"testing"
+
+	"golang.org/x/image/math/f32"
+)
+
+// Path operations for FuzzRasterizer, each followed by the big-endian bits of
+// zero to three float32 points.
+const (
+	fuzzMoveTo = iota
+	fuzzLineTo
+	fuzzQuadTo
+	fuzzClosePath
+	fuzzReset
+	fuzzCubeTo
+	numFuzzOps
+)
+
+// fuzzPath encodes a path for FuzzRasterizer.
+func fuzzPath(w, h uint8, ops ...interface{}) []byte {
+	b := []byte{w, h}
+	for _, o := range ops {
+		switch o := o.(type) {
+		case int:
+			b = append(b, byte(o))
+		case float32:
+			b = binary.BigEndian.AppendUint32(b, math.Float32bits(o))
+		}
+	}
+	return b
+}
+
+// FuzzRasterizer draws arbitrary paths, including points with NaN, infinite
+// and huge coordinates, with both implementations. It checks that nothing
+// panics.
+//
+// The seed corpus is in testdata/fuzz/FuzzRasterizer, in addition to the
+// paths added below.
+func FuzzRasterizer(f *testing.F) {
+	inf := float32(math.Inf(+1))
+	nan := float32(math.NaN())
+	f.Add(fuzzPath(16, 16,
+		fuzzMoveTo, float32(2), float32(2),
+		fuzzLineTo, float32(14), float32(2),
+		fuzzQuadTo, float32(14), float32(14), float32(2), float32(14),
+		fuzzClosePath,
+	))
+	f.Add(fuzzPath(16, 16,
+		fuzzMoveTo, float32(2), float32(8),
+		fuzzCubeTo, float32(2), float32(-4), float32(14), float32(20), float32(14), float32(8),
+		fuzzCubeTo, float32(1e30), float32(2), -inf, float32(14), float32(2), float32(8),
+		fuzzClosePath,
+	))
+	f.Add(fuzzPath(8, 8,
+		fuzzMoveTo, float32(-1e30), float32(4),
+		fuzzLineTo, float32(1e30), float32(5),
+		fuzzLineTo, float32(4), float32(1e30),
+		fuzzClosePath,
+	))
+	f.Add(fuzzPath(8, 8,
+		fuzzMoveTo, nan, float32(4),
+		fuzzLineTo, float32(4), inf,
+		fuzzQuadTo, -inf, float32(1), float32(4), nan,
+		fuzzClosePath,
+	))
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		if len(b) < 2 {
+			return
+		}
+		w, h := 1+int(b[0]%64), 1+int(b[1]%64)
+		b = b[2:]
+		next := func() f32.Vec2 {
+			if len(b) < 8 {
+				b = nil
+				return f32.Vec2{}
+			}
+			p := f32.Vec2{
+				math.Float32frombits(binary.BigEndian.Uint32(b[0:])),
+				math.Float32frombits(binary.BigEndian.Uint32(b[4:])),
+			}
+			b = b[8:]
+			return p
+		}
+
+		zs := []Rasterizer{NewFixed(w, h), NewFloating(w, h)}
+		for len(b) > 0 {
+			op := b[0] % numFuzzOps
+			b = b[1:]
+			switch op {
+			case fuzzMoveTo:
+				p := next()
+				for _, z := range zs {
+					z.MoveTo(p)
+				}
+			case fuzzLineTo:
+				p := next()
+				for _, z := range zs {
+					z.LineTo(p)
+				}
+			case fuzzQuadTo:
+				p, q := next(), next()
+				for _, z := range zs {
+					z.QuadTo(p, q)
+				}
+			case fuzzCubeTo:
+				p, q, r := next(), next(), next()
+				for _, z := range zs {
+					z.CubeTo(p, q, r)
+				}
+			case fuzzClosePath:
+				for _, z := range zs {
+					z.ClosePath()
+				}
+			case fuzzReset:
+				for _, z := range zs {
+					z.Reset()
+				}
+			}
+		}
+		for _, z := range zs {
+			z.Accumulate(image.NewAlpha(z.Bounds()))
+		}
+	})
+}
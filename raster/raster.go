@@ -0,0 +1,76 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package raster provides a common interface to the fixed and floating point
+// rasterizers, so that the implementation can be chosen at run time.
+package raster
+
+import (
+	"image"
+
+	"github.com/google/font-go/raster/fixed"
+	"github.com/google/font-go/raster/floating"
+	"golang.org/x/image/math/f32"
+)
+
+// MaxFixedPPEM is the largest pixels per em at which New returns a fixed point
+// rasterizer. Above that, the fixed point implementation may have rendering
+// artifacts.
+const MaxFixedPPEM = 1024
+
+// Rasterizer converts paths, such as glyph outlines, to an anti-aliased
+// coverage mask. It implements font.Pather.
+type Rasterizer interface {
+	// Bounds returns the rectangle of the mask, with its top-left at the
+	// origin.
+	Bounds() image.Rectangle
+	// Reset clears the accumulated coverage, so that the Rasterizer can be
+	// re-used.
+	Reset()
+	// MoveTo starts a new contour at p.
+	MoveTo(p f32.Vec2)
+	// LineTo adds a straight line to p.
+	LineTo(p f32.Vec2)
+	// QuadTo adds a quadratic Bézier curve, with control point p, to q.
+	QuadTo(p, q f32.Vec2)
+	// CubeTo adds a cubic Bézier curve, with control points p and q, to r.
+	CubeTo(p, q, r f32.Vec2)
+	// ClosePath adds a straight line back to the current contour's first
+	// point.
+	ClosePath()
+	// Accumulate converts the accumulated coverage to alpha values in dst,
+	// which should have the same bounds as the Rasterizer.
+	Accumulate(dst *image.Alpha)
+}
+
+var (
+	_ Rasterizer = (*fixed.Rasterizer)(nil)
+	_ Rasterizer = (*floating.Rasterizer)(nil)
+)
+
+// NewFixed returns a fixed point Rasterizer for a w×h pixel mask.
+func NewFixed(w, h int) Rasterizer { return fixed.NewRasterizer(w, h) }
+
+// NewFloating returns a floating point Rasterizer for a w×h pixel mask.
+func NewFloating(w, h int) Rasterizer { return floating.NewRasterizer(w, h) }
+
+// New returns a Rasterizer for a w×h pixel mask that is suitable for drawing
+// glyphs at the given pixels per em: the faster fixed point implementation up
+// to MaxFixedPPEM, and the floating point implementation above that.
+func New(w, h int, ppem float32) Rasterizer {
+	if ppem > MaxFixedPPEM {
+		return NewFloating(w, h)
+	}
+	return NewFixed(w, h)
+}
@@ -0,0 +1,247 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raster
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"github.com/google/font-go/raster/fixed"
+	"github.com/google/font-go/raster/floating"
+	"golang.org/x/image/math/f32"
+)
+
+func TestNew(t *testing.T) {
+	if _, ok := New(8, 8, MaxFixedPPEM).(*fixed.Rasterizer); !ok {
+		t.Errorf("ppem=%d: got %T, want *fixed.Rasterizer", MaxFixedPPEM, New(8, 8, MaxFixedPPEM))
+	}
+	if _, ok := New(8, 8, 2*MaxFixedPPEM).(*floating.Rasterizer); !ok {
+		t.Errorf("ppem=%d: got %T, want *floating.Rasterizer", 2*MaxFixedPPEM, New(8, 8, 2*MaxFixedPPEM))
+	}
+}
+
+// drawCircle draws a circle, approximated by quadratic Bézier curves, that is
+// inscribed in z's bounds.
+func drawCircle(z Rasterizer) {
+	const n = 16
+	r := float64(z.Bounds().Dx()) / 2
+	at := func(theta float64, radius float64) f32.Vec2 {
+		return f32.Vec2{
+			float32(r + radius*math.Cos(theta)),
+			float32(r + radius*math.Sin(theta)),
+		}
+	}
+	z.MoveTo(at(0, r))
+	for i := 0; i < n; i++ {
+		theta := 2 * math.Pi * float64(i) / n
+		delta := math.Pi / n
+		z.QuadTo(at(theta+delta, r/math.Cos(delta)), at(theta+2*delta, r))
+	}
+	z.ClosePath()
+}
+
+func TestFixedAndFloatingAgree(t *testing.T) {
+	const size = 64
+	masks := [2]*image.Alpha{}
+	for i, z := range []Rasterizer{NewFixed(size, size), NewFloating(size, size)} {
+		// Draw twice, with a Reset in between, to check that Reset clears
+		// the accumulated coverage.
+		drawCircle(z)
+		z.Reset()
+		drawCircle(z)
+		masks[i] = image.NewAlpha(z.Bounds())
+		z.Accumulate(masks[i])
+	}
+
+	for i := range masks[0].Pix {
+		a, b := int(masks[0].Pix[i]), int(masks[1].Pix[i])
+		if d := a - b; d < -2 || +2 < d {
+			t.Fatalf("i=%d: fixed %#02x and floating %#02x differ by more than 2", i, a, b)
+		}
+	}
+	if got := masks[0].Pix[(size/2)*size+size/2]; got != 0xff {
+		t.Errorf("center: got %#02x, want 0xff", got)
+	}
+	if got := masks[0].Pix[0]; got != 0x00 {
+		t.Errorf("corner: got %#02x, want 0x00", got)
+	}
+}
+
+// TestClipping checks the coverage of paths that extend past the mask, so
+// that the rasterizers clip them, including to huge coordinates.
+func TestClipping(t *testing.T) {
+	const huge = 1e30
+	// leftHalf is the coverage of a 4x4 mask whose left two columns are
+	// covered.
+	leftHalf := []uint8{
+		0xff, 0xff, 0x00, 0x00,
+		0xff, 0xff, 0x00, 0x00,
+		0xff, 0xff, 0x00, 0x00,
+		0xff, 0xff, 0x00, 0x00,
+	}
+	testCases := []struct {
+		desc string
+		draw func(z Rasterizer)
+		want []uint8
+	}{{
+		desc: "out of bounds",
+		draw: func(z Rasterizer) {
+			z.MoveTo(f32.Vec2{-10, -10})
+			z.LineTo(f32.Vec2{2, -10})
+			z.LineTo(f32.Vec2{2, 20})
+			z.LineTo(f32.Vec2{-10, 20})
+			z.ClosePath()
+		},
+		want: leftHalf,
+	}, {
+		desc: "right of the mask",
+		draw: func(z Rasterizer) {
+			z.MoveTo(f32.Vec2{10, 1})
+			z.LineTo(f32.Vec2{20, 1})
+			z.LineTo(f32.Vec2{20, 3})
+			z.LineTo(f32.Vec2{10, 3})
+			z.ClosePath()
+		},
+		want: make([]uint8, 16),
+	}, {
+		desc: "left of the mask",
+		draw: func(z Rasterizer) {
+			z.MoveTo(f32.Vec2{-20, 1})
+			z.LineTo(f32.Vec2{-10, 1})
+			z.LineTo(f32.Vec2{-10, 3})
+			z.LineTo(f32.Vec2{-20, 3})
+			z.ClosePath()
+		},
+		want: make([]uint8, 16),
+	}, {
+		desc: "huge coordinates",
+		draw: func(z Rasterizer) {
+			z.MoveTo(f32.Vec2{-huge, -huge})
+			z.LineTo(f32.Vec2{2, -huge})
+			z.LineTo(f32.Vec2{2, huge})
+			z.LineTo(f32.Vec2{-huge, huge})
+			z.ClosePath()
+		},
+		want: leftHalf,
+	}, {
+		desc: "huge curve",
+		draw: func(z Rasterizer) {
+			// The curve runs along x=2, past the mask and back.
+			z.MoveTo(f32.Vec2{2, -huge})
+			z.QuadTo(f32.Vec2{2, 3 * huge}, f32.Vec2{2, huge})
+			z.LineTo(f32.Vec2{-huge, huge})
+			z.LineTo(f32.Vec2{-huge, -huge})
+			z.ClosePath()
+		},
+		want: leftHalf,
+	}}
+	for _, tc := range testCases {
+		for _, z := range []Rasterizer{NewFixed(4, 4), NewFloating(4, 4)} {
+			tc.draw(z)
+			m := image.NewAlpha(z.Bounds())
+			z.Accumulate(m)
+			for i, got := range m.Pix {
+				if want := tc.want[i]; got != want {
+					t.Errorf("%s: %T: pixel (%d, %d): got %#02x, want %#02x", tc.desc, z, i%4, i/4, got, want)
+				}
+			}
+		}
+	}
+}
+
+// drawCubicCircle draws a circle, approximated by four cubic Bézier curves,
+// with center c and radius r.
+func drawCubicCircle(z Rasterizer, c f32.Vec2, r float32) {
+	// k places the control points so that the curves' midpoints are on the
+	// circle. The curves are then within 0.03% of r of the circle.
+	k := r * 4 / 3 * float32(math.Tan(math.Pi/8))
+	at := func(dx, dy float32) f32.Vec2 { return f32.Vec2{c[0] + dx, c[1] + dy} }
+	z.MoveTo(at(r, 0))
+	z.CubeTo(at(r, k), at(k, r), at(0, r))
+	z.CubeTo(at(-k, r), at(-r, k), at(-r, 0))
+	z.CubeTo(at(-r, -k), at(-k, -r), at(0, -r))
+	z.CubeTo(at(k, -r), at(r, -k), at(r, 0))
+	z.ClosePath()
+}
+
+// circleCoverage returns the area of the unit pixel at (x, y) that is inside
+// the circle with center c and radius r, integrating the height of the
+// circle's chord over the pixel's columns.
+func circleCoverage(x, y int, c f32.Vec2, r float64) float64 {
+	const n = 256
+	cx, cy := float64(c[0]), float64(c[1])
+	area := 0.0
+	for i := 0; i < n; i++ {
+		u := float64(x) + (float64(i)+0.5)/n - cx
+		if u*u >= r*r {
+			continue
+		}
+		h := math.Sqrt(r*r - u*u)
+		lo := math.Max(float64(y), cy-h)
+		hi := math.Min(float64(y+1), cy+h)
+		if hi > lo {
+			area += (hi - lo) / n
+		}
+	}
+	return area
+}
+
+// flattenTolerance is the maximum distance, in pixels, between a curve and the
+// lines that approximate it: 1/(4√3), given the subdivision in quadTo and
+// cubeTo, rounded up.
+const flattenTolerance = 0.15
+
+func TestCubicCircleCoverage(t *testing.T) {
+	testCases := []struct {
+		size int
+		c    f32.Vec2
+		r    float32
+	}{
+		{64, f32.Vec2{32, 32}, 32},
+		{40, f32.Vec2{20.3, 18.7}, 15.25},
+		{8, f32.Vec2{4, 4}, 2.5},
+		// The circle is clipped by the mask's edges.
+		{32, f32.Vec2{4, 30}, 20},
+	}
+	for _, tc := range testCases {
+		for _, z := range []Rasterizer{NewFixed(tc.size, tc.size), NewFloating(tc.size, tc.size)} {
+			drawCubicCircle(z, tc.c, tc.r)
+			dst := image.NewAlpha(z.Bounds())
+			z.Accumulate(dst)
+
+			maxDiff, total, want := 0.0, 0.0, 0.0
+			for y := 0; y < tc.size; y++ {
+				for x := 0; x < tc.size; x++ {
+					got := float64(dst.Pix[y*dst.Stride+x]) / 0xff
+					a := circleCoverage(x, y, tc.c, float64(tc.r))
+					maxDiff = math.Max(maxDiff, math.Abs(got-a))
+					total += got
+					want += a
+				}
+			}
+			// A pixel's coverage can change by the length of the edge within
+			// it, at most √2, times the distance that the edge moves. The
+			// total coverage can change by the circle's perimeter times that
+			// distance.
+			if maxDiff > math.Sqrt2*flattenTolerance+2.0/0xff {
+				t.Errorf("%T, %v: pixel coverage differs by up to %.4f", z, tc, maxDiff)
+			}
+			if d := math.Abs(total - want); d > 2*math.Pi*float64(tc.r)*flattenTolerance {
+				t.Errorf("%T, %v: total coverage: got %.2f, want %.2f", z, tc, total, want)
+			}
+		}
+	}
+}